@@ -0,0 +1,105 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// asyncNotifier notifies the callers of DB.ApplyAsync once their batches have
+// attained the requested durability. A single goroutine, started on demand,
+// waits for the batches in the order they were applied, which is the order in
+// which the WAL makes them durable.
+type asyncNotifier struct {
+	mu struct {
+		sync.Mutex
+		queue []asyncNotification
+		// running is true while the notifying goroutine is running.
+		running bool
+	}
+	wg sync.WaitGroup
+}
+
+type asyncNotification struct {
+	wait      func() error
+	onDurable func(error)
+}
+
+// add queues onDurable to be called with the result of wait, once the
+// notifications queued before it have been delivered.
+func (n *asyncNotifier) add(wait func() error, onDurable func(error)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.mu.queue = append(n.mu.queue, asyncNotification{wait: wait, onDurable: onDurable})
+	if !n.mu.running {
+		n.mu.running = true
+		n.wg.Add(1)
+		go n.run()
+	}
+}
+
+func (n *asyncNotifier) run() {
+	defer n.wg.Done()
+	for {
+		n.mu.Lock()
+		if len(n.mu.queue) == 0 {
+			n.mu.running = false
+			n.mu.Unlock()
+			return
+		}
+		next := n.mu.queue[0]
+		n.mu.queue[0] = asyncNotification{}
+		n.mu.queue = n.mu.queue[1:]
+		n.mu.Unlock()
+		next.onDurable(next.wait())
+	}
+}
+
+// close waits for the queued notifications to be delivered. It must be called
+// before the commit pipeline is locked by DB.Close, since the notifications
+// wait for the WAL.
+func (n *asyncNotifier) close() {
+	n.wg.Wait()
+}
+
+// groupSyncWindow tracks the smallest WriteOptions.GroupSyncWindow of the
+// writes with DurabilityGroupSync since the WAL was last synced. The WAL
+// writer delays the sync following another sync by that window, so that the
+// writes within the window share a single sync.
+type groupSyncWindow struct {
+	window atomic.Int64
+}
+
+// add records the window of a write with DurabilityGroupSync.
+func (w *groupSyncWindow) add(window time.Duration) {
+	for {
+		old := w.window.Load()
+		if old != 0 && old <= int64(window) {
+			return
+		}
+		if w.window.CompareAndSwap(old, int64(window)) {
+			return
+		}
+	}
+}
+
+// take returns the smallest window recorded since the previous call, or zero
+// if no window was recorded.
+func (w *groupSyncWindow) take() time.Duration {
+	return time.Duration(w.window.Swap(0))
+}
+
+// walMinSyncInterval returns the minimum duration between WAL syncs, which is
+// passed to the WAL writer in lieu of Options.WALMinSyncInterval. Recent
+// writes with DurabilityGroupSync raise it to their GroupSyncWindow.
+func (d *DB) walMinSyncInterval() time.Duration {
+	var interval time.Duration
+	if d.opts.WALMinSyncInterval != nil {
+		interval = d.opts.WALMinSyncInterval()
+	}
+	return max(interval, d.groupSyncWindow.take())
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/rangedel"
 	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/internal/rawalloc"
+	"github.com/cockroachdb/pebble/wal"
 )
 
 const (
@@ -329,6 +330,31 @@ type batchInternal struct {
 	// memtable.
 	flushable *flushableBatch
 
+	// The conditions of the batch's conditional operations (see
+	// Batch.SetIfAbsent), evaluated by the commit pipeline.
+	conditions []batchCondition
+
+	// indexUpdates records the state of the batch before the secondary index
+	// updates computed at commit were appended to it (see
+	// Batch.appendIndexUpdates), so that they can be discarded if the batch
+	// isn't committed.
+	indexUpdates struct {
+		offset       int
+		count        uint64
+		memTableSize uint64
+	}
+
+	// sequenced, if set, is called by the commit pipeline once the batch has
+	// been assigned its sequence number, or has been rejected without being
+	// sequenced.
+	sequenced func()
+
+	// walCompressed, if set, holds the compressed copy of the batch's
+	// representation written to the WAL. It's compressed before the batch
+	// enters the commit pipeline, and its sequence number is set once the
+	// batch is sequenced.
+	walCompressed *walCompressedBatch
+
 	// minimumFormatMajorVersion indicates the format major version required in
 	// order to commit this batch. If an operation requires a particular format
 	// major version, it ratchets the batch's minimumFormatMajorVersion. When
@@ -357,6 +383,13 @@ type batchInternal struct {
 
 	commitErr error
 
+	// durability is the durability requested when the batch was applied.
+	durability Durability
+	// walWriter and walOffset locate the end of the batch's WAL record. They
+	// are only set for DurabilityWritten. See DB.waitWALFlushed.
+	walWriter wal.Writer
+	walOffset int64
+
 	// Position bools together to reduce the sizeof the struct.
 
 	// ingestedSSTBatch indicates that the batch contains one or more key kinds
@@ -584,6 +617,7 @@ func (b *Batch) Apply(batch *Batch, _ *WriteOptions) error {
 		offset = batchrepr.HeaderLen
 	}
 	b.data = append(b.data, batch.data[batchrepr.HeaderLen:]...)
+	b.conditions = append(b.conditions, batch.conditions...)
 
 	b.setCount(b.Count() + batch.Count())
 
@@ -813,6 +847,22 @@ func (b *Batch) Set(key, value []byte, _ *WriteOptions) error {
 	return nil
 }
 
+// SetWithTimestamp adds an action to the batch that sets the version of the
+// key at timestamp ts to map to the value. The version's key is the key
+// followed by the suffix encoding ts (see TimestampOptions.EncodeTimestamp),
+// so the key must not already carry a suffix. It requires a batch created by
+// a DB with Options.Timestamps set.
+//
+// It is safe to modify the contents of the arguments after SetWithTimestamp
+// returns.
+func (b *Batch) SetWithTimestamp(key []byte, ts uint64, value []byte, _ *WriteOptions) error {
+	if b.db == nil || b.db.opts.Timestamps == nil {
+		return errors.New("pebble: SetWithTimestamp requires Options.Timestamps")
+	}
+	versioned := b.db.opts.Timestamps.EncodeTimestamp(append(make([]byte, 0, len(key)+16), key...), ts)
+	return b.Set(versioned, value, nil)
+}
+
 // SetDeferred is similar to Set in that it adds a set operation to the batch,
 // except it only takes in key/value lengths instead of complete slices,
 // letting the caller encode into those objects and then call Finish() on the
@@ -0,0 +1,133 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ErrConditionFailed is returned, through a *ConditionFailedError, when a
+// batch is applied whose conditional operations don't all hold.
+var ErrConditionFailed = errors.New("pebble: batch condition failed")
+
+// ConditionFailedError is the error returned when applying a batch one of
+// whose conditions (see Batch.SetIfAbsent, Batch.SetIfEquals and
+// Batch.DeleteIfEquals) doesn't hold. None of the batch's operations are
+// applied, and the batch may be reset and reused.
+type ConditionFailedError struct {
+	// Key is the key whose condition failed.
+	Key []byte
+	// Value is the value of Key against which the condition was evaluated, or
+	// nil if the key was absent.
+	Value []byte
+	// Exists is true if Key was present.
+	Exists bool
+}
+
+// Error implements the error interface.
+func (e *ConditionFailedError) Error() string {
+	state := "present"
+	if !e.Exists {
+		state = "absent"
+	}
+	return fmt.Sprintf("pebble: batch condition on key %q failed (key %s)", e.Key, state)
+}
+
+// Is returns true if target is ErrConditionFailed.
+func (e *ConditionFailedError) Is(target error) bool {
+	return target == ErrConditionFailed
+}
+
+// batchCondition is a condition on the value of a key that must hold for a
+// batch to be applied.
+type batchCondition struct {
+	key []byte
+	// absent is true if the key must be absent. Otherwise, the key must be
+	// present with the value expected.
+	absent   bool
+	expected []byte
+}
+
+// SetIfAbsent adds an action to the batch that sets the key to map to the
+// value, and conditions the application of the whole batch on the key being
+// absent.
+//
+// Conditions are evaluated when the batch is committed, against the latest
+// state of the DB and atomically with the application of the batch: no other
+// write may be applied between the evaluation and the application. Conditions
+// don't observe the batch's own operations. If a condition doesn't hold, the
+// batch fails with a *ConditionFailedError and none of its operations are
+// applied.
+//
+// It is safe to modify the contents of the arguments after SetIfAbsent
+// returns.
+func (b *Batch) SetIfAbsent(key, value []byte, _ *WriteOptions) error {
+	b.conditions = append(b.conditions, batchCondition{key: slices.Clone(key), absent: true})
+	return b.Set(key, value, nil)
+}
+
+// SetIfEquals adds an action to the batch that sets the key to map to the
+// value, and conditions the application of the whole batch on the key being
+// present with the value expected. See SetIfAbsent for the evaluation of
+// conditions.
+//
+// It is safe to modify the contents of the arguments after SetIfEquals
+// returns.
+func (b *Batch) SetIfEquals(key, expected, value []byte, _ *WriteOptions) error {
+	b.conditions = append(b.conditions, batchCondition{
+		key:      slices.Clone(key),
+		expected: slices.Clone(expected),
+	})
+	return b.Set(key, value, nil)
+}
+
+// DeleteIfEquals adds an action to the batch that deletes the entry for key,
+// and conditions the application of the whole batch on the key being present
+// with the value expected. See SetIfAbsent for the evaluation of conditions.
+//
+// It is safe to modify the contents of the arguments after DeleteIfEquals
+// returns.
+func (b *Batch) DeleteIfEquals(key, expected []byte, _ *WriteOptions) error {
+	b.conditions = append(b.conditions, batchCondition{
+		key:      slices.Clone(key),
+		expected: slices.Clone(expected),
+	})
+	return b.Delete(key, nil)
+}
+
+// commitCheckConditions evaluates the conditions of the batch against the
+// latest state of the DB. It's called by the commit pipeline once every batch
+// sequenced before b is visible, and before any other conditional batch is
+// sequenced.
+func (d *DB) commitCheckConditions(b *Batch) error {
+	for i := range b.conditions {
+		c := &b.conditions[i]
+		value, closer, err := d.Get(c.key)
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		} else if err != nil {
+			return err
+		}
+		exists := closer != nil
+		holds := !exists
+		if !c.absent {
+			holds = exists && bytes.Equal(value, c.expected)
+		}
+		if !holds {
+			err = &ConditionFailedError{Key: c.key, Value: slices.Clone(value), Exists: exists}
+		}
+		if exists {
+			err = errors.CombineErrors(err, closer.Close())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
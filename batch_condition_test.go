@@ -0,0 +1,115 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchConditions(t *testing.T) {
+	d, err := Open("", (&Options{FS: vfs.NewMem()}).WithFSDefaults())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	get := func(key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return "<absent>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	requireConditionFailed := func(err error, key string, exists bool) {
+		t.Helper()
+		require.True(t, errors.Is(err, ErrConditionFailed))
+		var condErr *ConditionFailedError
+		require.True(t, errors.As(err, &condErr))
+		require.Equal(t, key, string(condErr.Key))
+		require.Equal(t, exists, condErr.Exists)
+	}
+
+	b := d.NewBatch()
+	require.NoError(t, b.SetIfAbsent([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "1", get("a"))
+
+	// A failed condition fails the whole batch, which may then be reused.
+	b.Reset()
+	require.NoError(t, b.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, b.SetIfAbsent([]byte("a"), []byte("2"), nil))
+	requireConditionFailed(b.Commit(Sync), "a", true)
+	require.Equal(t, "1", get("a"))
+	require.Equal(t, "1", get("b"))
+
+	b.Reset()
+	require.NoError(t, b.SetIfEquals([]byte("a"), []byte("0"), []byte("2"), nil))
+	requireConditionFailed(b.Commit(nil), "a", true)
+	b.Reset()
+	require.NoError(t, b.SetIfEquals([]byte("a"), []byte("1"), []byte("2"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "2", get("a"))
+
+	// Conditions are evaluated against the DB, not the batch's own operations.
+	b.Reset()
+	require.NoError(t, b.Delete([]byte("b"), nil))
+	require.NoError(t, b.DeleteIfEquals([]byte("b"), []byte("1"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "<absent>", get("b"))
+	b.Reset()
+	require.NoError(t, b.DeleteIfEquals([]byte("b"), []byte("1"), nil))
+	requireConditionFailed(b.Commit(nil), "b", false)
+	require.NoError(t, b.Close())
+
+	// Concurrent compare-and-set increments are never lost, including while
+	// unconditional batches are committed concurrently.
+	const workers, increments = 4, 50
+	require.NoError(t, d.Set([]byte("counter"), []byte("0"), nil))
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	var writerWG sync.WaitGroup
+	writerWG.Add(1)
+	go func() {
+		defer writerWG.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			require.NoError(t, d.Set([]byte("other"), []byte(strconv.Itoa(i)), Sync))
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; {
+				cur := get("counter")
+				n, err := strconv.Atoi(cur)
+				require.NoError(t, err)
+				b := d.NewBatch()
+				require.NoError(t, b.SetIfEquals([]byte("counter"), []byte(cur), []byte(strconv.Itoa(n+1)), nil))
+				if err := b.Commit(nil); err == nil {
+					i++
+				} else {
+					require.True(t, errors.Is(err, ErrConditionFailed))
+				}
+				require.NoError(t, b.Close())
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	writerWG.Wait()
+	require.Equal(t, strconv.Itoa(workers*increments), get("counter"))
+}
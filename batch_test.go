@@ -346,6 +346,97 @@ func TestBatchApplyNoSyncWait(t *testing.T) {
 	}
 }
 
+func TestBatchApplyDurability(t *testing.T) {
+	for _, durability := range []Durability{DurabilityWritten, DurabilityGroupSync, DurabilitySync} {
+		t.Run(durability.String(), func(t *testing.T) {
+			fs := vfs.NewStrictMem()
+			d, err := Open("", &Options{FS: fs})
+			require.NoError(t, err)
+			opts := &WriteOptions{Durability: durability, GroupSyncWindow: 10 * time.Millisecond}
+			require.NoError(t, d.Set([]byte("a"), []byte("a"), opts))
+			if durability == DurabilityWritten {
+				// The record has reached the file, but it hasn't been synced.
+				ls, err := fs.List("")
+				require.NoError(t, err)
+				var walSize int64
+				for _, name := range ls {
+					if strings.HasSuffix(name, ".log") {
+						fi, err := fs.Stat(name)
+						require.NoError(t, err)
+						walSize += fi.Size()
+					}
+				}
+				require.Greater(t, walSize, int64(0))
+				require.NoError(t, d.Close())
+				return
+			}
+
+			// Simulate a crash: the write survives only if it was synced.
+			fs.SetIgnoreSyncs(true)
+			require.NoError(t, d.Close())
+			fs.ResetToSyncedState()
+			fs.SetIgnoreSyncs(false)
+			d, err = Open("", &Options{FS: fs})
+			require.NoError(t, err)
+			defer d.Close()
+			v, closer, err := d.Get([]byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, "a", string(v))
+			require.NoError(t, closer.Close())
+		})
+	}
+}
+
+func TestBatchApplyAsync(t *testing.T) {
+	for _, durability := range []Durability{DurabilityNone, DurabilityWritten, DurabilityGroupSync, DurabilitySync} {
+		t.Run(durability.String(), func(t *testing.T) {
+			fs := vfs.NewStrictMem()
+			d, err := Open("", &Options{FS: fs})
+			require.NoError(t, err)
+			opts := &WriteOptions{Durability: durability, GroupSyncWindow: 10 * time.Millisecond}
+			const n = 100
+			var wg sync.WaitGroup
+			wg.Add(n)
+			errs := make(chan error, n)
+			for i := 0; i < n; i++ {
+				b := d.NewBatch()
+				key := []byte(fmt.Sprintf("a%d", i))
+				require.NoError(t, b.Set(key, key, nil))
+				require.NoError(t, d.ApplyAsync(b, opts, func(err error) {
+					errs <- err
+					b.Close()
+					wg.Done()
+				}))
+				// The write is visible before it is durable.
+				v, closer, err := d.Get(key)
+				require.NoError(t, err)
+				require.Equal(t, key, v)
+				require.NoError(t, closer.Close())
+			}
+			// Close delivers the outstanding notifications.
+			require.NoError(t, d.Close())
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("wal-disabled", func(t *testing.T) {
+		d, err := Open("", &Options{FS: vfs.NewMem(), DisableWAL: true})
+		require.NoError(t, err)
+		defer d.Close()
+		b := d.NewBatch()
+		defer b.Close()
+		require.NoError(t, b.Set([]byte("a"), nil, nil))
+		err = d.ApplyAsync(b, &WriteOptions{Durability: DurabilityWritten}, func(error) {
+			t.Fatal("unexpected callback")
+		})
+		require.EqualError(t, err, "pebble: WAL disabled")
+	})
+}
+
 func TestBatchReset(t *testing.T) {
 	db, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -0,0 +1,159 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package batchrepr
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies the algorithm used to compress the body of a batch
+// written to the write-ahead log.
+//
+// A compressed batch retains its uncompressed header, so that its sequence
+// number and count may be read without decompressing it. Sequence numbers
+// occupy at most 56 bits, and the algorithm is recorded in the otherwise
+// unused high byte of the header's sequence number. A batch with a zero high
+// byte is uncompressed, so uncompressed and compressed batches may be mixed
+// within the same log.
+type Compression uint8
+
+const (
+	// NoCompression indicates the batch body is not compressed.
+	NoCompression Compression = iota
+	// SnappyCompression indicates the batch body is compressed with snappy.
+	SnappyCompression
+	// ZstdCompression indicates the batch body is compressed with zstd.
+	ZstdCompression
+)
+
+// String implements fmt.Stringer.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "NoCompression"
+	case SnappyCompression:
+		return "Snappy"
+	case ZstdCompression:
+		return "ZSTD"
+	default:
+		return "Unknown"
+	}
+}
+
+const (
+	// compressionOffset is the index into the batch representation where the
+	// compression algorithm is stored, the high byte of the little-endian
+	// sequence number.
+	compressionOffset = countOffset - 1
+	// seqNumMask masks out the compression algorithm from the header's
+	// sequence number.
+	seqNumMask = 1<<(8*compressionOffset) - 1
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ReadCompression returns the algorithm used to compress the body of the
+// provided batch representation. The provided byte slice must already be at
+// least HeaderLen bytes long or else ReadCompression will panic.
+func ReadCompression(repr []byte) Compression {
+	return Compression(repr[compressionOffset])
+}
+
+// Compress appends to dst the provided batch representation with its body
+// compressed with the provided algorithm, and returns the resulting slice. If
+// the compressed batch would not be smaller than repr, Compress returns repr
+// unmodified. The provided repr must not already be compressed.
+func Compress(dst, repr []byte, c Compression) []byte {
+	if c == NoCompression || len(repr) <= HeaderLen {
+		return repr
+	}
+	dst = append(dst[:0], repr[:HeaderLen]...)
+	dst[compressionOffset] = byte(c)
+	body := repr[HeaderLen:]
+	switch c {
+	case SnappyCompression:
+		n := snappy.MaxEncodedLen(len(body))
+		if cap(dst) < HeaderLen+n {
+			dst = append(make([]byte, 0, HeaderLen+n), dst...)
+		}
+		dst = dst[:HeaderLen+len(snappy.Encode(dst[HeaderLen:HeaderLen+n], body))]
+	case ZstdCompression:
+		dst = binary.AppendUvarint(dst, uint64(len(body)))
+		dst = zstdEncoder.EncodeAll(body, dst)
+	default:
+		panic(errors.AssertionFailedf("pebble: unknown batch compression %d", c))
+	}
+	if len(dst) >= len(repr) {
+		return repr
+	}
+	return dst
+}
+
+// SetCompressedSeqNum mutates the provided compressed batch representation,
+// storing the provided sequence number in its header while retaining its
+// compression algorithm. The provided byte slice must already be at least
+// HeaderLen bytes long or else SetCompressedSeqNum will panic.
+func SetCompressedSeqNum(repr []byte, seqNum uint64) {
+	c := repr[compressionOffset]
+	SetSeqNum(repr, seqNum)
+	repr[compressionOffset] = c
+}
+
+// Decompress appends to dst the provided batch representation with its body
+// decompressed, and returns the resulting slice. If repr is not compressed,
+// Decompress returns repr unmodified.
+func Decompress(dst, repr []byte) ([]byte, error) {
+	if len(repr) < HeaderLen {
+		return nil, ErrInvalidBatch
+	}
+	c := ReadCompression(repr)
+	if c == NoCompression {
+		return repr, nil
+	}
+	dst = append(dst[:0], repr[:HeaderLen]...)
+	dst[compressionOffset] = 0
+	body := repr[HeaderLen:]
+	var err error
+	switch c {
+	case SnappyCompression:
+		var n int
+		if n, err = snappy.DecodedLen(body); err != nil {
+			break
+		}
+		if cap(dst) < HeaderLen+n {
+			dst = append(make([]byte, 0, HeaderLen+n), dst...)
+		}
+		var decoded []byte
+		decoded, err = snappy.Decode(dst[HeaderLen:HeaderLen+n], body)
+		dst = dst[:HeaderLen+len(decoded)]
+	case ZstdCompression:
+		n, varIntLen := binary.Uvarint(body)
+		if varIntLen <= 0 || n > math.MaxUint32 {
+			return nil, base.CorruptionErrorf("pebble: compressed batch has invalid length")
+		}
+		if cap(dst) < HeaderLen+int(n) {
+			dst = append(make([]byte, 0, HeaderLen+int(n)), dst...)
+		}
+		dst, err = zstdDecoder.DecodeAll(body[varIntLen:], dst)
+		if err == nil && len(dst) != HeaderLen+int(n) {
+			err = errors.Newf("decompressed %d bytes, expected %d", len(dst)-HeaderLen, n)
+		}
+	default:
+		return nil, base.CorruptionErrorf("pebble: unknown batch compression %d", errors.Safe(c))
+	}
+	if err != nil {
+		return nil, base.MarkCorruptionError(errors.Wrap(err, "pebble: decompressing batch"))
+	}
+	return dst, nil
+}
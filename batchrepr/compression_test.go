@@ -0,0 +1,63 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package batchrepr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	repr := make([]byte, HeaderLen)
+	SetSeqNum(repr, 1<<56-1)
+	SetCount(repr, 10)
+	repr = append(repr, bytes.Repeat([]byte("compressible"), 100)...)
+	random := make([]byte, HeaderLen+100)
+	copy(random, repr[:HeaderLen])
+	rand.New(rand.NewSource(0)).Read(random[HeaderLen:])
+
+	for _, c := range []Compression{SnappyCompression, ZstdCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			compressed := Compress(nil, repr, c)
+			require.Less(t, len(compressed), len(repr))
+			require.Equal(t, c, ReadCompression(compressed))
+			require.Equal(t, NoCompression, ReadCompression(repr))
+
+			// The header of a compressed batch is readable.
+			h, ok := ReadHeader(compressed)
+			require.True(t, ok)
+			require.Equal(t, Header{SeqNum: 1<<56 - 1, Count: 10}, h)
+
+			decompressed, err := Decompress(nil, compressed)
+			require.NoError(t, err)
+			require.Equal(t, repr, decompressed)
+
+			// The sequence number of a compressed batch may be set after it's
+			// compressed.
+			SetCompressedSeqNum(compressed, 42)
+			require.Equal(t, c, ReadCompression(compressed))
+			h, ok = ReadHeader(compressed)
+			require.True(t, ok)
+			require.Equal(t, Header{SeqNum: 42, Count: 10}, h)
+			SetCompressedSeqNum(compressed, 1<<56-1)
+
+			// An uncompressed batch is returned as is.
+			decompressed, err = Decompress(nil, repr)
+			require.NoError(t, err)
+			require.Equal(t, repr, decompressed)
+
+			// A batch that doesn't compress is returned as is.
+			require.Equal(t, random, Compress(nil, random, c))
+
+			// A corrupt compressed batch fails to decompress.
+			compressed[len(compressed)/2] ^= 0xff
+			_, err = Decompress(nil, compressed[:len(compressed)-1])
+			require.Error(t, err)
+		})
+	}
+}
@@ -63,7 +63,7 @@ func (h Header) String() string {
 // performance sensitive code paths that should not necessarily read the rest of
 // the header as well.
 func ReadSeqNum(repr []byte) uint64 {
-	return binary.LittleEndian.Uint64(repr[:countOffset])
+	return binary.LittleEndian.Uint64(repr[:countOffset]) & seqNumMask
 }
 
 // Read constructs a Reader from an encoded batch representation, ignoring the
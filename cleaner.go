@@ -165,6 +165,9 @@ func (cm *cleanupManager) mainLoop() {
 				cm.onTableDeleteFn(of.nonLogFile.fileSize)
 				cm.deleteObsoleteObject(fileTypeTable, job.jobID, of.nonLogFile.fileNum)
 			case fileTypeLog:
+				if !cm.maybeArchiveLog(of.logFile) {
+					continue
+				}
 				cm.deleteObsoleteFile(of.logFile.FS, fileTypeLog, job.jobID, of.logFile.Path,
 					base.DiskFileNum(of.logFile.NumWAL), of.logFile.ApproxFileSize)
 			default:
@@ -181,6 +184,24 @@ func (cm *cleanupManager) mainLoop() {
 	}
 }
 
+// maybeArchiveLog archives the obsolete log if WAL archiving is configured.
+// It returns false if the log must not be deleted because archiving it
+// failed. The log will be archived again when the DB is next opened.
+func (cm *cleanupManager) maybeArchiveLog(log wal.DeletableLog) bool {
+	archive := cm.opts.WALArchive
+	if archive == nil {
+		return true
+	}
+	if err := archive.archive(log); err != nil {
+		cm.opts.Logger.Errorf("failed to archive WAL %s: %v", log.Path, err)
+		return false
+	}
+	if err := archive.prune(time.Now()); err != nil {
+		cm.opts.Logger.Errorf("failed to prune WAL archive: %v", err)
+	}
+	return true
+}
+
 // fileNumIfSST is read iff fileType is fileTypeTable.
 func (cm *cleanupManager) needsPacing(fileType base.FileType, fileNumIfSST base.DiskFileNum) bool {
 	if fileType != fileTypeTable {
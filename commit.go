@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/record"
 )
@@ -139,8 +140,19 @@ type commitEnv struct {
 	// the memtable the batch should be applied to. Serial execution enforced by
 	// commitPipeline.mu.
 	write func(b *Batch, wg *sync.WaitGroup, err *error) (*memTable, error)
+	// Evaluate the conditions of a conditional batch against the latest state,
+	// returning an error if one doesn't hold. Called with commitPipeline.mu
+	// held, once every previously sequenced batch is visible. Only required if
+	// batches carry conditions.
+	checkConditions func(b *Batch) error
 }
 
+// errBatchRejected marks the errors returned by commitPipeline.Commit for a
+// batch that was rejected before being sequenced, because its conditions
+// don't hold or couldn't be evaluated. The pipeline remains healthy and the
+// batch may be reused.
+var errBatchRejected = errors.New("pebble: batch rejected")
+
 // A commitPipeline manages the stages of committing a set of mutations
 // (contained in a single Batch) atomically to the DB. The steps are
 // conceptually:
@@ -247,6 +259,13 @@ type commitPipeline struct {
 	// The mutex to use for synchronizing access to logSeqNum and serializing
 	// calls to commitEnv.write().
 	mu sync.Mutex
+	// published is signaled when the visible sequence number is ratcheted
+	// while publishWaiters is non-zero. Conditional batches, and batches
+	// maintaining secondary indexes, wait on it for the batches sequenced
+	// before them to become visible (see waitVisible).
+	publishMu      sync.Mutex
+	published      sync.Cond
+	publishWaiters atomic.Int32
 }
 
 func newCommitPipeline(env commitEnv) *commitPipeline {
@@ -270,6 +289,7 @@ func newCommitPipeline(env commitEnv) *commitPipeline {
 		logSyncQSem:    make(chan struct{}, record.SyncConcurrency-1),
 		ingestSem:      make(chan struct{}, 1),
 	}
+	p.published.L = &p.publishMu
 	return p
 }
 
@@ -314,6 +334,17 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	// NB: We set Batch.commitErr on error so that the batch won't be a candidate
 	// for reuse. See Batch.release().
 	mem, err := p.prepare(b, syncWAL, noSyncWait)
+	if b.sequenced != nil {
+		b.sequenced()
+	}
+	if errors.Is(err, errBatchRejected) {
+		// The batch was rejected before being enqueued in the pending queue.
+		<-p.commitQueueSem
+		if syncWAL {
+			<-p.logSyncQSem
+		}
+		return err
+	}
 	if err != nil {
 		b.db = nil // prevent batch reuse on error
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
@@ -430,6 +461,18 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	if n == invalidBatchCount {
 		return nil, ErrInvalidBatch
 	}
+
+	p.mu.Lock()
+
+	if len(b.conditions) > 0 {
+		// Evaluate the batch's conditions while holding commitPipeline.mu, so
+		// that no other batch can be sequenced between the evaluation and b.
+		if err := p.checkConditions(b); err != nil {
+			p.mu.Unlock()
+			return nil, errors.Mark(err, errBatchRejected)
+		}
+	}
+
 	var syncWG *sync.WaitGroup
 	var syncErr *error
 	switch {
@@ -451,8 +494,6 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 		b.commit.Add(2)
 	}
 
-	p.mu.Lock()
-
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
 	// number order.
@@ -471,6 +512,31 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	return mem, err
 }
 
+// checkConditions waits for every batch sequenced so far to become visible,
+// and then evaluates the conditions of b against the latest state. Since the
+// caller holds commitPipeline.mu until b is sequenced, no other batch can be
+// applied between the evaluation and b.
+//
+// REQUIRES: p.mu is held.
+func (p *commitPipeline) checkConditions(b *Batch) error {
+	p.waitVisible()
+	return p.env.checkConditions(b)
+}
+
+// waitVisible waits for every batch sequenced before the call to become
+// visible.
+func (p *commitPipeline) waitVisible() {
+	if seqNum := p.env.logSeqNum.Load(); p.env.visibleSeqNum.Load() < seqNum {
+		p.publishMu.Lock()
+		p.publishWaiters.Add(1)
+		for p.env.visibleSeqNum.Load() < seqNum {
+			p.published.Wait()
+		}
+		p.publishWaiters.Add(-1)
+		p.publishMu.Unlock()
+	}
+}
+
 func (p *commitPipeline) publish(b *Batch) {
 	// Mark the batch as applied.
 	b.applied.Store(true)
@@ -512,6 +578,13 @@ func (p *commitPipeline) publish(b *Batch) {
 				break
 			}
 		}
+		if p.publishWaiters.Load() > 0 {
+			// A conditional batch is waiting for the visible sequence number to
+			// reach the batches sequenced before it.
+			p.publishMu.Lock()
+			p.published.Broadcast()
+			p.publishMu.Unlock()
+		}
 
 		t.commit.Done()
 	}
@@ -208,6 +208,43 @@ func TestCommitPipelineAllocateSeqNum(t *testing.T) {
 	}
 }
 
+func TestCommitPipelineConditions(t *testing.T) {
+	var e testCommitEnv
+	env := e.env()
+	checking := make(chan struct{})
+	release := make(chan struct{})
+	env.checkConditions = func(b *Batch) error {
+		close(checking)
+		<-release
+		return nil
+	}
+	p := newCommitPipeline(env)
+
+	conditional := &Batch{}
+	require.NoError(t, conditional.SetIfAbsent([]byte("foo"), []byte("bar"), nil))
+	unconditional := &Batch{}
+	require.NoError(t, unconditional.Set([]byte("foo"), []byte("baz"), nil))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		require.NoError(t, p.Commit(conditional, false /* sync */, false))
+	}()
+	<-checking
+	// An unconditional batch committed while the conditions are evaluated
+	// must not be sequenced before the conditional batch.
+	go func() {
+		defer wg.Done()
+		require.NoError(t, p.Commit(unconditional, false /* sync */, false))
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, uint64(0), e.writeCount.Load())
+	close(release)
+	wg.Wait()
+	require.Less(t, conditional.SeqNum(), unconditional.SeqNum())
+}
+
 type syncDelayFile struct {
 	vfs.File
 	done chan struct{}
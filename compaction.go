@@ -14,6 +14,7 @@ import (
 	"runtime/pprof"
 	"slices"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -151,6 +152,14 @@ const (
 	compactionKindRead
 	compactionKindRewrite
 	compactionKindIngestedFlushable
+	// compactionKindAge denotes a compaction of a table whose age exceeds
+	// Options.Experimental.MaxTableAge or PeriodicCompactionInterval.
+	compactionKindAge
+	// compactionKindTombstoneDensity denotes a compaction of a table with a
+	// high density of point tombstones.
+	compactionKindTombstoneDensity
+	// compactionKindHint denotes a compaction of the span of a CompactionHint.
+	compactionKindHint
 )
 
 func (k compactionKind) String() string {
@@ -173,6 +182,12 @@ func (k compactionKind) String() string {
 		return "ingested-flushable"
 	case compactionKindCopy:
 		return "copy"
+	case compactionKindAge:
+		return "age"
+	case compactionKindTombstoneDensity:
+		return "tombstone-density"
+	case compactionKindHint:
+		return "hint"
 	}
 	return "?"
 }
@@ -243,6 +258,19 @@ type compaction struct {
 	// to cancel, such as if a conflicting excise operation raced it to manifest
 	// application. Only holders of the manifest lock will write to this atomic.
 	cancel atomic.Bool
+	// parent is set on subcompactions to the compaction whose key range they
+	// partition. See splitIntoSubcompactions.
+	parent *compaction
+	// lower and upper bound the user keys processed by a subcompaction to
+	// [lower, upper). A nil bound is unbounded. If lowerExclusive is true,
+	// the lower bound is exclusive.
+	lower, upper   []byte
+	lowerExclusive bool
+	// checkpoint is set on resumable compactions, and records the
+	// compaction's progress. See compaction_checkpoint.go.
+	checkpoint *compactionCheckpoint
+	// hint is set on compactions of the span of a compaction hint.
+	hint *readCompaction
 
 	kind      compactionKind
 	cmp       Compare
@@ -382,6 +410,9 @@ func (c *compaction) makeInfo(jobID int) CompactionInfo {
 	for i, score := range c.pickerMetrics.scores {
 		info.Input[i].Score = score
 	}
+	if c.hint != nil {
+		info.Hint = c.hint.reason
+	}
 	info.SingleLevelOverlappingRatio = c.pickerMetrics.singleLevelOverlappingRatio
 	info.MultiLevelOverlappingRatio = c.pickerMetrics.multiLevelOverlappingRatio
 	if len(info.Input) > 2 {
@@ -408,6 +439,8 @@ func newCompaction(
 		maxOutputFileSize: pc.maxOutputFileSize,
 		maxOverlapBytes:   pc.maxOverlapBytes,
 		pickerMetrics:     pc.pickerMetrics,
+		checkpoint:        pc.checkpoint,
+		hint:              pc.hint,
 	}
 	c.startLevel = &c.inputs[0]
 	if pc.startLevel.l0SublevelInfo != nil {
@@ -428,7 +461,10 @@ func newCompaction(
 	c.setupInuseKeyRanges()
 	c.kind = pc.kind
 
-	if c.kind == compactionKindDefault && c.outputLevel.files.Empty() && !c.hasExtraLevelData() &&
+	// A resumed compaction can't be converted into a move or copy, because
+	// some of its output tables have already been written.
+	if c.kind == compactionKindDefault && c.checkpoint == nil &&
+		c.outputLevel.files.Empty() && !c.hasExtraLevelData() &&
 		c.startLevel.files.Len() == 1 && c.grandparents.SizeSum() <= c.maxOverlapBytes {
 		// This compaction can be converted into a move or copy from one level
 		// to the next. We avoid such a move if there is lots of overlapping
@@ -925,8 +961,14 @@ func (c *compaction) newInputIter(
 			Category: "pebble-compaction",
 			QoSLevel: sstable.NonLatencySensitiveQoSLevel,
 		},
-		logger: c.logger,
+		LowerBound: c.lower,
+		UpperBound: c.upper,
+		logger:     c.logger,
 	}
+	// Subcompactions only process the keys within their bounds. Span
+	// iterators are not bounded by iterOpts, so their spans are truncated to
+	// the bounds.
+	bounded := c.lower != nil || c.upper != nil
 
 	// Populate iters, rangeDelIters and rangeKeyIters with the appropriate
 	// constituent iterators. This depends on whether this is a flush or a
@@ -1003,6 +1045,9 @@ func (c *compaction) newInputIter(
 				if rangeDelIter == nil {
 					continue
 				}
+				if bounded {
+					rangeDelIter = c.truncateSpans(rangeDelIter)
+				}
 				rangeDelIters = append(rangeDelIters, rangeDelIter)
 				c.closers = append(c.closers, closer)
 			}
@@ -1039,7 +1084,11 @@ func (c *compaction) newInputIter(
 					return iter, err
 				}
 				li.Init(keyspan.SpanIterOptions{}, c.cmp, newRangeKeyIterWrapper, level.files.Iter(), l, manifest.KeyTypeRange)
-				rangeKeyIters = append(rangeKeyIters, li)
+				if bounded {
+					rangeKeyIters = append(rangeKeyIters, c.truncateSpans(li))
+				} else {
+					rangeKeyIters = append(rangeKeyIters, li)
+				}
 			}
 			return nil
 		}
@@ -1072,6 +1121,15 @@ func (c *compaction) newInputIter(
 	if len(iters) > 1 {
 		iter = newMergingIter(c.logger, &c.stats, c.cmp, nil, iters...)
 	}
+	if bounded {
+		iter = &boundedIter{
+			internalIterator: iter,
+			cmp:              c.cmp,
+			lower:            c.lower,
+			upper:            c.upper,
+			lowerExclusive:   c.lowerExclusive,
+		}
+	}
 
 	// In normal operation, levelIter iterates over the point operations in a
 	// level, and initializes a rangeDelIter pointer for the range deletions in
@@ -1106,6 +1164,200 @@ func (c *compaction) newInputIter(
 	return iter, nil
 }
 
+// cancelled returns true if the compaction, or the compaction that it is a
+// subcompaction of, has been cancelled by a concurrent operation.
+func (c *compaction) cancelled() bool {
+	return c.cancel.Load() || (c.parent != nil && c.parent.cancel.Load())
+}
+
+// splitIntoSubcompactions partitions the key range of the compaction into at
+// most n disjoint subranges of roughly equal size, and returns one
+// subcompaction per subrange. The subranges are delimited by the smallest keys
+// of input tables below the compaction's start level, so that each
+// subcompaction reads a similar number of bytes from the lower levels. An input
+// table that spans multiple subranges is read by each of the corresponding
+// subcompactions, restricted to their bounds. Returns nil if the compaction
+// cannot be split.
+func (c *compaction) splitIntoSubcompactions(n int) []*compaction {
+	var totalSize uint64
+	for i := range c.inputs {
+		totalSize += c.inputs[i].files.SizeSum()
+	}
+	// Don't split compactions that aren't expected to write at least
+	// subcompactionMinOutputFiles output tables per subcompaction.
+	n = min(n, int(totalSize/(subcompactionMinOutputFiles*c.maxOutputFileSize)))
+	if n <= 1 {
+		return nil
+	}
+
+	var files []*fileMetadata
+	var lowerSize uint64
+	for i := 1; i < len(c.inputs); i++ {
+		iter := c.inputs[i].files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			files = append(files, f)
+			lowerSize += f.Size
+		}
+	}
+	slices.SortFunc(files, func(a, b *fileMetadata) int {
+		return base.InternalCompare(c.cmp, a.Smallest, b.Smallest)
+	})
+	targetSize := lowerSize / uint64(n)
+	var splitKeys [][]byte
+	var cumulativeSize uint64
+	for _, f := range files {
+		if len(splitKeys) == n-1 {
+			break
+		}
+		if cumulativeSize >= targetSize*uint64(len(splitKeys)+1) {
+			k := f.Smallest.UserKey
+			if c.cmp(k, c.smallest.UserKey) > 0 &&
+				(len(splitKeys) == 0 || c.cmp(k, splitKeys[len(splitKeys)-1]) > 0) {
+				splitKeys = append(splitKeys, k)
+			}
+		}
+		cumulativeSize += f.Size
+	}
+	if len(splitKeys) == 0 {
+		return nil
+	}
+
+	subcompactions := make([]*compaction, 0, len(splitKeys)+1)
+	var lower []byte
+	for i := 0; i <= len(splitKeys); i++ {
+		var upper []byte
+		if i < len(splitKeys) {
+			upper = splitKeys[i]
+		}
+		subcompactions = append(subcompactions, c.newSubcompaction(lower, upper))
+		lower = upper
+	}
+	return subcompactions
+}
+
+// subcompactionMinOutputFiles is the minimum number of maximally-sized output
+// tables that each subcompaction of a split compaction is expected to write.
+const subcompactionMinOutputFiles = 2
+
+// newSubcompaction returns a compaction that writes the keys of c within the
+// user key bounds [lower, upper) to c's output level. A nil bound is
+// unbounded.
+func (c *compaction) newSubcompaction(lower, upper []byte) *compaction {
+	sc := &compaction{
+		parent:             c,
+		kind:               c.kind,
+		cmp:                c.cmp,
+		equal:              c.equal,
+		comparer:           c.comparer,
+		formatKey:          c.formatKey,
+		logger:             c.logger,
+		version:            c.version,
+		beganAt:            c.beganAt,
+		inputs:             make([]compactionLevel, len(c.inputs)),
+		maxOutputFileSize:  c.maxOutputFileSize,
+		maxOverlapBytes:    c.maxOverlapBytes,
+		disableSpanElision: c.disableSpanElision,
+		smallest:           c.smallest,
+		largest:            c.largest,
+		lower:              lower,
+		upper:              upper,
+	}
+	for i := range c.inputs {
+		var files []*fileMetadata
+		iter := c.inputs[i].files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if lower != nil && (c.cmp(f.Largest.UserKey, lower) < 0 ||
+				(c.cmp(f.Largest.UserKey, lower) == 0 && f.Largest.IsExclusiveSentinel())) {
+				continue
+			}
+			if upper != nil && c.cmp(f.Smallest.UserKey, upper) >= 0 {
+				break
+			}
+			files = append(files, f)
+		}
+		sc.inputs[i] = compactionLevel{
+			level: c.inputs[i].level,
+			files: manifest.NewLevelSliceKeySorted(c.cmp, files),
+		}
+	}
+	sc.startLevel = &sc.inputs[0]
+	sc.outputLevel = &sc.inputs[len(sc.inputs)-1]
+	for i := 1; i < len(sc.inputs)-1; i++ {
+		sc.extraLevels = append(sc.extraLevels, &sc.inputs[i])
+	}
+	if lower != nil {
+		sc.smallest = base.MakeInternalKey(lower, InternalKeySeqNumMax, InternalKeyKindMax)
+	}
+	if upper != nil {
+		sc.largest = base.MakeExclusiveSentinelKey(InternalKeyKindRangeDelete, upper)
+	}
+	if sc.outputLevel.level+1 < numLevels {
+		sc.grandparents = sc.version.Overlaps(sc.outputLevel.level+1,
+			sc.smallest.UserKey, sc.largest.UserKey, sc.largest.IsExclusiveSentinel())
+	}
+	sc.setupInuseKeyRanges()
+	return sc
+}
+
+// truncateSpans returns an iterator over the spans of iter truncated to the
+// bounds of a subcompaction. Spans that lie entirely outside the bounds are
+// omitted. If the lower bound is exclusive, spans are truncated to start at its
+// immediate successor; see resumableAfter.
+func (c *compaction) truncateSpans(iter keyspan.FragmentIterator) keyspan.FragmentIterator {
+	lower := c.lower
+	if lower != nil && c.lowerExclusive {
+		lower = c.comparer.ImmediateSuccessor(nil, lower)
+	}
+	return keyspan.Filter(iter, func(in *keyspan.Span, out *keyspan.Span) (keep bool) {
+		out.Start, out.End = in.Start, in.End
+		out.Keys = append(out.Keys[:0], in.Keys...)
+		if lower != nil && c.cmp(out.Start, lower) < 0 {
+			out.Start = lower
+		}
+		if c.upper != nil && c.cmp(out.End, c.upper) > 0 {
+			out.End = c.upper
+		}
+		return !out.Empty() && c.cmp(out.Start, out.End) < 0
+	}, c.cmp)
+}
+
+// boundedIter wraps the point iterator of a subcompaction, restricting it to
+// the subcompaction's [lower, upper) bounds. The sstable iterators used by
+// compactions support only First and Next and ignore iterator bounds, so the
+// bounds are enforced here by stepping over keys below the lower bound.
+type boundedIter struct {
+	internalIterator
+	cmp            Compare
+	lower, upper   []byte
+	lowerExclusive bool
+}
+
+// First implements (base.InternalIterator).First.
+func (i *boundedIter) First() (*InternalKey, base.LazyValue) {
+	key, val := i.internalIterator.First()
+	for i.lower != nil && key != nil {
+		if c := i.cmp(key.UserKey, i.lower); c > 0 || (c == 0 && !i.lowerExclusive) {
+			break
+		}
+		key, val = i.internalIterator.Next()
+	}
+	return i.checkUpper(key, val)
+}
+
+// Next implements (base.InternalIterator).Next.
+func (i *boundedIter) Next() (*InternalKey, base.LazyValue) {
+	return i.checkUpper(i.internalIterator.Next())
+}
+
+func (i *boundedIter) checkUpper(
+	key *InternalKey, val base.LazyValue,
+) (*InternalKey, base.LazyValue) {
+	if i.upper != nil && key != nil && i.cmp(key.UserKey, i.upper) >= 0 {
+		return nil, base.LazyValue{}
+	}
+	return key, val
+}
+
 func (c *compaction) newRangeDelIter(
 	newIters tableNewIters,
 	f manifest.LevelFile,
@@ -1172,6 +1424,13 @@ type readCompaction struct {
 	// If the file no longer belongs in the same
 	// level, then we skip the compaction.
 	fileNum base.FileNum
+
+	// priority and reason are set on the read compactions queued by
+	// compaction hints rather than by reads, for which level is the highest
+	// level from which the hinted span remains to be compacted and fileNum
+	// is unused. See DB.AddCompactionHint.
+	priority CompactionPriority
+	reason   string
 }
 
 type downloadSpan struct {
@@ -1838,6 +2097,81 @@ func (d *DB) maybeScheduleCompactionAsync() {
 	d.mu.Unlock()
 }
 
+// outputCreationTime returns the creation time of the tables output by the
+// compaction. The outputs of a flush are dated by the oldest flushed memtable,
+// and the outputs of a compaction by the oldest of its input tables, so that
+// the age of data is preserved as it moves down the LSM. Only a periodic
+// compaction rewriting tables in place resets their age.
+func (c *compaction) outputCreationTime() int64 {
+	var oldest int64
+	if len(c.flushing) != 0 {
+		for _, f := range c.flushing {
+			if t := f.createdAt.Unix(); !f.createdAt.IsZero() && (oldest == 0 || t < oldest) {
+				oldest = t
+			}
+		}
+	} else if c.kind != compactionKindAge || c.startLevel.level != c.outputLevel.level {
+		for _, cl := range c.inputs {
+			iter := cl.files.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				if f.CreationTime != 0 && (oldest == 0 || f.CreationTime < oldest) {
+					oldest = f.CreationTime
+				}
+			}
+		}
+	}
+	if oldest == 0 {
+		// The inputs' creation times are unknown.
+		oldest = c.beganAt.Unix()
+	}
+	return oldest
+}
+
+// ageCompactionCheckInterval returns how frequently the DB should check for
+// tables eligible for an age-based compaction, or zero if age-based
+// compactions are disabled.
+func ageCompactionCheckInterval(opts *Options) time.Duration {
+	age := opts.Experimental.MaxTableAge
+	if p := opts.Experimental.PeriodicCompactionInterval; p > 0 && (age == 0 || p < age) {
+		age = p
+	}
+	if age == 0 {
+		return 0
+	}
+	// Check several times per interval so that tables are compacted soon
+	// after they become overdue.
+	interval := age / 10
+	if interval < time.Second {
+		interval = time.Second
+	} else if interval > 10*time.Minute {
+		interval = 10 * time.Minute
+	}
+	return interval
+}
+
+// periodicallyScheduleCompactions attempts to schedule a compaction every
+// interval until the DB is closed. Compactions are otherwise only scheduled in
+// response to writes and the completion of flushes and compactions, so without
+// it a table in an idle DB could outlive the configured maximum table age
+// indefinitely. This method should be launched in a separate goroutine after
+// incrementing d.compactionSchedulers.
+func (d *DB) periodicallyScheduleCompactions(interval time.Duration) {
+	defer d.compactionSchedulers.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closedCh:
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			d.maybeScheduleCompaction()
+			d.mu.Unlock()
+		}
+	}
+}
+
 // maybeScheduleCompaction schedules a compaction if necessary.
 //
 // d.mu must be held when calling this.
@@ -1947,9 +2281,11 @@ func (d *DB) maybeScheduleCompactionPicker(
 
 	env := compactionEnv{
 		diskAvailBytes:          d.diskAvailBytes.Load(),
-		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
+		earliestSnapshotSeqNum:  d.earliestCompactionSnapshotLocked(),
 		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
+		now:                     d.timeNow(),
 	}
+	env.deferNonUrgent = d.deferNonUrgentCompactionsLocked(env.now)
 
 	// Check for delete-only compactions first, because they're expected to be
 	// cheap and reduce future compaction work.
@@ -1957,7 +2293,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 		len(d.mu.compact.deletionHints) > 0 &&
 		!d.opts.DisableAutomaticCompactions {
 		v := d.mu.versions.currentVersion()
-		snapshots := d.mu.snapshots.toSlice()
+		snapshots := d.compactionSnapshotsLocked()
 		inputs, unresolvedHints := checkDeleteCompactionHints(d.cmp, v, d.mu.compact.deletionHints, snapshots)
 		d.mu.compact.deletionHints = unresolvedHints
 
@@ -1991,6 +2327,12 @@ func (d *DB) maybeScheduleCompactionPicker(
 		}
 	}
 
+	// Resume interrupted compactions before picking new ones, so that their
+	// checkpointed output tables aren't invalidated by other compactions.
+	if !d.opts.DisableAutomaticCompactions && len(d.mu.compact.resumable) > 0 {
+		d.maybeScheduleResumedCompactions(env, maxConcurrentCompactions)
+	}
+
 	for !d.opts.DisableAutomaticCompactions && d.mu.compact.compactingCount < maxConcurrentCompactions {
 		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
 		env.readCompactionEnv = readCompactionEnv{
@@ -2380,6 +2722,10 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 		d.maybeUpdateDeleteCompactionHints(c)
 	}
 
+	if c.checkpoint != nil {
+		d.releaseCompactionCheckpoint(c.checkpoint, err != nil /* abandoned */)
+	}
+
 	// NB: clearing compacting state must occur before updating the read state;
 	// L0Sublevels initialization depends on it.
 	d.clearCompactingState(c, err != nil)
@@ -2634,8 +2980,7 @@ func (d *DB) runCompaction(
 		}
 	}()
 
-	snapshots := d.mu.snapshots.toSlice()
-	formatVers := d.FormatMajorVersion()
+	snapshots := d.compactionSnapshotsLocked()
 
 	if c.flushing == nil {
 		// Before dropping the db mutex, grab a ref to the current version. This
@@ -2653,11 +2998,94 @@ func (d *DB) runCompaction(
 		return ve, nil, stats, ErrCancelledCompaction
 	}
 
+	// A resumed compaction runs as a single subcompaction bounded below by
+	// the end of its last checkpointed output table. Otherwise, split the
+	// compaction into concurrent subcompactions if permitted. The additional
+	// compaction slots are released after the d.mu lock is re-acquired below.
+	var subcompactions []*compaction
+	releaseSubcompactions := func() {}
+	if c.checkpoint == nil && d.resumableCompaction(c) {
+		c.checkpoint = d.newCompactionCheckpoint(c)
+	}
+	if c.checkpoint != nil && len(c.checkpoint.outputs) > 0 {
+		lower, exclusive := c.checkpoint.resumeKey()
+		sc := c.newSubcompaction(lower, nil /* upper */)
+		sc.lowerExclusive = exclusive
+		sc.checkpoint = c.checkpoint
+		subcompactions = []*compaction{sc}
+	} else {
+		subcompactions, releaseSubcompactions = d.maybeSplitCompaction(c)
+	}
+	defer releaseSubcompactions()
+
 	// Release the d.mu lock while doing I/O.
 	// Note the unusual order: Unlock and then Lock.
 	d.mu.Unlock()
 	defer d.mu.Lock()
 
+	if len(subcompactions) > 0 {
+		ve, pendingOutputs, stats, retErr = d.runSubcompactions(jobID, c, subcompactions, snapshots)
+	} else {
+		ve, pendingOutputs, stats, retErr = d.compactAndWrite(jobID, c, snapshots)
+	}
+	if retErr != nil {
+		return nil, pendingOutputs, stats, retErr
+	}
+
+	if err := d.objProvider.Sync(); err != nil {
+		return nil, pendingOutputs, stats, err
+	}
+
+	// Refresh the disk available statistic whenever a compaction/flush
+	// completes, before re-acquiring the mutex.
+	_ = d.calculateDiskAvailableBytes()
+
+	return ve, pendingOutputs, stats, nil
+}
+
+// initMetrics initializes c.metrics with the bytes read from the inputs of the
+// compaction, and returns the metrics of the output level.
+func (c *compaction) initMetrics() *LevelMetrics {
+	startLevelBytes := c.startLevel.files.SizeSum()
+	outputMetrics := &LevelMetrics{
+		BytesIn:   startLevelBytes,
+		BytesRead: c.outputLevel.files.SizeSum(),
+	}
+	if len(c.extraLevels) > 0 {
+		outputMetrics.BytesIn += c.extraLevels[0].files.SizeSum()
+	}
+	outputMetrics.BytesRead += outputMetrics.BytesIn
+
+	c.metrics = map[int]*LevelMetrics{
+		c.outputLevel.level: outputMetrics,
+	}
+	if len(c.flushing) == 0 && c.metrics[c.startLevel.level] == nil {
+		c.metrics[c.startLevel.level] = &LevelMetrics{}
+	}
+	if len(c.extraLevels) > 0 {
+		c.metrics[c.extraLevels[0].level] = &LevelMetrics{}
+		outputMetrics.MultiLevel.BytesInTop = startLevelBytes
+		outputMetrics.MultiLevel.BytesIn = outputMetrics.BytesIn
+		outputMetrics.MultiLevel.BytesRead = outputMetrics.BytesRead
+	}
+	return outputMetrics
+}
+
+// compactAndWrite iterates over the inputs of the compaction c and writes
+// the resulting keys to new output tables. It returns a version edit that
+// adds the output tables and removes the input tables. The caller is
+// responsible for syncing the output tables.
+//
+// d.mu must not be held when calling this method.
+func (d *DB) compactAndWrite(
+	jobID int, c *compaction, snapshots []uint64,
+) (ve *versionEdit, pendingOutputs []*fileMetadata, stats compactStats, retErr error) {
+	defer func() {
+		if retErr != nil {
+			pendingOutputs = nil
+		}
+	}()
+
 	// Compactions use a pool of buffers to read blocks, avoiding polluting the
 	// block cache with blocks that will not be read again. We initialize the
 	// buffer pool with a size 12. This initial size does not need to be
@@ -2723,32 +3151,20 @@ func (d *DB) runCompaction(
 	ve = &versionEdit{
 		DeletedFiles: map[deletedFileEntry]*fileMetadata{},
 	}
-
-	startLevelBytes := c.startLevel.files.SizeSum()
-	outputMetrics := &LevelMetrics{
-		BytesIn:   startLevelBytes,
-		BytesRead: c.outputLevel.files.SizeSum(),
-	}
-	if len(c.extraLevels) > 0 {
-		outputMetrics.BytesIn += c.extraLevels[0].files.SizeSum()
-	}
-	outputMetrics.BytesRead += outputMetrics.BytesIn
-
-	c.metrics = map[int]*LevelMetrics{
-		c.outputLevel.level: outputMetrics,
-	}
-	if len(c.flushing) == 0 && c.metrics[c.startLevel.level] == nil {
-		c.metrics[c.startLevel.level] = &LevelMetrics{}
-	}
-	if len(c.extraLevels) > 0 {
-		c.metrics[c.extraLevels[0].level] = &LevelMetrics{}
-		outputMetrics.MultiLevel.BytesInTop = startLevelBytes
-		outputMetrics.MultiLevel.BytesIn = outputMetrics.BytesIn
-		outputMetrics.MultiLevel.BytesRead = outputMetrics.BytesRead
+	outputMetrics := c.initMetrics()
+	if c.checkpoint != nil {
+		// The output tables completed before the compaction was resumed are
+		// added to the version along with the new output tables.
+		for _, e := range c.checkpoint.outputs {
+			ve.NewFiles = append(ve.NewFiles, e)
+			outputMetrics.Size += int64(e.Meta.Size)
+			outputMetrics.NumFiles++
+		}
 	}
 
 	// The table is typically written at the maximum allowable format implied by
 	// the current format major version of the DB.
+	formatVers := d.FormatMajorVersion()
 	tableFormat := formatVers.MaxTableFormat()
 
 	// In format major versions with maximum table formats of Pebblev3, value
@@ -2777,10 +3193,11 @@ func (d *DB) runCompaction(
 			d.opts.Experimental.CPUWorkPermissionGranter.CPUWorkDone(cpuWorkHandle)
 		}
 	}()
+	creationTime := c.outputCreationTime()
 
 	newOutput := func() error {
 		// Check if we've been cancelled by a concurrent operation.
-		if c.cancel.Load() {
+		if c.cancelled() {
 			return ErrCancelledCompaction
 		}
 		fileMeta := &fileMetadata{}
@@ -2842,7 +3259,7 @@ func (d *DB) runCompaction(
 
 		tw = sstable.NewWriter(writable, writerOpts, cacheOpts, &prevPointKey)
 
-		fileMeta.CreationTime = time.Now().Unix()
+		fileMeta.CreationTime = creationTime
 		ve.NewFiles = append(ve.NewFiles, newFileEntry{
 			Level: c.outputLevel.level,
 			Meta:  fileMeta,
@@ -2971,6 +3388,7 @@ func (d *DB) runCompaction(
 		meta.Size = writerMeta.Size
 		meta.SmallestSeqNum = writerMeta.SmallestSeqNum
 		meta.LargestSeqNum = writerMeta.LargestSeqNum
+		meta.SeqNumTimes = d.seqNumTimes.samplesForTable(meta.SmallestSeqNum, meta.LargestSeqNum)
 		meta.InitPhysicalBacking()
 
 		// If the file didn't contain any range deletions, we can fill its
@@ -3071,6 +3489,9 @@ func (d *DB) runCompaction(
 		if err := meta.Validate(d.cmp, d.opts.Comparer.FormatKey); err != nil {
 			return err
 		}
+		if c.checkpoint != nil {
+			return d.maybeWriteCompactionCheckpoint(c.checkpoint, ve.NewFiles)
+		}
 		return nil
 	}
 
@@ -3107,6 +3528,14 @@ func (d *DB) runCompaction(
 	}
 	splitter := compact.CombineSplitters(c.cmp, outputSplitters...)
 
+	// Garbage collect the versions of keys shadowed at the full-history
+	// threshold, if configured. Flushes don't, since the key ranges in use
+	// below them aren't known (see elideRangeTombstone).
+	var tsGC timestampGC
+	gcTimestamps := len(c.flushing) == 0 && tsGC.init(d.opts, snapshots, func(userKey []byte) bool {
+		return !c.inuseEntireRange && c.elideRangeTombstone(userKey, userKey)
+	})
+
 	// Each outer loop iteration produces one output file. An iteration that
 	// produces a file containing point keys (and optionally range tombstones)
 	// guarantees that the input iterator advanced. An iteration that produces
@@ -3198,6 +3627,9 @@ func (d *DB) runCompaction(
 				}
 				continue
 			}
+			if gcTimestamps && tsGC.drop(key) {
+				continue
+			}
 			if tw == nil {
 				if err := newOutput(); err != nil {
 					return nil, pendingOutputs, stats, err
@@ -3259,14 +3691,119 @@ func (d *DB) runCompaction(
 	// compactStats.
 	stats.countMissizedDels = iter.stats.countMissizedDels
 
-	if err := d.objProvider.Sync(); err != nil {
-		return nil, pendingOutputs, stats, err
+	return ve, pendingOutputs, stats, nil
+}
+
+// maybeSplitCompaction returns the subcompactions that the compaction c should
+// be split into, or nil if c should run as a single compaction. Each
+// subcompaction beyond the first occupies a compaction slot until the returned
+// release function is called.
+//
+// d.mu must be held when calling this method and when calling the returned
+// release function.
+func (d *DB) maybeSplitCompaction(c *compaction) (_ []*compaction, release func()) {
+	n := min(d.opts.Experimental.MaxSubcompactions,
+		d.opts.MaxConcurrentCompactions()-d.mu.compact.compactingCount+1)
+	if n <= 1 || c.kind != compactionKindDefault || c.startLevel.level <= 0 || c.checkpoint != nil {
+		return nil, func() {}
+	}
+	const MaxSubcompactionAdditionalCPUTime = time.Millisecond * 100
+	granter := d.opts.Experimental.CPUWorkPermissionGranter
+	cpuWorkHandle := granter.GetPermission(MaxSubcompactionAdditionalCPUTime)
+	var subcompactions []*compaction
+	if cpuWorkHandle.Permitted() {
+		subcompactions = c.splitIntoSubcompactions(n)
+	}
+	if len(subcompactions) == 0 {
+		granter.CPUWorkDone(cpuWorkHandle)
+		return nil, func() {}
+	}
+	extra := len(subcompactions) - 1
+	d.mu.compact.compactingCount += extra
+	d.mu.compact.subcompactingCount += extra
+	d.mu.versions.metrics.Compact.SubcompactionCount += int64(len(subcompactions))
+	return subcompactions, func() {
+		d.mu.compact.compactingCount -= extra
+		d.mu.compact.subcompactingCount -= extra
+		granter.CPUWorkDone(cpuWorkHandle)
 	}
+}
 
-	// Refresh the disk available statistic whenever a compaction/flush
-	// completes, before re-acquiring the mutex.
-	_ = d.calculateDiskAvailableBytes()
+// runSubcompactions runs the subcompactions of the compaction c concurrently
+// and combines their outputs into a single version edit, so that the results
+// of all subcompactions are installed atomically. If any subcompaction fails,
+// the outputs of all subcompactions are removed.
+//
+// d.mu must not be held when calling this method.
+func (d *DB) runSubcompactions(
+	jobID int, c *compaction, subcompactions []*compaction, snapshots []uint64,
+) (ve *versionEdit, pendingOutputs []*fileMetadata, stats compactStats, retErr error) {
+	type result struct {
+		ve             *versionEdit
+		pendingOutputs []*fileMetadata
+		stats          compactStats
+		err            error
+	}
+	results := make([]result, len(subcompactions))
+	var wg sync.WaitGroup
+	for i := range subcompactions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pprof.Do(context.Background(), compactLabels, func(context.Context) {
+				r := &results[i]
+				r.ve, r.pendingOutputs, r.stats, r.err = d.compactAndWrite(jobID, subcompactions[i], snapshots)
+			})
+		}(i)
+	}
+	wg.Wait()
 
+	// Input tables that span multiple subcompactions are read by each of
+	// them, so the input metrics are computed from the parent compaction, and
+	// only the output metrics are accumulated from the subcompactions.
+	ve = &versionEdit{
+		DeletedFiles: map[deletedFileEntry]*fileMetadata{},
+	}
+	outputMetrics := c.initMetrics()
+	for i, sc := range subcompactions {
+		r := &results[i]
+		c.bytesIterated += sc.bytesIterated
+		c.bytesWritten += sc.bytesWritten
+		if r.err != nil {
+			retErr = firstError(retErr, r.err)
+			continue
+		}
+		ve.NewFiles = append(ve.NewFiles, r.ve.NewFiles...)
+		pendingOutputs = append(pendingOutputs, r.pendingOutputs...)
+		m := sc.metrics[sc.outputLevel.level]
+		outputMetrics.Size += m.Size
+		outputMetrics.NumFiles += m.NumFiles
+		outputMetrics.TablesCompacted += m.TablesCompacted
+		outputMetrics.BytesCompacted += m.BytesCompacted
+		outputMetrics.Additional.BytesWrittenDataBlocks += m.Additional.BytesWrittenDataBlocks
+		outputMetrics.Additional.BytesWrittenValueBlocks += m.Additional.BytesWrittenValueBlocks
+		stats.cumulativePinnedKeys += r.stats.cumulativePinnedKeys
+		stats.cumulativePinnedSize += r.stats.cumulativePinnedSize
+		stats.countMissizedDels += r.stats.countMissizedDels
+	}
+	if retErr != nil {
+		// The failed subcompactions have already removed their own outputs.
+		for _, f := range pendingOutputs {
+			_ = d.objProvider.Remove(fileTypeTable, base.PhysicalTableDiskFileNum(f.FileNum))
+		}
+		return nil, nil, stats, retErr
+	}
+	// The subcompactions only delete the input tables that overlap their
+	// bounds, so the deleted tables are taken from the compaction itself.
+	for _, cl := range c.inputs {
+		iter := cl.files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			ve.DeletedFiles[deletedFileEntry{
+				Level:   cl.level,
+				FileNum: f.FileNum,
+			}] = f
+		}
+	}
 	return ve, pendingOutputs, stats, nil
 }
 
@@ -3333,11 +3870,22 @@ func (d *DB) scanObsoleteFiles(list []string) {
 		}
 	}
 
+	// Protect the output tables of interrupted compactions that are awaiting
+	// resumption.
+	resumable := make(map[base.DiskFileNum]struct{})
+	for _, cp := range d.mu.compact.resumable {
+		resumable[cp.fileNum] = struct{}{}
+		for _, e := range cp.outputs {
+			liveFileNums[e.Meta.FileBacking.DiskFileNum] = struct{}{}
+		}
+	}
+
 	manifestFileNum := d.mu.versions.manifestFileNum
 
 	var obsoleteTables []fileInfo
 	var obsoleteManifests []fileInfo
 	var obsoleteOptions []fileInfo
+	var obsoleteCompactionCheckpoints []fileInfo
 
 	for _, filename := range list {
 		fileType, diskFileNum, ok := base.ParseFilename(d.opts.FS, filename)
@@ -3363,6 +3911,11 @@ func (d *DB) scanObsoleteFiles(list []string) {
 				fi.FileSize = uint64(stat.Size())
 			}
 			obsoleteOptions = append(obsoleteOptions, fi)
+		case fileTypeCompactionCheckpoint:
+			if _, ok := resumable[diskFileNum]; ok {
+				continue
+			}
+			obsoleteCompactionCheckpoints = append(obsoleteCompactionCheckpoints, fileInfo{FileNum: diskFileNum})
 		case fileTypeTable:
 			// Objects are handled through the objstorage provider below.
 		default:
@@ -3394,6 +3947,8 @@ func (d *DB) scanObsoleteFiles(list []string) {
 	d.mu.versions.updateObsoleteTableMetricsLocked()
 	d.mu.versions.obsoleteManifests = merge(d.mu.versions.obsoleteManifests, obsoleteManifests)
 	d.mu.versions.obsoleteOptions = merge(d.mu.versions.obsoleteOptions, obsoleteOptions)
+	d.mu.versions.obsoleteCompactionCheckpoints = merge(
+		d.mu.versions.obsoleteCompactionCheckpoints, obsoleteCompactionCheckpoints)
 }
 
 // disableFileDeletions disables file deletions and then waits for any
@@ -3441,6 +3996,8 @@ func (d *DB) deleteObsoleteFiles(jobID int) {
 		return
 	}
 	_, noRecycle := d.opts.Cleaner.(base.NeedsFileContents)
+	// Archived logs must not be recycled before they're archived.
+	noRecycle = noRecycle || d.opts.WALArchive != nil
 
 	// NB: d.mu.versions.minUnflushedLogNum is the log number of the earliest
 	// log that has not had its contents flushed to an sstable.
@@ -3475,22 +4032,27 @@ func (d *DB) deleteObsoleteFiles(jobID int) {
 	obsoleteOptions := d.mu.versions.obsoleteOptions
 	d.mu.versions.obsoleteOptions = nil
 
+	obsoleteCompactionCheckpoints := d.mu.versions.obsoleteCompactionCheckpoints
+	d.mu.versions.obsoleteCompactionCheckpoints = nil
+
 	// Release d.mu while preparing the cleanup job and possibly waiting.
 	// Note the unusual order: Unlock and then Lock.
 	d.mu.Unlock()
 	defer d.mu.Lock()
 
-	filesToDelete := make([]obsoleteFile, 0, len(obsoleteLogs)+len(obsoleteTables)+len(obsoleteManifests)+len(obsoleteOptions))
+	filesToDelete := make([]obsoleteFile, 0, len(obsoleteLogs)+len(obsoleteTables)+
+		len(obsoleteManifests)+len(obsoleteOptions)+len(obsoleteCompactionCheckpoints))
 	for _, f := range obsoleteLogs {
 		filesToDelete = append(filesToDelete, obsoleteFile{fileType: fileTypeLog, logFile: f})
 	}
-	files := [3]struct {
+	files := [4]struct {
 		fileType fileType
 		obsolete []fileInfo
 	}{
 		{fileTypeTable, obsoleteTables},
 		{fileTypeManifest, obsoleteManifests},
 		{fileTypeOptions, obsoleteOptions},
+		{fileTypeCompactionCheckpoint, obsoleteCompactionCheckpoints},
 	}
 	for _, f := range files {
 		// We sort to make the order of deletions deterministic, which is nice for
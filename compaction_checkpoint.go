@@ -0,0 +1,366 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+)
+
+// Large compactions can run for a long time, and a compaction that is
+// interrupted by a process restart has to start over from the beginning. To
+// avoid repeating the work, a compaction whose inputs exceed
+// Options.Experimental.ResumableCompactionThreshold records a checkpoint of the
+// output tables it has finished, at most once per
+// Options.Experimental.ResumableCompactionCheckpointInterval. The checkpoint
+// is stored in a COMPACTION-<filenum> file that is separate from the MANIFEST,
+// and is encoded as a version edit that deletes the compaction's input tables
+// and adds the output tables that have been completed so far. The output
+// tables are not added to the LSM until the compaction completes, so the
+// version remains unchanged until the compaction's final version edit is
+// applied.
+//
+// When the database is opened, the checkpoints that remain from interrupted
+// compactions are loaded, and their output tables are exempted from the
+// deletion of obsolete files. The compaction picker then resumes the
+// compactions before picking any other automatic compaction. A resumed
+// compaction reads its inputs from the end of its last checkpointed output
+// table, and its version edit adds both the checkpointed and the newly
+// written output tables. If the LSM changed in a way that conflicts with the
+// checkpoint, the checkpoint and its output tables are discarded, and the
+// inputs are compacted again from scratch if necessary.
+
+// compactionCheckpoint describes the progress of a resumable compaction.
+type compactionCheckpoint struct {
+	// fileNum is the file number of the checkpoint file.
+	fileNum base.DiskFileNum
+	// inputs holds the input tables of the compaction.
+	inputs map[deletedFileEntry]*fileMetadata
+	// outputs holds the output tables that the compaction completed before it
+	// was interrupted, in key order. It's empty if the compaction has not
+	// been resumed.
+	outputs []newFileEntry
+	// written is the number of output tables recorded by the last checkpoint
+	// written by the compaction, and writtenAt the time it was written.
+	written   int
+	writtenAt time.Time
+}
+
+// resumeKey returns the user key from which a resumed compaction continues
+// reading its inputs. If exclusive is true, keys equal to the returned user
+// key were written to the checkpointed output tables and must be skipped.
+func (cp *compactionCheckpoint) resumeKey() (key []byte, exclusive bool) {
+	largest := cp.outputs[len(cp.outputs)-1].Meta.Largest
+	return largest.UserKey, !largest.IsExclusiveSentinel()
+}
+
+// resumableAfter returns true if a compaction may be resumed after an output
+// table with the given largest key. A compaction resumed after a table whose
+// largest key is inclusive truncates its range deletions and range keys to
+// start at the immediate successor of the key, which is only defined for
+// prefix keys.
+func resumableAfter(comparer *base.Comparer, largest InternalKey) bool {
+	if largest.IsExclusiveSentinel() {
+		return true
+	}
+	return comparer.ImmediateSuccessor != nil &&
+		comparer.Split(largest.UserKey) == len(largest.UserKey)
+}
+
+// resumableCompaction returns true if the progress of the compaction c should
+// be checkpointed.
+func (d *DB) resumableCompaction(c *compaction) bool {
+	threshold := d.opts.Experimental.ResumableCompactionThreshold
+	if threshold == 0 || c.kind != compactionKindDefault || c.startLevel.level <= 0 ||
+		len(c.extraLevels) > 0 {
+		return false
+	}
+	// Objects on shared storage aren't listed by the objstorage provider
+	// until they're referenced by the version, so the outputs of resumable
+	// compactions must be written locally.
+	if remote.ShouldCreateShared(d.opts.Experimental.CreateOnShared, c.outputLevel.level) {
+		return false
+	}
+	return c.startLevel.files.SizeSum()+c.outputLevel.files.SizeSum() >= threshold
+}
+
+// newCompactionCheckpoint returns a checkpoint for the compaction c, which
+// must not have been resumed.
+//
+// d.mu must be held when calling this method.
+func (d *DB) newCompactionCheckpoint(c *compaction) *compactionCheckpoint {
+	cp := &compactionCheckpoint{
+		fileNum:   d.mu.versions.getNextDiskFileNum(),
+		inputs:    make(map[deletedFileEntry]*fileMetadata),
+		writtenAt: d.timeNow(),
+	}
+	for _, cl := range c.inputs {
+		iter := cl.files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			cp.inputs[deletedFileEntry{Level: cl.level, FileNum: f.FileNum}] = f
+		}
+	}
+	return cp
+}
+
+// maybeWriteCompactionCheckpoint is called each time the compaction with the
+// checkpoint cp completes an output table, with all the output tables
+// completed so far. It writes a checkpoint recording them if the checkpoint
+// interval has elapsed since the last checkpoint, and the compaction can be
+// resumed after the last output table.
+//
+// d.mu must not be held when calling this method.
+func (d *DB) maybeWriteCompactionCheckpoint(
+	cp *compactionCheckpoint, outputs []newFileEntry,
+) error {
+	if len(outputs) <= cp.written ||
+		d.timeNow().Sub(cp.writtenAt) < d.opts.Experimental.ResumableCompactionCheckpointInterval ||
+		!resumableAfter(d.opts.Comparer, outputs[len(outputs)-1].Meta.Largest) {
+		return nil
+	}
+	if err := d.writeCompactionCheckpoint(cp, outputs); err != nil {
+		return err
+	}
+	cp.written, cp.writtenAt = len(outputs), d.timeNow()
+	return nil
+}
+
+// writeCompactionCheckpoint durably records that the compaction with the
+// checkpoint cp has completed the given output tables. The checkpoint file is
+// replaced atomically, so a crash leaves either the previous or the new
+// checkpoint.
+//
+// d.mu must not be held when calling this method.
+func (d *DB) writeCompactionCheckpoint(cp *compactionCheckpoint, outputs []newFileEntry) error {
+	// The output tables must be durable before the checkpoint refers to them.
+	if err := d.objProvider.Sync(); err != nil {
+		return err
+	}
+	ve := versionEdit{
+		DeletedFiles: cp.inputs,
+		NewFiles:     outputs,
+	}
+	var buf bytes.Buffer
+	if err := ve.Encode(&buf); err != nil {
+		return err
+	}
+	tmpPath := base.MakeFilepath(d.opts.FS, d.dirname, fileTypeTemp, cp.fileNum)
+	path := base.MakeFilepath(d.opts.FS, d.dirname, fileTypeCompactionCheckpoint, cp.fileNum)
+	f, err := d.opts.FS.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := d.opts.FS.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return d.dataDir.Sync()
+}
+
+// releaseCompactionCheckpoint marks the checkpoint file of a completed or
+// abandoned compaction as obsolete. If the compaction was abandoned, the
+// output tables that it completed before being resumed are marked obsolete
+// too. The output tables written since the compaction was resumed are
+// removed by the compaction itself.
+//
+// d.mu must be held when calling this method.
+func (d *DB) releaseCompactionCheckpoint(cp *compactionCheckpoint, abandoned bool) {
+	d.mu.versions.obsoleteCompactionCheckpoints = append(
+		d.mu.versions.obsoleteCompactionCheckpoints, fileInfo{FileNum: cp.fileNum})
+	if !abandoned {
+		return
+	}
+	for _, e := range cp.outputs {
+		d.mu.versions.obsoleteTables = append(d.mu.versions.obsoleteTables, fileInfo{
+			FileNum:  e.Meta.FileBacking.DiskFileNum,
+			FileSize: e.Meta.Size,
+		})
+	}
+	d.mu.versions.updateObsoleteTableMetricsLocked()
+}
+
+// loadCompactionCheckpoints loads the checkpoints of the compactions that were
+// interrupted before the database was opened. Checkpoints that can no longer
+// be resumed are ignored, leaving their files and output tables to be
+// deleted as obsolete by scanObsoleteFiles.
+//
+// d.mu must be held when calling this method.
+func (d *DB) loadCompactionCheckpoints(list []string) {
+	for _, filename := range list {
+		ft, fileNum, ok := base.ParseFilename(d.opts.FS, filename)
+		if !ok || ft != fileTypeCompactionCheckpoint {
+			continue
+		}
+		cp, err := d.readCompactionCheckpoint(fileNum)
+		if err != nil {
+			d.opts.Logger.Infof("pebble: discarding compaction checkpoint %s: %s", fileNum, err)
+			continue
+		}
+		d.mu.compact.resumable = append(d.mu.compact.resumable, cp)
+	}
+}
+
+// readCompactionCheckpoint reads and validates the checkpoint file with the
+// given file number. It returns an error if the checkpoint's input tables are
+// no longer in the current version, or if any of its output tables are
+// missing.
+func (d *DB) readCompactionCheckpoint(fileNum base.DiskFileNum) (*compactionCheckpoint, error) {
+	path := base.MakeFilepath(d.opts.FS, d.dirname, fileTypeCompactionCheckpoint, fileNum)
+	f, err := d.opts.FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err = firstError(err, f.Close()); err != nil {
+		return nil, err
+	}
+	var ve versionEdit
+	if err := ve.Decode(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if len(ve.DeletedFiles) == 0 || len(ve.NewFiles) == 0 {
+		return nil, base.CorruptionErrorf("pebble: compaction checkpoint %s is empty", fileNum)
+	}
+
+	cp := &compactionCheckpoint{
+		fileNum: fileNum,
+		inputs:  make(map[deletedFileEntry]*fileMetadata, len(ve.DeletedFiles)),
+		outputs: ve.NewFiles,
+		written: len(ve.NewFiles),
+	}
+	v := d.mu.versions.currentVersion()
+	for e := range ve.DeletedFiles {
+		if e.Level <= 0 || e.Level >= numLevels {
+			return nil, base.CorruptionErrorf("pebble: compaction checkpoint %s has input table in L%d", fileNum, e.Level)
+		}
+		iter := v.Levels[e.Level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if f.FileNum == e.FileNum {
+				cp.inputs[e] = f
+				break
+			}
+		}
+		if cp.inputs[e] == nil {
+			return nil, errors.Errorf("input table %s is no longer in L%d", e.FileNum, e.Level)
+		}
+	}
+	for _, e := range cp.outputs {
+		if e.Meta.Virtual {
+			return nil, base.CorruptionErrorf("pebble: compaction checkpoint %s has virtual output table", fileNum)
+		}
+		objMeta, err := d.objProvider.Lookup(fileTypeTable, e.Meta.FileBacking.DiskFileNum)
+		if err != nil {
+			return nil, err
+		}
+		if size, err := d.objProvider.Size(objMeta); err != nil {
+			return nil, err
+		} else if uint64(size) != e.Meta.Size {
+			return nil, errors.Errorf("output table %s has size %d, expected %d",
+				e.Meta.FileNum, size, e.Meta.Size)
+		}
+	}
+	return cp, nil
+}
+
+// maybeScheduleResumedCompactions resumes the compactions of the loaded
+// checkpoints for which compaction slots are available. Checkpoints that
+// conflict with in-progress compactions are retained and retried later, and
+// checkpoints that can no longer be resumed are abandoned.
+//
+// d.mu must be held when calling this method.
+func (d *DB) maybeScheduleResumedCompactions(env compactionEnv, maxConcurrentCompactions int) {
+	var retained []*compactionCheckpoint
+	for _, cp := range d.mu.compact.resumable {
+		if d.mu.compact.compactingCount >= maxConcurrentCompactions {
+			retained = append(retained, cp)
+			continue
+		}
+		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
+		pc, retryLater := pickResumedCompaction(
+			d.mu.versions.currentVersion(), d.opts, env, d.mu.versions.picker.getBaseLevel(), cp)
+		switch {
+		case pc != nil:
+			c := newCompaction(pc, d.opts, d.timeNow(), d.ObjProvider())
+			d.mu.versions.metrics.Compact.ResumedCount++
+			d.mu.compact.compactingCount++
+			d.addInProgressCompaction(c)
+			go d.compact(c, nil)
+		case retryLater:
+			retained = append(retained, cp)
+		default:
+			d.opts.Logger.Infof("pebble: abandoning compaction checkpoint %s", cp.fileNum)
+			d.releaseCompactionCheckpoint(cp, true /* abandoned */)
+		}
+	}
+	d.mu.compact.resumable = retained
+}
+
+// pickResumedCompaction reconstructs the compaction of the checkpoint cp. If
+// the compaction can't be resumed, pickResumedCompaction returns a nil
+// compaction and retryLater is true if the compaction conflicts with an
+// in-progress compaction.
+func pickResumedCompaction(
+	vers *version, opts *Options, env compactionEnv, baseLevel int, cp *compactionCheckpoint,
+) (pc *pickedCompaction, retryLater bool) {
+	outputLevel := cp.outputs[0].Level
+	startLevel := outputLevel - 1
+	var startFiles, outputFiles []*fileMetadata
+	for e := range cp.inputs {
+		switch e.Level {
+		case startLevel:
+			startFiles = append(startFiles, cp.inputs[e])
+		case outputLevel:
+			outputFiles = append(outputFiles, cp.inputs[e])
+		default:
+			return nil, false
+		}
+	}
+	for _, f := range startFiles {
+		if !vers.Contains(startLevel, f) {
+			return nil, false
+		}
+	}
+	for _, f := range outputFiles {
+		if !vers.Contains(outputLevel, f) {
+			return nil, false
+		}
+	}
+	if len(startFiles) == 0 || startLevel < baseLevel {
+		return nil, false
+	}
+
+	pc = newPickedCompaction(opts, vers, startLevel, outputLevel, baseLevel)
+	pc.checkpoint = cp
+	pc.startLevel.files = manifest.NewLevelSliceKeySorted(pc.cmp, startFiles)
+	pc.outputLevel.files = manifest.NewLevelSliceKeySorted(pc.cmp, outputFiles)
+	pc.smallest, pc.largest = manifest.KeyRange(pc.cmp,
+		pc.startLevel.files.Iter(), pc.outputLevel.files.Iter())
+	// The checkpointed output tables replace the tables in the output level
+	// that overlap the compaction, so no other tables may have been added to
+	// the output level within the compaction's bounds.
+	overlaps := vers.Overlaps(outputLevel, pc.smallest.UserKey, pc.largest.UserKey,
+		pc.largest.IsExclusiveSentinel())
+	if overlaps.Len() != len(outputFiles) {
+		return nil, false
+	}
+	if inputRangeAlreadyCompacting(env, pc) {
+		return nil, true
+	}
+	return pc, false
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumableCompaction(t *testing.T) {
+	run := func(t *testing.T, removeOutput bool) {
+		fs := vfs.NewStrictMem()
+		var armed atomic.Bool
+		var created atomic.Int32
+		opts := (&Options{
+			FS:                          fs,
+			DebugCheck:                  DebugCheckLevels,
+			DisableAutomaticCompactions: true,
+			FormatMajorVersion:          FormatNewest,
+			EventListener: &EventListener{
+				TableCreated: func(info TableCreateInfo) {
+					// Simulate a crash once the compaction has finished two
+					// output tables by ignoring all subsequent syncs.
+					if armed.Load() && info.Reason == "compacting" && created.Add(1) == 3 {
+						fs.SetIgnoreSyncs(true)
+					}
+				},
+			},
+		}).WithFSDefaults()
+		opts.Levels = make([]LevelOptions, numLevels)
+		for i := range opts.Levels {
+			opts.Levels[i] = LevelOptions{BlockSize: 512, TargetFileSize: 4 << 10}
+		}
+		opts.Experimental.ResumableCompactionThreshold = 1
+		opts.Experimental.ResumableCompactionCheckpointInterval = time.Nanosecond
+		opts.Experimental.MultiLevelCompactionHeuristic = NoMultiLevel{}
+		opts.private.testingAlwaysWaitForCleanup = true
+
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key%04d", i)) }
+		value := func(v string) []byte { return bytes.Repeat([]byte(v), 100) }
+		const numKeys = 1000
+
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		d.mu.Lock()
+		d.mu.versions.dynamicBaseLevel = false
+		d.mu.versions.picker.forceBaseLevel1()
+		d.mu.Unlock()
+		for i := 0; i < numKeys; i++ {
+			require.NoError(t, d.Set(key(i), value("a"), nil))
+		}
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.manualCompact(key(0), key(numKeys), 0, false /* parallelize */))
+		require.NoError(t, d.manualCompact(key(0), key(numKeys), 1, false /* parallelize */))
+		for i := 0; i < numKeys; i += 2 {
+			require.NoError(t, d.Set(key(i), value("b"), nil))
+		}
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.manualCompact(key(0), key(numKeys), 0, false /* parallelize */))
+		m := d.Metrics()
+		require.Less(t, int64(0), m.Levels[1].NumFiles)
+		require.Less(t, int64(0), m.Levels[2].NumFiles)
+
+		// Compact L1 into L2, crashing partway through the compaction.
+		armed.Store(true)
+		require.NoError(t, d.manualCompact(key(0), key(numKeys), 1, false /* parallelize */))
+		require.NoError(t, d.Close())
+		fs.ResetToSyncedState()
+		fs.SetIgnoreSyncs(false)
+		armed.Store(false)
+
+		// A checkpoint of the two completed output tables remains.
+		var checkpoints []string
+		ls, err := fs.List("")
+		require.NoError(t, err)
+		for _, filename := range ls {
+			if ft, _, ok := base.ParseFilename(fs, filename); ok && ft == fileTypeCompactionCheckpoint {
+				checkpoints = append(checkpoints, filename)
+			}
+		}
+		require.Len(t, checkpoints, 1)
+		f, err := fs.Open(checkpoints[0])
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		var ve versionEdit
+		require.NoError(t, ve.Decode(bytes.NewReader(data)))
+		require.Len(t, ve.NewFiles, 2)
+		if removeOutput {
+			// A checkpoint with a missing output table is discarded.
+			require.NoError(t, fs.Remove(base.MakeFilename(fileTypeTable, ve.NewFiles[0].Meta.FileBacking.DiskFileNum)))
+		}
+
+		d, err = Open("", opts)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+		d.mu.Lock()
+		if removeOutput {
+			require.Len(t, d.mu.compact.resumable, 0)
+		} else {
+			require.Len(t, d.mu.compact.resumable, 1)
+			require.Len(t, d.mu.compact.resumable[0].outputs, 2)
+		}
+		d.mu.versions.dynamicBaseLevel = false
+		d.mu.versions.picker.forceBaseLevel1()
+		d.opts.DisableAutomaticCompactions = false
+		d.maybeScheduleCompaction()
+		for d.mu.compact.compactingCount > 0 {
+			d.mu.compact.cond.Wait()
+		}
+		d.opts.DisableAutomaticCompactions = true
+		require.Len(t, d.mu.compact.resumable, 0)
+		d.mu.Unlock()
+
+		m = d.Metrics()
+		if removeOutput {
+			require.Equal(t, int64(0), m.Compact.ResumedCount)
+		} else {
+			// The resumed compaction installed the checkpointed output tables.
+			require.Equal(t, int64(1), m.Compact.ResumedCount)
+			require.Equal(t, int64(0), m.Levels[1].NumFiles)
+			d.mu.Lock()
+			v := d.mu.versions.currentVersion()
+			d.mu.Unlock()
+			for _, e := range ve.NewFiles {
+				var found bool
+				iter := v.Levels[2].Iter()
+				for f := iter.First(); f != nil; f = iter.Next() {
+					found = found || f.FileNum == e.Meta.FileNum
+				}
+				require.True(t, found, "checkpointed output %s not found in L2", e.Meta.FileNum)
+			}
+		}
+
+		// The checkpoint is removed, along with any unused output tables.
+		ls, err = fs.List("")
+		require.NoError(t, err)
+		require.NotContains(t, ls, checkpoints[0])
+		if removeOutput {
+			require.NotContains(t, ls, base.MakeFilename(fileTypeTable, ve.NewFiles[1].Meta.FileBacking.DiskFileNum))
+		}
+
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var n int
+		for valid := iter.First(); valid; valid = iter.Next() {
+			v := "a"
+			if n%2 == 0 {
+				v = "b"
+			}
+			require.Equal(t, key(n), iter.Key())
+			require.Equal(t, value(v), iter.Value())
+			n++
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, numKeys, n)
+	}
+
+	t.Run("resume", func(t *testing.T) { run(t, false /* removeOutput */) })
+	t.Run("discard", func(t *testing.T) { run(t, true /* removeOutput */) })
+}
+
+func TestCompactionTruncateSpans(t *testing.T) {
+	span := func(start, end string) keyspan.Span {
+		return keyspan.Span{
+			Start: []byte(start),
+			End:   []byte(end),
+			Keys:  []keyspan.Key{{Trailer: base.MakeTrailer(1, base.InternalKeyKindRangeDelete)}},
+		}
+	}
+	spans := []keyspan.Span{span("a", "c"), span("c", "e"), span("e", "f")}
+	for _, tc := range []struct {
+		exclusive bool
+		want      []string
+	}{
+		{exclusive: false, want: []string{"c-e", "e-f"}},
+		{exclusive: true, want: []string{"c\x00-e", "e-f"}},
+	} {
+		c := &compaction{
+			cmp:            DefaultComparer.Compare,
+			comparer:       DefaultComparer,
+			lower:          []byte("c"),
+			lowerExclusive: tc.exclusive,
+		}
+		iter := c.truncateSpans(keyspan.NewIter(c.cmp, spans))
+		var got []string
+		s, err := iter.First()
+		for ; s != nil; s, err = iter.Next() {
+			got = append(got, fmt.Sprintf("%s-%s", s.Start, s.End))
+		}
+		require.NoError(t, err)
+		iter.Close()
+		require.Equal(t, tc.want, got)
+	}
+}
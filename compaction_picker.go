@@ -10,6 +10,7 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -37,6 +38,13 @@ type compactionEnv struct {
 	earliestSnapshotSeqNum  uint64
 	inProgressCompactions   []compactionInfo
 	readCompactionEnv       readCompactionEnv
+	// now is the current time, used to determine which tables are old enough
+	// to warrant an age-based compaction. If zero, age-based compactions are
+	// not picked.
+	now time.Time
+	// deferNonUrgent is true if compactions that don't help the LSM keep up
+	// with writes should be deferred. See DB.SetCompactionWindows.
+	deferNonUrgent bool
 }
 
 type compactionPicker interface {
@@ -64,6 +72,7 @@ type compactionInfo struct {
 	// been committed. The compaction may still be in-progress deleting newly
 	// obsolete files.
 	versionEditApplied bool
+	kind               compactionKind
 	inputs             []compactionLevel
 	outputLevel        int
 	smallest           InternalKey
@@ -224,6 +233,10 @@ type pickedCompaction struct {
 	largest       InternalKey
 	version       *version
 	pickerMetrics compactionPickerMetrics
+	// checkpoint is set if the compaction resumes an interrupted compaction.
+	checkpoint *compactionCheckpoint
+	// hint is set if the compaction was picked for a compaction hint.
+	hint *readCompaction
 }
 
 func defaultOutputLevel(startLevel, baseLevel int) int {
@@ -1195,6 +1208,12 @@ func responsibleForGarbageBytes(virtualBackings *manifest.VirtualBackings, m *fi
 // If a score-based compaction cannot be found, pickAuto falls back to looking
 // for an elision-only compaction to remove obsolete keys.
 func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompaction) {
+	// High-priority compaction hints take precedence over all other
+	// compactions.
+	if pc := p.pickHintedCompaction(env, CompactionPriorityHigh); pc != nil {
+		return pc
+	}
+
 	// Compaction concurrency is controlled by L0 read-amp. We allow one
 	// additional compaction per L0CompactionConcurrency sublevels, as well as
 	// one additional compaction per CompactionDebtConcurrency bytes of
@@ -1316,6 +1335,12 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		}
 	}
 
+	// The remaining compactions don't help us keep up with writes, and are
+	// deferred outside of the compaction windows.
+	if env.deferNonUrgent {
+		return nil
+	}
+
 	// Check for L6 files with tombstones that may be elided. These files may
 	// exist if a snapshot prevented the elision of a tombstone or because of
 	// a move compaction. These are low-priority compactions because they
@@ -1324,6 +1349,17 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		return pc
 	}
 
+	// Check for tables with runs of point tombstones that slow down
+	// iteration. Compacting them drops the tombstones, or at least moves them
+	// closer to the data they delete.
+	if pc := p.pickTombstoneDensityCompaction(env); pc != nil {
+		return pc
+	}
+
+	if pc := p.pickHintedCompaction(env, CompactionPriorityLow); pc != nil {
+		return pc
+	}
+
 	if pc := p.pickReadTriggeredCompaction(env); pc != nil {
 		return pc
 	}
@@ -1346,6 +1382,13 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		*env.readCompactionEnv.rescheduleReadCompaction = true
 	}
 
+	// Look for tables that have outlived the configured maximum table age.
+	// These compactions bound how long deleted or overwritten data may remain
+	// on disk, but they don't help us keep up with writes.
+	if pc := p.pickAgeCompaction(env); pc != nil {
+		return pc
+	}
+
 	// At the lowest possible compaction-picking priority, look for files marked
 	// for compaction. Pebble will mark files for compaction if they have atomic
 	// compaction units that span multiple files. While current Pebble code does
@@ -1534,6 +1577,249 @@ func (p *compactionPickerByScore) pickElisionOnlyCompaction(
 	return nil
 }
 
+// pickTombstoneDensityCompaction looks for the table with the highest fraction
+// of tombstone-dense data blocks at or above
+// Options.Experimental.TombstoneDenseCompactionThreshold. A table in the
+// bottommost level is rewritten in place, eliding its tombstones, while a table
+// in a higher level is compacted into the next level, where its tombstones may
+// drop the keys they delete. L0 tables are not considered, because L0 is
+// compacted as files accumulate.
+func (p *compactionPickerByScore) pickTombstoneDensityCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	threshold := p.opts.Experimental.TombstoneDenseCompactionThreshold
+	if threshold <= 0 {
+		return nil
+	}
+	var candidate *fileMetadata
+	var level int
+	for l := p.baseLevel; l < numLevels; l++ {
+		v := p.vers.Levels[l].Annotation(tombstoneDenseAnnotator{threshold: threshold})
+		if v == nil {
+			continue
+		}
+		f := v.(*fileMetadata)
+		if candidate == nil || f.Stats.TombstoneDenseBlocksRatio > candidate.Stats.TombstoneDenseBlocksRatio {
+			candidate, level = f, l
+		}
+	}
+	if candidate == nil || candidate.IsCompacting() {
+		return nil
+	}
+	// Tombstones in the bottommost level can only be elided once no snapshot
+	// requires them.
+	if level == numLevels-1 && candidate.LargestSeqNum >= env.earliestSnapshotSeqNum {
+		return nil
+	}
+	lf := p.vers.Levels[level].Find(p.opts.Comparer.Compare, candidate)
+	if lf == nil {
+		panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, level))
+	}
+	if level == numLevels-1 {
+		pc = newPickedCompaction(p.opts, p.vers, level, level, p.baseLevel)
+		pc.startLevel.files = lf.Slice()
+		if anyTablesCompacting(pc.startLevel.files) {
+			return nil
+		}
+		pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
+	} else {
+		pc = pickAutoLPositive(env, p.opts, p.vers, candidateLevelInfo{
+			level:       level,
+			outputLevel: defaultOutputLevel(level, p.baseLevel),
+			file:        *lf,
+		}, p.baseLevel, p.levelMaxBytes)
+		if pc == nil {
+			return nil
+		}
+	}
+	pc.kind = compactionKindTombstoneDensity
+	// Fail-safe to protect against compacting the same sstable concurrently.
+	if inputRangeAlreadyCompacting(env, pc) {
+		return nil
+	}
+	return pc
+}
+
+// oldestFileAnnotator implements the manifest.Annotator interface, annotating
+// B-Tree nodes with the *fileMetadata of the file with the earliest creation
+// time within the subtree. Files with an unknown creation time are ignored.
+type oldestFileAnnotator struct{}
+
+var _ manifest.Annotator = oldestFileAnnotator{}
+
+func (a oldestFileAnnotator) Zero(interface{}) interface{} {
+	return nil
+}
+
+func (a oldestFileAnnotator) Accumulate(f *fileMetadata, dst interface{}) (interface{}, bool) {
+	if f.CreationTime == 0 {
+		return dst, true
+	}
+	return oldestMergeHelper(f, dst), true
+}
+
+func (a oldestFileAnnotator) Merge(v interface{}, accum interface{}) interface{} {
+	if v == nil {
+		return accum
+	}
+	return oldestMergeHelper(v.(*fileMetadata), accum)
+}
+
+func oldestMergeHelper(f *fileMetadata, dst interface{}) interface{} {
+	if dst == nil || dst.(*fileMetadata).CreationTime > f.CreationTime {
+		return f
+	}
+	return dst
+}
+
+// maxTableAge returns the age beyond which tables in the provided level are
+// compacted by an age-based compaction, or zero if age-based compactions are
+// disabled for the level.
+func maxTableAge(opts *Options, level int) time.Duration {
+	age := opts.Experimental.PeriodicCompactionInterval
+	if level < numLevels-1 {
+		if a := opts.Experimental.MaxTableAge; a > 0 && (age == 0 || a < age) {
+			age = a
+		}
+	}
+	return age
+}
+
+// tableOverdue returns true if the table f is older than the provided maximum
+// age. Tables with an unknown creation time are never overdue.
+func tableOverdue(f *fileMetadata, now time.Time, maxAge time.Duration) bool {
+	return maxAge > 0 && f.CreationTime != 0 && now.Sub(time.Unix(f.CreationTime, 0)) > maxAge
+}
+
+// overdueFilesGranularity is the granularity of the creation time before which
+// overdueFilesAnnotator considers tables overdue. Coarsening the cutoff allows
+// the annotations to be reused across calls, at the cost of reporting tables
+// as overdue up to a minute late.
+const overdueFilesGranularity = 60 // seconds
+
+// overdueFiles is the annotation of overdueFilesAnnotator.
+type overdueFiles struct {
+	count int
+	bytes uint64
+}
+
+// overdueFilesAnnotator implements the manifest.Annotator interface,
+// annotating B-Tree nodes with the count and total size of the files created
+// before cutoff within the subtree. Files with an unknown creation time are
+// ignored. Annotations are cached under the annotator's address, so the cached
+// annotations must be invalidated when the cutoff changes: see count.
+type overdueFilesAnnotator struct {
+	cutoff int64
+}
+
+var _ manifest.Annotator = (*overdueFilesAnnotator)(nil)
+
+func (a *overdueFilesAnnotator) Zero(dst interface{}) interface{} {
+	if dst == nil {
+		return &overdueFiles{}
+	}
+	v := dst.(*overdueFiles)
+	*v = overdueFiles{}
+	return v
+}
+
+func (a *overdueFilesAnnotator) Accumulate(f *fileMetadata, dst interface{}) (interface{}, bool) {
+	v := dst.(*overdueFiles)
+	if f.CreationTime != 0 && f.CreationTime < a.cutoff {
+		v.count++
+		v.bytes += f.Size
+	}
+	return v, true
+}
+
+func (a *overdueFilesAnnotator) Merge(src interface{}, dst interface{}) interface{} {
+	srcV, dstV := src.(*overdueFiles), dst.(*overdueFiles)
+	dstV.count += srcV.count
+	dstV.bytes += srcV.bytes
+	return dstV
+}
+
+// count returns the count and total size of the files of the level that are
+// overdue at the provided time, given the level's maximum table age.
+//
+// REQUIRES: d.mu is held, and the annotator is only used with this level of
+// the current version.
+func (a *overdueFilesAnnotator) count(
+	lm *manifest.LevelMetadata, now time.Time, maxAge time.Duration,
+) (files int, bytes uint64) {
+	if maxAge <= 0 {
+		return 0, 0
+	}
+	cutoff := now.Add(-maxAge).Unix()
+	cutoff -= cutoff % overdueFilesGranularity
+	if cutoff != a.cutoff {
+		lm.InvalidateAnnotation(a)
+		a.cutoff = cutoff
+	}
+	v := lm.Annotation(a).(*overdueFiles)
+	return v.count, v.bytes
+}
+
+// pickAgeCompaction looks for a table whose age exceeds the maximum table age
+// of its level (see Options.Experimental.MaxTableAge and
+// PeriodicCompactionInterval). A table in the bottommost level is rewritten in
+// place, while a table in a higher level is compacted into the next level.
+// L0 tables are not considered, because L0 is compacted as files accumulate.
+func (p *compactionPickerByScore) pickAgeCompaction(env compactionEnv) (pc *pickedCompaction) {
+	if env.now.IsZero() {
+		return nil
+	}
+	// Age-based compactions are never urgent, so only one is permitted to run
+	// at a time to limit their impact on foreground traffic.
+	for i := range env.inProgressCompactions {
+		if env.inProgressCompactions[i].kind == compactionKindAge {
+			return nil
+		}
+	}
+	for l := p.baseLevel; l < numLevels; l++ {
+		maxAge := maxTableAge(p.opts, l)
+		if maxAge == 0 {
+			continue
+		}
+		v := p.vers.Levels[l].Annotation(oldestFileAnnotator{})
+		if v == nil {
+			continue
+		}
+		candidate := v.(*fileMetadata)
+		if candidate.IsCompacting() || !tableOverdue(candidate, env.now, maxAge) {
+			continue
+		}
+		lf := p.vers.Levels[l].Find(p.opts.Comparer.Compare, candidate)
+		if lf == nil {
+			panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, l))
+		}
+
+		if l == numLevels-1 {
+			pc = newPickedCompaction(p.opts, p.vers, l, l, p.baseLevel)
+			pc.startLevel.files = lf.Slice()
+			if anyTablesCompacting(pc.startLevel.files) {
+				continue
+			}
+			pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
+		} else {
+			pc = pickAutoLPositive(env, p.opts, p.vers, candidateLevelInfo{
+				level:       l,
+				outputLevel: defaultOutputLevel(l, p.baseLevel),
+				file:        *lf,
+			}, p.baseLevel, p.levelMaxBytes)
+			if pc == nil {
+				continue
+			}
+		}
+		pc.kind = compactionKindAge
+		// Fail-safe to protect against compacting the same sstable concurrently.
+		if !inputRangeAlreadyCompacting(env, pc) {
+			return pc
+		}
+	}
+	return nil
+}
+
 // pickRewriteCompaction attempts to construct a compaction that
 // rewrites a file marked for compaction. pickRewriteCompaction will
 // pull in adjacent files in the file's atomic compaction unit if
@@ -0,0 +1,252 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// CompactionPriority is the priority of a CompactionHint.
+type CompactionPriority int8
+
+const (
+	// CompactionPriorityLow hints are compacted when no score-based
+	// compaction is necessary, similarly to read-triggered compactions. They
+	// are deferred outside of the DB's compaction windows.
+	CompactionPriorityLow CompactionPriority = iota
+	// CompactionPriorityHigh hints are compacted ahead of score-based
+	// compactions, and are never deferred.
+	CompactionPriorityHigh
+)
+
+// String implements fmt.Stringer.
+func (p CompactionPriority) String() string {
+	switch p {
+	case CompactionPriorityLow:
+		return "low"
+	case CompactionPriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("CompactionPriority(%d)", int8(p))
+	}
+}
+
+// CompactionHint suggests that the keys within [Start, End] be compacted.
+type CompactionHint struct {
+	Start, End []byte
+	Priority   CompactionPriority
+	// Reason describes why the span should be compacted. It's reported as
+	// the Hint of the CompactionInfo of the resulting compactions.
+	Reason string
+}
+
+// AddCompactionHint suggests that the keys within the hint's span be
+// compacted, without requiring automatic compactions to be disabled as
+// DB.Compact does. The span is compacted one level at a time, starting with
+// the highest level containing tables that overlap the span, until it has
+// been compacted into the bottommost level. Hints enter the queue of
+// read-triggered compactions, where they remain until compacted, and
+// AddCompactionHint returns an error if maxQueuedCompactionHints hints are
+// already queued.
+func (d *DB) AddCompactionHint(hint CompactionHint) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if d.cmp(hint.Start, hint.End) > 0 {
+		return errors.Errorf("pebble: compaction hint start %s is greater than end %s",
+			d.opts.Comparer.FormatKey(hint.Start), d.opts.Comparer.FormatKey(hint.End))
+	}
+	rc := &readCompaction{
+		start:    append([]byte(nil), hint.Start...),
+		end:      append([]byte(nil), hint.End...),
+		priority: hint.Priority,
+		reason:   hint.Reason,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.mu.compact.readCompactions.addHint(rc) {
+		return errors.Errorf("pebble: too many queued compaction hints (%d)", maxQueuedCompactionHints)
+	}
+	d.maybeScheduleCompaction()
+	return nil
+}
+
+// maxQueuedCompactionHints is the maximum number of compaction hints awaiting
+// compaction.
+const maxQueuedCompactionHints = 64
+
+// CompactionWindow is a daily interval of time during which deferrable
+// compactions may run. See DB.SetCompactionWindows.
+type CompactionWindow struct {
+	// Start and End are the offsets from midnight at which the window opens
+	// and closes. If End is less than Start, the window spans midnight.
+	Start, End time.Duration
+	// Location is the time zone of the window. If nil, UTC is used.
+	Location *time.Location
+}
+
+// Contains returns true if the time t falls within the window.
+func (w CompactionWindow) Contains(t time.Time) bool {
+	offset := t.Sub(w.midnight(t))
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// untilOpen returns the duration from the time t until the window next opens,
+// or zero if the window contains t.
+func (w CompactionWindow) untilOpen(t time.Time) time.Duration {
+	if w.Contains(t) {
+		return 0
+	}
+	midnight := w.midnight(t)
+	open := midnight.Add(w.Start)
+	if !open.After(t) {
+		open = midnight.AddDate(0, 0, 1).Add(w.Start)
+	}
+	return open.Sub(t)
+}
+
+func (w CompactionWindow) midnight(t time.Time) time.Time {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// SetCompactionWindows restricts the automatic compactions that don't help
+// the LSM keep up with writes to the given daily windows. Outside of the
+// windows, only score-based compactions and high-priority compaction hints
+// are run, while elision-only, tombstone-density, read-triggered, age-based
+// and rewrite compactions and low-priority compaction hints are deferred
+// until a window opens. Calling SetCompactionWindows without any windows
+// removes the restriction.
+func (d *DB) SetCompactionWindows(windows ...CompactionWindow) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	for _, w := range windows {
+		if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End >= 24*time.Hour {
+			return errors.Errorf("pebble: compaction window [%s, %s) is not within a day", w.Start, w.End)
+		}
+		if w.Start == w.End {
+			return errors.Errorf("pebble: compaction window [%s, %s) is empty", w.Start, w.End)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.compact.windows = slices.Clone(windows)
+	d.maybeScheduleCompaction()
+	return nil
+}
+
+// deferNonUrgentCompactionsLocked returns true if compactions that don't help
+// the LSM keep up with writes should be deferred because none of the
+// compaction windows contain the time now. If so, it arranges for compactions
+// to be scheduled when the next window opens.
+//
+// d.mu must be held when calling this method.
+func (d *DB) deferNonUrgentCompactionsLocked(now time.Time) bool {
+	if len(d.mu.compact.windows) == 0 {
+		return false
+	}
+	untilOpen := d.mu.compact.windows[0].untilOpen(now)
+	for _, w := range d.mu.compact.windows[1:] {
+		untilOpen = min(untilOpen, w.untilOpen(now))
+	}
+	if untilOpen == 0 {
+		return false
+	}
+	if d.mu.compact.windowTimer == nil {
+		d.mu.compact.windowTimer = time.AfterFunc(untilOpen, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.mu.compact.windowTimer = nil
+			d.maybeScheduleCompaction()
+		})
+	}
+	return true
+}
+
+// pickHintedCompaction picks a compaction for the oldest compaction hint with
+// the given priority in the read compaction queue. Hints whose span conflicts
+// with an in-progress compaction remain queued in place.
+func (p *compactionPickerByScore) pickHintedCompaction(
+	env compactionEnv, priority CompactionPriority,
+) *pickedCompaction {
+	qu := env.readCompactionEnv.readCompactions
+	if qu == nil {
+		return nil
+	}
+	for i := 0; i < len(qu.hints); i++ {
+		rc := qu.hints[i]
+		if rc.priority != priority {
+			continue
+		}
+		pc, retryLater := pickHintedCompactionHelper(p, rc, env)
+		if retryLater {
+			continue
+		}
+		qu.hints = slices.Delete(qu.hints, i, i+1)
+		if pc == nil {
+			// No tables overlap the span above the bottommost level.
+			i--
+			continue
+		}
+		if pc.outputLevel.level < numLevels-1 {
+			// Continue from the output level once the compaction completes.
+			qu.hints = append(qu.hints, &readCompaction{
+				level:    pc.outputLevel.level,
+				start:    rc.start,
+				end:      rc.end,
+				priority: rc.priority,
+				reason:   rc.reason,
+			})
+		}
+		return pc
+	}
+	return nil
+}
+
+// pickHintedCompactionHelper picks a compaction of the span of the compaction
+// hint rc from the highest level at or below rc.level that contains
+// overlapping tables. If the span conflicts with an in-progress compaction,
+// retryLater is true.
+func pickHintedCompactionHelper(
+	p *compactionPickerByScore, rc *readCompaction, env compactionEnv,
+) (pc *pickedCompaction, retryLater bool) {
+	for level := rc.level; level < numLevels-1; level++ {
+		pc, retryLater = pickManualCompaction(p.vers, p.opts, env, p.baseLevel, &manualCompaction{
+			level: level,
+			start: rc.start,
+			end:   rc.end,
+		})
+		if retryLater {
+			return nil, true
+		}
+		if pc != nil {
+			break
+		}
+	}
+	if pc == nil {
+		return nil, false
+	}
+	pc.kind = compactionKindHint
+	pc.hint = rc
+	return pc, false
+}
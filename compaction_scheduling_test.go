@@ -0,0 +1,153 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactionWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	testCases := []struct {
+		window    CompactionWindow
+		t         time.Time
+		contains  bool
+		untilOpen time.Duration
+	}{
+		{CompactionWindow{Start: 2 * time.Hour, End: 4 * time.Hour}, at(3, 0), true, 0},
+		{CompactionWindow{Start: 2 * time.Hour, End: 4 * time.Hour}, at(2, 0), true, 0},
+		{CompactionWindow{Start: 2 * time.Hour, End: 4 * time.Hour}, at(4, 0), false, 22 * time.Hour},
+		{CompactionWindow{Start: 2 * time.Hour, End: 4 * time.Hour}, at(1, 30), false, 30 * time.Minute},
+		// A window spanning midnight.
+		{CompactionWindow{Start: 22 * time.Hour, End: 2 * time.Hour}, at(23, 0), true, 0},
+		{CompactionWindow{Start: 22 * time.Hour, End: 2 * time.Hour}, at(1, 0), true, 0},
+		{CompactionWindow{Start: 22 * time.Hour, End: 2 * time.Hour}, at(12, 0), false, 10 * time.Hour},
+		// A window in another time zone.
+		{CompactionWindow{Start: 2 * time.Hour, End: 4 * time.Hour, Location: time.FixedZone("", 3600)}, at(1, 30), true, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s-%s@%s", tc.window.Start, tc.window.End, tc.t.Format(time.Kitchen)), func(t *testing.T) {
+			require.Equal(t, tc.contains, tc.window.Contains(tc.t))
+			require.Equal(t, tc.untilOpen, tc.window.untilOpen(tc.t))
+		})
+	}
+}
+
+func TestCompactionHint(t *testing.T) {
+	var mu sync.Mutex
+	var infos []CompactionInfo
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		EventListener: &EventListener{
+			CompactionEnd: func(info CompactionInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				infos = append(infos, info)
+			},
+		},
+	}).WithFSDefaults()
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// The fake clock starts outside of the compaction window.
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.mu.Lock()
+	d.timeNow = func() time.Time { return now }
+	d.mu.Unlock()
+	require.NoError(t, d.SetCompactionWindows(CompactionWindow{Start: 2 * time.Hour, End: 4 * time.Hour}))
+	require.Error(t, d.SetCompactionWindows(CompactionWindow{Start: time.Hour, End: time.Hour}))
+	require.Error(t, d.SetCompactionWindows(CompactionWindow{Start: time.Hour, End: 25 * time.Hour}))
+	require.Error(t, d.AddCompactionHint(CompactionHint{Start: []byte("b"), End: []byte("a")}))
+
+	compact := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.opts.DisableAutomaticCompactions = false
+		d.maybeScheduleCompaction()
+		for d.mu.compact.compactingCount > 0 {
+			d.mu.compact.cond.Wait()
+		}
+		d.opts.DisableAutomaticCompactions = true
+	}
+	flush := func(prefix string) {
+		for i := 0; i < 10; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%s%02d", prefix, i)), []byte("v"), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+
+	// A low-priority hint is deferred until the compaction window opens.
+	flush("a")
+	require.NoError(t, d.AddCompactionHint(CompactionHint{
+		Start: []byte("a"), End: []byte("b"), Priority: CompactionPriorityLow, Reason: "low",
+	}))
+	compact()
+	require.Equal(t, int64(1), d.Metrics().Levels[0].NumFiles)
+	require.Equal(t, int64(0), d.Metrics().Compact.HintCount)
+
+	// Read-triggered compactions overlapping the hint don't evict it.
+	d.mu.Lock()
+	for i := 0; i < 2*readCompactionMaxQueueSize; i++ {
+		d.mu.compact.readCompactions.add(&readCompaction{
+			start: []byte("a"), end: []byte(fmt.Sprintf("a%02d", i)),
+		}, d.cmp)
+	}
+	require.Len(t, d.mu.compact.readCompactions.hints, 1)
+	hints := d.mu.compact.readCompactions.hints
+	d.mu.compact.readCompactions = readCompactionQueue{hints: hints}
+	d.mu.Unlock()
+
+	// A high-priority hint isn't deferred, and compacts the span into the
+	// bottommost level.
+	flush("c")
+	require.NoError(t, d.AddCompactionHint(CompactionHint{
+		Start: []byte("c"), End: []byte("d"), Priority: CompactionPriorityHigh, Reason: "high",
+	}))
+	compact()
+	m := d.Metrics()
+	require.Equal(t, int64(1), m.Levels[0].NumFiles)
+	require.Equal(t, int64(1), m.Levels[numLevels-1].NumFiles)
+	require.Less(t, int64(0), m.Compact.HintCount)
+	mu.Lock()
+	require.NotEmpty(t, infos)
+	for _, info := range infos {
+		require.Equal(t, "hint", info.Reason)
+		require.Equal(t, "high", info.Hint)
+	}
+	infos = nil
+	mu.Unlock()
+
+	// Once the window opens, the low-priority hint is compacted.
+	d.mu.Lock()
+	now = now.Add(15 * time.Hour)
+	d.mu.Unlock()
+	compact()
+	m = d.Metrics()
+	require.Equal(t, int64(0), m.Levels[0].NumFiles)
+	require.Equal(t, int64(2), m.Levels[numLevels-1].NumFiles)
+	mu.Lock()
+	require.NotEmpty(t, infos)
+	for _, info := range infos {
+		require.Equal(t, "low", info.Hint)
+	}
+	mu.Unlock()
+
+	// Hints aren't dropped when the queue is full: adding one fails instead.
+	for i := 0; i < maxQueuedCompactionHints; i++ {
+		require.NoError(t, d.AddCompactionHint(CompactionHint{Start: []byte("x"), End: []byte("y")}))
+	}
+	require.Error(t, d.AddCompactionHint(CompactionHint{Start: []byte("x"), End: []byte("y")}))
+}
@@ -849,6 +849,227 @@ func TestCompactionCPUGranterDefault(t *testing.T) {
 	}
 }
 
+// concurrentCPUPermissionGranter is a CPUWorkPermissionGranter that is safe
+// for concurrent use, and always grants permission.
+type concurrentCPUPermissionGranter struct {
+	requests    atomic.Int64
+	outstanding atomic.Int64
+}
+
+func (g *concurrentCPUPermissionGranter) GetPermission(time.Duration) CPUWorkHandle {
+	g.requests.Add(1)
+	g.outstanding.Add(1)
+	return cpuWorkHandle{permit: true}
+}
+
+func (g *concurrentCPUPermissionGranter) CPUWorkDone(CPUWorkHandle) {
+	g.outstanding.Add(-1)
+}
+
+// TestCompactionSubcompactions tests that an L5->L6 compaction is split into
+// subcompactions, and that the combined output of the subcompactions is
+// equivalent to the input, including range deletions and range keys that span
+// subcompaction boundaries.
+func TestCompactionSubcompactions(t *testing.T) {
+	mem := vfs.NewMem()
+	g := &concurrentCPUPermissionGranter{}
+	opts := (&Options{
+		FS:                          mem,
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+		MaxConcurrentCompactions:    func() int { return 4 },
+	}).WithFSDefaults()
+	opts.Levels = make([]LevelOptions, numLevels)
+	for i := range opts.Levels {
+		opts.Levels[i] = LevelOptions{TargetFileSize: 8 << 10, Compression: NoCompression}
+	}
+	opts.Experimental.MaxSubcompactions = 4
+	opts.Experimental.CPUWorkPermissionGranter = g
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	const numKeys = 4000
+	rng := rand.New(rand.NewSource(1))
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+	randValue := func() []byte {
+		v := make([]byte, 100)
+		rng.Read(v)
+		return v
+	}
+
+	// Write all the keys and compact them into L6.
+	expected := make(map[string][]byte)
+	b := d.NewBatch()
+	for i := 0; i < numKeys; i++ {
+		v := randValue()
+		require.NoError(t, b.Set(key(i), v, nil))
+		expected[string(key(i))] = v
+	}
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, d.Compact(key(0), key(numKeys), false /* parallelize */))
+	require.Less(t, int64(1), d.Metrics().Levels[6].NumFiles)
+
+	// Disable the dynamic base level, so that the ingested table below is
+	// placed in L5 rather than L0.
+	d.mu.Lock()
+	d.mu.versions.dynamicBaseLevel = false
+	d.mu.versions.picker.forceBaseLevel1()
+	d.mu.Unlock()
+
+	// Ingest a table that overlaps all of L6 into L5. It updates every fourth
+	// key, deletes a range of keys and sets a range key over the entire
+	// keyspace.
+	f, err := mem.Create("ext")
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f),
+		d.opts.MakeWriterOptions(0, d.FormatMajorVersion().MaxTableFormat()))
+	require.NoError(t, w.DeleteRange(key(1000), key(1500)))
+	for i := 0; i < numKeys; i += 4 {
+		if i >= 1000 && i < 1500 {
+			continue
+		}
+		v := randValue()
+		require.NoError(t, w.Set(key(i), v))
+		expected[string(key(i))] = v
+	}
+	require.NoError(t, w.RangeKeySet(key(0), key(numKeys), []byte("@1"), []byte("foo")))
+	require.NoError(t, w.Close())
+	for i := 1000; i < 1500; i++ {
+		delete(expected, string(key(i)))
+	}
+	require.NoError(t, d.Ingest([]string{"ext"}))
+	require.Equal(t, int64(1), d.Metrics().Levels[5].NumFiles)
+
+	require.NoError(t, d.manualCompact(key(0), key(numKeys), 5, false /* parallelize */))
+	m := d.Metrics()
+	require.Equal(t, int64(0), m.Levels[5].NumFiles)
+	require.Less(t, int64(1), m.Compact.SubcompactionCount)
+	require.Equal(t, int64(0), g.outstanding.Load())
+	require.NoError(t, d.CheckLevels(nil))
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var n int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		v, ok := expected[string(iter.Key())]
+		require.True(t, ok, "unexpected key %q", iter.Key())
+		require.Equal(t, v, iter.Value())
+		n++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, len(expected), n)
+
+	iter, err = d.NewIter(&IterOptions{KeyTypes: IterKeyTypeRangesOnly})
+	require.NoError(t, err)
+	require.True(t, iter.First())
+	start, end := iter.RangeBounds()
+	require.Equal(t, key(0), start)
+	require.Equal(t, key(numKeys), end)
+	require.Equal(t, []RangeKeyData{{Suffix: []byte("@1"), Value: []byte("foo")}}, iter.RangeKeys())
+	require.False(t, iter.Next())
+	require.NoError(t, iter.Close())
+}
+
+func TestCompactionAgeBased(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := (&Options{
+		FS:                          mem,
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+	}).WithFSDefaults()
+	opts.Experimental.MaxTableAge = time.Hour
+	opts.Experimental.PeriodicCompactionInterval = 24 * time.Hour
+	opts.Experimental.MultiLevelCompactionHeuristic = NoMultiLevel{}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+	d.mu.Lock()
+	d.timeNow = func() time.Time { return time.Unix(0, now.Load()) }
+	d.mu.Unlock()
+
+	maybeCompact := func(advance time.Duration) {
+		now.Add(int64(advance))
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.opts.DisableAutomaticCompactions = false
+		d.maybeScheduleCompaction()
+		for d.mu.compact.compactingCount > 0 {
+			d.mu.compact.cond.Wait()
+		}
+		d.opts.DisableAutomaticCompactions = true
+	}
+	levelFiles := func() (files [numLevels]int64) {
+		m := d.Metrics()
+		for l := range files {
+			files[l] = m.Levels[l].NumFiles
+		}
+		return files
+	}
+
+	// Write keys a-j into L6.
+	for c := 'a'; c <= 'j'; c++ {
+		require.NoError(t, d.Set([]byte{byte(c)}, []byte{byte(c)}, nil))
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("k"), false /* parallelize */))
+	require.Equal(t, [numLevels]int64{6: 1}, levelFiles())
+
+	// Delete keys a-e, placing the tombstones in L1.
+	d.mu.Lock()
+	d.mu.versions.dynamicBaseLevel = false
+	d.mu.versions.picker.forceBaseLevel1()
+	d.mu.Unlock()
+	for c := 'a'; c <= 'e'; c++ {
+		require.NoError(t, d.Delete([]byte{byte(c)}, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.manualCompact([]byte("a"), []byte("k"), 0, false /* parallelize */))
+	require.Equal(t, [numLevels]int64{1: 1, 6: 1}, levelFiles())
+
+	// Nothing is overdue yet.
+	maybeCompact(0)
+	require.Equal(t, [numLevels]int64{1: 1, 6: 1}, levelFiles())
+	require.Equal(t, 0, d.Metrics().Compact.OverdueFiles)
+
+	// Once the table of tombstones exceeds MaxTableAge, it's compacted into
+	// the next level. The outputs retain the creation time of the flushed
+	// memtable, so they're compacted level by level until the tombstones reach
+	// L6 and are elided along with the data they delete.
+	now.Add(int64(2 * time.Hour))
+	m := d.Metrics()
+	require.Equal(t, 1, m.Compact.OverdueFiles)
+	require.Less(t, uint64(0), m.Compact.OverdueBytes)
+	maybeCompact(0)
+	require.Equal(t, [numLevels]int64{6: 1}, levelFiles())
+	require.Equal(t, int64(5), d.Metrics().Compact.AgeCount)
+	require.Equal(t, 0, d.Metrics().Compact.OverdueFiles)
+
+	// The L6 table is only rewritten once it exceeds the
+	// PeriodicCompactionInterval, which resets its age.
+	maybeCompact(21 * time.Hour)
+	require.Equal(t, int64(5), d.Metrics().Compact.AgeCount)
+	maybeCompact(2 * time.Hour)
+	require.Equal(t, int64(6), d.Metrics().Compact.AgeCount)
+	maybeCompact(2 * time.Hour)
+	require.Equal(t, int64(6), d.Metrics().Compact.AgeCount)
+	require.Equal(t, [numLevels]int64{6: 1}, levelFiles())
+	require.Equal(t, 0, d.Metrics().Compact.OverdueFiles)
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"f", "g", "h", "i", "j"}, keys)
+}
+
 func TestCompaction(t *testing.T) {
 	const memTableSize = 10000
 	// Tuned so that 2 values can reside in the memtable before a flush, but a
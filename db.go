@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invalidating"
@@ -303,6 +304,19 @@ type DB struct {
 
 	commit *commitPipeline
 
+	// groupSyncWindow holds the window of the writes with
+	// DurabilityGroupSync, which delays the WAL syncs so that they're shared.
+	groupSyncWindow groupSyncWindow
+	// asyncNotifier notifies the callers of ApplyAsync.
+	asyncNotifier asyncNotifier
+	// seqNumTimes maps sequence numbers to wall-clock time to serve
+	// time-travel reads.
+	seqNumTimes seqNumTimeMapping
+	// indexMu serializes the commits of batches that write the primary keys of
+	// secondary indexes, from reading the previous values of the keys until
+	// the batch is sequenced.
+	indexMu sync.Mutex
+
 	// readState provides access to the state needed for reading without needing
 	// to acquire DB.mu.
 	readState struct {
@@ -414,6 +428,10 @@ type DB struct {
 			flushing bool
 			// The number of ongoing compactions.
 			compactingCount int
+			// The number of compaction slots occupied by the additional
+			// subcompactions of in-progress compactions. These slots are
+			// included in compactingCount.
+			subcompactingCount int
 			// The list of deletion hints, suggesting ranges for delete-only
 			// compactions.
 			deletionHints []deleteCompactionHint
@@ -423,6 +441,19 @@ type DB struct {
 			// downloads is the list of suggested download tasks. The next download to
 			// perform is at the start of the list. New entries are added to the end.
 			downloads []*downloadSpan
+			// resumable is the list of checkpoints of interrupted compactions
+			// that are awaiting resumption. See compaction_checkpoint.go.
+			resumable []*compactionCheckpoint
+			// windows are the daily windows outside of which non-urgent
+			// compactions are deferred. windowTimer, if set, schedules
+			// compactions when the next window opens. See
+			// DB.SetCompactionWindows.
+			windows     []CompactionWindow
+			windowTimer *time.Timer
+			// overdue annotates the levels of the current version with the
+			// files that are overdue for an age-based compaction, serving
+			// Metrics.Compact.OverdueFiles.
+			overdue [numLevels]overdueFilesAnnotator
 			// inProgress is the set of in-progress flushes and compactions.
 			// It's used in the calculation of some metrics and to initialize L0
 			// sublevels' state. Some of the compactions contained within this
@@ -435,7 +466,8 @@ type DB struct {
 			rescheduleReadCompaction bool
 
 			// readCompactions is a readCompactionQueue which keeps track of the
-			// compactions which we might have to perform.
+			// compactions which we might have to perform, including those of
+			// compaction hints.
 			readCompactions readCompactionQueue
 
 			// The cumulative duration of all completed compactions since Open.
@@ -492,6 +524,15 @@ type DB struct {
 			// validating is set to true when validation is running.
 			validating bool
 		}
+
+		lsmViews struct {
+			// cond is a condition variable used to signal the completion of a
+			// request served by LSMViewHandler.
+			cond sync.Cond
+			// serving is the number of requests served by LSMViewHandler that
+			// are reading the LSM, which Close waits for.
+			serving int
+		}
 	}
 
 	// Normally equal to time.Now() but may be overridden in tests.
@@ -772,9 +813,10 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 	return d.applyInternal(batch, opts, false)
 }
 
-// ApplyNoSyncWait must only be used when opts.Sync is true and the caller
-// does not want to wait for the WAL fsync to happen. The method will return
-// once the mutation is applied to the memtable and is visible (note that a
+// ApplyNoSyncWait must only be used when opts syncs the WAL (opts.Sync is true,
+// or the durability is DurabilityGroupSync) and the caller does not want to
+// wait for the WAL fsync to happen. The method will return once the mutation
+// is applied to the memtable and is visible (note that a
 // mutation is visible before the WAL sync even in the wait case, so we have
 // not weakened the durability semantics). The caller must call Batch.SyncWait
 // to wait for the WAL fsync. The caller must not Close the batch without
@@ -785,13 +827,40 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 // EXPERIMENTAL: API/feature subject to change. Do not yet use outside
 // CockroachDB.
 func (d *DB) ApplyNoSyncWait(batch *Batch, opts *WriteOptions) error {
-	if !opts.Sync {
+	if durability := opts.GetDurability(); durability != DurabilitySync && durability != DurabilityGroupSync {
 		return errors.Errorf("cannot request asynchonous apply when WriteOptions.Sync is false")
 	}
 	return d.applyInternal(batch, opts, true)
 }
 
-// REQUIRES: noSyncWait => opts.Sync
+// ApplyAsync applies the batch to the DB like Apply, but returns once the
+// mutation is applied to the memtable and visible, without waiting for it to
+// attain the durability requested by opts. onDurable is called, possibly on
+// another goroutine, once the batch has attained that durability or failed
+// to. The caller must not Close or reuse the batch before onDurable is
+// called.
+//
+// If ApplyAsync returns an error, onDurable is not called.
+func (d *DB) ApplyAsync(batch *Batch, opts *WriteOptions, onDurable func(error)) error {
+	if err := d.applyInternal(batch, opts, true /* noSyncWait */); err != nil {
+		return err
+	}
+	switch batch.durability {
+	case DurabilitySync, DurabilityGroupSync:
+		d.asyncNotifier.add(batch.SyncWait, onDurable)
+	case DurabilityWritten:
+		d.asyncNotifier.add(func() error { return d.waitWALFlushed(batch) }, onDurable)
+	default:
+		onDurable(nil)
+	}
+	return nil
+}
+
+// applyInternal applies the batch to the DB. If noSyncWait is true, it returns
+// without waiting for the batch to attain its durability, and the caller must
+// wait for it: with Batch.SyncWait if the batch syncs the WAL
+// (DurabilitySync or DurabilityGroupSync), or with DB.waitWALFlushed for
+// DurabilityWritten.
 func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
@@ -809,8 +878,11 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 		panic(fmt.Sprintf("pebble: batch db mismatch: %p != %p", batch.db, d))
 	}
 
-	sync := opts.GetSync()
-	if sync && d.opts.DisableWAL {
+	durability := opts.GetDurability()
+	if durability == DurabilityGroupSync && opts.GroupSyncWindow <= 0 {
+		durability = DurabilitySync
+	}
+	if durability > DurabilityNone && d.opts.DisableWAL {
 		return errors.New("pebble: WAL disabled")
 	}
 
@@ -826,10 +898,38 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 			return errNoSplit
 		}
 	}
+	var indexLocked bool
+	if len(d.opts.SecondaryIndexes) > 0 {
+		writesIndexedKeys, err := d.batchWritesIndexedKeys(batch)
+		if err != nil {
+			return err
+		}
+		if writesIndexedKeys {
+			d.indexMu.Lock()
+			indexLocked = true
+			if err := d.maintainSecondaryIndexes(batch); err != nil {
+				batch.discardIndexUpdates()
+				d.indexMu.Unlock()
+				return err
+			}
+		}
+	}
 	batch.committing = true
+	batch.durability = durability
 
+	// abort undoes the preparation of the batch for a commit that doesn't take
+	// place, so that the batch may be applied again.
+	abort := func() {
+		batch.committing = false
+		batch.flushable = nil
+		if indexLocked {
+			batch.discardIndexUpdates()
+			d.indexMu.Unlock()
+		}
+	}
 	if batch.db == nil {
 		if err := batch.refreshMemTableSize(); err != nil {
+			abort()
 			return err
 		}
 	}
@@ -837,14 +937,54 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 		var err error
 		batch.flushable, err = newFlushableBatch(batch, d.opts.Comparer)
 		if err != nil {
+			abort()
 			return err
 		}
 	}
-	if err := d.commit.Commit(batch, sync, noSyncWait); err != nil {
+	// Compress the batch before entering the commit pipeline, so that the
+	// compression doesn't hold up the commits of other batches.
+	if c := d.walCompression(); c != batchrepr.NoCompression && !d.opts.DisableWAL {
+		batch.walCompressed = newWALCompressedBatch(batch.Repr(), c)
+		defer func() {
+			if batch.walCompressed != nil {
+				batch.walCompressed.unref()
+				batch.walCompressed = nil
+			}
+		}()
+	}
+	if indexLocked {
+		// Release d.indexMu once the batch is sequenced, rather than once it's
+		// committed: the next batch maintaining the indexes waits for it to be
+		// visible before reading the primary keys.
+		batch.sequenced = func() {
+			batch.sequenced = nil
+			indexLocked = false
+			d.indexMu.Unlock()
+		}
+	}
+	syncWAL := durability == DurabilitySync || durability == DurabilityGroupSync
+	if durability == DurabilityGroupSync {
+		d.groupSyncWindow.add(opts.GroupSyncWindow)
+	}
+	if err := d.commit.Commit(batch, syncWAL, noSyncWait && syncWAL); errors.Is(err, errBatchRejected) {
+		// The batch's conditions don't hold. Nothing was written, and the batch
+		// may be reused without the index updates.
+		batch.discardIndexUpdates()
+		abort()
+		return err
+	} else if err != nil {
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
 	}
+	if d.seqNumTimes.enabled() {
+		d.seqNumTimes.maybeSample(d.mu.versions.visibleSeqNum.Load(), d.timeNow())
+	}
+	if !noSyncWait && durability == DurabilityWritten {
+		if err := d.waitWALFlushed(batch); err != nil {
+			d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
+		}
+	}
 	// If this is a large batch, we need to clear the batch contents as the
 	// flushable batch may still be present in the flushables queue.
 	//
@@ -898,6 +1038,15 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 	var size int64
 	repr := b.Repr()
 
+	// The record written to the WAL is the batch's representation, or its
+	// compressed copy. The WAL writer may retain a reference to either beyond
+	// the call to WriteRecord.
+	walRepr, walRef := repr, wal.RefFunc(b.refData)
+	if wc := b.walCompressed; wc != nil && wc.compressed {
+		batchrepr.SetCompressedSeqNum(wc.buf, b.SeqNum())
+		walRepr, walRef = wc.buf, wc.ref
+	}
+
 	if b.flushable != nil {
 		// We have a large batch. Such batches are special in that they don't get
 		// added to the memtable, and are instead inserted into the queue of
@@ -911,7 +1060,7 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		b.flushable.setSeqNum(b.SeqNum())
 		if !d.opts.DisableWAL {
 			var err error
-			size, err = d.mu.log.writer.WriteRecord(repr, wal.SyncOptions{Done: syncWG, Err: syncErr}, b.refData)
+			size, err = d.mu.log.writer.WriteRecord(walRepr, wal.SyncOptions{Done: syncWG, Err: syncErr}, walRef)
 			if err != nil {
 				panic(err)
 			}
@@ -949,16 +1098,90 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 	}
 
 	if b.flushable == nil {
-		size, err = d.mu.log.writer.WriteRecord(repr, wal.SyncOptions{Done: syncWG, Err: syncErr}, b.refData)
+		size, err = d.mu.log.writer.WriteRecord(walRepr, wal.SyncOptions{Done: syncWG, Err: syncErr}, walRef)
 		if err != nil {
 			panic(err)
 		}
 	}
 
+	if b.durability == DurabilityWritten {
+		b.walWriter, b.walOffset = d.mu.log.writer, size
+	}
 	d.logSize.Store(uint64(size))
 	return mem, err
 }
 
+// waitWALFlushed waits until the WAL record of a batch committed with
+// DurabilityWritten has been written to the operating system. If the WAL
+// writer can't wait for that, the WAL is synced instead.
+func (d *DB) waitWALFlushed(b *Batch) error {
+	w := b.walWriter
+	b.walWriter = nil
+	if fw, ok := w.(wal.FlushWaiter); ok {
+		return fw.WaitFlushed(b.walOffset)
+	}
+	return d.LogData(nil /* data */, Sync)
+}
+
+// walCompressedBatch holds the compressed copy of a batch written to the WAL.
+// Its buffer is returned to walCompressedBatchPool once it's unreferenced by
+// both the committing batch and the WAL writer.
+type walCompressedBatch struct {
+	buf []byte
+	// compressed is false if the batch doesn't compress, in which case the
+	// batch's representation is written to the WAL.
+	compressed bool
+	refs       atomic.Int32
+}
+
+var walCompressedBatchPool = sync.Pool{
+	New: func() interface{} { return &walCompressedBatch{} },
+}
+
+// newWALCompressedBatch compresses repr into a pooled buffer. The returned
+// walCompressedBatch holds a reference that must be released with unref.
+func newWALCompressedBatch(repr []byte, c batchrepr.Compression) *walCompressedBatch {
+	wc := walCompressedBatchPool.Get().(*walCompressedBatch)
+	wc.refs.Store(1)
+	compressed := batchrepr.Compress(wc.buf[:0], repr, c)
+	wc.compressed = len(compressed) < len(repr)
+	if wc.compressed {
+		wc.buf = compressed
+	}
+	return wc
+}
+
+// ref is passed to (wal.Writer).WriteRecord along with the compressed batch.
+func (wc *walCompressedBatch) ref() (unref func()) {
+	wc.refs.Add(+1)
+	return wc.unref
+}
+
+func (wc *walCompressedBatch) unref() {
+	if wc.refs.Add(-1) == 0 {
+		if cap(wc.buf) > batchMaxRetainedSize {
+			wc.buf = nil
+		}
+		walCompressedBatchPool.Put(wc)
+	}
+}
+
+// walCompression returns the algorithm used to compress batches written to the
+// WAL.
+func (d *DB) walCompression() batchrepr.Compression {
+	if d.FormatMajorVersion() < FormatWALCompression {
+		return batchrepr.NoCompression
+	}
+	switch d.opts.WALCompression {
+	case SnappyCompression:
+		return batchrepr.SnappyCompression
+	case ZstdCompression:
+		return batchrepr.ZstdCompression
+	default:
+		return batchrepr.NoCompression
+	}
+}
+
 type iterAlloc struct {
 	dbi                 Iterator
 	keyBuf              []byte
@@ -1029,6 +1252,9 @@ func (d *DB) newIter(
 		// DB.mem.queue[0].logSeqNum.
 		panic("OnlyReadGuaranteedDurable is not supported for batches or snapshots")
 	}
+	if (batch != nil || seqNum != 0) && (o != nil && !o.AsOfTime.IsZero()) {
+		panic("AsOfTime is not supported for batches or snapshots")
+	}
 	var readState *readState
 	var newIters tableNewIters
 	var newIterRangeKey keyspanimpl.TableNewSpanIter
@@ -1079,9 +1305,10 @@ func (d *DB) newIter(
 		batchOnlyIter:       internalOpts.batch.batchOnly,
 	}
 	if o != nil {
-		dbi.opts = *o
+		dbi.opts = *o.withReadTimestamp(d.opts.Timestamps, d.opts.Comparer.Split)
 		dbi.processBounds(o.LowerBound, o.UpperBound)
 	}
+	dbi.timestamps = d.opts.Timestamps
 	dbi.opts.logger = d.opts.Logger
 	if d.opts.private.disableLazyCombinedIteration {
 		dbi.opts.disableLazyCombinedIteration = true
@@ -1367,7 +1594,10 @@ func (i *Iterator) constructPointIter(
 		// Already have one.
 		return
 	}
-	internalOpts := internalIterOpts{stats: &i.stats.InternalStats}
+	internalOpts := internalIterOpts{
+		stats:      &i.stats.InternalStats,
+		bufferPool: i.opts.bufferPool,
+	}
 	if i.opts.RangeKeyMasking.Filter != nil {
 		internalOpts.boundLimitedFilter = &i.rangeKeyMasking
 	}
@@ -1532,6 +1762,20 @@ func (d *DB) NewIter(o *IterOptions) (*Iterator, error) {
 // NewIterWithContext is like NewIter, and additionally accepts a context for
 // tracing.
 func (d *DB) NewIterWithContext(ctx context.Context, o *IterOptions) (*Iterator, error) {
+	if o != nil && !o.AsOfTime.IsZero() {
+		seqNum, err := d.SeqNumForTime(o.AsOfTime)
+		if err != nil {
+			return nil, err
+		}
+		// NB: newIter rejects AsOfTime along with a snapshot, so clear it.
+		opts := *o
+		opts.AsOfTime = time.Time{}
+		it := d.newIter(ctx, nil /* batch */, newIterOpts{
+			snapshot: snapshotIterOpts{seqNum: seqNum},
+		}, &opts)
+		it.opts.AsOfTime = o.AsOfTime
+		return it, nil
+	}
 	return d.newIter(ctx, nil /* batch */, newIterOpts{}, o), nil
 }
 
@@ -1580,6 +1824,13 @@ func (d *DB) NewEventuallyFileOnlySnapshot(keyRanges []KeyRange) *EventuallyFile
 // or to call Close concurrently with any other DB method. It is not valid
 // to call any of a DB's methods after the DB has been closed.
 func (d *DB) Close() error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	// Deliver the notifications of ApplyAsync, which wait for the WAL, before
+	// locking the commit pipeline.
+	d.asyncNotifier.close()
+
 	// Lock the commit pipeline for the duration of Close. This prevents a race
 	// with makeRoomForWrite. Rotating the WAL in makeRoomForWrite requires
 	// dropping d.mu several times for I/O. If Close only holds d.mu, an
@@ -1607,6 +1858,9 @@ func (d *DB) Close() error {
 
 	d.closed.Store(errors.WithStack(ErrClosed))
 	close(d.closedCh)
+	if d.mu.compact.windowTimer != nil {
+		d.mu.compact.windowTimer.Stop()
+	}
 
 	defer d.opts.Cache.Unref()
 
@@ -1619,6 +1873,9 @@ func (d *DB) Close() error {
 	for d.mu.tableValidation.validating {
 		d.mu.tableValidation.cond.Wait()
 	}
+	for d.mu.lsmViews.serving > 0 {
+		d.mu.lsmViews.cond.Wait()
+	}
 
 	var err error
 	if n := len(d.mu.compact.inProgress); n > 0 {
@@ -2082,8 +2339,16 @@ func (d *DB) Metrics() *Metrics {
 	*metrics = d.mu.versions.metrics
 	metrics.Compact.EstimatedDebt = d.mu.versions.picker.estimatedCompactionDebt(0)
 	metrics.Compact.InProgressBytes = d.mu.versions.atomicInProgressBytes.Load()
-	metrics.Compact.NumInProgress = int64(d.mu.compact.compactingCount)
+	metrics.Compact.NumInProgress = int64(d.mu.compact.compactingCount - d.mu.compact.subcompactingCount)
 	metrics.Compact.MarkedFiles = vers.Stats.MarkedForCompaction
+	if d.opts.Experimental.MaxTableAge > 0 || d.opts.Experimental.PeriodicCompactionInterval > 0 {
+		now := d.timeNow()
+		for l := 1; l < numLevels; l++ {
+			files, bytes := d.mu.compact.overdue[l].count(&vers.Levels[l], now, maxTableAge(d.opts, l))
+			metrics.Compact.OverdueFiles += files
+			metrics.Compact.OverdueBytes += bytes
+		}
+	}
 	metrics.Compact.Duration = d.mu.compact.duration
 	for c := range d.mu.compact.inProgress {
 		if c.kind != compactionKindFlush {
@@ -2136,6 +2401,7 @@ func (d *DB) Metrics() *Metrics {
 	// TODO(jackson): Consider making these metrics optional.
 	metrics.Keys.RangeKeySetsCount = countRangeKeySetFragments(vers)
 	metrics.Keys.TombstoneCount = countTombstones(vers)
+	metrics.Keys.TombstoneDenseBlocksCount = countTombstoneDenseBlocks(vers)
 
 	d.mu.versions.logLock()
 	metrics.private.manifestFileSize = uint64(d.mu.versions.manifest.Size())
@@ -2552,6 +2818,7 @@ func (d *DB) newFlushableEntry(
 		flushed:        make(chan struct{}),
 		logNum:         logNum,
 		logSeqNum:      logSeqNum,
+		createdAt:      d.timeNow(),
 		deleteFn:       d.mu.versions.addObsolete,
 		deleteFnLocked: d.mu.versions.addObsoleteLocked,
 	}
@@ -2779,6 +3046,7 @@ func (d *DB) getInProgressCompactionInfoLocked(finishing *compaction) (rv []comp
 		if len(c.flushing) == 0 && (finishing == nil || c != finishing) {
 			info := compactionInfo{
 				versionEditApplied: c.versionEditApplied,
+				kind:               c.kind,
 				inputs:             c.inputs,
 				smallest:           c.smallest,
 				largest:            c.largest,
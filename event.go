@@ -66,6 +66,9 @@ type CompactionInfo struct {
 	JobID int
 	// Reason is the reason for the compaction.
 	Reason string
+	// Hint is the reason given by the compaction hint that triggered the
+	// compaction, if any. See DB.AddCompactionHint.
+	Hint string
 	// Input contains the input tables for the compaction organized by level.
 	Input []LevelInfo
 	// Output contains the output tables generated by the compaction. The output
@@ -119,6 +122,9 @@ func (i CompactionInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 		w.Printf("[JOB %d] compacting(%s) ",
 			redact.Safe(i.JobID),
 			redact.SafeString(i.Reason))
+		if i.Hint != "" {
+			w.Printf("(hint: %s) ", i.Hint)
+		}
 		w.Printf("%s", i.Annotations)
 		w.Printf("%s; ", levelInfos(i.Input))
 		w.Printf("OverlappingRatio: Single %.2f, Multi %.2f", i.SingleLevelOverlappingRatio, i.MultiLevelOverlappingRatio)
@@ -126,6 +132,9 @@ func (i CompactionInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	}
 	outputSize := tablesTotalSize(i.Output.Tables)
 	w.Printf("[JOB %d] compacted(%s) ", redact.Safe(i.JobID), redact.SafeString(i.Reason))
+	if i.Hint != "" {
+		w.Printf("(hint: %s) ", i.Hint)
+	}
 	w.Printf("%s", i.Annotations)
 	w.Print(levelInfos(i.Input))
 	w.Printf(" -> L%d [%s] (%s), in %.1fs (%.1fs total), output rate %s/s",
@@ -467,6 +476,59 @@ func (i WALDeleteInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("[JOB %d] WAL deleted %s", redact.Safe(i.JobID), i.FileNum)
 }
 
+// WALRecordsDroppedInfo contains the info for a WAL replay event in which
+// records were dropped because of a corruption tolerated by
+// Options.WALRecoveryMode.
+type WALRecordsDroppedInfo struct {
+	// JobID is the ID of the job replaying the WAL.
+	JobID int
+	// FileNum is the file number of the WAL whose records were dropped.
+	FileNum base.DiskFileNum
+	// Path is the physical file containing the first dropped record, and
+	// Offset is the offset of that record within the file.
+	Path   string
+	Offset int64
+	// EndOffset is the offset within Path at which replay resumed after the
+	// dropped records, or -1 if the remainder of the WAL was dropped.
+	EndOffset int64
+	// StartSeqNum and EndSeqNum are the bounds [StartSeqNum, EndSeqNum) of
+	// the sequence numbers of the dropped records. The sequence numbers of a
+	// corrupted record can't be read, so EndSeqNum is the sequence number of
+	// the first record replayed after the dropped records, or one past the
+	// highest sequence number of the intact records dropped along with the
+	// corrupted ones. EndSeqNum is zero if neither exists, in which case only
+	// StartSeqNum is known.
+	StartSeqNum uint64
+	EndSeqNum   uint64
+	// Mode is the recovery mode that tolerated the corruption.
+	Mode WALRecoveryMode
+	// Err is the corruption that caused the records to be dropped. When
+	// WALRecoveryPointInTime drops WALs following a corrupted WAL, it's the
+	// corruption encountered in that WAL.
+	Err error
+}
+
+func (i WALRecordsDroppedInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i WALRecordsDroppedInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("[JOB %d] WAL %s dropped records from offset %d",
+		redact.Safe(i.JobID), i.FileNum, redact.Safe(i.Offset))
+	if i.EndOffset >= 0 {
+		w.Printf(" to %d", redact.Safe(i.EndOffset))
+	} else {
+		w.Printf(" to the end")
+	}
+	if i.EndSeqNum > 0 {
+		w.Printf(", seqnums [%d,%d)", redact.Safe(i.StartSeqNum), redact.Safe(i.EndSeqNum))
+	} else {
+		w.Printf(", seqnums from %d", redact.Safe(i.StartSeqNum))
+	}
+	w.Printf(" (%s): %s", redact.Safe(i.Mode), i.Err)
+}
+
 // WriteStallBeginInfo contains the info for a write stall begin event.
 type WriteStallBeginInfo struct {
 	Reason string
@@ -550,6 +612,12 @@ type EventListener struct {
 	// WALDeleted is invoked after a WAL has been deleted.
 	WALDeleted func(WALDeleteInfo)
 
+	// WALRecordsDropped is invoked when Open drops records while replaying a
+	// WAL, because of a corruption tolerated by Options.WALRecoveryMode. An
+	// unclean tail of the most recent WAL, which no intact record follows,
+	// isn't reported.
+	WALRecordsDropped func(WALRecordsDroppedInfo)
+
 	// WriteStallBegin is invoked when writes are intentionally delayed.
 	WriteStallBegin func(WriteStallBeginInfo)
 
@@ -616,6 +684,15 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.WALDeleted == nil {
 		l.WALDeleted = func(info WALDeleteInfo) {}
 	}
+	if l.WALRecordsDropped == nil {
+		if logger != nil {
+			l.WALRecordsDropped = func(info WALRecordsDroppedInfo) {
+				logger.Errorf("%s", info)
+			}
+		} else {
+			l.WALRecordsDropped = func(info WALRecordsDroppedInfo) {}
+		}
+	}
 	if l.WriteStallBegin == nil {
 		l.WriteStallBegin = func(info WriteStallBeginInfo) {}
 	}
@@ -680,6 +757,9 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		WALDeleted: func(info WALDeleteInfo) {
 			logger.Infof("%s", info)
 		},
+		WALRecordsDropped: func(info WALRecordsDroppedInfo) {
+			logger.Errorf("%s", info)
+		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
 			logger.Infof("%s", info)
 		},
@@ -758,6 +838,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.WALDeleted(info)
 			b.WALDeleted(info)
 		},
+		WALRecordsDropped: func(info WALRecordsDroppedInfo) {
+			a.WALRecordsDropped(info)
+			b.WALRecordsDropped(info)
+		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
 			a.WriteStallBegin(info)
 			b.WriteStallBegin(info)
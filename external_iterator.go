@@ -160,6 +160,10 @@ func validateExternalIterOpts(iterOpts *IterOptions) error {
 		return errors.Errorf("pebble: external iterator: RangeKeyFilters unsupported")
 	case iterOpts.OnlyReadGuaranteedDurable:
 		return errors.Errorf("pebble: external iterator: OnlyReadGuaranteedDurable unsupported")
+	case iterOpts.ReadTimestamp != 0:
+		return errors.Errorf("pebble: external iterator: ReadTimestamp unsupported")
+	case !iterOpts.AsOfTime.IsZero():
+		return errors.Errorf("pebble: external iterator: AsOfTime unsupported")
 	case iterOpts.UseL6Filters:
 		return errors.Errorf("pebble: external iterator: UseL6Filters unsupported")
 	}
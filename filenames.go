@@ -19,4 +19,6 @@ const (
 	fileTypeOptions  = base.FileTypeOptions
 	fileTypeTemp     = base.FileTypeTemp
 	fileTypeOldTemp  = base.FileTypeOldTemp
+
+	fileTypeCompactionCheckpoint = base.FileTypeCompactionCheckpoint
 )
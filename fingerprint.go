@@ -0,0 +1,253 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// FingerprintOptions configures DB.Fingerprint and Snapshot.Fingerprint.
+type FingerprintOptions struct {
+	// FillCache, if set, lets the data blocks read to compute the fingerprint
+	// be added to the block cache. By default they are read into buffers that
+	// are released once read, so that fingerprinting large spans doesn't evict
+	// the blocks of the DB's working set.
+	FillCache bool
+	// IgnoreTableFingerprints, if set, reads every key of the span instead of
+	// reusing the fingerprints precomputed for sstables (see
+	// Options.Experimental.PointKeyFingerprints). The fingerprint is the same
+	// either way.
+	IgnoreTableFingerprints bool
+}
+
+// Fingerprint is the fingerprint of the visible keys of a span of the DB, as
+// computed by DB.Fingerprint.
+type Fingerprint struct {
+	// Hash is the sum of the hashes of the span's visible point keys and range
+	// keys. It only depends on the visible keys and their values, and not on
+	// the history of writes or the shape of the LSM, so that replicas holding
+	// the same data have the same Hash.
+	Hash uint64
+	// PointKeys is the number of visible point keys of the span.
+	PointKeys uint64
+	// RangeKeys is the number of visible range keys of the span, each span of
+	// range keys counting once per suffix.
+	RangeKeys uint64
+	// TablesReused is the number of sstables whose precomputed fingerprints
+	// were used instead of reading their keys.
+	TablesReused int
+}
+
+// Fingerprint computes the fingerprint of the keys of the span [start, end)
+// visible at an implicit snapshot, that is the point keys and range keys an
+// iterator with IterKeyTypePointsAndRanges would observe. Range deletions
+// contribute to the fingerprint through the point keys they delete, which
+// aren't visible. Range keys are fingerprinted after defragmentation, and
+// truncated to the span. A nil start or end leaves the span unbounded on that
+// side.
+//
+// Sstables that lie within the span, whose keys are all visible and that no
+// other data of the DB overlaps, are fingerprinted from a table property
+// without being read, if they were written with
+// Options.Experimental.PointKeyFingerprints.
+func (d *DB) Fingerprint(start, end []byte, opts *FingerprintOptions) (Fingerprint, error) {
+	return d.fingerprint(start, end, 0 /* seqNum */, opts)
+}
+
+// Fingerprint computes the fingerprint of the keys of the span [start, end)
+// visible at the snapshot. See DB.Fingerprint.
+func (s *Snapshot) Fingerprint(start, end []byte, opts *FingerprintOptions) (Fingerprint, error) {
+	if s.db == nil {
+		panic(ErrClosed)
+	}
+	return s.db.fingerprint(start, end, s.seqNum, opts)
+}
+
+// fingerprintTable is an sstable whose precomputed fingerprint is reused by
+// DB.Fingerprint.
+type fingerprintTable struct {
+	meta        *fileMetadata
+	fingerprint uint64
+	pointKeys   uint64
+}
+
+func (d *DB) fingerprint(
+	start, end []byte, seqNum uint64, opts *FingerprintOptions,
+) (_ Fingerprint, err error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if opts == nil {
+		opts = &FingerprintOptions{}
+	}
+	if start != nil && end != nil && d.cmp(start, end) >= 0 {
+		return Fingerprint{}, nil
+	}
+	// Determine the seqnum to read at after grabbing the read state, like
+	// iterators do.
+	rs := d.loadReadState()
+	defer rs.unref()
+	if seqNum == 0 {
+		seqNum = d.mu.versions.visibleSeqNum.Load()
+	}
+
+	var tables []fingerprintTable
+	if !opts.IgnoreTableFingerprints {
+		if tables, err = d.fingerprintTables(rs, start, end, seqNum); err != nil {
+			return Fingerprint{}, err
+		}
+	}
+
+	iterOpts := &IterOptions{KeyTypes: IterKeyTypePointsAndRanges}
+	var bufferPool sstable.BufferPool
+	if !opts.FillCache {
+		// NB: The iterator must be closed before the pool is released, which
+		// the order of the deferred calls guarantees.
+		bufferPool.Init(5)
+		defer bufferPool.Release()
+		iterOpts.bufferPool = &bufferPool
+	}
+	iter := d.newIter(context.Background(), nil /* batch */, newIterOpts{
+		snapshot: snapshotIterOpts{seqNum: seqNum, readState: rs},
+	}, iterOpts)
+	defer func() {
+		err = errors.CombineErrors(err, iter.Close())
+	}()
+
+	// Scan the gaps between the reused tables. Since no other data overlaps a
+	// reused table, the keys of a gap are the keys of the span between the
+	// largest key of the preceding table, excluded, and the smallest key of the
+	// following table, excluded.
+	var fp Fingerprint
+	lower, skip := start, []byte(nil)
+	for i := 0; i <= len(tables); i++ {
+		upper := end
+		if i < len(tables) {
+			upper = tables[i].meta.Smallest.UserKey
+		}
+		if lower == nil || upper == nil || d.cmp(lower, upper) < 0 {
+			if err := fp.scan(iter, lower, upper, skip); err != nil {
+				return Fingerprint{}, err
+			}
+		}
+		if i < len(tables) {
+			fp.Hash += tables[i].fingerprint
+			fp.PointKeys += tables[i].pointKeys
+			fp.TablesReused++
+			lower = tables[i].meta.Largest.UserKey
+			skip = lower
+		}
+	}
+	return fp, nil
+}
+
+// scan adds the keys of the span [lower, upper) to the fingerprint, except for
+// the point key skip.
+func (fp *Fingerprint) scan(iter *Iterator, lower, upper, skip []byte) error {
+	iter.SetBounds(lower, upper)
+	for valid := iter.First(); valid; valid = iter.Next() {
+		hasPoint, hasRange := iter.HasPointAndRange()
+		if hasRange && iter.RangeKeyChanged() {
+			start, end := iter.RangeBounds()
+			for _, rk := range iter.RangeKeys() {
+				fp.Hash += base.FingerprintRangeKey(start, end, rk.Suffix, rk.Value)
+				fp.RangeKeys++
+			}
+		}
+		if !hasPoint || (skip != nil && iter.cmp(iter.Key(), skip) == 0) {
+			continue
+		}
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			return err
+		}
+		fp.Hash += base.FingerprintPointKey(iter.Key(), value)
+		fp.PointKeys++
+	}
+	return iter.Error()
+}
+
+// fingerprintTables returns the tables of the read state whose precomputed
+// fingerprints may be reused to fingerprint the span [start, end) at seqNum,
+// sorted by key. Such tables lie within the span, only contain keys visible at
+// seqNum, and don't overlap any other table or memtable.
+func (d *DB) fingerprintTables(
+	rs *readState, start, end []byte, seqNum uint64,
+) ([]fingerprintTable, error) {
+	v := rs.current
+	var candidates []*fileMetadata
+	for level := range v.Levels {
+		iter := v.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if f.Virtual || f.HasRangeKeys || f.SyntheticPrefix.IsSet() || f.SyntheticSuffix.IsSet() ||
+				f.LargestSeqNum >= seqNum || f.Largest.IsExclusiveSentinel() {
+				continue
+			}
+			if (start != nil && d.cmp(f.Smallest.UserKey, start) < 0) ||
+				(end != nil && d.cmp(f.Largest.UserKey, end) >= 0) {
+				continue
+			}
+			overlaps := false
+			for l := range v.Levels {
+				ls := v.Overlaps(l, f.Smallest.UserKey, f.Largest.UserKey, false /* exclusiveEnd */)
+				n := ls.Len()
+				if l == level {
+					// The table overlaps itself.
+					n--
+				}
+				if n > 0 {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				candidates = append(candidates, f)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	bs := make([]bounded, len(candidates))
+	for i := range candidates {
+		bs[i] = candidates[i]
+	}
+	overlapping := make(map[*fileMetadata]bool)
+	for _, mem := range rs.memtables {
+		mem.computePossibleOverlaps(func(b bounded) shouldContinue {
+			overlapping[b.(*fileMetadata)] = true
+			return continueIteration
+		}, bs...)
+	}
+
+	var tables []fingerprintTable
+	for _, f := range candidates {
+		if overlapping[f] {
+			continue
+		}
+		props, err := d.tableCache.getTableProperties(f)
+		if err != nil {
+			return nil, err
+		}
+		if props.PointKeyFingerprint == 0 {
+			continue
+		}
+		tables = append(tables, fingerprintTable{
+			meta:        f,
+			fingerprint: props.PointKeyFingerprint,
+			pointKeys:   props.NumEntries,
+		})
+	}
+	slices.SortFunc(tables, func(a, b fingerprintTable) int {
+		return d.cmp(a.meta.Smallest.UserKey, b.meta.Smallest.UserKey)
+	})
+	return tables, nil
+}
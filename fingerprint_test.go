@@ -0,0 +1,141 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	open := func(t *testing.T, tableFingerprints bool) *DB {
+		opts := (&Options{
+			FS:                          vfs.NewMem(),
+			DisableAutomaticCompactions: true,
+			FormatMajorVersion:          FormatNewest,
+		}).WithFSDefaults()
+		opts.Experimental.PointKeyFingerprints = tableFingerprints
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, d.Close()) })
+		return d
+	}
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%04d", i)) }
+	fingerprint := func(
+		t *testing.T, d *DB, start, end []byte, opts *FingerprintOptions,
+	) Fingerprint {
+		fp, err := d.Fingerprint(start, end, opts)
+		require.NoError(t, err)
+		return fp
+	}
+	const numKeys = 500
+
+	// a holds the keys in a single table of L6.
+	a := open(t, true /* tableFingerprints */)
+	for i := 0; i < numKeys; i++ {
+		require.NoError(t, a.Set(key(i), []byte("value"), nil))
+	}
+	require.NoError(t, a.Compact(key(0), key(numKeys), false /* parallelize */))
+
+	// b holds the same keys, written in a different order and alongside keys
+	// that were later overwritten or deleted, in several tables of L0 and in
+	// the memtable.
+	b := open(t, false /* tableFingerprints */)
+	for i := numKeys - 1; i >= 0; i-- {
+		require.NoError(t, b.Set(key(i), []byte("old"), nil))
+	}
+	require.NoError(t, b.Set([]byte("key9999"), []byte("deleted"), nil))
+	require.NoError(t, b.Flush())
+	for i := 0; i < numKeys; i += 2 {
+		require.NoError(t, b.Set(key(i), []byte("value"), nil))
+	}
+	require.NoError(t, b.DeleteRange([]byte("key9"), []byte("key:"), nil))
+	require.NoError(t, b.Flush())
+	for i := 1; i < numKeys; i += 2 {
+		require.NoError(t, b.Set(key(i), []byte("value"), nil))
+	}
+
+	fpA := fingerprint(t, a, nil, nil, nil)
+	require.Equal(t, uint64(numKeys), fpA.PointKeys)
+	require.Equal(t, 1, fpA.TablesReused)
+	fpB := fingerprint(t, b, nil, nil, nil)
+	require.Equal(t, 0, fpB.TablesReused)
+	require.Equal(t, fpA.Hash, fpB.Hash)
+	require.Equal(t, fpA.PointKeys, fpB.PointKeys)
+
+	// Reading every key yields the same fingerprint as reusing the table's.
+	fpScan := fingerprint(t, a, nil, nil, &FingerprintOptions{IgnoreTableFingerprints: true})
+	require.Equal(t, 0, fpScan.TablesReused)
+	require.Equal(t, fpA.Hash, fpScan.Hash)
+
+	// The table isn't reused to fingerprint a span it isn't within, and the
+	// fingerprints of adjacent spans add up.
+	mid := key(numKeys / 2)
+	fpLeft := fingerprint(t, a, nil, mid, nil)
+	fpRight := fingerprint(t, a, mid, nil, nil)
+	require.Equal(t, 0, fpLeft.TablesReused+fpRight.TablesReused)
+	require.Equal(t, fpA.Hash, fpLeft.Hash+fpRight.Hash)
+	require.Equal(t, fpLeft.Hash, fingerprint(t, b, nil, mid, nil).Hash)
+	require.Equal(t, Fingerprint{}, fingerprint(t, a, mid, mid, nil))
+
+	// A snapshot's fingerprint is unaffected by later writes, which change
+	// the fingerprint of the DB. Once the memtable overlaps the table, its
+	// fingerprint can no longer be reused.
+	snap := a.NewSnapshot()
+	defer snap.Close()
+	require.NoError(t, a.Set(key(0), []byte("changed"), nil))
+	fpSnap, err := snap.Fingerprint(nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, fpA.Hash, fpSnap.Hash)
+	require.Equal(t, 0, fpSnap.TablesReused)
+	require.NotEqual(t, fpA.Hash, fingerprint(t, a, nil, nil, nil).Hash)
+	require.NoError(t, b.Set(key(0), []byte("changed"), nil))
+	require.Equal(t, fingerprint(t, a, nil, nil, nil), fingerprint(t, b, nil, nil, nil))
+
+	// Range keys contribute to the fingerprint once defragmented, regardless
+	// of how they were written.
+	require.NoError(t, a.RangeKeySet([]byte("a"), []byte("c"), []byte("@1"), []byte("v"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("a"), []byte("b"), []byte("@1"), []byte("v"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("b"), []byte("c"), []byte("@1"), []byte("v"), nil))
+	fpA = fingerprint(t, a, nil, nil, nil)
+	fpB = fingerprint(t, b, nil, nil, nil)
+	require.Equal(t, uint64(1), fpA.RangeKeys)
+	require.Equal(t, fpA, fpB)
+	require.NoError(t, b.RangeKeyUnset([]byte("a"), []byte("c"), []byte("@1"), nil))
+	require.NotEqual(t, fpA.Hash, fingerprint(t, b, nil, nil, nil).Hash)
+}
+
+func TestFingerprintFillCache(t *testing.T) {
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+	}).WithFSDefaults()
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%04d", i)), []byte("value"), nil))
+	}
+	require.NoError(t, d.Flush())
+
+	fingerprint := func(fillCache bool) (Fingerprint, int64) {
+		fp, err := d.Fingerprint(nil, nil, &FingerprintOptions{FillCache: fillCache})
+		require.NoError(t, err)
+		return fp, d.Metrics().BlockCache.Size
+	}
+	// Only the table's metadata blocks are cached, until the fingerprint is
+	// computed with FillCache.
+	fp, size := fingerprint(false /* fillCache */)
+	fp2, size2 := fingerprint(false /* fillCache */)
+	require.Equal(t, fp, fp2)
+	require.Equal(t, size, size2)
+	fp3, size3 := fingerprint(true /* fillCache */)
+	require.Equal(t, fp, fp3)
+	require.Less(t, size, size3)
+}
@@ -84,6 +84,9 @@ type flushableEntry struct {
 	// The current logSeqNum at the time the memtable was created. This is
 	// guaranteed to be less than or equal to any seqnum stored in the memtable.
 	logSeqNum uint64
+	// createdAt is the time the flushable was created, which dates the
+	// tables it's flushed to.
+	createdAt time.Time
 	// readerRefs tracks the read references on the flushable. The two sources of
 	// reader references are DB.mu.mem.queue and readState.memtables. The memory
 	// reserved by the flushable in the cache is released when the reader refs
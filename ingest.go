@@ -1206,7 +1206,8 @@ func (d *DB) IngestExternalFiles(external []ExternalFile) (IngestOperationStats,
 // keys in exciseSpan are deleted by turning existing sstables into virtual
 // sstables (if not virtual already) and shrinking their spans to exclude
 // exciseSpan. See the comment at Ingest for a more complete picture of the
-// ingestion process.
+// ingestion process. If no files are specified, exciseSpan is excised on its
+// own.
 //
 // Panics if this DB instance was not instantiated with a remote.Storage and
 // shared sstables are present.
@@ -1390,7 +1391,7 @@ func (d *DB) ingest(
 		return IngestOperationStats{}, err
 	}
 
-	if loadResult.fileCount() == 0 {
+	if loadResult.fileCount() == 0 && !exciseSpan.Valid() {
 		// All of the sstables to be ingested were empty. Nothing to do.
 		return IngestOperationStats{}, nil
 	}
@@ -1669,7 +1670,7 @@ func (d *DB) ingest(
 		info.GlobalSeqNum = loadResult.local[0].SmallestSeqNum
 	} else if len(loadResult.shared) > 0 {
 		info.GlobalSeqNum = loadResult.shared[0].SmallestSeqNum
-	} else {
+	} else if len(loadResult.external) > 0 {
 		info.GlobalSeqNum = loadResult.external[0].SmallestSeqNum
 	}
 	var stats IngestOperationStats
@@ -61,6 +61,7 @@ const (
 	FileTypeOptions
 	FileTypeOldTemp
 	FileTypeTemp
+	FileTypeCompactionCheckpoint
 )
 
 // MakeFilename builds a filename from components.
@@ -80,6 +81,8 @@ func MakeFilename(fileType FileType, dfn DiskFileNum) string {
 		return fmt.Sprintf("CURRENT.%s.dbtmp", dfn)
 	case FileTypeTemp:
 		return fmt.Sprintf("temporary.%s.dbtmp", dfn)
+	case FileTypeCompactionCheckpoint:
+		return fmt.Sprintf("COMPACTION-%s", dfn)
 	}
 	panic("unreachable")
 }
@@ -107,6 +110,12 @@ func ParseFilename(fs vfs.FS, filename string) (fileType FileType, dfn DiskFileN
 			break
 		}
 		return FileTypeOptions, dfn, ok
+	case strings.HasPrefix(filename, "COMPACTION-"):
+		dfn, ok = ParseDiskFileNum(filename[len("COMPACTION-"):])
+		if !ok {
+			break
+		}
+		return FileTypeCompactionCheckpoint, dfn, ok
 	case strings.HasPrefix(filename, "CURRENT.") && strings.HasSuffix(filename, ".dbtmp"):
 		s := strings.TrimSuffix(filename[len("CURRENT."):], ".dbtmp")
 		dfn, ok = ParseDiskFileNum(s)
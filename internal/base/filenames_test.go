@@ -41,6 +41,9 @@ func TestParseFilename(t *testing.T) {
 		"OPTIONS-":               false,
 		"OPTIONS-123456":         true,
 		"OPTIONS-123456.doc":     false,
+		"COMPACTION-":            false,
+		"COMPACTION-123456":      true,
+		"COMPACTION-123456.doc":  false,
 		"CURRENT.123456":         false,
 		"CURRENT.dbtmp":          false,
 		"CURRENT.123456.dbtmp":   true,
@@ -65,6 +68,8 @@ func TestFilenameRoundTrip(t *testing.T) {
 		FileTypeOptions:  true,
 		FileTypeOldTemp:  true,
 		FileTypeTemp:     true,
+		// Compaction checkpoints.
+		FileTypeCompactionCheckpoint: true,
 		// NB: Log filenames are created and parsed elsewhere in the wal/
 		// package.
 		// FileTypeLog:      true,
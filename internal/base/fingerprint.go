@@ -0,0 +1,54 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package base
+
+import (
+	"encoding/binary"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// The fingerprint of a span of keys is the sum, modulo 2^64, of the hashes of
+// its keys. Summing makes the fingerprint independent of the order in which
+// the keys are visited, so that the fingerprints of disjoint subsets of the
+// keys, such as the precomputed fingerprint of an sstable, can be added to
+// one another.
+
+// Kinds of the keys hashed by the fingerprint functions, written before the
+// key so that the hashes of keys of different kinds never collide by
+// construction.
+const (
+	fingerprintPointKey byte = iota
+	fingerprintRangeKey
+)
+
+// FingerprintPointKey returns the hash of a point key with the given user key
+// and value, to be summed into a fingerprint.
+func FingerprintPointKey(userKey, value []byte) uint64 {
+	var d xxhash.Digest
+	d.Reset()
+	fingerprintWrite(&d, []byte{fingerprintPointKey}, userKey, value)
+	return d.Sum64()
+}
+
+// FingerprintRangeKey returns the hash of a range key with the given bounds,
+// suffix and value, to be summed into a fingerprint.
+func FingerprintRangeKey(start, end, suffix, value []byte) uint64 {
+	var d xxhash.Digest
+	d.Reset()
+	fingerprintWrite(&d, []byte{fingerprintRangeKey}, start, end, suffix, value)
+	return d.Sum64()
+}
+
+// fingerprintWrite writes the fields to the digest, each prefixed by its
+// length so that the boundaries between fields are unambiguous.
+func fingerprintWrite(d *xxhash.Digest, kind []byte, fields ...[]byte) {
+	_, _ = d.Write(kind)
+	var buf [binary.MaxVarintLen64]byte
+	for _, f := range fields {
+		_, _ = d.Write(buf[:binary.PutUvarint(buf[:], uint64(len(f)))])
+		_, _ = d.Write(f)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package manifest
+
+import (
+	"encoding/binary"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// SeqNumTime is a sample of the mapping from sequence numbers to wall-clock
+// time: the writes visible at SeqNum, those with lower sequence numbers, had
+// all been committed by Time, in nanoseconds since the Unix epoch.
+type SeqNumTime struct {
+	SeqNum uint64
+	Time   int64
+}
+
+// encodeSeqNumTimes encodes samples in increasing sequence number order as
+// pairs of deltas from the previous sample.
+func encodeSeqNumTimes(samples []SeqNumTime) []byte {
+	buf := make([]byte, 0, len(samples)*2*binary.MaxVarintLen64)
+	var prev SeqNumTime
+	for _, s := range samples {
+		buf = binary.AppendUvarint(buf, s.SeqNum-prev.SeqNum)
+		buf = binary.AppendVarint(buf, s.Time-prev.Time)
+		prev = s
+	}
+	return buf
+}
+
+// decodeSeqNumTimes decodes samples encoded by encodeSeqNumTimes.
+func decodeSeqNumTimes(buf []byte) ([]SeqNumTime, error) {
+	var samples []SeqNumTime
+	var prev SeqNumTime
+	for len(buf) > 0 {
+		seqNumDelta, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, base.CorruptionErrorf("new-file4: invalid seqnum times")
+		}
+		buf = buf[n:]
+		timeDelta, n := binary.Varint(buf)
+		if n <= 0 || (seqNumDelta == 0 && len(samples) > 0) {
+			return nil, base.CorruptionErrorf("new-file4: invalid seqnum times")
+		}
+		buf = buf[n:]
+		prev = SeqNumTime{SeqNum: prev.SeqNum + seqNumDelta, Time: prev.Time + timeDelta}
+		samples = append(samples, prev)
+	}
+	return samples, nil
+}
@@ -72,6 +72,13 @@ type TableStats struct {
 	RangeDeletionsBytesEstimate uint64
 	// Total size of value blocks and value index block.
 	ValueBlocksSize uint64
+	// The number of data blocks in the table whose entries are predominantly
+	// point tombstones. For virtual tables, this is an estimate scaled by the
+	// table's share of its backing table.
+	TombstoneDenseBlocks uint64
+	// The fraction of the table's data blocks that are predominantly point
+	// tombstones.
+	TombstoneDenseBlocksRatio float64
 }
 
 // boundType represents the type of key (point or range) present as the smallest
@@ -158,6 +165,12 @@ type FileMetadata struct {
 	// in pebble.Iterator after every after every positioning operation
 	// that returns a user key (eg. Next, Prev, SeekGE, SeekLT, etc).
 	AllowedSeeks atomic.Int64
+	// ReadSamples is the number of reads sampled by pebble.Iterator that were
+	// attributed to the file. Every sampled read is counted, including reads
+	// of keys that a single level contains, which don't decrement
+	// AllowedSeeks. Unlike AllowedSeeks it is never reset, and it isn't
+	// persisted.
+	ReadSamples atomic.Int64
 
 	// statsValid indicates if stats have been loaded for the table. The
 	// TableStats structure is populated only if valid is true.
@@ -193,6 +206,11 @@ type FileMetadata struct {
 	// sstable bounds.
 	SmallestSeqNum uint64
 	LargestSeqNum  uint64
+	// SeqNumTimes holds samples of the mapping from sequence numbers to
+	// wall-clock time that cover the table's sequence numbers, in increasing
+	// order. They're only recorded when time-travel reads are enabled, and
+	// allow the DB to rebuild the mapping on Open.
+	SeqNumTimes []SeqNumTime
 	// SmallestPointKey and LargestPointKey are the inclusive bounds for the
 	// internal point keys stored in the table. This includes RANGEDELs, which
 	// alter point keys.
@@ -64,6 +64,7 @@ const (
 	customTagTerminate         = 1
 	customTagNeedsCompaction   = 2
 	customTagCreationTime      = 6
+	customTagSeqNumTimes       = 32
 	customTagPathID            = 65
 	customTagNonSafeIgnoreMask = 1 << 6
 	customTagVirtual           = 66
@@ -338,6 +339,7 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 			}
 			var markedForCompaction bool
 			var creationTime uint64
+			var seqNumTimes []SeqNumTime
 			virtualState := struct {
 				virtual        bool
 				backingFileNum uint64
@@ -375,6 +377,15 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 							return base.CorruptionErrorf("new-file4: invalid file creation time")
 						}
 
+					case customTagSeqNumTimes:
+						field, err := d.readBytes()
+						if err != nil {
+							return err
+						}
+						if seqNumTimes, err = decodeSeqNumTimes(field); err != nil {
+							return err
+						}
+
 					case customTagPathID:
 						return base.CorruptionErrorf("new-file4: path-id field not supported")
 
@@ -412,6 +423,7 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 				CreationTime:        int64(creationTime),
 				SmallestSeqNum:      smallestSeqNum,
 				LargestSeqNum:       largestSeqNum,
+				SeqNumTimes:         seqNumTimes,
 				MarkedForCompaction: markedForCompaction,
 				Virtual:             virtualState.virtual,
 				SyntheticPrefix:     syntheticPrefix,
@@ -641,7 +653,8 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 		e.writeUvarint(uint64(x.FileNum))
 	}
 	for _, x := range v.NewFiles {
-		customFields := x.Meta.MarkedForCompaction || x.Meta.CreationTime != 0 || x.Meta.Virtual
+		customFields := x.Meta.MarkedForCompaction || x.Meta.CreationTime != 0 || x.Meta.Virtual ||
+			len(x.Meta.SeqNumTimes) > 0
 		var tag uint64
 		switch {
 		case x.Meta.HasRangeKeys:
@@ -690,6 +703,10 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 				n := binary.PutUvarint(buf[:], uint64(x.Meta.CreationTime))
 				e.writeBytes(buf[:n])
 			}
+			if len(x.Meta.SeqNumTimes) > 0 {
+				e.writeUvarint(customTagSeqNumTimes)
+				e.writeBytes(encodeSeqNumTimes(x.Meta.SeqNumTimes))
+			}
 			if x.Meta.MarkedForCompaction {
 				e.writeUvarint(customTagNeedsCompaction)
 				e.writeBytes([]byte{1})
@@ -131,6 +131,7 @@ func TestVersionEditRoundTrip(t *testing.T) {
 		LargestSeqNum:       5,
 		MarkedForCompaction: true,
 		SyntheticSuffix:     []byte("foo"),
+		SeqNumTimes:         []SeqNumTime{{SeqNum: 3, Time: 806040e9}, {SeqNum: 6, Time: 806039e9}},
 	}).ExtendPointKeyBounds(
 		cmp,
 		base.DecodeInternalKey([]byte("A\x00\x01\x02\x03\x04\x05\x06\x07")),
@@ -182,12 +182,14 @@ type Iterator struct {
 	// short-lived (since they pin memtables and sstables), (b) plumbing a
 	// context into every method is very painful, (c) they do not (yet) respect
 	// context cancellation and are only used for tracing.
-	ctx       context.Context
-	opts      IterOptions
-	merge     Merge
-	comparer  base.Comparer
-	iter      internalIterator
-	pointIter topLevelIterator
+	ctx      context.Context
+	opts     IterOptions
+	merge    Merge
+	comparer base.Comparer
+	// timestamps configures IterOptions.ReadTimestamp, if set.
+	timestamps *TimestampOptions
+	iter       internalIterator
+	pointIter  topLevelIterator
 	// Either readState or version is set, but not both.
 	readState *readState
 	version   *version
@@ -826,41 +828,43 @@ func (i *Iterator) sampleRead() {
 	if mi == nil {
 		return
 	}
-	if len(mi.levels) > 1 {
-		mi.ForEachLevelIter(func(li *levelIter) bool {
-			l := manifest.LevelToInt(li.level)
-			if f := li.iterFile; f != nil {
-				var containsKey bool
-				if i.pos == iterPosNext || i.pos == iterPosCurForward ||
-					i.pos == iterPosCurForwardPaused {
-					containsKey = i.cmp(f.SmallestPointKey.UserKey, i.key) <= 0
-				} else if i.pos == iterPosPrev || i.pos == iterPosCurReverse ||
-					i.pos == iterPosCurReversePaused {
-					containsKey = i.cmp(f.LargestPointKey.UserKey, i.key) >= 0
-				}
-				// Do nothing if the current key is not contained in f's
-				// bounds. We could seek the LevelIterator at this level
-				// to find the right file, but the performance impacts of
-				// doing that are significant enough to negate the benefits
-				// of read sampling in the first place. See the discussion
-				// at:
-				// https://github.com/cockroachdb/pebble/pull/1041#issuecomment-763226492
-				if containsKey {
-					numOverlappingLevels++
-					if numOverlappingLevels >= 2 {
-						// Terminate the loop early if at least 2 overlapping levels are found.
-						return true
-					}
-					topLevel = l
-					topFile = f
+	// NB: the topmost file containing the key is sampled even if no other
+	// level contains it, so that its ReadSamples count every sampled read.
+	// Only reads overlapping several levels count towards a read compaction.
+	mi.ForEachLevelIter(func(li *levelIter) bool {
+		l := manifest.LevelToInt(li.level)
+		if f := li.iterFile; f != nil {
+			var containsKey bool
+			if i.pos == iterPosNext || i.pos == iterPosCurForward ||
+				i.pos == iterPosCurForwardPaused {
+				containsKey = i.cmp(f.SmallestPointKey.UserKey, i.key) <= 0
+			} else if i.pos == iterPosPrev || i.pos == iterPosCurReverse ||
+				i.pos == iterPosCurReversePaused {
+				containsKey = i.cmp(f.LargestPointKey.UserKey, i.key) >= 0
+			}
+			// Do nothing if the current key is not contained in f's
+			// bounds. We could seek the LevelIterator at this level
+			// to find the right file, but the performance impacts of
+			// doing that are significant enough to negate the benefits
+			// of read sampling in the first place. See the discussion
+			// at:
+			// https://github.com/cockroachdb/pebble/pull/1041#issuecomment-763226492
+			if containsKey {
+				numOverlappingLevels++
+				if numOverlappingLevels >= 2 {
+					// Terminate the loop early if at least 2 overlapping levels are found.
+					return true
 				}
+				topLevel = l
+				topFile = f
 			}
-			return false
-		})
-	}
+		}
+		return false
+	})
 	if topFile == nil || topLevel >= numLevels {
 		return
 	}
+	topFile.ReadSamples.Add(1)
 	if numOverlappingLevels >= 2 {
 		allowedSeeks := topFile.AllowedSeeks.Add(-1)
 		if allowedSeeks == 0 {
@@ -2520,6 +2524,10 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 			panic(err)
 		}
 	}
+	if !o.AsOfTime.Equal(i.opts.AsOfTime) {
+		panic("pebble: AsOfTime may not be changed by SetOptions")
+	}
+	o = o.withReadTimestamp(i.timestamps, i.comparer.Split)
 
 	// Ensure that the Iterator appears exhausted, regardless of whether we
 	// actually have to invalidate the internal iterator. Optimizations that
@@ -2785,6 +2793,8 @@ func (i *Iterator) Clone(opts CloneOptions) (*Iterator, error) {
 func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*Iterator, error) {
 	if opts.IterOptions == nil {
 		opts.IterOptions = &i.opts
+	} else {
+		opts.IterOptions = opts.IterOptions.withReadTimestamp(i.timestamps, i.comparer.Split)
 	}
 	if i.batchOnlyIter {
 		return nil, errors.Errorf("cannot Clone a batch-only Iterator")
@@ -2816,6 +2826,7 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 		alloc:               buf,
 		merge:               i.merge,
 		comparer:            i.comparer,
+		timestamps:          i.timestamps,
 		readState:           readState,
 		version:             vers,
 		keyBuf:              buf.keyBuf,
@@ -0,0 +1,153 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// KeyDistributionOptions configures DB.KeyDistribution.
+type KeyDistributionOptions struct {
+	// PrefixLen, if positive, groups the keys by their first PrefixLen bytes,
+	// which is only meaningful if the Comparer orders keys bytewise. By
+	// default, the keys are grouped by the prefix returned by Comparer.Split.
+	PrefixLen int
+}
+
+// KeyPrefixStats describes the point keys sharing a prefix in the sstables of
+// a DB, as estimated by DB.KeyDistribution.
+type KeyPrefixStats struct {
+	// Prefix is the prefix of the keys.
+	Prefix []byte
+	// Size is the estimated size of the keys and their values in the sstables,
+	// in bytes.
+	Size uint64
+	// Keys is the estimated number of keys, which counts every version of a
+	// key, including the overwritten and deleted ones that haven't been
+	// compacted away yet.
+	Keys uint64
+	// Tables is the number of sstables containing keys with the prefix.
+	Tables int
+	// ReadSamples is the estimated number of sampled reads of the keys. The
+	// reads sampled by iterators to schedule read-triggered compactions are
+	// only tracked per sstable, so the reads of an sstable are divided among
+	// the prefixes of its keys in proportion to their size.
+	ReadSamples float64
+}
+
+// KeyDistribution estimates the distribution by prefix of the point keys of
+// the sstables within the span [start, end), in order to find out which
+// prefixes take up space and which are hot. A nil start or end leaves the span
+// unbounded on that side. The prefixes are returned in key order. The keys of
+// the memtables aren't taken into account, and read samples are only counted
+// since the DB was opened.
+//
+// The data blocks are attributed to prefixes using the index blocks of the
+// sstables, only reading the data blocks that straddle prefixes or the bounds
+// of the span. See sstable.Reader.EstimateKeyDistribution.
+func (d *DB) KeyDistribution(
+	start, end []byte, opts *KeyDistributionOptions,
+) ([]KeyPrefixStats, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if opts == nil {
+		opts = &KeyDistributionOptions{}
+	}
+	prefix := func(key []byte) []byte {
+		if opts.PrefixLen > 0 {
+			return key[:min(len(key), opts.PrefixLen)]
+		}
+		return key[:d.opts.Comparer.Split(key)]
+	}
+	if start != nil && end != nil && d.cmp(start, end) >= 0 {
+		return nil, nil
+	}
+
+	// Grab and reference the current readState. This prevents the underlying
+	// files in the associated version from being deleted if there is a
+	// concurrent compaction.
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	stats := make(map[string]*KeyPrefixStats)
+	type fileStats struct {
+		prefix     string
+		size, keys uint64
+	}
+	var fileRuns []fileStats
+	for _, files := range readState.current.Levels {
+		iter := files.Iter()
+		for file := iter.First(); file != nil; file = iter.Next() {
+			if (start != nil && d.cmp(file.Largest.UserKey, start) < 0) ||
+				(end != nil && d.cmp(file.Smallest.UserKey, end) >= 0) {
+				continue
+			}
+			fileRuns = fileRuns[:0]
+			fn := func(prefix []byte, size, keys uint64) {
+				if n := len(fileRuns); n > 0 && fileRuns[n-1].prefix == string(prefix) {
+					fileRuns[n-1].size += size
+					fileRuns[n-1].keys += keys
+					return
+				}
+				fileRuns = append(fileRuns, fileStats{prefix: string(prefix), size: size, keys: keys})
+			}
+			var err error
+			if file.Virtual {
+				err = d.tableCache.withVirtualReader(
+					file.VirtualMeta(),
+					func(r sstable.VirtualReader) error {
+						return r.EstimateKeyDistribution(start, end, prefix, fn)
+					},
+				)
+			} else {
+				err = d.tableCache.withReader(
+					file.PhysicalMeta(),
+					func(r *sstable.Reader) error {
+						return r.EstimateKeyDistribution(start, end, false /* upperInclusive */, prefix, fn)
+					},
+				)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			var fileSize uint64
+			for _, run := range fileRuns {
+				fileSize += run.size
+			}
+			readSamples := float64(file.ReadSamples.Load())
+			for _, run := range fileRuns {
+				s := stats[run.prefix]
+				if s == nil {
+					s = &KeyPrefixStats{Prefix: []byte(run.prefix)}
+					stats[run.prefix] = s
+				}
+				s.Size += run.size
+				s.Keys += run.keys
+				s.Tables++
+				if fileSize > 0 {
+					s.ReadSamples += readSamples * float64(run.size) / float64(fileSize)
+				}
+			}
+		}
+	}
+
+	distribution := make([]KeyPrefixStats, 0, len(stats))
+	for _, s := range stats {
+		distribution = append(distribution, *s)
+	}
+	compare := d.cmp
+	if opts.PrefixLen > 0 {
+		compare = bytes.Compare
+	}
+	slices.SortFunc(distribution, func(a, b KeyPrefixStats) int {
+		return compare(a.Prefix, b.Prefix)
+	})
+	return distribution, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyDistribution(t *testing.T) {
+	opts := (&Options{
+		Comparer:                    testkeys.Comparer,
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+	}).WithFSDefaults()
+	// Sample reads every 64KB on average.
+	opts.Experimental.ReadSamplingMultiplier = 1
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	rng := rand.New(rand.NewSource(1))
+	value := func(n int) []byte {
+		v := make([]byte, n)
+		rng.Read(v)
+		return v
+	}
+
+	// The keys starting with "a" take up twice as much space as those starting
+	// with "b", and are written to L6, then overwritten in L0.
+	write := func() {
+		for i := 0; i < 200; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("a%03d", i)), value(200), nil))
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("b%03d", i)), value(100), nil))
+		}
+	}
+	write()
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	write()
+	require.NoError(t, d.Flush())
+
+	byFirstByte := &KeyDistributionOptions{PrefixLen: 1}
+	distribution, err := d.KeyDistribution(nil, nil, byFirstByte)
+	require.NoError(t, err)
+	require.Len(t, distribution, 2)
+	a, b := distribution[0], distribution[1]
+	require.Equal(t, "a", string(a.Prefix))
+	require.Equal(t, "b", string(b.Prefix))
+	require.Equal(t, 2, a.Tables)
+	// The number of keys of the data blocks that aren't read is estimated as
+	// if the keys of a table were all the same size.
+	require.InDelta(t, 800, a.Keys+b.Keys, 20)
+	require.Greater(t, a.Keys, uint64(200))
+	require.InDelta(t, 2, float64(a.Size)/float64(b.Size), 0.5)
+	require.Zero(t, a.ReadSamples+b.ReadSamples)
+
+	// By default the keys are grouped by Comparer.Split, and only the keys
+	// within the span are counted.
+	distribution, err = d.KeyDistribution([]byte("b100"), []byte("b200"), nil)
+	require.NoError(t, err)
+	require.Len(t, distribution, 100)
+	require.Equal(t, "b100", string(distribution[0].Prefix))
+	require.Equal(t, "b199", string(distribution[99].Prefix))
+
+	// Reading the keys samples reads of the L0 table, which shadows the L6
+	// table, and the samples are attributed to its prefixes.
+	for i := 0; i < 20; i++ {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		for valid := iter.First(); valid; valid = iter.Next() {
+		}
+		require.NoError(t, iter.Close())
+	}
+	require.Equal(t, int64(1), d.Metrics().Levels[0].NumFiles)
+	rs := d.loadReadState()
+	l0 := rs.current.Levels[0].Iter()
+	samples := l0.First().ReadSamples.Load()
+	rs.unref()
+	require.Positive(t, samples)
+	distribution, err = d.KeyDistribution(nil, nil, byFirstByte)
+	require.NoError(t, err)
+	require.InDelta(t, float64(samples), distribution[0].ReadSamples+distribution[1].ReadSamples, 0.001)
+	require.Greater(t, distribution[0].ReadSamples, distribution[1].ReadSamples)
+
+	// Reads of keys that a single level contains are sampled too.
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	for i := 0; i < 20; i++ {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		for valid := iter.First(); valid; valid = iter.Next() {
+		}
+		require.NoError(t, iter.Close())
+	}
+	distribution, err = d.KeyDistribution(nil, nil, byFirstByte)
+	require.NoError(t, err)
+	require.Positive(t, distribution[0].ReadSamples+distribution[1].ReadSamples)
+}
@@ -28,7 +28,19 @@ func (d *DB) LSMViewURL() string {
 	}()
 	defer v.Unref()
 
-	b := lsmViewBuilder{
+	b := d.newLSMViewBuilder(v)
+	data := b.Build(d.objProvider, d.newIters)
+	url, err := lsmview.GenerateURL(data)
+	if err != nil {
+		return fmt.Sprintf("error: %s", err)
+	}
+	return url.String()
+}
+
+// newLSMViewBuilder returns a builder for the diagram of the given version,
+// with its levels and keys populated.
+func (d *DB) newLSMViewBuilder(v *version) *lsmViewBuilder {
+	b := &lsmViewBuilder{
 		cmp:    d.opts.Comparer.Compare,
 		fmtKey: d.opts.Comparer.FormatKey,
 	}
@@ -37,12 +49,7 @@ func (d *DB) LSMViewURL() string {
 	}
 	b.InitLevels(v)
 	b.PopulateKeys()
-	data := b.Build(d.objProvider, d.newIters)
-	url, err := lsmview.GenerateURL(data)
-	if err != nil {
-		return fmt.Sprintf("error: %s", err)
-	}
-	return url.String()
+	return b
 }
 
 type lsmViewBuilder struct {
@@ -0,0 +1,382 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/internal/lsmview"
+)
+
+// defaultLSMViewRefresh is the default interval at which the page served by
+// LSMViewHandler refreshes itself.
+const defaultLSMViewRefresh = 10 * time.Second
+
+// defaultLSMViewFiles is the default maximum number of files listed per level
+// by the page served by LSMViewHandler.
+const defaultLSMViewFiles = 100
+
+// LSMViewHandler returns an http.Handler serving a live view of the LSM: a
+// page showing the LSM diagram of LSMViewURL, the metrics of the DB, the
+// in-progress compactions and the files of each level along with the files of
+// the lower levels that their key ranges overlap. The page refreshes itself
+// every 10 seconds, which the refresh query parameter overrides (in seconds, 0
+// disabling refreshes). At most 100 files are listed per level, which the files
+// query parameter overrides.
+//
+// The same data is served as JSON at lsm.json, relative to the page. The
+// handler is meant to be registered on a path ending with a slash, for
+// example:
+//
+//	mux.Handle("/debug/lsm/", db.LSMViewHandler())
+//
+// The handler serves requests until the DB is closed, after which it responds
+// with 503 Service Unavailable.
+func (d *DB) LSMViewHandler() http.Handler {
+	return http.HandlerFunc(d.serveLSMView)
+}
+
+func (d *DB) serveLSMView(w http.ResponseWriter, r *http.Request) {
+	refresh := defaultLSMViewRefresh
+	if s := r.URL.Query().Get("refresh"); s != "" {
+		secs, err := strconv.Atoi(s)
+		if err != nil || secs < 0 {
+			http.Error(w, fmt.Sprintf("invalid refresh %q", s), http.StatusBadRequest)
+			return
+		}
+		refresh = time.Duration(secs) * time.Second
+	}
+	maxFiles := defaultLSMViewFiles
+	if s := r.URL.Query().Get("files"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid files %q", s), http.StatusBadRequest)
+			return
+		}
+		maxFiles = n
+	}
+
+	state, err := d.lsmViewState(maxFiles)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusServiceUnavailable)
+		return
+	}
+	if path.Base(r.URL.Path) == "lsm.json" {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(state); err != nil {
+			d.opts.Logger.Infof("serving LSM view: %s", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page := lsmViewPage{
+		State:          state,
+		RefreshSeconds: int(refresh / time.Second),
+	}
+	if err := lsmViewTemplate.Execute(w, page); err != nil {
+		d.opts.Logger.Infof("serving LSM view: %s", err)
+	}
+}
+
+// lsmViewState is the state of the LSM served by LSMViewHandler.
+type lsmViewState struct {
+	Time time.Time `json:"time"`
+	// LSM is the data of the LSM diagram, and URL the URL showing it.
+	LSM lsmview.Data `json:"lsm"`
+	URL string       `json:"url"`
+	// Metrics is the formatted DB.Metrics.
+	Metrics     string              `json:"metrics"`
+	Compactions []lsmViewCompaction `json:"compactions"`
+	Levels      []lsmViewLevel      `json:"levels"`
+}
+
+// lsmViewCompaction describes an in-progress compaction or flush.
+type lsmViewCompaction struct {
+	Kind string `json:"kind"`
+	// StartLevel is -1 for flushes, and OutputLevel is unset for delete-only
+	// compactions.
+	StartLevel  int                      `json:"start_level"`
+	OutputLevel *int                     `json:"output_level,omitempty"`
+	Inputs      []lsmViewCompactionInput `json:"inputs"`
+	InputBytes  uint64                   `json:"input_bytes"`
+	Smallest    string                   `json:"smallest"`
+	Largest     string                   `json:"largest"`
+	Duration    time.Duration            `json:"duration_ns"`
+}
+
+// lsmViewCompactionInput lists the files of a level read by a compaction.
+type lsmViewCompactionInput struct {
+	Level int      `json:"level"`
+	Files []string `json:"files"`
+}
+
+// lsmViewLevel describes a level of the LSM.
+type lsmViewLevel struct {
+	Level     int           `json:"level"`
+	NumFiles  int64         `json:"num_files"`
+	Size      uint64        `json:"size"`
+	Score     float64       `json:"score"`
+	Sublevels int32         `json:"sublevels"`
+	Files     []lsmViewFile `json:"files"`
+	// OmittedFiles is the number of files of the level beyond the maximum
+	// number of files listed.
+	OmittedFiles int `json:"omitted_files,omitempty"`
+}
+
+// lsmViewFile describes a file of the LSM.
+type lsmViewFile struct {
+	FileNum string `json:"file_num"`
+	// Sublevel is the L0 sublevel of the file, and zero for the files of the
+	// other levels.
+	Sublevel       int    `json:"sublevel"`
+	Size           uint64 `json:"size"`
+	Smallest       string `json:"smallest"`
+	Largest        string `json:"largest"`
+	SmallestSeqNum uint64 `json:"smallest_seq_num"`
+	LargestSeqNum  uint64 `json:"largest_seq_num"`
+	Virtual        bool   `json:"virtual"`
+	Compacting     bool   `json:"compacting"`
+	// Overlaps lists the files of the older sublevels and lower levels whose
+	// key ranges overlap the key range of the file.
+	Overlaps []lsmViewOverlap `json:"overlaps"`
+}
+
+// lsmViewOverlap lists the files of a level (named as in the LSM diagram,
+// e.g. "L0.1" or "L3") overlapping a file.
+type lsmViewOverlap struct {
+	Level string   `json:"level"`
+	Files []string `json:"files"`
+}
+
+// lsmViewState returns the current state of the LSM, listing at most maxFiles
+// files per level. It returns ErrClosed if the DB is closed; otherwise, Close
+// waits for it to return, since it opens the tables of the LSM.
+func (d *DB) lsmViewState(maxFiles int) (lsmViewState, error) {
+	d.mu.Lock()
+	if err := d.closed.Load(); err != nil {
+		d.mu.Unlock()
+		return lsmViewState{}, err.(error)
+	}
+	d.mu.lsmViews.serving++
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.mu.lsmViews.serving--
+		d.mu.lsmViews.cond.Broadcast()
+	}()
+
+	state := lsmViewState{Time: time.Now()}
+	metrics := d.Metrics()
+	state.Metrics = metrics.String()
+
+	var compacting map[base.FileNum]bool
+	v := func() *version {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		state.Compactions, compacting = d.inProgressCompactionsForLSMView(state.Time)
+		v := d.mu.versions.currentVersion()
+		v.Ref()
+		return v
+	}()
+	defer v.Unref()
+
+	b := d.newLSMViewBuilder(v)
+	state.LSM = b.Build(d.objProvider, d.newIters)
+	if url, err := lsmview.GenerateURL(state.LSM); err == nil {
+		state.URL = url.String()
+	}
+
+	// The levels of the builder are in newest-to-oldest order, starting with
+	// the L0 sublevels.
+	fileName := func(f *fileMetadata) string { return f.FileNum.String() }
+	state.Levels = make([]lsmViewLevel, numLevels)
+	for level := range state.Levels {
+		l := &state.Levels[level]
+		l.Level = level
+		l.NumFiles = metrics.Levels[level].NumFiles
+		l.Size = uint64(metrics.Levels[level].Size)
+		l.Score = metrics.Levels[level].Score
+		l.Sublevels = metrics.Levels[level].Sublevels
+	}
+	for i, files := range b.levels {
+		level, sublevel := 0, 0
+		if i < len(v.L0SublevelFiles) {
+			sublevel = len(v.L0SublevelFiles) - 1 - i
+		} else {
+			level = i - max(len(v.L0SublevelFiles), 1) + 1
+		}
+		for _, f := range files {
+			if len(state.Levels[level].Files) >= maxFiles {
+				state.Levels[level].OmittedFiles++
+				continue
+			}
+			vf := lsmViewFile{
+				FileNum:        fileName(f),
+				Sublevel:       sublevel,
+				Size:           f.Size,
+				Smallest:       fmt.Sprint(f.Smallest.Pretty(b.fmtKey)),
+				Largest:        fmt.Sprint(f.Largest.Pretty(b.fmtKey)),
+				SmallestSeqNum: f.SmallestSeqNum,
+				LargestSeqNum:  f.LargestSeqNum,
+				Virtual:        f.Virtual,
+				Compacting:     compacting[f.FileNum],
+			}
+			for j := i + 1; j < len(b.levels); j++ {
+				if overlaps := b.overlappingFiles(f, b.levels[j]); len(overlaps) > 0 {
+					o := lsmViewOverlap{Level: b.levelNames[j]}
+					for _, f := range overlaps {
+						o.Files = append(o.Files, fileName(f))
+					}
+					vf.Overlaps = append(vf.Overlaps, o)
+				}
+			}
+			state.Levels[level].Files = append(state.Levels[level].Files, vf)
+		}
+	}
+	return state, nil
+}
+
+// inProgressCompactionsForLSMView describes the in-progress compactions, in
+// the order in which they started, and returns the set of their input files.
+//
+// d.mu must be held when calling this.
+func (d *DB) inProgressCompactionsForLSMView(
+	now time.Time,
+) ([]lsmViewCompaction, map[base.FileNum]bool) {
+	fmtKey := d.opts.Comparer.FormatKey
+	if fmtKey == nil {
+		fmtKey = DefaultComparer.FormatKey
+	}
+	compactions := make([]*compaction, 0, len(d.mu.compact.inProgress))
+	for c := range d.mu.compact.inProgress {
+		compactions = append(compactions, c)
+	}
+	slices.SortFunc(compactions, func(a, b *compaction) int {
+		return a.beganAt.Compare(b.beganAt)
+	})
+	res := make([]lsmViewCompaction, len(compactions))
+	compacting := make(map[base.FileNum]bool)
+	for i, c := range compactions {
+		vc := &res[i]
+		vc.Kind = c.kind.String()
+		vc.StartLevel = c.startLevel.level
+		if c.outputLevel != nil {
+			outputLevel := c.outputLevel.level
+			vc.OutputLevel = &outputLevel
+		}
+		for _, cl := range c.inputs {
+			input := lsmViewCompactionInput{Level: cl.level}
+			iter := cl.files.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				input.Files = append(input.Files, f.FileNum.String())
+				vc.InputBytes += f.Size
+				compacting[f.FileNum] = true
+			}
+			if len(input.Files) > 0 {
+				vc.Inputs = append(vc.Inputs, input)
+			}
+		}
+		if c.kind == compactionKindFlush || c.kind == compactionKindIngestedFlushable {
+			for _, f := range c.flushing {
+				vc.InputBytes += f.inuseBytes()
+			}
+		}
+		vc.Smallest = fmt.Sprint(c.smallest.Pretty(fmtKey))
+		vc.Largest = fmt.Sprint(c.largest.Pretty(fmtKey))
+		vc.Duration = now.Sub(c.beganAt)
+	}
+	return res, compacting
+}
+
+// overlappingFiles returns the files of the given level, whose files must be
+// sorted and non-overlapping, whose key ranges overlap the key range of f.
+func (b *lsmViewBuilder) overlappingFiles(f *fileMetadata, files []*fileMetadata) []*fileMetadata {
+	// before returns whether the key range ending at end (exclusive if the key
+	// is an exclusive sentinel) ends before the key range starting at start.
+	before := func(end base.InternalKey, start []byte) bool {
+		c := b.cmp(end.UserKey, start)
+		return c < 0 || (c == 0 && end.IsExclusiveSentinel())
+	}
+	i, _ := slices.BinarySearchFunc(files, f, func(g, f *fileMetadata) int {
+		if before(g.Largest, f.Smallest.UserKey) {
+			return -1
+		}
+		return 1
+	})
+	j := i
+	for j < len(files) && !before(f.Largest, files[j].Smallest.UserKey) {
+		j++
+	}
+	return files[i:j]
+}
+
+// lsmViewPage is the data of lsmViewTemplate.
+type lsmViewPage struct {
+	State          lsmViewState
+	RefreshSeconds int
+}
+
+var lsmViewTemplate = template.Must(template.New("lsm").Funcs(template.FuncMap{
+	"bytes": func(n uint64) string { return humanize.Bytes.Uint64(n).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{if .RefreshSeconds}}<meta http-equiv="refresh" content="{{.RefreshSeconds}}">{{end}}
+<title>LSM</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; vertical-align: top; }
+pre { font-size: 12px; }
+iframe { width: 100%; height: 600px; border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<p>{{.State.Time.Format "2006-01-02 15:04:05.000 MST"}}{{if .RefreshSeconds}}, refreshing every {{.RefreshSeconds}}s{{end}} &middot; <a href="lsm.json">JSON</a>{{with .State.URL}} &middot; <a href="{{.}}">diagram</a>{{end}}</p>
+{{with .State.URL}}<iframe src="{{.}}"></iframe>{{end}}
+<h2>Compactions</h2>
+{{if .State.Compactions}}
+<table>
+<tr><th>kind</th><th>levels</th><th>inputs</th><th>input bytes</th><th>key range</th><th>duration</th></tr>
+{{range .State.Compactions}}
+<tr><td>{{.Kind}}</td><td>L{{.StartLevel}}{{with .OutputLevel}} &rarr; L{{.}}{{end}}</td><td>{{range .Inputs}}L{{.Level}}: {{range .Files}}{{.}} {{end}}<br>{{end}}</td><td>{{bytes .InputBytes}}</td><td>{{.Smallest}} - {{.Largest}}</td><td>{{.Duration}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>none</p>
+{{end}}
+<h2>Levels</h2>
+{{range .State.Levels}}
+<h3>L{{.Level}}: {{.NumFiles}} files, {{bytes .Size}}, score {{printf "%.2f" .Score}}{{if .Sublevels}}, {{.Sublevels}} sublevels{{end}}</h3>
+{{if .Files}}
+<table>
+<tr><th>file</th>{{if eq .Level 0}}<th>sublevel</th>{{end}}<th>size</th><th>key range</th><th>seqnums</th><th>overlaps</th></tr>
+{{$level := .Level}}
+{{range .Files}}
+<tr><td>{{.FileNum}}{{if .Virtual}} (virtual){{end}}{{if .Compacting}} (compacting){{end}}</td>{{if eq $level 0}}<td>{{.Sublevel}}</td>{{end}}<td>{{bytes .Size}}</td><td>{{.Smallest}} - {{.Largest}}</td><td>{{.SmallestSeqNum}} - {{.LargestSeqNum}}</td><td>{{range .Overlaps}}{{.Level}}: {{range .Files}}{{.}} {{end}}<br>{{end}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{with .OmittedFiles}}<p>{{.}} more files</p>{{end}}
+{{end}}
+<h2>Metrics</h2>
+<pre>{{.State.Metrics}}</pre>
+</body>
+</html>
+`))
@@ -0,0 +1,121 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLSMViewHandler(t *testing.T) {
+	var d *DB
+	defer func() {
+		if d != nil {
+			require.NoError(t, d.Close())
+		}
+	}()
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		d.LSMViewHandler().ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+	datadriven.RunTest(t, "testdata/lsm_view_handler",
+		func(t *testing.T, td *datadriven.TestData) string {
+			switch td.Cmd {
+			case "define":
+				if d != nil {
+					require.NoError(t, d.Close())
+				}
+				var err error
+				d, err = runDBDefineCmd(td, nil /* options */)
+				if err != nil {
+					td.Fatalf(t, "error: %s", err)
+				}
+				return ""
+
+			case "json":
+				target := "/debug/lsm/lsm.json"
+				if td.HasArg("files") {
+					var files int
+					td.ScanArgs(t, "files", &files)
+					target += fmt.Sprintf("?files=%d", files)
+				}
+				rec := get(target)
+				require.Equal(t, http.StatusOK, rec.Code)
+				require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				var state lsmViewState
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+				require.NotEmpty(t, state.URL)
+				require.NotEmpty(t, state.Metrics)
+				var buf strings.Builder
+				fmt.Fprintf(&buf, "compactions: %d\n", len(state.Compactions))
+				for _, l := range state.Levels {
+					if len(l.Files) == 0 {
+						continue
+					}
+					fmt.Fprintf(&buf, "L%d: %d files, %d sublevels\n", l.Level, l.NumFiles, l.Sublevels)
+					for _, f := range l.Files {
+						fmt.Fprintf(&buf, "  %s", f.FileNum)
+						if l.Level == 0 {
+							fmt.Fprintf(&buf, " (sublevel %d)", f.Sublevel)
+						}
+						fmt.Fprintf(&buf, " [%s-%s]", f.Smallest, f.Largest)
+						for _, o := range f.Overlaps {
+							fmt.Fprintf(&buf, " %s:%s", o.Level, strings.Join(o.Files, ","))
+						}
+						fmt.Fprintf(&buf, "\n")
+					}
+					if l.OmittedFiles > 0 {
+						fmt.Fprintf(&buf, "  %d more\n", l.OmittedFiles)
+					}
+				}
+				return buf.String()
+
+			default:
+				td.Fatalf(t, "unknown command %q", td.Cmd)
+				return ""
+			}
+		})
+
+	// The page refreshes itself, unless disabled, and links to the JSON data.
+	rec := get("/debug/lsm/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	page := rec.Body.String()
+	require.Contains(t, page, `<meta http-equiv="refresh" content="10">`)
+	require.Contains(t, page, `<a href="lsm.json">`)
+	require.Contains(t, page, `<iframe src="https://raduberinde.github.io/lsmview/decode.html#`)
+	require.Contains(t, page, "<h3>L6: 1 files")
+	page = get("/debug/lsm/?refresh=0").Body.String()
+	require.NotContains(t, page, `http-equiv="refresh"`)
+	require.Equal(t, http.StatusBadRequest, get("/debug/lsm/?refresh=x").Code)
+	require.Equal(t, http.StatusBadRequest, get("/debug/lsm/?files=-1").Code)
+
+	// Requests concurrent with Close either complete or fail cleanly.
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- get("/debug/lsm/lsm.json").Code
+		}()
+	}
+	require.NoError(t, d.Close())
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		require.Contains(t, []int{http.StatusOK, http.StatusServiceUnavailable}, code)
+	}
+	require.Equal(t, http.StatusServiceUnavailable, get("/debug/lsm/").Code)
+	d = nil
+}
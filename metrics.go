@@ -162,6 +162,23 @@ type Metrics struct {
 		RewriteCount      int64
 		MultiLevelCount   int64
 		CounterLevelCount int64
+		// The number of compactions of tables whose age exceeded
+		// Options.Experimental.MaxTableAge or PeriodicCompactionInterval.
+		AgeCount int64
+		// The number of compactions of tables with a high density of point
+		// tombstones. See Options.Experimental.TombstoneDenseCompactionThreshold.
+		TombstoneDensityCount int64
+		// The number of compactions of the spans of compaction hints. See
+		// DB.AddCompactionHint.
+		HintCount int64
+		// The number of subcompactions run by compactions that were split into
+		// multiple concurrent subcompactions. See
+		// Options.Experimental.MaxSubcompactions.
+		SubcompactionCount int64
+		// The number of compactions that were resumed from a checkpoint after
+		// the database was reopened. See
+		// Options.Experimental.ResumableCompactionThreshold.
+		ResumedCount int64
 		// An estimate of the number of bytes that need to be compacted for the LSM
 		// to reach a stable state.
 		EstimatedDebt uint64
@@ -175,6 +192,12 @@ type Metrics struct {
 		// compaction. Such files are compacted in a rewrite compaction
 		// when no other compactions are picked.
 		MarkedFiles int
+		// OverdueFiles and OverdueBytes are the count and total size of files
+		// whose age exceeds Options.Experimental.MaxTableAge or
+		// PeriodicCompactionInterval and that are awaiting an age-based
+		// compaction. Files are reported as overdue up to a minute late.
+		OverdueFiles int
+		OverdueBytes uint64
 		// Duration records the cumulative duration of all compactions since the
 		// database was opened.
 		Duration time.Duration
@@ -229,6 +252,11 @@ type Metrics struct {
 		// The approximate count of internal tombstones (DEL, SINGLEDEL and
 		// RANGEDEL key kinds) within the database.
 		TombstoneCount uint64
+		// The approximate count of data blocks within the database whose
+		// entries are predominantly point tombstones. Only tables written with
+		// Options.Experimental.TombstoneDenseCompactionThreshold set are
+		// accounted for.
+		TombstoneDenseBlocksCount uint64
 		// A cumulative total number of missized DELSIZED keys encountered by
 		// compactions since the database was opened.
 		MissizedTombstonesCount uint64
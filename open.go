@@ -250,11 +250,13 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	}()
 
 	d.commit = newCommitPipeline(commitEnv{
-		logSeqNum:     &d.mu.versions.logSeqNum,
-		visibleSeqNum: &d.mu.versions.visibleSeqNum,
-		apply:         d.commitApply,
-		write:         d.commitWrite,
+		logSeqNum:       &d.mu.versions.logSeqNum,
+		visibleSeqNum:   &d.mu.versions.visibleSeqNum,
+		apply:           d.commitApply,
+		write:           d.commitWrite,
+		checkConditions: d.commitCheckConditions,
 	})
+	d.seqNumTimes.init(opts)
 	d.mu.nextJobID = 1
 	d.mu.mem.nextSize = opts.MemTableSize
 	if d.mu.mem.nextSize > initialMemTableSize {
@@ -328,7 +330,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		NoSyncOnClose:        opts.NoSyncOnClose,
 		BytesPerSync:         opts.WALBytesPerSync,
 		PreallocateSize:      d.walPreallocateSize,
-		MinSyncInterval:      opts.WALMinSyncInterval,
+		MinSyncInterval:      d.walMinSyncInterval,
 		FsyncLatency:         d.mu.log.metrics.fsyncLatency,
 		QueueSemChan:         d.commit.logSyncQSem,
 		Logger:               opts.Logger,
@@ -338,12 +340,21 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		walOpts.Secondary = opts.WALFailover.Secondary
 		walOpts.FailoverOptions = opts.WALFailover.FailoverOptions
 	}
+	if opts.WALMirror != nil {
+		walOpts.MirrorOptions = *opts.WALMirror
+	}
 	walDirs := append(walOpts.Dirs(), opts.WALRecoveryDirs...)
 	wals, err := wal.Scan(walDirs...)
 	if err != nil {
 		return nil, err
 	}
-	walManager, err := wal.Init(walOpts, wals)
+	var walManager wal.Manager
+	if opts.Experimental.WALManager != nil {
+		walManager = opts.Experimental.WALManager()
+		err = walManager.Init(walOpts, wals)
+	} else {
+		walManager, err = wal.Init(walOpts, wals)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -465,7 +476,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	var toFlush flushableList
 	for i, lf := range replayWALs {
 		lastWAL := i == len(replayWALs)-1
-		flush, maxSeqNum, err := d.replayWAL(jobID, &ve, lf, strictWALTail && !lastWAL)
+		flush, maxSeqNum, stopErr, err := d.replayWAL(jobID, &ve, lf, strictWALTail && !lastWAL)
 		if err != nil {
 			return nil, err
 		}
@@ -473,8 +484,21 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		if d.mu.versions.logSeqNum.Load() < maxSeqNum {
 			d.mu.versions.logSeqNum.Store(maxSeqNum)
 		}
+		if stopErr != nil {
+			// Replay stopped at a corrupted record. The subsequent WALs are
+			// dropped to recover a consistent point in time.
+			for _, dropped := range replayWALs[i+1:] {
+				d.reportDroppedWAL(jobID, dropped, stopErr)
+			}
+			break
+		}
 	}
 	d.mu.versions.visibleSeqNum.Store(d.mu.versions.logSeqNum.Load())
+	if d.seqNumTimes.enabled() {
+		// NB: the samples of the writes replayed from the WALs were lost, so
+		// reads as of the times they were committed observe an earlier state.
+		d.seqNumTimes.load(d.mu.versions.currentVersion(), d.mu.versions.visibleSeqNum.Load(), d.timeNow())
+	}
 
 	if !d.opts.ReadOnly {
 		// Create an empty .log file.
@@ -566,6 +590,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	}
 
 	if !d.opts.ReadOnly {
+		d.loadCompactionCheckpoints(ls)
 		d.scanObsoleteFiles(ls)
 		d.deleteObsoleteFiles(jobID)
 	}
@@ -573,6 +598,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 
 	d.mu.tableStats.cond.L = &d.mu.Mutex
 	d.mu.tableValidation.cond.L = &d.mu.Mutex
+	d.mu.lsmViews.cond.L = &d.mu.Mutex
 	if !d.opts.ReadOnly {
 		d.maybeCollectTableStatsLocked()
 	}
@@ -580,6 +606,10 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 
 	d.maybeScheduleFlush()
 	d.maybeScheduleCompaction()
+	if interval := ageCompactionCheckInterval(d.opts); interval > 0 && !d.opts.ReadOnly {
+		d.compactionSchedulers.Add(1)
+		go d.periodicallyScheduleCompactions(interval)
+	}
 
 	// Note: this is a no-op if invariants are disabled or race is enabled.
 	//
@@ -643,6 +673,15 @@ func prepareAndOpenDirs(
 			}
 			f.Close()
 		}
+		if opts.WALMirror != nil {
+			for _, mirror := range opts.WALMirror.Mirrors {
+				f, err := mkdirAllAndSyncParents(mirror.FS, mirror.Dirname)
+				if err != nil {
+					return "", nil, err
+				}
+				f.Close()
+			}
+		}
 	}
 
 	dataDir, err = opts.FS.OpenDir(dirname)
@@ -740,16 +779,23 @@ func GetVersion(dir string, fs vfs.FS) (string, error) {
 // to the manifest, it is up to the caller of replayWAL to unreference the
 // toFlush flushables returned by replayWAL.
 //
+// Corrupted records are handled according to Options.WALRecoveryMode. If
+// strictWALTail is false, the WAL may have an unclean tail, which
+// WALRecoveryTolerateCorruptedTail tolerates. The stopErr return value is
+// non-nil if WALRecoveryPointInTime stopped replay at a corrupted record, in
+// which case the subsequent WALs must not be replayed.
+//
 // d.mu must be held when calling this, but the mutex may be dropped and
 // re-acquired during the course of this method.
 func (d *DB) replayWAL(
 	jobID int, ve *versionEdit, ll wal.LogicalLog, strictWALTail bool,
-) (toFlush flushableList, maxSeqNum uint64, err error) {
+) (toFlush flushableList, maxSeqNum uint64, stopErr error, err error) {
 	rr := ll.OpenForRead()
 	defer rr.Close()
 	var (
 		b               Batch
 		buf             bytes.Buffer
+		decompressBuf   []byte
 		mem             *memTable
 		entry           *flushableEntry
 		offset          int64 // byte offset in rr
@@ -826,47 +872,132 @@ func (d *DB) replayWAL(
 		}
 	}()
 
+	mode := d.opts.WALRecoveryMode
+	// nextSeqNum is the sequence number following the records replayed so far,
+	// and so the first sequence number of any records dropped.
+	nextSeqNum := d.mu.versions.logSeqNum.Load()
+	// skipped describes the records skipped by
+	// WALRecoverySkipAnyCorruptedRecords since the last replayed record. It's
+	// reported once replay resumes or the WAL ends.
+	var skipped *WALRecordsDroppedInfo
+	// tolerateCorruption handles the corrupted record at offset according to
+	// the recovery mode. It returns whether replay resumes with the next intact
+	// record, or an error if the corruption isn't tolerated. If replay doesn't
+	// resume, the remainder of the WAL is dropped.
+	tolerateCorruption := func(offset wal.Offset, corruptionErr error) (resume bool, err error) {
+		info := WALRecordsDroppedInfo{
+			JobID:       jobID,
+			FileNum:     base.DiskFileNum(ll.Num),
+			Path:        offset.PhysicalFile,
+			Offset:      offset.Physical,
+			EndOffset:   -1,
+			StartSeqNum: nextSeqNum,
+			Mode:        mode,
+			Err:         corruptionErr,
+		}
+		switch mode {
+		case WALRecoverySkipAnyCorruptedRecords:
+			if !wal.RecoverReader(rr) {
+				return false, errors.Wrap(corruptionErr, "pebble: error when replaying WAL")
+			}
+			if skipped == nil {
+				skipped = &info
+			}
+			return true, nil
+		case WALRecoveryTolerateCorruptedTail:
+			if strictWALTail || !record.IsInvalidRecord(corruptionErr) {
+				return false, errors.Wrap(corruptionErr, "pebble: error when replaying WAL")
+			}
+		case WALRecoveryPointInTime:
+		default:
+			return false, errors.Wrap(corruptionErr, "pebble: error when replaying WAL")
+		}
+		// It is common to encounter a zeroed or invalid chunk due to WAL
+		// preallocation and WAL recycling, or a torn record if the process
+		// crashed while writing it. We need to distinguish these from EOF in
+		// order to recognize that the record was truncated and to avoid
+		// replaying subsequent WALs, and to report the intact records that
+		// follow the corruption, if any.
+		if wal.RecoverReader(rr) {
+			_, info.EndSeqNum = scanWALSeqNums(rr)
+		}
+		if info.EndSeqNum == 0 && (mode == WALRecoveryTolerateCorruptedTail ||
+			(!strictWALTail && corruptionErr == record.ErrZeroedChunk)) {
+			// The corruption is the unclean tail of the WAL, and no records
+			// were dropped.
+			return false, nil
+		}
+		if mode == WALRecoveryPointInTime {
+			stopErr = corruptionErr
+		}
+		d.opts.EventListener.WALRecordsDropped(info)
+		return false, nil
+	}
+
 	for {
 		r, offset, err := rr.NextRecord()
 		if err == nil {
 			_, err = io.Copy(&buf, r)
 		}
+		if err == nil && buf.Len() < batchrepr.HeaderLen {
+			err = base.CorruptionErrorf("pebble: corrupt wal %s (offset %s)",
+				errors.Safe(base.DiskFileNum(ll.Num)), offset)
+		}
+		var repr []byte
+		if err == nil && !d.opts.ErrorIfNotPristine {
+			// Decompress ahead of time to handle a corrupted batch like any
+			// other corrupted record.
+			repr, err = batchrepr.Decompress(decompressBuf, buf.Bytes())
+			if err != nil {
+				err = base.MarkCorruptionError(errors.Wrapf(err, "pebble: corrupt wal %s (offset %s)",
+					errors.Safe(base.DiskFileNum(ll.Num)), offset))
+			}
+		}
 		if err != nil {
-			// It is common to encounter a zeroed or invalid chunk due to WAL
-			// preallocation and WAL recycling. We need to distinguish these
-			// errors from EOF in order to recognize that the record was
-			// truncated and to avoid replaying subsequent WALs, but want
-			// to otherwise treat them like EOF.
 			if err == io.EOF {
 				break
-			} else if record.IsInvalidRecord(err) && !strictWALTail {
-				break
+			} else if !record.IsInvalidRecord(err) && !errors.Is(err, base.ErrCorruption) {
+				return nil, 0, nil, errors.Wrap(err, "pebble: error when replaying WAL")
 			}
-			return nil, 0, errors.Wrap(err, "pebble: error when replaying WAL")
-		}
-
-		if buf.Len() < batchrepr.HeaderLen {
-			return nil, 0, base.CorruptionErrorf("pebble: corrupt wal %s (offset %s)",
-				errors.Safe(base.DiskFileNum(ll.Num)), offset)
+			buf.Reset()
+			resume, err := tolerateCorruption(offset, err)
+			if err != nil {
+				return nil, 0, nil, err
+			} else if resume {
+				continue
+			}
+			break
 		}
 
 		if d.opts.ErrorIfNotPristine {
-			return nil, 0, errors.WithDetailf(ErrDBNotPristine, "location: %q", d.dirname)
+			return nil, 0, nil, errors.WithDetailf(ErrDBNotPristine, "location: %q", d.dirname)
+		}
+		if skipped != nil {
+			if skipped.Path == offset.PhysicalFile {
+				skipped.EndOffset = offset.Physical
+			}
+			skipped.EndSeqNum = batchrepr.ReadSeqNum(buf.Bytes())
+			d.opts.EventListener.WALRecordsDropped(*skipped)
+			skipped = nil
 		}
 
 		// Specify Batch.db so that Batch.SetRepr will compute Batch.memTableSize
 		// which is used below.
 		b = Batch{}
 		b.db = d
-		b.SetRepr(buf.Bytes())
+		if batchrepr.ReadCompression(buf.Bytes()) != batchrepr.NoCompression {
+			decompressBuf = repr
+		}
+		b.SetRepr(repr)
 		seqNum := b.SeqNum()
 		maxSeqNum = seqNum + uint64(b.Count())
+		nextSeqNum = maxSeqNum
 		keysReplayed += int64(b.Count())
 		batchesReplayed++
 		{
 			br := b.Reader()
 			if kind, encodedFileNum, _, ok, err := br.Next(); err != nil {
-				return nil, 0, err
+				return nil, 0, nil, err
 			} else if ok && kind == InternalKeyKindIngestSST {
 				fileNums := make([]base.DiskFileNum, 0, b.Count())
 				addFileNum := func(encodedFileNum []byte) {
@@ -881,7 +1012,7 @@ func (d *DB) replayWAL(
 				for i := 1; i < int(b.Count()); i++ {
 					kind, encodedFileNum, _, ok, err := br.Next()
 					if err != nil {
-						return nil, 0, err
+						return nil, 0, nil, err
 					}
 					if kind != InternalKeyKindIngestSST {
 						panic("pebble: invalid batch key kind.")
@@ -893,7 +1024,7 @@ func (d *DB) replayWAL(
 				}
 
 				if _, _, _, ok, err := br.Next(); err != nil {
-					return nil, 0, err
+					return nil, 0, nil, err
 				} else if ok {
 					panic("pebble: invalid number of entries in batch.")
 				}
@@ -903,29 +1034,29 @@ func (d *DB) replayWAL(
 					var readable objstorage.Readable
 					objMeta, err := d.objProvider.Lookup(fileTypeTable, n)
 					if err != nil {
-						return nil, 0, errors.Wrap(err, "pebble: error when looking up ingested SSTs")
+						return nil, 0, nil, errors.Wrap(err, "pebble: error when looking up ingested SSTs")
 					}
 					if objMeta.IsRemote() {
 						readable, err = d.objProvider.OpenForReading(context.TODO(), fileTypeTable, n, objstorage.OpenOptions{MustExist: true})
 						if err != nil {
-							return nil, 0, errors.Wrap(err, "pebble: error when opening flushable ingest files")
+							return nil, 0, nil, errors.Wrap(err, "pebble: error when opening flushable ingest files")
 						}
 					} else {
 						path := base.MakeFilepath(d.opts.FS, d.dirname, fileTypeTable, n)
 						f, err := d.opts.FS.Open(path)
 						if err != nil {
-							return nil, 0, err
+							return nil, 0, nil, err
 						}
 
 						readable, err = sstable.NewSimpleReadable(f)
 						if err != nil {
-							return nil, 0, err
+							return nil, 0, nil, err
 						}
 					}
 					// NB: ingestLoad1 will close readable.
 					meta[i], err = ingestLoad1(d.opts, d.FormatMajorVersion(), readable, d.cacheID, base.PhysicalTableFileNum(n))
 					if err != nil {
-						return nil, 0, errors.Wrap(err, "pebble: error when loading flushable ingest files")
+						return nil, 0, nil, errors.Wrap(err, "pebble: error when loading flushable ingest files")
 					}
 				}
 
@@ -937,7 +1068,7 @@ func (d *DB) replayWAL(
 					meta, seqNum, base.DiskFileNum(ll.Num),
 				)
 				if err != nil {
-					return nil, 0, err
+					return nil, 0, nil, err
 				}
 
 				if d.opts.ReadOnly {
@@ -975,13 +1106,13 @@ func (d *DB) replayWAL(
 						d.timeNow(),
 					)
 					if err != nil {
-						return nil, 0, err
+						return nil, 0, nil, err
 					}
 					for _, file := range c.flushing[0].flushable.(*ingestedFlushable).files {
 						ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: 0, Meta: file.FileMetadata})
 					}
 				}
-				return toFlush, maxSeqNum, nil
+				return toFlush, maxSeqNum, nil, nil
 			}
 		}
 
@@ -992,7 +1123,7 @@ func (d *DB) replayWAL(
 			b.data = slices.Clone(b.data)
 			b.flushable, err = newFlushableBatch(&b, d.opts.Comparer)
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, nil, err
 			}
 			entry := d.newFlushableEntry(b.flushable, base.DiskFileNum(ll.Num), b.SeqNum())
 			// Disable memory accounting by adding a reader ref that will never be
@@ -1015,7 +1146,7 @@ func (d *DB) replayWAL(
 		} else {
 			ensureMem(seqNum)
 			if err = mem.prepare(&b); err != nil && err != arenaskl.ErrArenaFull {
-				return nil, 0, err
+				return nil, 0, nil, err
 			}
 			// We loop since DB.newMemTable() slowly grows the size of allocated memtables, so the
 			// batch may not initially fit, but will eventually fit (since it is smaller than
@@ -1025,17 +1156,22 @@ func (d *DB) replayWAL(
 				ensureMem(seqNum)
 				err = mem.prepare(&b)
 				if err != nil && err != arenaskl.ErrArenaFull {
-					return nil, 0, err
+					return nil, 0, nil, err
 				}
 			}
 			if err = mem.apply(&b, seqNum); err != nil {
-				return nil, 0, err
+				return nil, 0, nil, err
 			}
 			mem.writerUnref()
 		}
 		buf.Reset()
 	}
 
+	if skipped != nil && (strictWALTail || skipped.Err != record.ErrZeroedChunk) {
+		// The zeroed chunk of a WAL with an unclean tail is expected to be its
+		// preallocated tail, and nothing was dropped.
+		d.opts.EventListener.WALRecordsDropped(*skipped)
+	}
 	d.opts.Logger.Infof("[JOB %d] WAL %s stopped reading at offset: %d; replayed %d keys in %d batches",
 		jobID, base.DiskFileNum(ll.Num).String(), offset, keysReplayed, batchesReplayed)
 	flushMem()
@@ -1044,10 +1180,60 @@ func (d *DB) replayWAL(
 	if !d.opts.ReadOnly && batchesReplayed > 0 {
 		err = updateVE()
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, nil, err
+		}
+	}
+	return toFlush, maxSeqNum, stopErr, err
+}
+
+// scanWALSeqNums reads the remaining records of rr, skipping corrupted
+// records, and returns the bounds [start, end) of the sequence numbers of the
+// intact records, or zeros if there are none.
+func scanWALSeqNums(rr wal.Reader) (start, end uint64) {
+	for {
+		r, _, err := rr.NextRecord()
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(r)
+		}
+		if err == io.EOF {
+			return start, end
+		} else if (record.IsInvalidRecord(err) || errors.Is(err, base.ErrCorruption)) && wal.RecoverReader(rr) {
+			continue
+		} else if err != nil {
+			return start, end
+		}
+		if h, ok := batchrepr.ReadHeader(data); ok && h.Count > 0 {
+			if start == 0 || h.SeqNum < start {
+				start = h.SeqNum
+			}
+			end = max(end, h.SeqNum+uint64(h.Count))
 		}
 	}
-	return toFlush, maxSeqNum, err
+}
+
+// reportDroppedWAL reports the records of a WAL dropped because
+// WALRecoveryPointInTime stopped replay at a corrupted record in a previous
+// WAL.
+func (d *DB) reportDroppedWAL(jobID int, ll wal.LogicalLog, stopErr error) {
+	rr := ll.OpenForRead()
+	defer rr.Close()
+	start, end := scanWALSeqNums(rr)
+	if end == 0 {
+		// The WAL contains no records.
+		return
+	}
+	_, path := ll.SegmentLocation(0)
+	d.opts.EventListener.WALRecordsDropped(WALRecordsDroppedInfo{
+		JobID:       jobID,
+		FileNum:     base.DiskFileNum(ll.Num),
+		Path:        path,
+		EndOffset:   -1,
+		StartSeqNum: start,
+		EndSeqNum:   end,
+		Mode:        d.opts.WALRecoveryMode,
+		Err:         stopErr,
+	})
 }
 
 func checkOptions(opts *Options, path string) (strictWALTail bool, err error) {
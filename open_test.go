@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -17,18 +18,21 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"testing"
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/vfs/atomicfs"
@@ -324,7 +328,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000004.017",
+			"marker.format-version.000005.018",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -1520,3 +1524,347 @@ func TestOpenRatchetsNextFileNum(t *testing.T) {
 	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
 
 }
+
+func TestOpenWALCompression(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{
+		FS:                 fs,
+		FormatMajorVersion: FormatWALCompression - 1,
+		WALCompression:     ZstdCompression,
+	}
+	value := func(i int) []byte { return bytes.Repeat([]byte{byte('a' + i)}, 1000) }
+
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	// Batches are not compressed before the format major version permits it.
+	require.NoError(t, d.Set([]byte("a"), value(0), nil))
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatWALCompression))
+	require.NoError(t, d.Set([]byte("b"), value(1), nil))
+	require.NoError(t, d.Set([]byte("c"), value(2), nil))
+	m := d.Metrics()
+	require.Less(t, m.WAL.BytesWritten, m.WAL.BytesIn)
+	require.NoError(t, d.Close())
+
+	// The WAL contains both uncompressed and compressed batches.
+	ls, err := fs.List("")
+	require.NoError(t, err)
+	var compressions []batchrepr.Compression
+	for _, filename := range ls {
+		num, _, ok := wal.ParseLogFilename(filename)
+		if !ok {
+			continue
+		}
+		f, err := fs.Open(filename)
+		require.NoError(t, err)
+		rr := record.NewReader(f, base.DiskFileNum(num))
+		for {
+			r, err := rr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			repr, err := io.ReadAll(r)
+			require.NoError(t, err)
+			compressions = append(compressions, batchrepr.ReadCompression(repr))
+		}
+		require.NoError(t, f.Close())
+	}
+	require.Equal(t, []batchrepr.Compression{
+		batchrepr.NoCompression, batchrepr.ZstdCompression, batchrepr.ZstdCompression,
+	}, compressions)
+
+	// The WAL is replayed when the database is reopened, regardless of the
+	// configured compression.
+	opts.WALCompression = NoCompression
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	for i, k := range []string{"a", "b", "c"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, value(i), v)
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+}
+
+// replicatingWALManager is a wal.Manager that synchronously mirrors every WAL
+// record to a peer before writing it to the wrapped Manager.
+type replicatingWALManager struct {
+	wal.Manager
+	peer *walPeer
+}
+
+// walPeer is an in-process stand-in for a remote replica of the WAL.
+type walPeer struct {
+	mu      sync.Mutex
+	records [][]byte
+}
+
+func (m *replicatingWALManager) Init(o wal.Options, initial wal.Logs) error {
+	var err error
+	m.Manager, err = wal.Init(o, initial)
+	return err
+}
+
+func (m *replicatingWALManager) Create(wn wal.NumWAL, jobID int) (wal.Writer, error) {
+	w, err := m.Manager.Create(wn, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return &replicatingWALWriter{Writer: w, peer: m.peer}, nil
+}
+
+type replicatingWALWriter struct {
+	wal.Writer
+	peer *walPeer
+}
+
+func (w *replicatingWALWriter) WriteRecord(
+	p []byte, opts wal.SyncOptions, ref wal.RefFunc,
+) (int64, error) {
+	w.peer.mu.Lock()
+	w.peer.records = append(w.peer.records, slices.Clone(p))
+	w.peer.mu.Unlock()
+	return w.Writer.WriteRecord(p, opts, ref)
+}
+
+func TestOpenWALManager(t *testing.T) {
+	fs := vfs.NewMem()
+	peer := &walPeer{}
+	opts := &Options{FS: fs, Logger: testLogger{t}}
+	opts.Experimental.WALManager = func() wal.Manager {
+		return &replicatingWALManager{peer: peer}
+	}
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		writeOpts := NoSync
+		if i%10 == 0 {
+			writeOpts = Sync
+		}
+		key := []byte(fmt.Sprintf("key%03d", i))
+		require.NoError(t, d.Set(key, key, writeOpts))
+		if i == 50 {
+			// Rotate the WAL.
+			require.NoError(t, d.Flush())
+		}
+	}
+	require.NoError(t, d.Close())
+
+	// The peer received every batch, in sequence number order.
+	require.Len(t, peer.records, 100)
+	first := batchrepr.ReadSeqNum(peer.records[0])
+	for i, repr := range peer.records {
+		h, ok := batchrepr.ReadHeader(repr)
+		require.True(t, ok)
+		require.Equal(t, first+uint64(i), h.SeqNum)
+		require.Equal(t, uint32(1), h.Count)
+	}
+
+	// The local WAL written by the wrapped manager is replayed on open.
+	d, err = Open("db", opts)
+	require.NoError(t, err)
+	v, closer, err := d.Get([]byte("key099"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key099"), v)
+	require.NoError(t, closer.Close())
+	require.NoError(t, d.Close())
+
+	// The peer's records suffice to reconstruct the database.
+	replica, err := Open("replica", &Options{FS: fs, Logger: testLogger{t}})
+	require.NoError(t, err)
+	for _, repr := range peer.records {
+		b := replica.NewBatch()
+		require.NoError(t, b.SetRepr(slices.Clone(repr)))
+		require.NoError(t, replica.Apply(b, NoSync))
+	}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i))
+		v, closer, err := replica.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, key, v)
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, replica.Close())
+}
+
+func TestOpenWALMirror(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{
+		FS:     fs,
+		Logger: testLogger{t},
+		WALMirror: &wal.MirrorOptions{
+			Mirrors:   []wal.Dir{{FS: fs, Dirname: "mirror"}},
+			AckPolicy: wal.MirrorAckAll,
+		},
+	}
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		require.NoError(t, d.Set(key, key, Sync))
+	}
+	logs, err := d.mu.log.manager.List()
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, 2, logs[0].NumSegments())
+	require.NoError(t, d.Close())
+
+	// Lose the copy of the WAL in the primary directory, as if its disk had
+	// failed. The unflushed writes are recovered from the mirror.
+	ls, err := fs.List("db")
+	require.NoError(t, err)
+	for _, filename := range ls {
+		if _, _, ok := wal.ParseLogFilename(filename); ok {
+			require.NoError(t, fs.Remove(fs.PathJoin("db", filename)))
+		}
+	}
+	d, err = Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		v, closer, err := d.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, key, v)
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+}
+
+func TestOpenWALRecoveryMode(t *testing.T) {
+	// makeFS returns a filesystem containing a database whose WAL is
+	// corrupted in its second 32KiB block, along with the sequence numbers of
+	// the keys written to the corrupted WAL. If secondWAL is true, a second
+	// intact WAL containing the key "z" follows the corrupted WAL.
+	makeFS := func(t *testing.T, secondWAL bool) (vfs.FS, []uint64) {
+		fs := vfs.NewMem()
+		d, err := Open("", &Options{FS: fs})
+		require.NoError(t, err)
+		var seqNums []uint64
+		for i := 0; i < 20; i++ {
+			b := d.NewBatch()
+			require.NoError(t, b.Set([]byte(fmt.Sprintf("k%02d", i)), bytes.Repeat([]byte{'v'}, 10<<10), nil))
+			require.NoError(t, d.Apply(b, NoSync))
+			seqNums = append(seqNums, b.SeqNum())
+			require.NoError(t, b.Close())
+		}
+		require.NoError(t, d.Close())
+
+		logs, err := wal.Scan(wal.Dir{FS: fs})
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		_, path := logs[0].SegmentLocation(0)
+		f, err := fs.OpenReadWrite(path)
+		require.NoError(t, err)
+		_, err = f.WriteAt([]byte("corruption"), 32<<10+100)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		if secondWAL {
+			b := newBatch(nil)
+			require.NoError(t, b.Set([]byte("z"), []byte("z"), nil))
+			b.setSeqNum(seqNums[len(seqNums)-1] + 1)
+			f, err := fs.Create(fmt.Sprintf("%s.log", base.DiskFileNum(logs[0].Num)+100))
+			require.NoError(t, err)
+			w := record.NewWriter(f)
+			rw, err := w.Next()
+			require.NoError(t, err)
+			_, err = rw.Write(b.Repr())
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			require.NoError(t, f.Close())
+		}
+		return fs, seqNums
+	}
+
+	// open opens the database, returning the dropped records reported.
+	open := func(
+		t *testing.T, fs vfs.FS, mode WALRecoveryMode,
+	) (*DB, []WALRecordsDroppedInfo, error) {
+		var dropped []WALRecordsDroppedInfo
+		d, err := Open("", &Options{
+			FS:              fs,
+			WALRecoveryMode: mode,
+			EventListener: &EventListener{
+				WALRecordsDropped: func(info WALRecordsDroppedInfo) {
+					dropped = append(dropped, info)
+				},
+			},
+		})
+		return d, dropped, err
+	}
+
+	// checkKeys checks that exactly the keys whose sequence numbers aren't in
+	// [start, end) were recovered.
+	checkKeys := func(t *testing.T, d *DB, seqNums []uint64, start, end uint64) {
+		for i, seqNum := range seqNums {
+			_, closer, err := d.Get([]byte(fmt.Sprintf("k%02d", i)))
+			if seqNum >= start && seqNum < end {
+				require.ErrorIs(t, err, ErrNotFound, "k%02d", i)
+			} else {
+				require.NoError(t, err, "k%02d", i)
+				require.NoError(t, closer.Close())
+			}
+		}
+	}
+
+	t.Run("absolute-consistency", func(t *testing.T) {
+		fs, _ := makeFS(t, false /* secondWAL */)
+		_, dropped, err := open(t, fs, WALRecoveryAbsoluteConsistency)
+		require.True(t, errors.Is(err, base.ErrCorruption), "%+v", err)
+		require.Empty(t, dropped)
+	})
+
+	t.Run("tolerate-corrupted-tail", func(t *testing.T) {
+		fs, seqNums := makeFS(t, false /* secondWAL */)
+		d, dropped, err := open(t, fs, WALRecoveryTolerateCorruptedTail)
+		require.NoError(t, err)
+		// The intact records following the corruption are dropped and
+		// reported.
+		require.Len(t, dropped, 1)
+		require.Equal(t, int64(-1), dropped[0].EndOffset)
+		require.Equal(t, record.ErrInvalidChunk, dropped[0].Err)
+		require.Equal(t, seqNums[len(seqNums)-1]+1, dropped[0].EndSeqNum)
+		checkKeys(t, d, seqNums, dropped[0].StartSeqNum, math.MaxUint64)
+		require.NoError(t, d.Close())
+
+		// The corruption is only tolerated in the most recent WAL.
+		fs, _ = makeFS(t, true /* secondWAL */)
+		_, _, err = open(t, fs, WALRecoveryTolerateCorruptedTail)
+		require.True(t, errors.Is(err, base.ErrCorruption), "%+v", err)
+	})
+
+	t.Run("point-in-time", func(t *testing.T) {
+		fs, seqNums := makeFS(t, true /* secondWAL */)
+		d, dropped, err := open(t, fs, WALRecoveryPointInTime)
+		require.NoError(t, err)
+		defer d.Close()
+		require.Len(t, dropped, 2)
+		require.Less(t, seqNums[0], dropped[0].StartSeqNum)
+		require.Equal(t, seqNums[len(seqNums)-1]+1, dropped[0].EndSeqNum)
+		checkKeys(t, d, seqNums, dropped[0].StartSeqNum, math.MaxUint64)
+		// The subsequent WAL is dropped entirely.
+		require.Equal(t, dropped[0].Err, dropped[1].Err)
+		require.Equal(t, int64(0), dropped[1].Offset)
+		require.Equal(t, seqNums[len(seqNums)-1]+1, dropped[1].StartSeqNum)
+		require.Equal(t, seqNums[len(seqNums)-1]+2, dropped[1].EndSeqNum)
+		_, _, err = d.Get([]byte("z"))
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("skip-any-corrupted-records", func(t *testing.T) {
+		fs, seqNums := makeFS(t, true /* secondWAL */)
+		d, dropped, err := open(t, fs, WALRecoverySkipAnyCorruptedRecords)
+		require.NoError(t, err)
+		defer d.Close()
+		require.Len(t, dropped, 1)
+		require.Less(t, dropped[0].Offset, int64(32<<10+100))
+		require.GreaterOrEqual(t, dropped[0].EndOffset, int64(64<<10))
+		require.Less(t, dropped[0].StartSeqNum, dropped[0].EndSeqNum)
+		checkKeys(t, d, seqNums, dropped[0].StartSeqNum, dropped[0].EndSeqNum)
+		v, closer, err := d.Get([]byte("z"))
+		require.NoError(t, err)
+		require.Equal(t, "z", string(v))
+		require.NoError(t, closer.Close())
+	})
+}
@@ -177,6 +177,19 @@ type IterOptions struct {
 	// weight than creating an iterator, so we have opted to support this
 	// iterator option.
 	OnlyReadGuaranteedDurable bool
+	// AsOfTime, if set, is an advanced option that is only supported by
+	// DB.NewIter. The iterator observes the state of the DB as of AsOfTime,
+	// which must be within the time-travel retention window configured by
+	// Options.TimeTravelRetention. See DB.SeqNumForTime for the precision of
+	// the observed state. AsOfTime may not be changed by SetOptions.
+	AsOfTime time.Time
+	// ReadTimestamp, if non-zero, hides the versions of keys with timestamps
+	// greater than ReadTimestamp. It requires Options.Timestamps. Since the
+	// versions of a prefix sort in decreasing timestamp order, the first
+	// visible key of a prefix is its newest version as of ReadTimestamp, and
+	// Iterator.NextPrefix skips over the older versions. Unversioned keys and
+	// range keys are always visible.
+	ReadTimestamp uint64
 	// UseL6Filters allows the caller to opt into reading filter blocks for L6
 	// sstables. Helpful if a lot of SeekPrefixGEs are expected in quick
 	// succession, that are also likely to not yield a single key. Filter blocks in
@@ -203,6 +216,10 @@ type IterOptions struct {
 	// files and is used to decide whether to hide obsolete points. A value of 0
 	// implies obsolete points should not be hidden.
 	snapshotForHideObsoletePoints uint64
+	// bufferPool, if set, is used to allocate the data blocks read from
+	// sstables instead of the block cache, so that the iterator doesn't fill
+	// the cache. The iterator must be closed before the pool is released.
+	bufferPool *sstable.BufferPool
 
 	// NB: If adding new Options, you must account for them in iterator
 	// construction and Iterator.SetOptions.
@@ -364,6 +381,20 @@ type WriteOptions struct {
 	//
 	// The default value is true.
 	Sync bool
+
+	// Durability is the durability the write must attain before the call that
+	// applies it returns, or before DB.ApplyAsync notifies its callback. If
+	// DurabilityDefault, the durability is determined by Sync.
+	Durability Durability
+
+	// GroupSyncWindow is the maximum duration a write with DurabilityGroupSync
+	// may wait for the WAL sync that makes it durable. Like
+	// Options.WALMinSyncInterval, the window delays the WAL sync following
+	// another sync, so that the writes within the window share a single sync.
+	// While such writes are being applied, the writes with DurabilitySync may
+	// be delayed by up to the window as well. If zero, DurabilityGroupSync is
+	// equivalent to DurabilitySync.
+	GroupSyncWindow time.Duration
 }
 
 // Sync specifies the default write options for writes which synchronize to
@@ -379,6 +410,64 @@ func (o *WriteOptions) GetSync() bool {
 	return o == nil || o.Sync
 }
 
+// GetDurability returns the durability requested by the write options,
+// resolving DurabilityDefault according to Sync. It returns DurabilitySync if
+// the receiver is nil.
+func (o *WriteOptions) GetDurability() Durability {
+	switch {
+	case o == nil:
+		return DurabilitySync
+	case o.Durability != DurabilityDefault:
+		return o.Durability
+	case o.Sync:
+		return DurabilitySync
+	default:
+		return DurabilityNone
+	}
+}
+
+// Durability describes how durable a write is once it has been applied.
+type Durability int8
+
+const (
+	// DurabilityDefault defers to WriteOptions.Sync: the write uses
+	// DurabilitySync if Sync is true and DurabilityNone otherwise.
+	DurabilityDefault Durability = iota
+	// DurabilityNone only guarantees that the write has been added to the WAL
+	// buffers of the process. It may be lost if the process crashes.
+	DurabilityNone
+	// DurabilityWritten guarantees that the write has been written to the
+	// operating system's buffers. It survives a crash of the process, but not
+	// of the machine.
+	DurabilityWritten
+	// DurabilityGroupSync guarantees that the write has been synced to stable
+	// storage by a WAL sync issued at most WriteOptions.GroupSyncWindow after
+	// the write. Writes within the same window share a single sync, trading
+	// latency for fewer syncs.
+	DurabilityGroupSync
+	// DurabilitySync guarantees that the write has been synced to stable
+	// storage.
+	DurabilitySync
+)
+
+// String implements fmt.Stringer.
+func (d Durability) String() string {
+	switch d {
+	case DurabilityDefault:
+		return "default"
+	case DurabilityNone:
+		return "none"
+	case DurabilityWritten:
+		return "written"
+	case DurabilityGroupSync:
+		return "group-sync"
+	case DurabilitySync:
+		return "sync"
+	default:
+		return fmt.Sprintf("Durability(%d)", int8(d))
+	}
+}
+
 // LevelOptions holds the optional per-level parameters.
 type LevelOptions struct {
 	// BlockRestartInterval is the number of keys between restart points
@@ -643,6 +732,68 @@ type Options struct {
 		// for CPUWorkPermissionGranter for more details.
 		CPUWorkPermissionGranter CPUWorkPermissionGranter
 
+		// MaxSubcompactions is the maximum number of disjoint key ranges a
+		// single compaction may be split into and run concurrently. Each
+		// subcompaction beyond the first occupies one of the slots permitted by
+		// MaxConcurrentCompactions, and compactions are only split when the
+		// CPUWorkPermissionGranter permits additional CPU work. Only compactions
+		// out of L1 and lower levels are split. A value of 0 or 1 disables
+		// subcompactions.
+		MaxSubcompactions int
+
+		// ResumableCompactionThreshold is the minimum total size of the input
+		// tables of a compaction for the compaction to be resumable. A
+		// resumable compaction records its progress in a checkpoint file as it
+		// finishes output tables. If the process exits before the
+		// compaction completes, the compaction is resumed after the database is
+		// reopened, reusing the checkpointed output tables and continuing from
+		// the end of the last one. Only compactions out of L1 and lower levels
+		// that are not multi-level compactions are resumable, and resumable
+		// compactions are not split into subcompactions. A value of 0 disables
+		// resumable compactions.
+		ResumableCompactionThreshold uint64
+
+		// ResumableCompactionCheckpointInterval is the minimum time between
+		// two checkpoints of a resumable compaction. The output tables finished
+		// in the interval are recorded by the next checkpoint. The default
+		// value is 10 seconds.
+		ResumableCompactionCheckpointInterval time.Duration
+
+		// MaxTableAge bounds the lifetime of sstables in levels above the
+		// bottommost level. Tables whose creation time is older than
+		// MaxTableAge are compacted into the next level once no
+		// higher-priority compaction is available, pushing tombstones down
+		// towards the data they delete. A value of 0 disables age-based
+		// compactions of non-bottommost levels.
+		MaxTableAge time.Duration
+
+		// PeriodicCompactionInterval bounds the lifetime of sstables in all
+		// levels. Tables whose creation time is older than
+		// PeriodicCompactionInterval are compacted into the next level or, in
+		// the bottommost level, rewritten in place, dropping deleted and
+		// overwritten data. At most one age-based compaction (see also
+		// MaxTableAge) runs at a time. A value of 0 disables periodic
+		// compactions.
+		PeriodicCompactionInterval time.Duration
+
+		// TombstoneDenseCompactionThreshold is the fraction of a table's data
+		// blocks that must be tombstone-dense, i.e. consist predominantly of
+		// point tombstones, for the table to be compacted even if the level
+		// scores do not call for a compaction. Such runs of tombstones slow
+		// down iteration, which must step over every tombstone. Setting a
+		// non-zero threshold also configures new sstables to be written with a
+		// block property collector that records the number of point
+		// tombstones within each data block. A value of 0 disables
+		// tombstone-density compactions.
+		TombstoneDenseCompactionThreshold float64
+
+		// PointKeyFingerprints configures new sstables to be written with the
+		// fingerprint of their point keys, when they consist only of SETs of
+		// distinct user keys. DB.Fingerprint reuses these fingerprints for the
+		// tables that lie within the fingerprinted span and that no other data
+		// overlaps, instead of reading the tables.
+		PointKeyFingerprints bool
+
 		// EnableValueBlocks is used to decide whether to enable writing
 		// TableFormatPebblev3 sstables. This setting is only respected by a
 		// specific subset of format major versions: FormatSSTableValueBlocks,
@@ -783,6 +934,17 @@ type Options struct {
 		//   which will later be consumed by SingleDelete#3. The violation will
 		//   not be detected and the DB will be correct.
 		SingleDeleteInvariantViolationCallback func(userKey []byte)
+
+		// WALManager, if non-nil, is called when the DB is opened to construct
+		// the manager of the DB's write-ahead logs, in place of the standalone
+		// or failover manager that Pebble would otherwise use. The returned
+		// Manager is initialized with the DB's WAL options, including the
+		// secondary directory if WALFailover is set, and must honor the
+		// contract documented on wal.Manager and wal.Writer. The logs it writes
+		// must be readable by wal.Scan, since they're replayed from the WAL
+		// directories when the DB is next opened. wal.Init may be used to
+		// construct a Manager to delegate to.
+		WALManager func() wal.Manager
 	}
 
 	// Filters is a map from filter policy name to filter policy. It is used for
@@ -980,6 +1142,15 @@ type Options struct {
 	// default behaviour in RocksDB.
 	WALBytesPerSync int
 
+	// WALCompression is the compression algorithm applied to the batches
+	// written to the write-ahead log. Only SnappyCompression and
+	// ZstdCompression enable compression; the default value
+	// (DefaultCompression) and NoCompression write batches uncompressed.
+	// Batches are written compressed only once the format major version is
+	// at least FormatWALCompression, and only if compression reduces their
+	// size.
+	WALCompression Compression
+
 	// WALDir specifies the directory to store write-ahead logs (WALs) in. If
 	// empty (the default), WALs will be stored in the same directory as sstables
 	// (i.e. the directory passed to pebble.Open).
@@ -992,6 +1163,15 @@ type Options struct {
 	// unavailability.
 	WALFailover *WALFailoverOptions
 
+	// WALMirror may be set to configure Pebble to write every write-ahead log
+	// entry to one or more mirror directories (eg, on separate physical disks)
+	// in addition to the primary WAL directory. A sync is acknowledged once
+	// the copies required by the ack policy are durable, which protects
+	// acknowledged writes against the loss of a single disk. When the WAL is
+	// replayed, the longest valid prefix among the copies is recovered.
+	// WALMirror and WALFailover are mutually exclusive.
+	WALMirror *wal.MirrorOptions
+
 	// WALRecoveryDirs is a list of additional directories that should be
 	// scanned for the existence of additional write-ahead logs. WALRecoveryDirs
 	// is expected to be used when starting Pebble with a new WALDir or a new
@@ -1003,6 +1183,18 @@ type Options struct {
 	// is not a corresponding entry in WALRecoveryDirs, Open will error.
 	WALRecoveryDirs []wal.Dir
 
+	// WALRecoveryMode determines how Open handles corrupted records while
+	// replaying the write-ahead logs. Records dropped because of a tolerated
+	// corruption are reported through EventListener.WALRecordsDropped.
+	//
+	// The default value is WALRecoveryTolerateCorruptedTail.
+	WALRecoveryMode WALRecoveryMode
+
+	// WALArchive may be set to archive write-ahead logs once they're no
+	// longer needed for recovery, rather than deleting or recycling them. See
+	// WALArchiveOptions.
+	WALArchive *WALArchiveOptions
+
 	// WALMinSyncInterval is the minimum duration between syncs of the WAL. If
 	// WAL syncs are requested faster than this interval, they will be
 	// artificially delayed. Introducing a small artificial delay (500us) between
@@ -1029,6 +1221,33 @@ type Options struct {
 	// Setting this to 0 disables deletion pacing, which is also the default.
 	TargetByteDeletionRate int
 
+	// SecondaryIndexes declares secondary indexes maintained atomically with
+	// the writes of their primary keys. See SecondaryIndex.
+	SecondaryIndexes []SecondaryIndex
+
+	// Timestamps, if set, enables first-class support for user-defined
+	// timestamps encoded in key suffixes. See TimestampOptions.
+	Timestamps *TimestampOptions
+
+	// TimeTravelRetention enables reads of the state of the DB as of a past
+	// time (see IterOptions.AsOfTime and DB.SeqNumForTime), up to
+	// TimeTravelRetention in the past. The DB samples the mapping from
+	// sequence numbers to wall-clock time as writes commit, and compactions
+	// preserve the state visible at each sample within the retention window,
+	// as they do for open snapshots. Longer retentions increase the space
+	// amplification of workloads that overwrite or delete keys.
+	//
+	// The default value is 0, which disables time-travel reads.
+	TimeTravelRetention time.Duration
+
+	// TimeTravelSampleInterval is the minimum interval between samples of the
+	// mapping from sequence numbers to wall-clock time, and bounds the
+	// precision of time-travel reads. It is only used if TimeTravelRetention
+	// is set.
+	//
+	// The default value is 1s.
+	TimeTravelSampleInterval time.Duration
+
 	// private options are only used by internal tests or are used internally
 	// for facilitating upgrade paths of unconfigurable functionality.
 	private struct {
@@ -1087,6 +1306,59 @@ type WALFailoverOptions struct {
 	wal.FailoverOptions
 }
 
+// WALRecoveryMode determines how corrupted records encountered while
+// replaying the write-ahead logs during Open are handled. A record is
+// corrupted if it was torn by a crash in the middle of a write, or if its
+// contents don't match its checksum.
+type WALRecoveryMode int8
+
+const (
+	// WALRecoveryTolerateCorruptedTail treats a corrupted record in the most
+	// recent WAL as the end of the WAL, which is expected if the process
+	// crashed while writing it. Intact records following the corrupted record
+	// are dropped and reported, while a corrupted tail isn't reported. A
+	// corrupted record in an older WAL fails Open.
+	WALRecoveryTolerateCorruptedTail WALRecoveryMode = iota
+	// WALRecoveryAbsoluteConsistency fails Open on any corrupted record,
+	// including a torn record at the end of the most recent WAL.
+	WALRecoveryAbsoluteConsistency
+	// WALRecoveryPointInTime stops replay at the first corrupted record in any
+	// WAL, recovering the database to a consistent point in time. The records
+	// following it, including those of subsequent WALs, are dropped.
+	WALRecoveryPointInTime
+	// WALRecoverySkipAnyCorruptedRecords skips corrupted records and continues
+	// replay with the next intact record, recovering as much data as possible.
+	// The recovered state may not correspond to any point in time.
+	WALRecoverySkipAnyCorruptedRecords
+)
+
+// String implements fmt.Stringer.
+func (m WALRecoveryMode) String() string {
+	switch m {
+	case WALRecoveryTolerateCorruptedTail:
+		return "tolerate-corrupted-tail"
+	case WALRecoveryAbsoluteConsistency:
+		return "absolute-consistency"
+	case WALRecoveryPointInTime:
+		return "point-in-time"
+	case WALRecoverySkipAnyCorruptedRecords:
+		return "skip-any-corrupted-records"
+	default:
+		return fmt.Sprintf("WALRecoveryMode(%d)", int8(m))
+	}
+}
+
+// ParseWALRecoveryMode parses the string representation of a WALRecoveryMode,
+// as returned by WALRecoveryMode.String.
+func ParseWALRecoveryMode(s string) (WALRecoveryMode, error) {
+	for m := WALRecoveryTolerateCorruptedTail; m <= WALRecoverySkipAnyCorruptedRecords; m++ {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, errors.Errorf("pebble: unknown WAL recovery mode: %q", errors.Safe(s))
+}
+
 // DebugCheckLevels calls CheckLevels on the provided database.
 // It may be set in the DebugCheck field of Options to check
 // level invariants whenever a new version is installed.
@@ -1201,6 +1473,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.NumPrevManifest <= 0 {
 		o.NumPrevManifest = 1
 	}
+	if o.TimeTravelSampleInterval <= 0 {
+		o.TimeTravelSampleInterval = time.Second
+	}
 
 	if o.FormatMajorVersion == FormatDefault {
 		o.FormatMajorVersion = FormatMinSupported
@@ -1227,6 +1502,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.Experimental.ReadSamplingMultiplier == 0 {
 		o.Experimental.ReadSamplingMultiplier = 1 << 4
 	}
+	if o.Experimental.ResumableCompactionCheckpointInterval <= 0 {
+		o.Experimental.ResumableCompactionCheckpointInterval = 10 * time.Second
+	}
 	if o.Experimental.TableCacheShards <= 0 {
 		o.Experimental.TableCacheShards = runtime.GOMAXPROCS(0)
 	}
@@ -1344,6 +1622,12 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  max_concurrent_compactions=%d\n", o.MaxConcurrentCompactions())
 	fmt.Fprintf(&buf, "  max_manifest_file_size=%d\n", o.MaxManifestFileSize)
 	fmt.Fprintf(&buf, "  max_open_files=%d\n", o.MaxOpenFiles)
+	if o.Experimental.MaxSubcompactions > 0 {
+		fmt.Fprintf(&buf, "  max_subcompactions=%d\n", o.Experimental.MaxSubcompactions)
+	}
+	if o.Experimental.MaxTableAge > 0 {
+		fmt.Fprintf(&buf, "  max_table_age=%s\n", o.Experimental.MaxTableAge)
+	}
 	fmt.Fprintf(&buf, "  mem_table_size=%d\n", o.MemTableSize)
 	fmt.Fprintf(&buf, "  mem_table_stop_writes_threshold=%d\n", o.MemTableStopWritesThreshold)
 	fmt.Fprintf(&buf, "  min_deletion_rate=%d\n", o.TargetByteDeletionRate)
@@ -1351,13 +1635,36 @@ func (o *Options) String() string {
 	if o.Experimental.MultiLevelCompactionHeuristic != nil {
 		fmt.Fprintf(&buf, "  multilevel_compaction_heuristic=%s\n", o.Experimental.MultiLevelCompactionHeuristic.String())
 	}
+	if o.Experimental.PeriodicCompactionInterval > 0 {
+		fmt.Fprintf(&buf, "  periodic_compaction_interval=%s\n", o.Experimental.PeriodicCompactionInterval)
+	}
+	if o.Experimental.PointKeyFingerprints {
+		fmt.Fprintf(&buf, "  point_key_fingerprints=%t\n", o.Experimental.PointKeyFingerprints)
+	}
 	fmt.Fprintf(&buf, "  read_compaction_rate=%d\n", o.Experimental.ReadCompactionRate)
 	fmt.Fprintf(&buf, "  read_sampling_multiplier=%d\n", o.Experimental.ReadSamplingMultiplier)
+	if o.Experimental.ResumableCompactionThreshold > 0 {
+		fmt.Fprintf(&buf, "  resumable_compaction_threshold=%d\n", o.Experimental.ResumableCompactionThreshold)
+		fmt.Fprintf(&buf, "  resumable_compaction_checkpoint_interval=%s\n", o.Experimental.ResumableCompactionCheckpointInterval)
+	}
 	fmt.Fprintf(&buf, "  strict_wal_tail=%t\n", o.private.strictWALTail)
 	fmt.Fprintf(&buf, "  table_cache_shards=%d\n", o.Experimental.TableCacheShards)
+	if o.TimeTravelRetention > 0 {
+		fmt.Fprintf(&buf, "  time_travel_retention=%s\n", o.TimeTravelRetention)
+		fmt.Fprintf(&buf, "  time_travel_sample_interval=%s\n", o.TimeTravelSampleInterval)
+	}
+	if o.Experimental.TombstoneDenseCompactionThreshold > 0 {
+		fmt.Fprintf(&buf, "  tombstone_dense_compaction_threshold=%f\n", o.Experimental.TombstoneDenseCompactionThreshold)
+	}
 	fmt.Fprintf(&buf, "  validate_on_ingest=%t\n", o.Experimental.ValidateOnIngest)
 	fmt.Fprintf(&buf, "  wal_dir=%s\n", o.WALDir)
 	fmt.Fprintf(&buf, "  wal_bytes_per_sync=%d\n", o.WALBytesPerSync)
+	if o.WALCompression == SnappyCompression || o.WALCompression == ZstdCompression {
+		fmt.Fprintf(&buf, "  wal_compression=%s\n", o.WALCompression)
+	}
+	if o.WALRecoveryMode != WALRecoveryTolerateCorruptedTail {
+		fmt.Fprintf(&buf, "  wal_recovery_mode=%s\n", o.WALRecoveryMode)
+	}
 	fmt.Fprintf(&buf, "  max_writer_concurrency=%d\n", o.Experimental.MaxWriterConcurrency)
 	fmt.Fprintf(&buf, "  force_writer_parallelism=%t\n", o.Experimental.ForceWriterParallelism)
 	fmt.Fprintf(&buf, "  secondary_cache_size_bytes=%d\n", o.Experimental.SecondaryCacheSizeBytes)
@@ -1392,6 +1699,15 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  elevated_write_stall_threshold_lag=%s\n", o.WALFailover.FailoverOptions.ElevatedWriteStallThresholdLag)
 	}
 
+	if o.WALMirror != nil {
+		fmt.Fprintf(&buf, "\n")
+		fmt.Fprintf(&buf, "[WAL Mirror]\n")
+		for _, d := range o.WALMirror.Mirrors {
+			fmt.Fprintf(&buf, "  dir=%s\n", d.Dirname)
+		}
+		fmt.Fprintf(&buf, "  ack_policy=%s\n", o.WALMirror.AckPolicy)
+	}
+
 	for i := range o.Levels {
 		l := &o.Levels[i]
 		fmt.Fprintf(&buf, "\n")
@@ -1596,6 +1912,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.MaxManifestFileSize, err = strconv.ParseInt(value, 10, 64)
 			case "max_open_files":
 				o.MaxOpenFiles, err = strconv.Atoi(value)
+			case "max_subcompactions":
+				o.Experimental.MaxSubcompactions, err = strconv.Atoi(value)
+			case "max_table_age":
+				o.Experimental.MaxTableAge, err = time.ParseDuration(value)
 			case "mem_table_size":
 				o.MemTableSize, err = strconv.ParseUint(value, 10, 64)
 			case "mem_table_stop_writes_threshold":
@@ -1634,6 +1954,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				default:
 					err = errors.Newf("unrecognized multilevel compaction heuristic: %s", value)
 				}
+			case "periodic_compaction_interval":
+				o.Experimental.PeriodicCompactionInterval, err = time.ParseDuration(value)
+			case "point_key_fingerprints":
+				o.Experimental.PointKeyFingerprints, err = strconv.ParseBool(value)
 			case "point_tombstone_weight":
 				// Do nothing; deprecated.
 			case "strict_wal_tail":
@@ -1653,6 +1977,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.Experimental.ReadCompactionRate, err = strconv.ParseInt(value, 10, 64)
 			case "read_sampling_multiplier":
 				o.Experimental.ReadSamplingMultiplier, err = strconv.ParseInt(value, 10, 64)
+			case "resumable_compaction_checkpoint_interval":
+				o.Experimental.ResumableCompactionCheckpointInterval, err = time.ParseDuration(value)
+			case "resumable_compaction_threshold":
+				o.Experimental.ResumableCompactionThreshold, err = strconv.ParseUint(value, 10, 64)
 			case "table_cache_shards":
 				o.Experimental.TableCacheShards, err = strconv.Atoi(value)
 			case "table_format":
@@ -1664,12 +1992,33 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				}
 			case "table_property_collectors":
 				// No longer implemented; ignore.
+			case "time_travel_retention":
+				o.TimeTravelRetention, err = time.ParseDuration(value)
+			case "time_travel_sample_interval":
+				o.TimeTravelSampleInterval, err = time.ParseDuration(value)
+			case "tombstone_dense_compaction_threshold":
+				o.Experimental.TombstoneDenseCompactionThreshold, err = strconv.ParseFloat(value, 64)
 			case "validate_on_ingest":
 				o.Experimental.ValidateOnIngest, err = strconv.ParseBool(value)
 			case "wal_dir":
 				o.WALDir = value
 			case "wal_bytes_per_sync":
 				o.WALBytesPerSync, err = strconv.Atoi(value)
+			case "wal_compression":
+				switch value {
+				case "Default":
+					o.WALCompression = DefaultCompression
+				case "NoCompression":
+					o.WALCompression = NoCompression
+				case "Snappy":
+					o.WALCompression = SnappyCompression
+				case "ZSTD":
+					o.WALCompression = ZstdCompression
+				default:
+					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
+				}
+			case "wal_recovery_mode":
+				o.WALRecoveryMode, err = ParseWALRecoveryMode(value)
 			case "max_writer_concurrency":
 				o.Experimental.MaxWriterConcurrency, err = strconv.Atoi(value)
 			case "force_writer_parallelism":
@@ -1722,6 +2071,25 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 			}
 			return err
 
+		case section == "WAL Mirror":
+			if o.WALMirror == nil {
+				o.WALMirror = new(wal.MirrorOptions)
+			}
+			var err error
+			switch key {
+			case "dir":
+				o.WALMirror.Mirrors = append(o.WALMirror.Mirrors, wal.Dir{Dirname: value, FS: vfs.Default})
+			case "ack_policy":
+				o.WALMirror.AckPolicy, err = wal.ParseMirrorAckPolicy(value)
+			default:
+				if hooks != nil && hooks.SkipUnknown != nil && hooks.SkipUnknown(section+"."+key, value) {
+					return nil
+				}
+				return errors.Errorf("pebble: unknown option: %s.%s",
+					errors.Safe(section), errors.Safe(key))
+			}
+			return err
+
 		case strings.HasPrefix(section, "Level "):
 			var index int
 			if n, err := fmt.Sscanf(section, `Level "%d"`, &index); err != nil {
@@ -1824,13 +2192,20 @@ func (o *Options) checkOptions(s string) (strictWALTail bool, err error) {
 			if err != nil {
 				return errors.Errorf("pebble: error parsing strict_wal_tail value %q: %w", value, err)
 			}
-		case "Options.wal_dir", "WAL Failover.secondary_dir":
+		case "Options.wal_dir", "WAL Failover.secondary_dir", "WAL Mirror.dir":
 			switch {
 			case o.WALDir == value:
 				return nil
 			case o.WALFailover != nil && o.WALFailover.Secondary.Dirname == value:
 				return nil
 			default:
+				if o.WALMirror != nil {
+					for _, d := range o.WALMirror.Mirrors {
+						if d.Dirname == value {
+							return nil
+						}
+					}
+				}
 				for _, d := range o.WALRecoveryDirs {
 					if d.Dirname == value {
 						return nil
@@ -1884,9 +2259,28 @@ func (o *Options) Validate() error {
 			o.FormatMajorVersion, FormatMinForSharedObjects)
 
 	}
+	if o.WALMirror != nil {
+		if len(o.WALMirror.Mirrors) == 0 {
+			fmt.Fprintf(&buf, "WALMirror requires at least one mirror directory\n")
+		}
+		if o.WALFailover != nil {
+			fmt.Fprintf(&buf, "WALMirror and WALFailover are mutually exclusive\n")
+		}
+	}
+	if o.WALArchive != nil {
+		if err := o.WALArchive.validate(); err != nil {
+			fmt.Fprintf(&buf, "%s\n", err)
+		}
+	}
 	if o.TableCache != nil && o.Cache != o.TableCache.cache {
 		fmt.Fprintf(&buf, "underlying cache in the TableCache and the Cache dont match\n")
 	}
+	if err := validateSecondaryIndexes(o.Comparer.Compare, o.SecondaryIndexes); err != nil {
+		fmt.Fprintf(&buf, "%s\n", err)
+	}
+	if o.Timestamps != nil && (o.Timestamps.EncodeTimestamp == nil || o.Timestamps.DecodeTimestamp == nil) {
+		fmt.Fprintf(&buf, "Timestamps requires EncodeTimestamp and DecodeTimestamp\n")
+	}
 	if buf.Len() == 0 {
 		return nil
 	}
@@ -1922,6 +2316,18 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 			writerOpts.MergerName = o.Merger.Name
 		}
 		writerOpts.BlockPropertyCollectors = o.BlockPropertyCollectors
+		writerOpts.PointKeyFingerprint = o.Experimental.PointKeyFingerprints
+		if o.Experimental.TombstoneDenseCompactionThreshold > 0 {
+			collectors := make([]func() BlockPropertyCollector, 0, len(o.BlockPropertyCollectors)+1)
+			collectors = append(collectors, o.BlockPropertyCollectors...)
+			writerOpts.BlockPropertyCollectors = append(collectors, newTombstoneDensityCollector)
+		}
+		if o.Timestamps != nil {
+			collectors := make([]func() BlockPropertyCollector, 0, len(writerOpts.BlockPropertyCollectors)+1)
+			collectors = append(collectors, writerOpts.BlockPropertyCollectors...)
+			writerOpts.BlockPropertyCollectors = append(collectors,
+				o.Timestamps.newTimestampIntervalCollector(o.Comparer.Split))
+		}
 	}
 	if format >= sstable.TableFormatPebblev3 {
 		writerOpts.ShortAttributeExtractor = o.Experimental.ShortAttributeExtractor
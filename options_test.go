@@ -211,6 +211,23 @@ func TestOptionsCheck(t *testing.T) {
 [WAL Failover]
   secondary_dir=failover-wal-dir
 `))
+
+	// The same applies to WAL mirror dirs.
+	require.Equal(t, ErrMissingWALRecoveryDir{Dir: "mirror-wal-dir"},
+		(&Options{}).EnsureDefaults().Check(`
+[Options]
+
+[WAL Mirror]
+  dir=mirror-wal-dir
+  ack_policy=all
+`))
+	require.NoError(t, (&Options{WALMirror: &wal.MirrorOptions{Mirrors: []wal.Dir{{Dirname: "mirror-wal-dir"}}}}).EnsureDefaults().Check(`
+[Options]
+
+[WAL Mirror]
+  dir=mirror-wal-dir
+  ack_policy=all
+`))
 }
 
 type testCleaner struct{}
@@ -270,6 +287,8 @@ func TestOptionsParse(t *testing.T) {
 			opts.Comparer = c.comparer
 			opts.Merger = c.merger
 			opts.WALDir = "wal"
+			opts.WALCompression = ZstdCompression
+			opts.WALRecoveryMode = WALRecoveryPointInTime
 			opts.Levels = make([]LevelOptions, 3)
 			opts.Levels[0].BlockSize = 1024
 			opts.Levels[1].BlockSize = 2048
@@ -279,15 +298,27 @@ func TestOptionsParse(t *testing.T) {
 			opts.FlushDelayRangeKey = 11 * time.Second
 			opts.Experimental.LevelMultiplier = 5
 			opts.TargetByteDeletionRate = 200
+			opts.TimeTravelRetention = time.Hour
+			opts.TimeTravelSampleInterval = 5 * time.Second
 			opts.WALFailover = &WALFailoverOptions{
 				Secondary: wal.Dir{Dirname: "wal_secondary", FS: vfs.Default},
 			}
+			opts.WALMirror = &wal.MirrorOptions{
+				Mirrors:   []wal.Dir{{Dirname: "wal_mirror1", FS: vfs.Default}, {Dirname: "wal_mirror2", FS: vfs.Default}},
+				AckPolicy: wal.MirrorAckQuorum,
+			}
 			opts.Experimental.ReadCompactionRate = 300
 			opts.Experimental.ReadSamplingMultiplier = 400
 			opts.Experimental.TableCacheShards = 500
 			opts.Experimental.MaxWriterConcurrency = 1
 			opts.Experimental.ForceWriterParallelism = true
 			opts.Experimental.SecondaryCacheSizeBytes = 1024
+			opts.Experimental.MaxTableAge = time.Hour
+			opts.Experimental.PeriodicCompactionInterval = 24 * time.Hour
+			opts.Experimental.TombstoneDenseCompactionThreshold = 0.25
+			opts.Experimental.PointKeyFingerprints = true
+			opts.Experimental.ResumableCompactionThreshold = 64 << 20
+			opts.Experimental.ResumableCompactionCheckpointInterval = time.Minute
 			opts.EnsureDefaults()
 			str := opts.String()
 
@@ -335,6 +366,21 @@ func TestOptionsValidate(t *testing.T) {
 `,
 			`MemTableStopWritesThreshold .* must be >= 2`,
 		},
+		{`
+[WAL Failover]
+  secondary_dir=failover-wal-dir
+
+[WAL Mirror]
+  dir=mirror-wal-dir
+`,
+			`WALMirror and WALFailover are mutually exclusive`,
+		},
+		{`
+[WAL Mirror]
+  ack_policy=any
+`,
+			`WALMirror requires at least one mirror directory`,
+		},
 	}
 
 	for _, c := range testCases {
@@ -24,6 +24,13 @@ type readCompactionQueue struct {
 	// of the queue are occupied.
 	// The size will be <= readCompactionMaxQueueSize.
 	size int
+
+	// hints holds the read compactions queued by compaction hints, in order
+	// of insertion. Unlike the read compactions above, they're never evicted
+	// by other read compactions: a hint remains queued until its span has
+	// been compacted into the bottommost level. The number of hints will be
+	// <= maxQueuedCompactionHints.
+	hints []*readCompaction
 }
 
 // combine should be used to combine an older queue with a newer
@@ -65,6 +72,16 @@ func (qu *readCompactionQueue) add(rc *readCompaction, cmp base.Compare) {
 	}
 }
 
+// addHint adds the read compaction of a compaction hint to the queue. It
+// returns false if maxQueuedCompactionHints hints are already queued.
+func (qu *readCompactionQueue) addHint(rc *readCompaction) bool {
+	if len(qu.hints) >= maxQueuedCompactionHints {
+		return false
+	}
+	qu.hints = append(qu.hints, rc)
+	return true
+}
+
 // Shifts the non-nil elements of the queue to the left so
 // that a continguous prefix of the queue is non-nil.
 func (qu *readCompactionQueue) shiftLeft() {
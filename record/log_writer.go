@@ -451,6 +451,11 @@ type LogWriter struct {
 		closed chan struct{}
 		// Accumulated flush error.
 		err error
+		// flushedSize is the number of bytes written to the underlying writer.
+		flushedSize int64
+		// flushed is broadcast when flushedSize or err change, or the flush
+		// loop terminates. See WaitFlushed.
+		flushed sync.Cond
 		// minSyncInterval is the minimum duration between syncs.
 		minSyncInterval durationFunc
 		fsyncLatency    prometheus.Histogram
@@ -551,6 +556,7 @@ func NewLogWriter(
 	r.block = blockPool.Get().(*block)
 	r.flusher.ready.init(&r.flusher.Mutex, r.flusher.pendingSyncs)
 	r.flusher.closed = make(chan struct{})
+	r.flusher.flushed.L = &r.flusher.Mutex
 	r.flusher.pending = make([]*block, 0, cap(r.free.blocks))
 	r.flusher.metrics = m
 
@@ -579,6 +585,7 @@ func (w *LogWriter) flushLoop(context.Context) {
 			syncTimer.Stop()
 		}
 		close(f.closed)
+		f.flushed.Broadcast()
 		f.Unlock()
 	}()
 
@@ -690,6 +697,7 @@ func (w *LogWriter) flushLoop(context.Context) {
 			// with the rest of the accounting, which means we will undercount.
 			idleStartTime = time.Now()
 			f.Lock()
+			f.flushed.Broadcast()
 			continue
 		}
 		synced, syncLatency, bytesWritten, err := w.flushPending(data, pending, snap)
@@ -698,6 +706,10 @@ func (w *LogWriter) flushLoop(context.Context) {
 			f.fsyncLatency.Observe(float64(syncLatency))
 		}
 		f.err = err
+		if err == nil {
+			f.flushedSize += bytesWritten
+		}
+		f.flushed.Broadcast()
 		if f.err != nil {
 			f.pendingSyncs.clearBlocked()
 			// Update the idleStartTime if work could not be done, so that we don't
@@ -946,6 +958,34 @@ func (w *LogWriter) SyncRecordGeneralized(p []byte, ps PendingSync) (logSize int
 	return offset, nil
 }
 
+// WaitFlushed blocks until the records written to the LogWriter before
+// logSize, as returned by SyncRecord, have been written to the underlying
+// writer, without requiring that they be synced. Records written without
+// requesting a sync are otherwise buffered until a block fills up or a sync is
+// requested. WaitFlushed may be called concurrently with the other methods,
+// including Close.
+func (w *LogWriter) WaitFlushed(logSize int64) error {
+	f := &w.flusher
+	f.Lock()
+	defer f.Unlock()
+	for f.flushedSize < logSize {
+		if f.err != nil {
+			return f.err
+		}
+		select {
+		case <-f.closed:
+			// The flush loop flushes everything before terminating.
+			return nil
+		default:
+		}
+		// The flush loop writes the partial block when signalled, even if no
+		// sync has been requested.
+		f.ready.Signal()
+		f.flushed.Wait()
+	}
+	return nil
+}
+
 // Size returns the current size of the file.
 // External synchronisation provided by commitPipeline.mu.
 func (w *LogWriter) Size() int64 {
@@ -205,6 +205,26 @@ func TestSyncRecord(t *testing.T) {
 	}
 }
 
+func TestWaitFlushed(t *testing.T) {
+	f := &syncFile{}
+	w := NewLogWriter(f, 0, LogWriterConfig{WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{})})
+
+	for i := 0; i < 1000; i++ {
+		offset, err := w.WriteRecord([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, w.WaitFlushed(offset))
+		if v := f.writePos.Load(); offset > v {
+			t.Fatalf("expected write pos >= %d, but found %d", offset, v)
+		}
+	}
+	// Flushing doesn't sync.
+	require.Equal(t, int64(0), f.syncPos.Load())
+	offset, err := w.WriteRecord([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, w.WaitFlushed(offset))
+}
+
 func TestSyncRecordWithSignalChan(t *testing.T) {
 	f := &syncFile{}
 	semChan := make(chan struct{}, 5)
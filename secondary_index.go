@@ -0,0 +1,363 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// SecondaryIndex declares a secondary index maintained by the DB (see
+// Options.SecondaryIndexes). The index maps the primary keys within Primary to
+// index keys within Index, as computed by Extract from each primary key and
+// its value. Every index key is stored with the primary key as its value.
+//
+// When a batch is applied, the DB reads the previous value of each primary
+// key the batch sets or deletes, and commits along with the batch the deletion
+// of the index keys no longer extracted and the addition of the new ones.
+// Batches applied concurrently that write primary keys are serialized from the
+// computation of their index entries until they are sequenced, so that the
+// index remains consistent with the primary keys. Batches may not write index
+// keys directly, merge into primary keys, or delete ranges overlapping the
+// primary or index keys. Ingestions and excises bypass index maintenance.
+type SecondaryIndex struct {
+	// Name identifies the index in errors.
+	Name string
+	// Primary is the span of the primary keys covered by the index.
+	Primary KeyRange
+	// Index is the span of the index keys. It must not overlap the primary
+	// keys of any index.
+	Index KeyRange
+	// Extract appends to dst the index keys of the primary key and value, and
+	// returns the resulting slice. The index keys must lie within Index, and
+	// are typically suffixed by the primary key to be unique. Extract must be
+	// a pure function, and must not retain key or value.
+	Extract func(dst [][]byte, key, value []byte) [][]byte
+}
+
+// indexEntry is an entry of a secondary index.
+type indexEntry struct {
+	key, primary []byte
+}
+
+// validateSecondaryIndexes checks the declarations of the secondary indexes.
+func validateSecondaryIndexes(cmp Compare, indexes []SecondaryIndex) error {
+	overlaps := func(a, b KeyRange) bool {
+		return cmp(a.Start, b.End) < 0 && cmp(b.Start, a.End) < 0
+	}
+	for i := range indexes {
+		idx := &indexes[i]
+		switch {
+		case idx.Name == "":
+			return errors.Errorf("pebble: secondary index %d has no name", i)
+		case idx.Extract == nil:
+			return errors.Errorf("pebble: secondary index %q has no Extract function", idx.Name)
+		case !idx.Primary.Valid() || !idx.Index.Valid():
+			return errors.Errorf("pebble: secondary index %q must define its primary and index key ranges", idx.Name)
+		}
+		for j := range indexes {
+			if overlaps(idx.Index, indexes[j].Primary) {
+				return errors.Errorf("pebble: secondary index %q keys overlap the primary keys of index %q",
+					idx.Name, indexes[j].Name)
+			}
+		}
+	}
+	return nil
+}
+
+// batchWritesIndexedKeys returns true if the batch writes primary keys of the
+// secondary indexes. It returns an error if the batch contains operations that
+// would bypass index maintenance.
+func (d *DB) batchWritesIndexedKeys(batch *Batch) (bool, error) {
+	contains := func(r KeyRange, key []byte) bool {
+		return d.cmp(r.Start, key) <= 0 && d.cmp(key, r.End) < 0
+	}
+	indexes := d.opts.SecondaryIndexes
+	writes := false
+	for r := batch.Reader(); ; {
+		kind, ukey, value, ok, err := r.Next()
+		if err != nil {
+			return false, err
+		} else if !ok {
+			return writes, nil
+		}
+		switch kind {
+		case InternalKeyKindRangeDelete:
+			for i := range indexes {
+				idx := &indexes[i]
+				span := KeyRange{Start: ukey, End: value}
+				for _, r := range []KeyRange{idx.Primary, idx.Index} {
+					if d.cmp(span.Start, r.End) < 0 && d.cmp(r.Start, span.End) < 0 {
+						return false, errors.Errorf("pebble: range deletion [%s, %s) overlaps secondary index %q",
+							d.opts.Comparer.FormatKey(span.Start), d.opts.Comparer.FormatKey(span.End), idx.Name)
+					}
+				}
+			}
+		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete,
+			InternalKeyKindLogData:
+		default:
+			for i := range indexes {
+				idx := &indexes[i]
+				if contains(idx.Index, ukey) {
+					return false, errors.Errorf("pebble: batch writes key %s of secondary index %q",
+						d.opts.Comparer.FormatKey(ukey), idx.Name)
+				}
+				if contains(idx.Primary, ukey) {
+					if kind == InternalKeyKindMerge {
+						return false, errors.Errorf("pebble: batch merges into key %s of secondary index %q",
+							d.opts.Comparer.FormatKey(ukey), idx.Name)
+					}
+					writes = true
+				}
+			}
+		}
+	}
+}
+
+// maintainSecondaryIndexes appends to the batch the index updates of the
+// primary keys it writes. The updates are built in a separate batch, and are
+// discarded from the batch if it isn't committed. The previous value of each
+// primary key is read through an indexed batch to which the batch's
+// operations are applied in order, so that a key written multiple times by
+// the batch is diffed against its value as of the preceding write.
+//
+// REQUIRES: d.indexMu, held until the batch is sequenced.
+func (d *DB) maintainSecondaryIndexes(batch *Batch) error {
+	// The previous batch that maintained the indexes released d.indexMu once
+	// sequenced: wait for it to be visible before reading the primary keys.
+	d.commit.waitVisible()
+
+	indexes := d.opts.SecondaryIndexes
+	view := d.NewIndexedBatch()
+	defer view.Close()
+
+	var updates []indexEntry
+	var oldKeys, newKeys [][]byte
+	for r := batch.Reader(); ; {
+		kind, ukey, value, ok, err := r.Next()
+		if err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+		var set bool
+		switch kind {
+		case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+			set = true
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
+		default:
+			continue
+		}
+		prev, closer, err := view.Get(ukey)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		for i := range indexes {
+			idx := &indexes[i]
+			if d.cmp(idx.Primary.Start, ukey) > 0 || d.cmp(ukey, idx.Primary.End) >= 0 {
+				continue
+			}
+			oldKeys, newKeys = oldKeys[:0], newKeys[:0]
+			if closer != nil {
+				oldKeys = idx.Extract(oldKeys, ukey, prev)
+			}
+			if set {
+				newKeys = idx.Extract(newKeys, ukey, value)
+			}
+			updates = d.diffIndexKeys(updates, ukey, oldKeys, newKeys)
+		}
+		if closer != nil {
+			if err := closer.Close(); err != nil {
+				return err
+			}
+		}
+		if set {
+			err = view.Set(ukey, value, nil)
+		} else {
+			err = view.Delete(ukey, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	repr := d.NewBatch()
+	defer repr.Close()
+	for _, u := range updates {
+		var err error
+		if u.primary != nil {
+			err = repr.Set(u.key, u.primary, nil)
+		} else {
+			err = repr.Delete(u.key, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	batch.appendIndexUpdates(repr)
+	return nil
+}
+
+// appendIndexUpdates appends the operations of updates, the secondary index
+// updates of the batch's operations, to the batch. They are committed along
+// with the batch, but aren't indexed for reads from an indexed batch.
+func (b *Batch) appendIndexUpdates(updates *Batch) {
+	if len(b.data) == 0 {
+		b.init(batchrepr.HeaderLen)
+	}
+	b.indexUpdates.offset = len(b.data)
+	b.indexUpdates.count = b.count
+	b.indexUpdates.memTableSize = b.memTableSize
+	b.data = append(b.data, updates.data[batchrepr.HeaderLen:]...)
+	b.count += updates.count
+	b.memTableSize += updates.memTableSize
+}
+
+// discardIndexUpdates removes from the batch the secondary index updates
+// appended by appendIndexUpdates, so that the batch may be applied again.
+func (b *Batch) discardIndexUpdates() {
+	if b.indexUpdates.offset == 0 {
+		return
+	}
+	b.data = b.data[:b.indexUpdates.offset]
+	b.count = b.indexUpdates.count
+	b.memTableSize = b.indexUpdates.memTableSize
+	b.indexUpdates.offset = 0
+}
+
+// diffIndexKeys appends to updates the deletions of the index keys of the
+// primary key in oldKeys but not newKeys, as entries with a nil primary key,
+// and the additions of those in newKeys but not oldKeys. The returned entries
+// don't alias the arguments.
+func (d *DB) diffIndexKeys(
+	updates []indexEntry, primary []byte, oldKeys, newKeys [][]byte,
+) []indexEntry {
+	slices.SortFunc(oldKeys, d.cmp)
+	slices.SortFunc(newKeys, d.cmp)
+	oldKeys = slices.CompactFunc(oldKeys, d.equal)
+	newKeys = slices.CompactFunc(newKeys, d.equal)
+	primary = slices.Clone(primary)
+	for len(oldKeys) > 0 || len(newKeys) > 0 {
+		c := 0
+		switch {
+		case len(oldKeys) == 0:
+			c = 1
+		case len(newKeys) == 0:
+			c = -1
+		default:
+			c = d.cmp(oldKeys[0], newKeys[0])
+		}
+		switch {
+		case c < 0:
+			updates = append(updates, indexEntry{key: slices.Clone(oldKeys[0])})
+			oldKeys = oldKeys[1:]
+		case c > 0:
+			updates = append(updates, indexEntry{key: slices.Clone(newKeys[0]), primary: primary})
+			newKeys = newKeys[1:]
+		default:
+			oldKeys, newKeys = oldKeys[1:], newKeys[1:]
+		}
+	}
+	return updates
+}
+
+// CheckIndexesStats provides basic stats on the secondary indexes checked by
+// CheckIndexes.
+type CheckIndexesStats struct {
+	NumPrimaryKeys  int64
+	NumIndexEntries int64
+}
+
+// CheckIndexes checks that the secondary indexes configured through
+// Options.SecondaryIndexes are consistent with their primary keys: every index
+// key extracted from a primary key and its value is present with the primary
+// key as its value, and every index key present is extracted from its primary
+// key. The check reads a consistent snapshot of the DB.
+func (d *DB) CheckIndexes(stats *CheckIndexesStats) error {
+	snap := d.NewSnapshot()
+	defer snap.Close()
+	for i := range d.opts.SecondaryIndexes {
+		if err := d.checkIndex(snap, &d.opts.SecondaryIndexes[i], stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DB) checkIndex(snap *Snapshot, idx *SecondaryIndex, stats *CheckIndexesStats) error {
+	// Extract the expected entries from the primary keys.
+	var expected []indexEntry
+	iter, err := snap.NewIter(&IterOptions{LowerBound: idx.Primary.Start, UpperBound: idx.Primary.End})
+	if err != nil {
+		return err
+	}
+	var keys [][]byte
+	for valid := iter.First(); valid; valid = iter.Next() {
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			return errors.CombineErrors(err, iter.Close())
+		}
+		primary := slices.Clone(iter.Key())
+		keys = idx.Extract(keys[:0], primary, value)
+		for _, k := range keys {
+			expected = append(expected, indexEntry{key: slices.Clone(k), primary: primary})
+		}
+		if stats != nil {
+			stats.NumPrimaryKeys++
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	slices.SortFunc(expected, func(a, b indexEntry) int { return d.cmp(a.key, b.key) })
+	expected = slices.CompactFunc(expected, func(a, b indexEntry) bool { return d.equal(a.key, b.key) })
+
+	// Compare them against the index entries present.
+	formatKey := d.opts.Comparer.FormatKey
+	iter, err = snap.NewIter(&IterOptions{LowerBound: idx.Index.Start, UpperBound: idx.Index.End})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	valid := iter.First()
+	for valid || len(expected) > 0 {
+		c := 0
+		switch {
+		case !valid:
+			c = 1
+		case len(expected) == 0:
+			c = -1
+		default:
+			c = d.cmp(iter.Key(), expected[0].key)
+		}
+		switch {
+		case c < 0:
+			return base.CorruptionErrorf("pebble: secondary index %q: dangling entry %s",
+				idx.Name, formatKey(iter.Key()))
+		case c > 0:
+			return base.CorruptionErrorf("pebble: secondary index %q: missing entry %s for primary key %s",
+				idx.Name, formatKey(expected[0].key), formatKey(expected[0].primary))
+		}
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			return err
+		}
+		if !d.equal(value, expected[0].primary) {
+			return base.CorruptionErrorf("pebble: secondary index %q: entry %s refers to primary key %s, expected %s",
+				idx.Name, formatKey(iter.Key()), formatKey(value), formatKey(expected[0].primary))
+		}
+		if stats != nil {
+			stats.NumIndexEntries++
+		}
+		expected = expected[1:]
+		valid = iter.Next()
+	}
+	return iter.Error()
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// byValueIndex indexes the primary keys p/<key> by their comma-separated
+// values, as i/<value>/<key>.
+var byValueIndex = SecondaryIndex{
+	Name:    "by-value",
+	Primary: KeyRange{Start: []byte("p/"), End: []byte("p0")},
+	Index:   KeyRange{Start: []byte("i/"), End: []byte("i0")},
+	Extract: func(dst [][]byte, key, value []byte) [][]byte {
+		for _, v := range strings.Split(string(value), ",") {
+			if v != "" {
+				dst = append(dst, []byte(fmt.Sprintf("i/%s/%s", v, key[2:])))
+			}
+		}
+		return dst
+	},
+}
+
+func TestSecondaryIndexes(t *testing.T) {
+	opts := (&Options{FS: vfs.NewMem()}).WithFSDefaults()
+	opts.SecondaryIndexes = []SecondaryIndex{byValueIndex}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	scanIndex := func() string {
+		it, err := d.NewIter(&IterOptions{LowerBound: []byte("i/"), UpperBound: []byte("i0")})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, it.Close()) }()
+		var entries []string
+		for valid := it.First(); valid; valid = it.Next() {
+			entries = append(entries, fmt.Sprintf("%s=%s", it.Key(), it.Value()))
+		}
+		return strings.Join(entries, " ")
+	}
+	check := func() {
+		t.Helper()
+		require.NoError(t, d.CheckIndexes(nil))
+	}
+
+	require.NoError(t, d.Set([]byte("p/a"), []byte("x,y"), nil))
+	require.NoError(t, d.Set([]byte("p/b"), []byte("y"), nil))
+	require.NoError(t, d.Set([]byte("q"), []byte("unindexed"), nil))
+	require.Equal(t, "i/x/a=p/a i/y/a=p/a i/y/b=p/b", scanIndex())
+	check()
+
+	// Overwrites and deletions remove the stale index entries, including when
+	// a batch writes the same key repeatedly.
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("p/a"), []byte("z"), nil))
+	require.NoError(t, b.Set([]byte("p/a"), []byte("y,w"), nil))
+	require.NoError(t, b.Delete([]byte("p/b"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "i/w/a=p/a i/y/a=p/a", scanIndex())
+	check()
+
+	// A batch rejected by a condition doesn't retain its index updates, and
+	// commits them once when retried.
+	b = d.NewBatch()
+	require.NoError(t, b.SetIfEquals([]byte("p/a"), []byte("x"), []byte("v"), nil))
+	count := b.Count()
+	require.True(t, errors.Is(b.Commit(nil), ErrConditionFailed))
+	require.Equal(t, count, b.Count())
+	require.NoError(t, d.Set([]byte("p/a"), []byte("x"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, b.Close())
+	require.Equal(t, "i/v/a=p/a", scanIndex())
+	check()
+
+	// Concurrent writers of the same keys keep the index consistent.
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := []byte(fmt.Sprintf("p/%d", i%5))
+				require.NoError(t, d.Set(key, []byte(fmt.Sprintf("v%d,v%d", w, i)), nil))
+			}
+		}(w)
+	}
+	wg.Wait()
+	var stats CheckIndexesStats
+	require.NoError(t, d.CheckIndexes(&stats))
+	require.Equal(t, int64(6), stats.NumPrimaryKeys)
+	require.Equal(t, int64(11), stats.NumIndexEntries)
+
+	// Writes that would bypass index maintenance are rejected.
+	require.Error(t, d.Set([]byte("i/x/a"), []byte("p/a"), nil))
+	require.Error(t, d.Merge([]byte("p/a"), []byte("x"), nil))
+	require.Error(t, d.DeleteRange([]byte("a"), []byte("p/b"), nil))
+	require.NoError(t, d.DeleteRange([]byte("q"), []byte("r"), nil))
+	require.NoError(t, d.Close())
+
+	// A DB written without the index declared is inconsistent with it.
+	opts.SecondaryIndexes = nil
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("i/stray/c"), []byte("p/c"), nil))
+	require.NoError(t, d.Set([]byte("p/d"), []byte("u"), nil))
+	require.NoError(t, d.Close())
+	opts.SecondaryIndexes = []SecondaryIndex{byValueIndex}
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	err = d.CheckIndexes(nil)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.Contains(t, err.Error(), "dangling entry i/stray/c")
+	require.NoError(t, d.Close())
+
+	// Invalid declarations are rejected.
+	opts.SecondaryIndexes = []SecondaryIndex{byValueIndex, byValueIndex}
+	opts.SecondaryIndexes[1].Index = byValueIndex.Primary
+	_, err = Open("", opts)
+	require.Error(t, err)
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// seqNumTimeMapping maintains samples of the mapping from sequence numbers to
+// wall-clock time, which serve reads as of a past time (see
+// IterOptions.AsOfTime). Samples are taken at commit time, at most once per
+// Options.TimeTravelSampleInterval. Samples older than
+// Options.TimeTravelRetention are discarded, except for the most recent of
+// them, which determines the state visible at the start of the retention
+// window. Older samples are coarsened, so that the number of retained samples
+// grows logarithmically with the retention: the precision of time-travel reads
+// decreases with the age of the state read.
+//
+// The samples covering the sequence numbers of a table are persisted in its
+// FileMetadata, so that the mapping may be rebuilt on Open. Compactions treat
+// the sequence numbers of the retained samples like those of open snapshots,
+// preserving the state visible at each of them.
+type seqNumTimeMapping struct {
+	retention time.Duration
+	interval  time.Duration
+	// lastSample is the time of the most recent sample, in nanoseconds since
+	// the Unix epoch. It allows commits to skip sampling without locking mu.
+	lastSample atomic.Int64
+
+	mu struct {
+		sync.Mutex
+		// samples are in increasing order of sequence number and time.
+		samples []manifest.SeqNumTime
+	}
+}
+
+// seqNumTimeSamplesPerDoubling is the number of samples retained per doubling
+// of their age: a sample is retained only if it follows the previous retained
+// sample by at least 1/seqNumTimeSamplesPerDoubling of its age.
+const seqNumTimeSamplesPerDoubling = 8
+
+// maxTableSeqNumTimes is the maximum number of samples persisted in the
+// metadata of a table.
+const maxTableSeqNumTimes = 16
+
+func (m *seqNumTimeMapping) init(opts *Options) {
+	m.retention = opts.TimeTravelRetention
+	m.interval = opts.TimeTravelSampleInterval
+}
+
+// enabled returns true if time-travel reads are enabled.
+func (m *seqNumTimeMapping) enabled() bool {
+	return m.retention > 0
+}
+
+// load rebuilds the mapping from the samples persisted in the metadata of the
+// tables of v, and records that the writes visible at seqNum had been
+// committed by now.
+func (m *seqNumTimeMapping) load(v *version, seqNum uint64, now time.Time) {
+	var samples []manifest.SeqNumTime
+	for _, l := range v.Levels {
+		iter := l.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			samples = append(samples, f.SeqNumTimes...)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].SeqNum < samples[j].SeqNum
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mu.samples = m.mu.samples[:0]
+	for _, s := range samples {
+		m.addLocked(s)
+	}
+	m.addLocked(manifest.SeqNumTime{SeqNum: seqNum, Time: now.UnixNano()})
+	m.truncateLocked(now)
+	m.coarsenLocked(now)
+	m.lastSample.Store(now.UnixNano())
+}
+
+// maybeSample records that the writes visible at seqNum had been committed by
+// now, unless the previous sample is more recent than the sample interval.
+func (m *seqNumTimeMapping) maybeSample(seqNum uint64, now time.Time) {
+	t := now.UnixNano()
+	last := m.lastSample.Load()
+	if t-last < int64(m.interval) || !m.lastSample.CompareAndSwap(last, t) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addLocked(manifest.SeqNumTime{SeqNum: seqNum, Time: t})
+	m.truncateLocked(now)
+	m.coarsenLocked(now)
+}
+
+// addLocked appends a sample, unless it doesn't advance both the sequence
+// number and the time of the most recent sample. A sample for a sequence
+// number already sampled would only delay the time from which reads observe
+// it, and the time of a sample may move backwards along with the wall clock.
+func (m *seqNumTimeMapping) addLocked(s manifest.SeqNumTime) {
+	if n := len(m.mu.samples); n > 0 {
+		if last := m.mu.samples[n-1]; s.SeqNum <= last.SeqNum || s.Time < last.Time {
+			return
+		}
+	}
+	m.mu.samples = append(m.mu.samples, s)
+}
+
+// retainedLocked returns the index of the first sample needed to serve reads
+// within the retention window ending at now.
+func (m *seqNumTimeMapping) retainedLocked(now time.Time) int {
+	cutoff := now.Add(-m.retention).UnixNano()
+	i := sort.Search(len(m.mu.samples), func(i int) bool {
+		return m.mu.samples[i].Time > cutoff
+	})
+	// The state visible at the start of the window is the state visible at
+	// the most recent sample before it.
+	return max(i-1, 0)
+}
+
+// truncateLocked discards the samples no longer needed to serve reads within
+// the retention window ending at now.
+func (m *seqNumTimeMapping) truncateLocked(now time.Time) {
+	if i := m.retainedLocked(now); i > 0 {
+		m.mu.samples = append(m.mu.samples[:0], m.mu.samples[i:]...)
+	}
+}
+
+// coarsenLocked discards the samples that are too close to the previous
+// retained sample given their age (see seqNumTimeSamplesPerDoubling). Reads as
+// of the time of a discarded sample observe the state of the previous sample
+// instead. The oldest sample, which determines the state visible at the start
+// of the retention window, and the most recent one are always retained.
+func (m *seqNumTimeMapping) coarsenLocked(now time.Time) {
+	samples := m.mu.samples
+	if len(samples) <= 2 {
+		return
+	}
+	// samples[:n] are the retained samples.
+	n := 1
+	for i := 1; i < len(samples)-1; i++ {
+		age := now.UnixNano() - samples[i].Time
+		if samples[i].Time-samples[n-1].Time >= max(int64(m.interval), age/seqNumTimeSamplesPerDoubling) {
+			samples[n] = samples[i]
+			n++
+		}
+	}
+	samples[n] = samples[len(samples)-1]
+	m.mu.samples = samples[:n+1]
+}
+
+// seqNumForTime returns the sequence number at which to read the state of the
+// DB as of t: the sequence number of the most recent sample not after t.
+func (m *seqNumTimeMapping) seqNumForTime(t, now time.Time) (uint64, error) {
+	if !m.enabled() {
+		return 0, errors.New("pebble: time-travel reads require Options.TimeTravelRetention")
+	}
+	if t.Before(now.Add(-m.retention)) {
+		return 0, errors.Errorf("pebble: %s is outside of the time-travel retention window of %s",
+			t.Format(time.RFC3339Nano), m.retention)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.Search(len(m.mu.samples), func(i int) bool {
+		return m.mu.samples[i].Time > t.UnixNano()
+	})
+	if i == 0 {
+		return 0, errors.Errorf("pebble: no sequence number known for %s", t.Format(time.RFC3339Nano))
+	}
+	return m.mu.samples[i-1].SeqNum, nil
+}
+
+// retainedSeqNums returns the sequence numbers of the samples within the
+// retention window ending at now, which compactions must treat as snapshots.
+func (m *seqNumTimeMapping) retainedSeqNums(now time.Time) []uint64 {
+	if !m.enabled() {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples := m.mu.samples[m.retainedLocked(now):]
+	seqNums := make([]uint64, len(samples))
+	for i := range samples {
+		seqNums[i] = samples[i].SeqNum
+	}
+	return seqNums
+}
+
+// samplesForTable returns the samples to persist in the metadata of a table
+// containing the sequence numbers [smallest, largest]: the most recent sample
+// that doesn't observe any of them, the samples observing some of them, and
+// the first sample observing all of them. At most maxTableSeqNumTimes samples
+// are returned, evenly chosen among those.
+func (m *seqNumTimeMapping) samplesForTable(smallest, largest uint64) []manifest.SeqNumTime {
+	if !m.enabled() {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples := m.mu.samples
+	// NB: the writes visible at a sample have lower sequence numbers.
+	i := sort.Search(len(samples), func(i int) bool {
+		return samples[i].SeqNum > smallest
+	})
+	j := sort.Search(len(samples), func(i int) bool {
+		return samples[i].SeqNum > largest
+	})
+	i = max(i-1, 0)
+	j = min(j+1, len(samples))
+	if i >= j {
+		return nil
+	}
+	if j-i <= maxTableSeqNumTimes {
+		return append([]manifest.SeqNumTime(nil), samples[i:j]...)
+	}
+	// Persist evenly spaced samples, including the first and the last.
+	res := make([]manifest.SeqNumTime, maxTableSeqNumTimes)
+	for k := range res {
+		res[k] = samples[i+k*(j-1-i)/(maxTableSeqNumTimes-1)]
+	}
+	return res
+}
+
+// SeqNumForTime returns the sequence number at which the state of the DB as
+// of t may be read, as IterOptions.AsOfTime does. The state visible at the
+// returned sequence number includes all the writes committed by the most
+// recent sample of the mapping from sequence numbers to time not after t, so
+// writes committed less than Options.TimeTravelSampleInterval before t may not
+// be visible.
+//
+// SeqNumForTime returns an error if time-travel reads are disabled, or if t
+// is outside of the retention window configured by
+// Options.TimeTravelRetention.
+func (d *DB) SeqNumForTime(t time.Time) (uint64, error) {
+	return d.seqNumTimes.seqNumForTime(t, d.timeNow())
+}
+
+// compactionSnapshotsLocked returns the sequence numbers of the open snapshots
+// and of the samples retained for time-travel reads, in increasing order.
+// Compactions must preserve the state visible at each of them. Since the
+// retained samples are coarsened with age, their number grows logarithmically
+// with the retention window.
+//
+// REQUIRES: d.mu.
+func (d *DB) compactionSnapshotsLocked() []uint64 {
+	snapshots := d.mu.snapshots.toSlice()
+	if !d.seqNumTimes.enabled() {
+		return snapshots
+	}
+	snapshots = append(snapshots, d.seqNumTimes.retainedSeqNums(d.timeNow())...)
+	slices.Sort(snapshots)
+	return slices.Compact(snapshots)
+}
+
+// earliestCompactionSnapshotLocked returns the earliest sequence number
+// returned by compactionSnapshotsLocked, or math.MaxUint64 if there are none.
+//
+// REQUIRES: d.mu.
+func (d *DB) earliestCompactionSnapshotLocked() uint64 {
+	earliest := d.mu.snapshots.earliest()
+	if !d.seqNumTimes.enabled() {
+		return earliest
+	}
+	if retained := d.seqNumTimes.retainedSeqNums(d.timeNow()); len(retained) > 0 {
+		earliest = min(earliest, retained[0])
+	}
+	return earliest
+}
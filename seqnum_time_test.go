@@ -0,0 +1,143 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeTravelReads(t *testing.T) {
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		TimeTravelRetention:         time.Hour,
+	}).WithFSDefaults()
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	var now atomic.Int64
+	start := time.Now()
+	now.Store(start.UnixNano())
+	d.mu.Lock()
+	d.timeNow = func() time.Time { return time.Unix(0, now.Load()) }
+	d.mu.Unlock()
+
+	// Overwrite a key once per minute, and delete it at the end.
+	const versions = 5
+	for i := 1; i <= versions; i++ {
+		now.Add(int64(time.Minute))
+		require.NoError(t, d.Set([]byte("a"), []byte(fmt.Sprint(i)), nil))
+	}
+	now.Add(int64(time.Minute))
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	now.Add(int64(time.Minute))
+
+	get := func(d *DB, asOf time.Time) string {
+		it, err := d.NewIter(&IterOptions{AsOfTime: asOf})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, it.Close()) }()
+		if !it.First() {
+			return "<none>"
+		}
+		return string(it.Value())
+	}
+	check := func(d *DB) {
+		t.Helper()
+		require.Equal(t, "<none>", get(d, start.Add(30*time.Second)))
+		for i := 1; i <= versions; i++ {
+			asOf := start.Add(time.Duration(i)*time.Minute + 30*time.Second)
+			require.Equal(t, fmt.Sprint(i), get(d, asOf))
+		}
+		require.Equal(t, "<none>", get(d, start.Add((versions+1)*time.Minute)))
+	}
+	check(d)
+
+	// Compactions preserve the versions visible within the retention window.
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), true /* parallelize */))
+	check(d)
+
+	// Time-travel reads aren't supported along with snapshots, and may not
+	// reach beyond the retention window.
+	s := d.NewSnapshot()
+	require.Panics(t, func() { _, _ = s.NewIter(&IterOptions{AsOfTime: start}) })
+	require.NoError(t, s.Close())
+	_, err = d.NewIter(&IterOptions{AsOfTime: start.Add(-2 * time.Hour)})
+	require.Error(t, err)
+
+	// The mapping is rebuilt from the table metadata on Open.
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	check(d)
+
+	// Once the versions fall out of the retention window, compactions drop
+	// them.
+	d.mu.Lock()
+	d.timeNow = func() time.Time { return start.Add(3 * time.Hour) }
+	d.mu.Unlock()
+	_, err = d.NewIter(&IterOptions{AsOfTime: start.Add(time.Minute)})
+	require.Error(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("new"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), true /* parallelize */))
+	d.mu.Lock()
+	iter := d.mu.versions.currentVersion().Levels[numLevels-1].Iter()
+	f := iter.First()
+	require.NotNil(t, f)
+	require.Equal(t, f.SmallestSeqNum, f.LargestSeqNum)
+	require.Nil(t, iter.Next())
+	d.mu.Unlock()
+	require.NoError(t, d.Close())
+
+	// Without a retention, time-travel reads are disabled.
+	opts.TimeTravelRetention = 0
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	_, err = d.SeqNumForTime(time.Now())
+	require.Error(t, err)
+	require.NoError(t, d.Close())
+}
+
+func TestSeqNumTimeMappingCoarsening(t *testing.T) {
+	var m seqNumTimeMapping
+	m.init(&Options{TimeTravelRetention: time.Hour, TimeTravelSampleInterval: time.Second})
+	start := time.Unix(1000, 0)
+	now := start
+	for seqNum := uint64(1); now.Sub(start) < 2*time.Hour; seqNum++ {
+		now = now.Add(time.Second)
+		m.maybeSample(seqNum, now)
+	}
+
+	m.mu.Lock()
+	samples := append([]manifest.SeqNumTime(nil), m.mu.samples...)
+	m.mu.Unlock()
+	// An hour of samples taken every second is coarsened to a number of
+	// samples logarithmic in the retention.
+	require.Less(t, len(samples), 100)
+	require.Equal(t, now.UnixNano(), samples[len(samples)-1].Time)
+	require.LessOrEqual(t, samples[0].Time, now.Add(-time.Hour).UnixNano())
+	for i := 1; i < len(samples)-1; i++ {
+		age := now.UnixNano() - samples[i].Time
+		require.GreaterOrEqual(t, samples[i].Time-samples[i-1].Time, age/seqNumTimeSamplesPerDoubling)
+	}
+	// Reads as of a recent time are precise to the sample interval.
+	seqNum, err := m.seqNumForTime(now.Add(-3*time.Second), now)
+	require.NoError(t, err)
+	require.Equal(t, samples[len(samples)-4].SeqNum, seqNum)
+	require.Equal(t, m.retainedSeqNums(now)[len(samples)-4], seqNum)
+
+	// The samples persisted per table are capped.
+	tableSamples := m.samplesForTable(0, samples[len(samples)-1].SeqNum)
+	require.Len(t, tableSamples, maxTableSeqNumTimes)
+	require.Equal(t, samples[0], tableSamples[0])
+	require.Equal(t, samples[len(samples)-1], tableSamples[maxTableSeqNumTimes-1])
+}
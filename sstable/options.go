@@ -230,6 +230,15 @@ type WriterOptions struct {
 	// 750MB sstables -- see
 	// https://github.com/cockroachdb/cockroach/issues/117113).
 	DisableValueBlocks bool
+
+	// PointKeyFingerprint, if set, makes the writer record the fingerprint of
+	// the table's point keys in the Properties.PointKeyFingerprint property
+	// (see base.FingerprintPointKey). The fingerprint is only recorded for
+	// tables whose keys are all SETs of distinct user keys, without range
+	// deletions or range keys, so that it's the fingerprint of the keys a
+	// reader sees when the table's keys are visible and nothing overlaps the
+	// table.
+	PointKeyFingerprint bool
 }
 
 func (o WriterOptions) ensureDefaults() WriterOptions {
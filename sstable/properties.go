@@ -163,6 +163,10 @@ type Properties struct {
 	NumValueBlocks uint64 `prop:"pebble.num.value-blocks"`
 	// The number of values stored in value blocks. Only serialized if > 0.
 	NumValuesInValueBlocks uint64 `prop:"pebble.num.values.in.value-blocks"`
+	// The fingerprint of the table's point keys, if the table was written with
+	// WriterOptions.PointKeyFingerprint and is eligible for one. Zero if the
+	// table has no fingerprint.
+	PointKeyFingerprint uint64 `prop:"pebble.point-key.fingerprint"`
 	// A comma separated list of names of the property collectors used in this
 	// table.
 	PropertyCollectorNames string `prop:"rocksdb.property.collectors"`
@@ -395,6 +399,9 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 	if p.NumValuesInValueBlocks > 0 {
 		p.saveUvarint(m, unsafe.Offsetof(p.NumValuesInValueBlocks), p.NumValuesInValueBlocks)
 	}
+	if p.PointKeyFingerprint > 0 {
+		p.saveUvarint(m, unsafe.Offsetof(p.PointKeyFingerprint), p.PointKeyFingerprint)
+	}
 	if p.PropertyCollectorNames != "" {
 		p.saveString(m, unsafe.Offsetof(p.PropertyCollectorNames), p.PropertyCollectorNames)
 	}
@@ -298,7 +298,7 @@ func (r *Reader) NewIterWithBlockPropertyFilters(
 ) (Iterator, error) {
 	return r.newIterWithBlockPropertyFiltersAndContext(
 		context.Background(), transforms, lower, upper, filterer, useFilterBlock,
-		stats, categoryAndQoS, statsCollector, rp, nil)
+		stats, categoryAndQoS, statsCollector, rp, nil, nil /* bufferPool */)
 }
 
 // NewIterWithBlockPropertyFiltersAndContextEtc is similar to
@@ -321,7 +321,16 @@ func (r *Reader) NewIterWithBlockPropertyFiltersAndContextEtc(
 ) (Iterator, error) {
 	return r.newIterWithBlockPropertyFiltersAndContext(
 		ctx, transforms, lower, upper, filterer, useFilterBlock,
-		stats, categoryAndQoS, statsCollector, rp, nil)
+		stats, categoryAndQoS, statsCollector, rp, nil, nil /* bufferPool */)
+}
+
+// NewPointIter is like NewIterWithBlockPropertyFiltersAndContextEtc, with the
+// parameters of the iterator specified by opts.
+func (r *Reader) NewPointIter(ctx context.Context, opts PointIterOptions) (Iterator, error) {
+	return r.newIterWithBlockPropertyFiltersAndContext(
+		ctx, opts.Transforms, opts.Lower, opts.Upper, opts.Filterer, opts.UseFilterBlock,
+		opts.Stats, opts.CategoryAndQoS, opts.StatsCollector, opts.ReaderProvider, nil,
+		opts.BufferPool)
 }
 
 // TryAddBlockPropertyFilterForHideObsoletePoints is expected to be called
@@ -351,6 +360,7 @@ func (r *Reader) newIterWithBlockPropertyFiltersAndContext(
 	statsCollector *CategoryStatsCollector,
 	rp ReaderProvider,
 	vState *virtualState,
+	bufferPool *BufferPool,
 ) (Iterator, error) {
 	// NB: pebble.tableCache wraps the returned iterator with one which performs
 	// reference counting on the Reader, preventing the Reader from being closed
@@ -358,7 +368,7 @@ func (r *Reader) newIterWithBlockPropertyFiltersAndContext(
 	if r.Properties.IndexType == twoLevelIndex {
 		i := twoLevelIterPool.Get().(*twoLevelIterator)
 		err := i.init(ctx, r, vState, transforms, lower, upper, filterer, useFilterBlock,
-			stats, categoryAndQoS, statsCollector, rp, nil /* bufferPool */)
+			stats, categoryAndQoS, statsCollector, rp, bufferPool)
 		if err != nil {
 			return nil, err
 		}
@@ -367,7 +377,7 @@ func (r *Reader) newIterWithBlockPropertyFiltersAndContext(
 
 	i := singleLevelIterPool.Get().(*singleLevelIterator)
 	err := i.init(ctx, r, vState, transforms, lower, upper, filterer, useFilterBlock,
-		stats, categoryAndQoS, statsCollector, rp, nil /* bufferPool */)
+		stats, categoryAndQoS, statsCollector, rp, bufferPool)
 	if err != nil {
 		return nil, err
 	}
@@ -1051,6 +1061,11 @@ func (r *Reader) CommonProperties() *CommonProperties {
 	return &r.Properties.CommonProperties
 }
 
+// UserProperties returns the user properties of the table.
+func (r *Reader) UserProperties() map[string]string {
+	return r.Properties.UserProperties
+}
+
 // EstimateDiskUsage returns the total size of data blocks overlapping the range
 // `[start, end]`. Even if a data block partially overlaps, or we cannot
 // determine overlap due to abbreviated index keys, the full data block size is
@@ -1183,6 +1198,179 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 		endBH.Offset + endBH.Length + blockTrailerLen - startBH.Offset), nil
 }
 
+// EstimateKeyDistribution estimates the distribution by prefix of the point
+// keys of the table within the span [lower, upper), calling fn in key order
+// with the estimated size and number of keys of each run of keys with the same
+// prefix, as returned by the prefix function. The same prefix may be passed to
+// fn several times, and is only valid for the duration of the call. A nil lower
+// or upper leaves the span unbounded on that side, and upperInclusive includes
+// upper in the span.
+//
+// The data blocks whose index separators show that all their keys are within
+// the span and share a prefix aren't read: their number of keys is estimated
+// from the table's properties, as if all the keys of the table took up the same
+// space. The other data blocks overlapping the span are
+// read, and their size is divided among their keys. As in EstimateDiskUsage,
+// the size of the value blocks is interpolated.
+func (r *Reader) EstimateKeyDistribution(
+	lower, upper []byte,
+	upperInclusive bool,
+	prefix func(key []byte) []byte,
+	fn func(prefix []byte, size, keys uint64),
+) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.Properties.DataSize == 0 {
+		return nil
+	}
+	var pointKeys uint64
+	if r.Properties.NumEntries > r.Properties.NumRangeDeletions {
+		pointKeys = r.Properties.NumEntries - r.Properties.NumRangeDeletions
+	}
+	// The ratio of the size of the data and value blocks to the size of the
+	// data blocks.
+	sizeRatio := 1 + float64(r.Properties.ValueBlocksSize)/float64(r.Properties.DataSize)
+	beforeUpper := func(key []byte) bool {
+		if upper == nil {
+			return true
+		}
+		c := r.Compare(key, upper)
+		return c < 0 || (c == 0 && upperInclusive)
+	}
+
+	// The user keys of a data block are within [prevSep, sep], where sep is the
+	// user key of the block's index separator and prevSep that of the
+	// preceding block. The user keys of the first data block aren't bounded
+	// from below.
+	var prevSep []byte
+	var havePrev, done bool
+	return r.forEachDataBlock(func(sep []byte, bh BlockHandle) error {
+		if done {
+			return nil
+		}
+		defer func() {
+			prevSep = append(prevSep[:0], sep...)
+			havePrev = true
+		}()
+		if lower != nil && r.Compare(sep, lower) < 0 {
+			return nil
+		}
+		if havePrev && !beforeUpper(prevSep) {
+			done = true
+			return nil
+		}
+		size := float64(bh.Length+blockTrailerLen) * sizeRatio
+		if havePrev && (lower == nil || r.Compare(lower, prevSep) <= 0) && beforeUpper(sep) {
+			if p := prefix(prevSep); bytes.Equal(p, prefix(sep)) {
+				keys := float64(pointKeys) * float64(bh.Length) / float64(r.Properties.DataSize)
+				fn(p, uint64(size+0.5), uint64(keys+0.5))
+				return nil
+			}
+		}
+		return r.distributeDataBlock(bh, size, lower, beforeUpper, prefix, fn)
+	})
+}
+
+// distributeDataBlock reads the data block and divides its size among its
+// keys, calling fn with the size and number of keys of each run of keys within
+// the bounds sharing a prefix.
+func (r *Reader) distributeDataBlock(
+	bh BlockHandle,
+	size float64,
+	lower []byte,
+	beforeUpper func(key []byte) bool,
+	prefix func(key []byte) []byte,
+	fn func(prefix []byte, size, keys uint64),
+) error {
+	h, err := r.readBlock(context.Background(), bh,
+		nil /* transform */, nil /* readHandle */, nil /* stats */, nil /* iterStats */, nil /* buffer pool */)
+	if err != nil {
+		return err
+	}
+	defer h.Release()
+	iter, err := newBlockIter(r.Compare, r.Split, h.Get(), NoTransforms)
+	if err != nil {
+		return err
+	}
+	type run struct {
+		prefix []byte
+		keys   uint64
+	}
+	var runs []run
+	var blockKeys uint64
+	for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+		blockKeys++
+		if (lower != nil && r.Compare(key.UserKey, lower) < 0) || !beforeUpper(key.UserKey) {
+			continue
+		}
+		p := prefix(key.UserKey)
+		if len(runs) == 0 || !bytes.Equal(runs[len(runs)-1].prefix, p) {
+			runs = append(runs, run{prefix: slices.Clone(p)})
+		}
+		runs[len(runs)-1].keys++
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		fn(run.prefix, uint64(size*float64(run.keys)/float64(blockKeys)+0.5), run.keys)
+	}
+	return nil
+}
+
+// forEachDataBlock calls fn with the user key of the index separator and the
+// handle of each data block of the table, in order. The separator is only
+// valid for the duration of the call.
+func (r *Reader) forEachDataBlock(fn func(sep []byte, bh BlockHandle) error) error {
+	indexH, err := r.readIndex(context.Background(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer indexH.Release()
+
+	visit := func(index []byte) error {
+		iter, err := newBlockIter(r.Compare, r.Split, index, NoTransforms)
+		if err != nil {
+			return err
+		}
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			bh, err := decodeBlockHandleWithProperties(value.InPlaceValue())
+			if err != nil {
+				return errCorruptIndexEntry
+			}
+			if err := fn(key.UserKey, bh.BlockHandle); err != nil {
+				return err
+			}
+		}
+		return iter.Error()
+	}
+	if r.Properties.IndexPartitions == 0 {
+		return visit(indexH.Get())
+	}
+	topIter, err := newBlockIter(r.Compare, r.Split, indexH.Get(), NoTransforms)
+	if err != nil {
+		return err
+	}
+	for key, value := topIter.First(); key != nil; key, value = topIter.Next() {
+		indexBH, err := decodeBlockHandleWithProperties(value.InPlaceValue())
+		if err != nil {
+			return errCorruptIndexEntry
+		}
+		subIndex, err := r.readBlock(context.Background(), indexBH.BlockHandle,
+			nil /* transform */, nil /* readHandle */, nil /* stats */, nil /* iterStats */, nil /* buffer pool */)
+		if err != nil {
+			return err
+		}
+		err = visit(subIndex.Get())
+		subIndex.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return topIter.Error()
+}
+
 // TableFormat returns the format version for the table.
 func (r *Reader) TableFormat() (TableFormat, error) {
 	if r.err != nil {
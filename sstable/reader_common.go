@@ -45,6 +45,23 @@ type CommonReader interface {
 	CommonProperties() *CommonProperties
 }
 
+// PointIterOptions holds the parameters of a point iterator created by
+// Reader.NewPointIter or VirtualReader.NewPointIter. The fields correspond to
+// the parameters of NewIterWithBlockPropertyFiltersAndContextEtc.
+type PointIterOptions struct {
+	Transforms     IterTransforms
+	Lower, Upper   []byte
+	Filterer       *BlockPropertiesFilterer
+	UseFilterBlock bool
+	Stats          *base.InternalIteratorStats
+	CategoryAndQoS CategoryAndQoS
+	StatsCollector *CategoryStatsCollector
+	ReaderProvider ReaderProvider
+	// BufferPool, if non-nil, is used to allocate the data blocks read by the
+	// iterator, rather than inserting them into the block cache.
+	BufferPool *BufferPool
+}
+
 // IterTransforms allow on-the-fly transformation of data at iteration time.
 //
 // These transformations could in principle be implemented as block transforms
@@ -1323,7 +1323,7 @@ func TestRandomizedPrefixSuffixRewriter(t *testing.T) {
 			TrivialReaderProvider{Reader: eReader}, &virtualState{
 				lower: base.MakeInternalKey([]byte("_"), base.InternalKeySeqNumMax, base.InternalKeyKindSet),
 				upper: base.MakeRangeDeleteSentinelKey([]byte("~~~~~~~~~~~~~~~~")),
-			})
+			}, nil /* bufferPool */)
 		require.NoError(t, err)
 		return iter, func() {
 			require.NoError(t, iter.Close())
@@ -1738,6 +1738,70 @@ func TestReader_TableFormat(t *testing.T) {
 	}
 }
 
+func TestReaderEstimateKeyDistribution(t *testing.T) {
+	// The keys are spread evenly over 26 prefixes of one byte, and have values
+	// of the same size.
+	const keysPerPrefix = 200
+	key := func(p byte, i int) []byte { return []byte(fmt.Sprintf("%c%05d", p, i)) }
+	prefix := func(key []byte) []byte { return key[:1] }
+	test := func(t *testing.T, indexBlockSize int) {
+		fs := vfs.NewMem()
+		f, err := fs.Create("test")
+		require.NoError(t, err)
+		w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+			BlockSize:      512,
+			IndexBlockSize: indexBlockSize,
+			TableFormat:    TableFormatPebblev2,
+		})
+		for p := byte('a'); p <= 'z'; p++ {
+			for i := 0; i < keysPerPrefix; i++ {
+				require.NoError(t, w.Set(key(p, i), []byte("value")))
+			}
+		}
+		require.NoError(t, w.Close())
+		f, err = fs.Open("test")
+		require.NoError(t, err)
+		r, err := newReader(f, ReaderOptions{})
+		require.NoError(t, err)
+		defer r.Close()
+
+		distribution := func(lower, upper []byte) (map[string]uint64, uint64) {
+			keys := make(map[string]uint64)
+			var size uint64
+			var last string
+			require.NoError(t, r.EstimateKeyDistribution(lower, upper, false /* upperInclusive */, prefix,
+				func(prefix []byte, s, k uint64) {
+					require.LessOrEqual(t, last, string(prefix))
+					last = string(prefix)
+					keys[last] += k
+					size += s
+				}))
+			return keys, size
+		}
+
+		// The estimated number of keys of each prefix is within a block of the
+		// actual one, and the sizes add up to the size of the data blocks.
+		keys, size := distribution(nil, nil)
+		require.Len(t, keys, 26)
+		for p, n := range keys {
+			require.InDelta(t, keysPerPrefix, n, 20, "prefix %s", p)
+		}
+		require.InDelta(t, r.Properties.DataSize, size, float64(r.Properties.NumDataBlocks))
+
+		// Only the keys within the span are counted, and the size of the data
+		// blocks is shared among them.
+		keys, size = distribution(key('c', 100), key('e', 0))
+		require.Len(t, keys, 2)
+		require.InDelta(t, keysPerPrefix/2, keys["c"], 20)
+		require.InDelta(t, keysPerPrefix, keys["d"], 20)
+		require.InDelta(t, r.Properties.DataSize*3/52, size, float64(r.Properties.DataSize)/50)
+		keys, _ = distribution(key('c', 100), key('c', 100))
+		require.Empty(t, keys)
+	}
+	t.Run("single-level", func(t *testing.T) { test(t, 0 /* indexBlockSize */) })
+	t.Run("two-level", func(t *testing.T) { test(t, 64 /* indexBlockSize */) })
+}
+
 func buildTestTable(
 	t *testing.T,
 	numEntries uint64,
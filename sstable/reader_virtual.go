@@ -118,7 +118,16 @@ func (v *VirtualReader) NewIterWithBlockPropertyFiltersAndContextEtc(
 ) (Iterator, error) {
 	return v.reader.newIterWithBlockPropertyFiltersAndContext(
 		ctx, transforms, lower, upper, filterer, useFilterBlock,
-		stats, categoryAndQoS, statsCollector, rp, &v.vState)
+		stats, categoryAndQoS, statsCollector, rp, &v.vState, nil /* bufferPool */)
+}
+
+// NewPointIter wraps Reader.NewPointIter, with the same assumption as
+// NewIterWithBlockPropertyFiltersAndContextEtc regarding the bounds.
+func (v *VirtualReader) NewPointIter(ctx context.Context, opts PointIterOptions) (Iterator, error) {
+	return v.reader.newIterWithBlockPropertyFiltersAndContext(
+		ctx, opts.Transforms, opts.Lower, opts.Upper, opts.Filterer, opts.UseFilterBlock,
+		opts.Stats, opts.CategoryAndQoS, opts.StatsCollector, opts.ReaderProvider, &v.vState,
+		opts.BufferPool)
 }
 
 // ValidateBlockChecksumsOnBacking will call ValidateBlockChecksumsOnBacking on the underlying reader.
@@ -253,7 +262,21 @@ func (v *VirtualReader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 	return v.reader.EstimateDiskUsage(f, l)
 }
 
+// EstimateKeyDistribution just calls VirtualReader.reader.EstimateKeyDistribution
+// after enforcing the virtual sstable bounds.
+func (v *VirtualReader) EstimateKeyDistribution(
+	start, end []byte, prefix func(key []byte) []byte, fn func(prefix []byte, size, keys uint64),
+) error {
+	lastKeyInclusive, f, l := v.vState.constrainBounds(start, end, false /* endInclusive */)
+	return v.reader.EstimateKeyDistribution(f, l, lastKeyInclusive, prefix, fn)
+}
+
 // CommonProperties implements the CommonReader interface.
 func (v *VirtualReader) CommonProperties() *CommonProperties {
 	return &v.Properties
 }
+
+// UserProperties returns the user properties of the backing table.
+func (v *VirtualReader) UserProperties() map[string]string {
+	return v.reader.Properties.UserProperties
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"math"
+	"strings"
 	"sync"
 
 	"github.com/cespare/xxhash/v2"
@@ -11,6 +12,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/bytealloc"
 	"github.com/cockroachdb/pebble/internal/invariants"
+	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/objstorage"
 )
@@ -513,6 +515,224 @@ func RewriteKeySuffixesViaWriter(
 	return writerMeta, err
 }
 
+// RewriteTable copies the content of the passed sstable to a new sstable
+// written to out with the passed WriterOptions, which may differ from those
+// the sstable was written with, for example in their TableFormat, Compression
+// or BlockPropertyCollectors. The point keys, range deletions and range keys
+// are copied with their sequence numbers and kinds, while the blocks, filter
+// and block properties are rebuilt by the Writer. The merger name and the user
+// properties not written by a block property collector of the sstable are
+// preserved; those of its block property collectors are only rewritten if the
+// same collectors are configured in the WriterOptions. VerifyRewrite may be
+// used to check the content of the resulting sstable.
+//
+// Any obsolete bits that key-value pairs may be annotated with are ignored
+// and lost during the rewrite, and the output sstable is not strict obsolete.
+func RewriteTable(r *Reader, out objstorage.Writable, o WriterOptions) (*WriterMetadata, error) {
+	o = o.ensureDefaults()
+	if o.Comparer.Name != r.Properties.ComparerName {
+		return nil, errors.Errorf("comparer %s does not match the sstable's comparer %s",
+			errors.Safe(o.Comparer.Name), errors.Safe(r.Properties.ComparerName))
+	}
+	o.MergerName = r.Properties.MergerName
+	o.IsStrictObsolete = false
+	w := NewWriter(out, o)
+	defer func() {
+		if w != nil {
+			w.Close()
+		}
+	}()
+
+	blockProps := make(map[string]bool)
+	for _, name := range strings.Split(strings.Trim(r.Properties.PropertyCollectorNames, "[]"), ",") {
+		blockProps[name] = true
+	}
+	for name, prop := range r.Properties.UserProperties {
+		if !blockProps[name] {
+			if w.preservedUserProps == nil {
+				w.preservedUserProps = make(map[string]string)
+			}
+			w.preservedUserProps[name] = prop
+		}
+	}
+
+	if err := rewritePointKeysToWriter(r, w); err != nil {
+		return nil, errors.Wrap(err, "rewriting point keys")
+	}
+	if err := rewriteRangeDelsToWriter(r, w); err != nil {
+		return nil, errors.Wrap(err, "rewriting range deletions")
+	}
+	if err := rewriteRangeKeysToWriter(r, w); err != nil {
+		return nil, errors.Wrap(err, "rewriting range keys")
+	}
+	if err := w.Close(); err != nil {
+		w = nil
+		return nil, err
+	}
+	writerMeta, err := w.Metadata()
+	w = nil
+	return writerMeta, err
+}
+
+func rewritePointKeysToWriter(r *Reader, w *Writer) (err error) {
+	iter, err := r.NewIter(NoTransforms, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = firstError(err, iter.Close())
+	}()
+	for k, v := iter.First(); k != nil; k, v = iter.Next() {
+		val, _, err := v.Value(nil)
+		if err != nil {
+			return err
+		}
+		if err := w.Add(*k, val); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+func rewriteRangeDelsToWriter(r *Reader, w *Writer) error {
+	iter, err := r.NewRawRangeDelIter(NoTransforms)
+	if err != nil || iter == nil {
+		return err
+	}
+	defer iter.Close()
+	s, err := iter.First()
+	for ; s != nil; s, err = iter.Next() {
+		for _, k := range s.Keys {
+			if err := w.Add(InternalKey{UserKey: s.Start, Trailer: k.Trailer}, s.End); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+func rewriteRangeKeysToWriter(r *Reader, w *Writer) error {
+	iter, err := r.NewRawRangeKeyIter(NoTransforms)
+	if err != nil || iter == nil {
+		return err
+	}
+	defer iter.Close()
+	s, err := iter.First()
+	for ; s != nil; s, err = iter.Next() {
+		// Calling AddRangeKey bypasses the fragmenter, which is okay since the
+		// spans off of iter are already fragmented.
+		if err := rangekey.Encode(s, w.AddRangeKey); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// VerifyRewrite checks that the rewritten sstable, such as one produced by
+// RewriteTable, has the same point keys, range deletions and range keys as the
+// sstable r, returning an error describing the first difference otherwise.
+func VerifyRewrite(r, rewritten *Reader) error {
+	if err := verifyPointKeys(r, rewritten); err != nil {
+		return err
+	}
+	rangeDelIter := func(r *Reader) (keyspan.FragmentIterator, error) {
+		return r.NewRawRangeDelIter(NoTransforms)
+	}
+	if err := verifySpans(r, rewritten, "range deletion", rangeDelIter); err != nil {
+		return err
+	}
+	rangeKeyIter := func(r *Reader) (keyspan.FragmentIterator, error) {
+		return r.NewRawRangeKeyIter(NoTransforms)
+	}
+	return verifySpans(r, rewritten, "range key", rangeKeyIter)
+}
+
+func verifyPointKeys(r, rewritten *Reader) (err error) {
+	a, err := r.NewIter(NoTransforms, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { err = firstError(err, a.Close()) }()
+	b, err := rewritten.NewIter(NoTransforms, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { err = firstError(err, b.Close()) }()
+
+	ka, va := a.First()
+	kb, vb := b.First()
+	for ka != nil && kb != nil {
+		if ka.Trailer != kb.Trailer || !r.Equal(ka.UserKey, kb.UserKey) {
+			return errors.Errorf("point key %s rewritten as %s",
+				ka.Pretty(r.FormatKey), kb.Pretty(r.FormatKey))
+		}
+		valA, _, err := va.Value(nil)
+		if err != nil {
+			return err
+		}
+		valB, _, err := vb.Value(nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(valA, valB) {
+			return errors.Errorf("value of point key %s differs", ka.Pretty(r.FormatKey))
+		}
+		ka, va = a.Next()
+		kb, vb = b.Next()
+	}
+	if err := firstError(a.Error(), b.Error()); err != nil {
+		return err
+	}
+	switch {
+	case ka != nil:
+		return errors.Errorf("point key %s missing", ka.Pretty(r.FormatKey))
+	case kb != nil:
+		return errors.Errorf("unexpected point key %s", kb.Pretty(r.FormatKey))
+	}
+	return nil
+}
+
+func verifySpans(
+	r, rewritten *Reader, kind string, newIter func(r *Reader) (keyspan.FragmentIterator, error),
+) (err error) {
+	iters := [2]keyspan.FragmentIterator{}
+	for i, r := range []*Reader{r, rewritten} {
+		if iters[i], err = newIter(r); err != nil {
+			return err
+		}
+		if iters[i] == nil {
+			iters[i] = keyspan.NewIter(r.Compare, nil)
+		}
+		defer func(iter keyspan.FragmentIterator) { err = firstError(err, iter.Close()) }(iters[i])
+	}
+
+	sa, errA := iters[0].First()
+	sb, errB := iters[1].First()
+	for sa != nil && sb != nil {
+		equal := r.Equal(sa.Start, sb.Start) && r.Equal(sa.End, sb.End) &&
+			len(sa.Keys) == len(sb.Keys)
+		for i := 0; equal && i < len(sa.Keys); i++ {
+			equal = sa.Keys[i].Equal(r.Equal, sb.Keys[i])
+		}
+		if !equal {
+			return errors.Errorf("%s %s rewritten as %s",
+				errors.Safe(kind), sa.Pretty(r.FormatKey), sb.Pretty(r.FormatKey))
+		}
+		sa, errA = iters[0].Next()
+		sb, errB = iters[1].Next()
+	}
+	if err := firstError(errA, errB); err != nil {
+		return err
+	}
+	switch {
+	case sa != nil:
+		return errors.Errorf("%s %s missing", errors.Safe(kind), sa.Pretty(r.FormatKey))
+	case sb != nil:
+		return errors.Errorf("unexpected %s %s", errors.Safe(kind), sb.Pretty(r.FormatKey))
+	}
+	return nil
+}
+
 // NewMemReader opens a reader over the SST stored in the passed []byte.
 func NewMemReader(sst []byte, o ReaderOptions) (*Reader, error) {
 	return NewReader(newMemReader(sst), o)
@@ -268,3 +268,71 @@ func BenchmarkRewriteSST(b *testing.B) {
 		})
 	}
 }
+
+func TestRewriteTable(t *testing.T) {
+	makeSST := func(format TableFormat, rangeDels bool) []byte {
+		f := &memFile{}
+		w := NewWriter(f, WriterOptions{
+			BlockPropertyCollectors: []func() BlockPropertyCollector{keyCountCollectorFn("count")},
+			BlockSize:               64,
+			TableFormat:             format,
+		})
+		for i := 0; i < 100; i++ {
+			k := []byte(fmt.Sprintf("key%03d", i))
+			require.NoError(t, w.Add(base.MakeInternalKey(k, uint64(2*i+2), InternalKeyKindSet), k))
+			kind := InternalKeyKindDelete
+			if i%2 == 0 {
+				kind = InternalKeyKindMerge
+			}
+			require.NoError(t, w.Add(base.MakeInternalKey(k, uint64(2*i+1), kind), nil))
+		}
+		if rangeDels {
+			require.NoError(t, w.DeleteRange([]byte("key010"), []byte("key020")))
+		}
+		require.NoError(t, w.RangeKeySet([]byte("key030"), []byte("key040"), []byte("@5"), []byte("v")))
+		require.NoError(t, w.RangeKeyUnset([]byte("key035"), []byte("key045"), []byte("@3")))
+		require.NoError(t, w.Close())
+		return f.Data()
+	}
+
+	for format := TableFormatPebblev2; format <= TableFormatMax; format++ {
+		r, err := NewMemReader(makeSST(format, true /* rangeDels */), ReaderOptions{})
+		require.NoError(t, err)
+		defer r.Close()
+		// Properties not written by a block property collector, such as those
+		// of sstables written by RocksDB, are preserved.
+		r.Properties.UserProperties["custom"] = "preserved"
+
+		for rwFormat := TableFormatPebblev2; rwFormat <= TableFormatMax; rwFormat++ {
+			t.Run(fmt.Sprintf("%s->%s", format, rwFormat), func(t *testing.T) {
+				f := &memFile{}
+				_, err := RewriteTable(r, f, WriterOptions{
+					BlockPropertyCollectors: []func() BlockPropertyCollector{keyCountCollectorFn("count2")},
+					Compression:             ZstdCompression,
+					TableFormat:             rwFormat,
+				})
+				require.NoError(t, err)
+				rewritten, err := NewMemReader(f.Data(), ReaderOptions{})
+				require.NoError(t, err)
+				defer rewritten.Close()
+				require.NoError(t, VerifyRewrite(r, rewritten))
+
+				tableFormat, err := rewritten.TableFormat()
+				require.NoError(t, err)
+				require.Equal(t, rwFormat, tableFormat)
+				require.Equal(t, "ZSTD", rewritten.Properties.CompressionName)
+				props := rewritten.Properties.UserProperties
+				require.Equal(t, "preserved", props["custom"])
+				require.Contains(t, props, "count2")
+				require.NotContains(t, props, "count")
+			})
+		}
+
+		// A table with different content fails verification.
+		other, err := NewMemReader(makeSST(format, false /* rangeDels */), ReaderOptions{})
+		require.NoError(t, err)
+		defer other.Close()
+		require.NoError(t, VerifyRewrite(other, other))
+		require.ErrorContains(t, VerifyRewrite(r, other), "range deletion")
+	}
+}
@@ -141,6 +141,15 @@ type Writer struct {
 	// sstable in order. It is intended for internal use only in the construction
 	// of invalid sstables for testing. See tool/make_test_sstables.go.
 	disableKeyOrderChecks bool
+	// fingerprinting is true while the table may have a point key
+	// fingerprint, which fingerprint accumulates. See
+	// WriterOptions.PointKeyFingerprint.
+	fingerprinting bool
+	fingerprint    uint64
+	// preservedUserProps are user properties written along with those of the
+	// block property collectors, unless a collector writes the same property.
+	// See RewriteTable.
+	preservedUserProps map[string]string
 	// With two level indexes, the index/filter of a SST file is partitioned into
 	// smaller blocks with an additional top-level index on them. When reading an
 	// index/filter, only the top-level index is loaded into memory. The two level
@@ -797,6 +806,24 @@ func (w *Writer) makeAddPointDecisionV2(key InternalKey) error {
 	return nil
 }
 
+// addPointToFingerprint adds the point key to the table's fingerprint, or
+// abandons the fingerprint if the key is not a SET or has the same user key as
+// the previous point key.
+func (w *Writer) addPointToFingerprint(key InternalKey, value []byte) {
+	switch key.Kind() {
+	case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+	default:
+		w.fingerprinting = false
+		return
+	}
+	if w.dataBlockBuf.dataBlock.nEntries > 0 &&
+		w.compare(w.dataBlockBuf.dataBlock.getCurUserKey(), key.UserKey) == 0 {
+		w.fingerprinting = false
+		return
+	}
+	w.fingerprint += base.FingerprintPointKey(key.UserKey, value)
+}
+
 // REQUIRES: at least one point has been written to the Writer.
 func (w *Writer) getLastPointUserKey() []byte {
 	if w.dataBlockBuf.dataBlock.nEntries == 0 {
@@ -926,6 +953,9 @@ func (w *Writer) addPoint(key InternalKey, value []byte, forceObsolete bool) err
 	if w.isStrictObsolete && key.Kind() == InternalKeyKindMerge {
 		return errors.Errorf("MERGE not supported in a strict-obsolete sstable")
 	}
+	if w.fingerprinting {
+		w.addPointToFingerprint(key, value)
+	}
 	var err error
 	var setHasSameKeyPrefix, writeToValueBlock, addPrefixToValueStoredWithKey bool
 	var isObsolete bool
@@ -2043,11 +2073,22 @@ func (w *Writer) Close() (err error) {
 				// that the block property collector was used when writing.
 				userProps[w.blockPropCollectors[i].Name()] = prop
 			}
+			for name, prop := range w.preservedUserProps {
+				if _, ok := userProps[name]; !ok {
+					userProps[name] = prop
+				}
+			}
 			if len(userProps) > 0 {
 				w.props.UserProperties = userProps
 			}
 		}
 
+		// A zero fingerprint is indistinguishable from the absence of one, in
+		// which case the table is simply not fingerprinted.
+		if w.fingerprinting && w.props.NumRangeDeletions == 0 && w.props.NumRangeKeys() == 0 {
+			w.props.PointKeyFingerprint = w.fingerprint
+		}
+
 		// Write the properties block.
 		var raw rawBlockWriter
 		// The restart interval is set to infinity because the properties block
@@ -2200,6 +2241,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		tableFormat:             o.TableFormat,
 		isStrictObsolete:        o.IsStrictObsolete,
 		writingToLowestLevel:    o.WritingToLowestLevel,
+		fingerprinting:          o.PointKeyFingerprint,
 		cache:                   o.Cache,
 		restartInterval:         o.BlockRestartInterval,
 		checksumType:            o.Checksum,
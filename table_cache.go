@@ -546,6 +546,13 @@ func (c *tableCacheShard) newIters(
 	return iters, nil
 }
 
+// pointIterReader is implemented by the sstable readers that accept the
+// parameters of a point iterator as sstable.PointIterOptions, which allows
+// allocating its blocks from a buffer pool.
+type pointIterReader interface {
+	NewPointIter(ctx context.Context, opts sstable.PointIterOptions) (sstable.Iterator, error)
+}
+
 // newPointIter is an internal helper that constructs a point iterator over a
 // sstable. This function is for internal use only, and callers should use
 // newIters instead.
@@ -638,6 +645,19 @@ func (c *tableCacheShard) newPointIter(
 		iter, err = cr.NewCompactionIter(
 			transforms, internalOpts.bytesIterated, categoryAndQoS, dbOpts.sstStatsCollector, rp,
 			internalOpts.bufferPool)
+	} else if pr, ok := cr.(pointIterReader); ok && internalOpts.bufferPool != nil {
+		iter, err = pr.NewPointIter(ctx, sstable.PointIterOptions{
+			Transforms:     transforms,
+			Lower:          opts.GetLowerBound(),
+			Upper:          opts.GetUpperBound(),
+			Filterer:       filterer,
+			UseFilterBlock: useFilter,
+			Stats:          internalOpts.stats,
+			CategoryAndQoS: categoryAndQoS,
+			StatsCollector: dbOpts.sstStatsCollector,
+			ReaderProvider: rp,
+			BufferPool:     internalOpts.bufferPool,
+		})
 	} else {
 		iter, err = cr.NewIterWithBlockPropertyFiltersAndContextEtc(
 			ctx, transforms, opts.GetLowerBound(), opts.GetUpperBound(), filterer, useFilter,
@@ -324,6 +324,11 @@ func (d *DB) loadTableStats(
 			// picking.
 			stats.NumRangeKeySets = props.NumRangeKeySets
 			stats.ValueBlocksSize = props.ValueBlocksSize
+			// Both the physical and the virtual readers expose the user
+			// properties, which aren't part of the CommonReader interface.
+			if ur, ok := r.(interface{ UserProperties() map[string]string }); ok {
+				setTombstoneDensityStats(meta, ur.UserProperties(), &stats)
+			}
 			return
 		})
 	if err != nil {
@@ -679,6 +684,7 @@ func maybeSetStatsFromProperties(meta physicalMeta, props *sstable.Properties) b
 	meta.Stats.PointDeletionsBytesEstimate = pointEstimate
 	meta.Stats.RangeDeletionsBytesEstimate = 0
 	meta.Stats.ValueBlocksSize = props.ValueBlocksSize
+	setTombstoneDensityStats(meta.FileMetadata, props.UserProperties, &meta.Stats)
 	meta.StatsMarkValid()
 	return true
 }
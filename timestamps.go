@@ -0,0 +1,219 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// TimestampOptions configures first-class support for user-defined timestamps
+// (see Options.Timestamps). A timestamped key is the concatenation of a
+// prefix, as determined by Comparer.Split, and a suffix encoding a timestamp.
+// The versions of a prefix must sort in decreasing timestamp order, after the
+// bare prefix, which is unversioned and visible at every timestamp.
+//
+// With timestamps configured:
+//   - Batch.SetWithTimestamp writes a version of a key.
+//   - IterOptions.ReadTimestamp hides the versions newer than a timestamp.
+//     Tables and data blocks that only contain such versions are skipped
+//     through a block-property filter on the interval of timestamps of their
+//     keys.
+//   - Compactions garbage collect the versions of a prefix that are shadowed
+//     at the timestamp returned by FullHistoryThreshold.
+type TimestampOptions struct {
+	// EncodeTimestamp appends the suffix encoding ts to dst, and returns the
+	// resulting slice.
+	EncodeTimestamp func(dst []byte, ts uint64) []byte
+	// DecodeTimestamp returns the timestamp encoded in suffix, a key suffix as
+	// determined by Comparer.Split. It returns false if the suffix doesn't
+	// encode a timestamp, as is the case for an empty suffix.
+	DecodeTimestamp func(suffix []byte) (ts uint64, ok bool)
+	// FullHistoryThreshold, if set, returns the timestamp at and above which
+	// the history of keys must be fully preserved. Reads at timestamps below
+	// the threshold may miss the versions that compactions garbage collect:
+	// the versions of a prefix that are older than its newest version at or
+	// below the threshold. The threshold should only ever increase.
+	//
+	// Garbage collection assumes that versions at or below the threshold are
+	// never deleted individually, by point or range deletions of their keys:
+	// otherwise, deleting the newest such version could fail to reveal the
+	// older ones. Keys should instead be deleted by writing a newer version
+	// that the application interprets as a tombstone.
+	FullHistoryThreshold func() uint64
+}
+
+// timestampIntervalCollectorName is the name of the block property collector
+// that records the interval of the timestamps of the point keys of each block.
+const timestampIntervalCollectorName = "pebble.timestamp-interval"
+
+// newTimestampIntervalCollector returns a function that constructs the block
+// property collector of the interval of the timestamps of point keys, which
+// serves IterOptions.ReadTimestamp. Unversioned keys are collected with a
+// timestamp of zero, so that their blocks are never filtered.
+func (o *TimestampOptions) newTimestampIntervalCollector(
+	split Split,
+) func() BlockPropertyCollector {
+	return func() BlockPropertyCollector {
+		return sstable.NewBlockIntervalCollector(timestampIntervalCollectorName,
+			&timestampIntervalCollector{split: split, decode: o.DecodeTimestamp}, nil /* ranges */)
+	}
+}
+
+// timestampIntervalCollector implements sstable.DataBlockIntervalCollector.
+type timestampIntervalCollector struct {
+	split        Split
+	decode       func(suffix []byte) (uint64, bool)
+	lower, upper uint64
+}
+
+var _ sstable.DataBlockIntervalCollector = (*timestampIntervalCollector)(nil)
+
+// Add implements sstable.DataBlockIntervalCollector.
+func (c *timestampIntervalCollector) Add(key InternalKey, value []byte) error {
+	ts, _ := c.decode(key.UserKey[c.split(key.UserKey):])
+	if c.lower >= c.upper {
+		c.lower, c.upper = ts, ts+1
+	} else {
+		c.lower, c.upper = min(c.lower, ts), max(c.upper, ts+1)
+	}
+	return nil
+}
+
+// FinishDataBlock implements sstable.DataBlockIntervalCollector.
+func (c *timestampIntervalCollector) FinishDataBlock() (lower, upper uint64, err error) {
+	lower, upper = c.lower, c.upper
+	c.lower, c.upper = 0, 0
+	return lower, upper, nil
+}
+
+// timestampSyntheticReplacer implements sstable.BlockIntervalSyntheticReplacer
+// for the interval of timestamps collected by timestampIntervalCollector.
+type timestampSyntheticReplacer struct {
+	decode func(suffix []byte) (uint64, bool)
+}
+
+var _ sstable.BlockIntervalSyntheticReplacer = timestampSyntheticReplacer{}
+
+// AdjustIntervalWithSyntheticSuffix implements
+// sstable.BlockIntervalSyntheticReplacer.
+func (r timestampSyntheticReplacer) AdjustIntervalWithSyntheticSuffix(
+	lower, upper uint64, suffix []byte,
+) (uint64, uint64, error) {
+	ts, ok := r.decode(suffix)
+	if !ok {
+		return 0, 0, errors.Errorf("pebble: synthetic suffix %x doesn't encode a timestamp", suffix)
+	}
+	return ts, ts + 1, nil
+}
+
+// withReadTimestamp returns the options to iterate with when o configures a
+// read timestamp: o, plus a SkipPoint function hiding the versions newer than
+// the read timestamp and a block-property filter skipping the blocks that only
+// contain such versions. It returns o itself if no read timestamp is set.
+func (o *IterOptions) withReadTimestamp(ts *TimestampOptions, split Split) *IterOptions {
+	if o == nil || o.ReadTimestamp == 0 {
+		return o
+	}
+	if ts == nil {
+		panic("pebble: IterOptions.ReadTimestamp requires Options.Timestamps")
+	}
+	opts := *o
+	readTS, decode, skipPoint := o.ReadTimestamp, ts.DecodeTimestamp, o.SkipPoint
+	opts.SkipPoint = func(userKey []byte) bool {
+		if v, ok := decode(userKey[split(userKey):]); ok && v > readTS {
+			return true
+		}
+		return skipPoint != nil && skipPoint(userKey)
+	}
+	opts.PointKeyFilters = make([]BlockPropertyFilter, 0, len(o.PointKeyFilters)+1)
+	opts.PointKeyFilters = append(opts.PointKeyFilters, o.PointKeyFilters...)
+	opts.PointKeyFilters = append(opts.PointKeyFilters, sstable.NewBlockIntervalFilter(
+		timestampIntervalCollectorName, 0, readTS+1, timestampSyntheticReplacer{decode: decode}))
+	return &opts
+}
+
+// timestampGC garbage collects, during a compaction, the versions of a prefix
+// older than its newest version at or below the full-history threshold (see
+// TimestampOptions.FullHistoryThreshold). Reads at or above the threshold
+// observe that version or a newer one, so the older versions are invisible to
+// them.
+//
+// The retained version must be the newest entry of its user key and be
+// visible to every open snapshot, so that no reader at or above the threshold
+// may observe an older version instead. An older version may only be dropped
+// if it's visible to every open snapshot, and no older entry for its user key
+// may exist below the compaction's output level, where it would otherwise
+// resurface.
+type timestampGC struct {
+	split     Split
+	equal     Equal
+	decode    func(suffix []byte) (uint64, bool)
+	threshold uint64
+	// earliestSnapshot is the sequence number of the earliest open snapshot,
+	// or InternalKeySeqNumMax if there are none.
+	earliestSnapshot uint64
+	// elidable returns true if no entries for a user key may exist below the
+	// compaction's output level.
+	elidable func(userKey []byte) bool
+
+	// prevUserKey is the user key of the previous key, and prefix its prefix.
+	prevUserKey []byte
+	prefix      []byte
+	// retained is true if the newest version of prefix at or below the
+	// threshold has been retained.
+	retained bool
+}
+
+// init initializes g for a compaction. It returns false if the compaction
+// doesn't garbage collect versions.
+func (g *timestampGC) init(
+	opts *Options, snapshots []uint64, elidable func(userKey []byte) bool,
+) bool {
+	ts := opts.Timestamps
+	if ts == nil || ts.FullHistoryThreshold == nil {
+		return false
+	}
+	*g = timestampGC{
+		split:            opts.Comparer.Split,
+		equal:            opts.Comparer.Equal,
+		decode:           ts.DecodeTimestamp,
+		threshold:        ts.FullHistoryThreshold(),
+		earliestSnapshot: base.InternalKeySeqNumMax,
+		elidable:         elidable,
+	}
+	if len(snapshots) > 0 {
+		g.earliestSnapshot = snapshots[0]
+	}
+	return g.threshold > 0
+}
+
+// drop returns true if key, the next key output by the compaction iterator,
+// should be garbage collected. Keys must be supplied in order.
+func (g *timestampGC) drop(key *InternalKey) bool {
+	firstOfUserKey := !g.equal(key.UserKey, g.prevUserKey)
+	n := g.split(key.UserKey)
+	if firstOfUserKey {
+		if !g.equal(key.UserKey[:n], g.prefix) {
+			g.prefix = append(g.prefix[:0], key.UserKey[:n]...)
+			g.retained = false
+		}
+		g.prevUserKey = append(g.prevUserKey[:0], key.UserKey...)
+	}
+	ts, ok := g.decode(key.UserKey[n:])
+	if !ok || ts > g.threshold {
+		return false
+	}
+	visible := key.SeqNum() < g.earliestSnapshot
+	if g.retained {
+		return visible && g.elidable(key.UserKey)
+	}
+	switch key.Kind() {
+	case InternalKeyKindSet, InternalKeyKindSetWithDelete, InternalKeyKindMerge:
+		g.retained = firstOfUserKey && visible
+	}
+	return false
+}
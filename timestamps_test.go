@@ -0,0 +1,120 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func testkeysTimestampOptions(threshold *atomic.Uint64) *TimestampOptions {
+	return &TimestampOptions{
+		EncodeTimestamp: func(dst []byte, ts uint64) []byte {
+			return append(dst, testkeys.Suffix(int64(ts))...)
+		},
+		DecodeTimestamp: func(suffix []byte) (uint64, bool) {
+			if len(suffix) == 0 {
+				return 0, false
+			}
+			ts, err := testkeys.ParseSuffix(suffix)
+			return uint64(ts), err == nil
+		},
+		FullHistoryThreshold: threshold.Load,
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	var threshold atomic.Uint64
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		Comparer:                    testkeys.Comparer,
+		DisableAutomaticCompactions: true,
+		Timestamps:                  testkeysTimestampOptions(&threshold),
+	}).WithFSDefaults()
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	b := d.NewBatch()
+	for ts := uint64(1); ts <= 5; ts++ {
+		require.NoError(t, b.SetWithTimestamp([]byte("a"), ts, []byte("v"), nil))
+	}
+	require.NoError(t, b.Set([]byte("b"), []byte("v"), nil))
+	require.NoError(t, b.SetWithTimestamp([]byte("c"), 3, []byte("v"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, d.Flush())
+	// A table that only contains versions at a later timestamp.
+	require.NoError(t, d.Apply(func() *Batch {
+		b := d.NewBatch()
+		require.NoError(t, b.SetWithTimestamp([]byte("d"), 100, []byte("v"), nil))
+		return b
+	}(), nil))
+	require.NoError(t, d.Flush())
+
+	// scan returns the first visible version of each prefix, and all versions
+	// if all is set.
+	scan := func(o *IterOptions, all bool) string {
+		it, err := d.NewIter(o)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, it.Close()) }()
+		var keys []string
+		for valid := it.First(); valid; {
+			keys = append(keys, string(it.Key()))
+			if all {
+				valid = it.Next()
+			} else {
+				valid = it.NextPrefix()
+			}
+		}
+		return strings.Join(keys, " ")
+	}
+	require.Equal(t, "a@3 b c@3", scan(&IterOptions{ReadTimestamp: 3}, false))
+	require.Equal(t, "a@2 b", scan(&IterOptions{ReadTimestamp: 2}, false))
+	require.Equal(t, "a@5 b c@3 d@100", scan(&IterOptions{ReadTimestamp: 100}, false))
+	require.Equal(t, "a@5 b c@3 d@100", scan(nil, false))
+
+	// SetOptions and Clone preserve the read timestamp.
+	it, err := d.NewIter(&IterOptions{ReadTimestamp: 3})
+	require.NoError(t, err)
+	it.SetOptions(&IterOptions{ReadTimestamp: 1})
+	require.True(t, it.First())
+	require.Equal(t, "a@1", string(it.Key()))
+	clone, err := it.Clone(CloneOptions{})
+	require.NoError(t, err)
+	require.True(t, clone.First())
+	require.Equal(t, "a@1", string(clone.Key()))
+	require.NoError(t, clone.Close())
+	require.NoError(t, it.Close())
+
+	// The table containing only later versions is filtered out.
+	tables, err := d.SSTables(WithProperties())
+	require.NoError(t, err)
+	filter := (&IterOptions{ReadTimestamp: 3}).withReadTimestamp(opts.Timestamps, opts.Comparer.Split).PointKeyFilters[0]
+	var intersects []bool
+	for _, table := range tables[0] {
+		prop, ok := table.Properties.UserProperties[timestampIntervalCollectorName]
+		require.True(t, ok)
+		ok, err := filter.Intersects([]byte(prop)[1:])
+		require.NoError(t, err)
+		intersects = append(intersects, ok)
+	}
+	// NB: L0 tables are ordered from oldest to newest.
+	require.Equal(t, []bool{true, false}, intersects)
+
+	// Compactions garbage collect the versions shadowed at the full-history
+	// threshold.
+	require.Equal(t, "a@5 a@4 a@3 a@2 a@1 b c@3 d@100", scan(nil, true))
+	threshold.Store(3)
+	require.NoError(t, d.Compact([]byte("a"), []byte("e"), false /* parallelize */))
+	require.Equal(t, "a@5 a@4 a@3 b c@3 d@100", scan(nil, true))
+
+	// Without Options.Timestamps, versioned writes are rejected.
+	require.Error(t, (&Batch{}).SetWithTimestamp([]byte("a"), 1, nil, nil))
+}
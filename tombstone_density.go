@@ -0,0 +1,243 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/binary"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// Runs of point tombstones, such as those left behind by queue-like
+// workloads, force iterators to step over many dead keys. To find such runs,
+// sstables are written with a block property collector that records the
+// number of point tombstones within each data block. At the table level, the
+// collector records how many of the table's data blocks are tombstone-dense.
+// The table stats collector loads these counts into each file's TableStats,
+// and the compaction picker schedules compactions of tables whose fraction
+// of tombstone-dense blocks exceeds
+// Options.Experimental.TombstoneDenseCompactionThreshold.
+
+// tombstoneDensityCollectorName is the name of the block property collector
+// that records the number of point tombstones within each data block.
+const tombstoneDensityCollectorName = "pebble.tombstone-density"
+
+// tombstoneDenseBlockRatio is the fraction of a data block's entries that must
+// be point tombstones (DEL, SINGLEDEL and DELSIZED keys) for the block to be
+// considered tombstone-dense.
+const tombstoneDenseBlockRatio = 0.5
+
+// tombstoneDensityCollector implements sstable.BlockPropertyCollector. Each
+// data block and index block's property is the uvarint-encoded count of point
+// tombstones within the block. The table's property is the uvarint-encoded
+// count of tombstone-dense data blocks, followed by the uvarint-encoded count
+// of data blocks.
+type tombstoneDensityCollector struct {
+	blockEntries    uint64
+	blockTombstones uint64
+	// prevBlockTombstones is the count of tombstones in the most recently
+	// finished data block, to be added to the current index block.
+	prevBlockTombstones uint64
+	indexTombstones     uint64
+	dataBlocks          uint64
+	denseBlocks         uint64
+}
+
+var _ sstable.BlockPropertyCollector = (*tombstoneDensityCollector)(nil)
+var _ sstable.SuffixReplaceableBlockCollector = (*tombstoneDensityCollector)(nil)
+
+func newTombstoneDensityCollector() BlockPropertyCollector {
+	return &tombstoneDensityCollector{}
+}
+
+// Name implements sstable.BlockPropertyCollector.
+func (c *tombstoneDensityCollector) Name() string {
+	return tombstoneDensityCollectorName
+}
+
+// Add implements sstable.BlockPropertyCollector.
+func (c *tombstoneDensityCollector) Add(key InternalKey, value []byte) error {
+	c.blockEntries++
+	switch key.Kind() {
+	case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
+		c.blockTombstones++
+	}
+	return nil
+}
+
+// FinishDataBlock implements sstable.BlockPropertyCollector.
+func (c *tombstoneDensityCollector) FinishDataBlock(buf []byte) ([]byte, error) {
+	c.dataBlocks++
+	if c.blockTombstones > 0 &&
+		float64(c.blockTombstones) >= tombstoneDenseBlockRatio*float64(c.blockEntries) {
+		c.denseBlocks++
+	}
+	c.prevBlockTombstones = c.blockTombstones
+	c.blockEntries, c.blockTombstones = 0, 0
+	return binary.AppendUvarint(buf, c.prevBlockTombstones), nil
+}
+
+// AddPrevDataBlockToIndexBlock implements sstable.BlockPropertyCollector.
+func (c *tombstoneDensityCollector) AddPrevDataBlockToIndexBlock() {
+	c.indexTombstones += c.prevBlockTombstones
+	c.prevBlockTombstones = 0
+}
+
+// FinishIndexBlock implements sstable.BlockPropertyCollector.
+func (c *tombstoneDensityCollector) FinishIndexBlock(buf []byte) ([]byte, error) {
+	indexTombstones := c.indexTombstones
+	c.indexTombstones = 0
+	return binary.AppendUvarint(buf, indexTombstones), nil
+}
+
+// FinishTable implements sstable.BlockPropertyCollector.
+func (c *tombstoneDensityCollector) FinishTable(buf []byte) ([]byte, error) {
+	buf = binary.AppendUvarint(buf, c.denseBlocks)
+	return binary.AppendUvarint(buf, c.dataBlocks), nil
+}
+
+// UpdateKeySuffixes implements sstable.SuffixReplaceableBlockCollector.
+// Suffix replacement is only permitted for tables consisting of SETs, so the
+// block has no tombstones and there is nothing to count: FinishDataBlock,
+// which is called next, records the block without any tombstones.
+func (c *tombstoneDensityCollector) UpdateKeySuffixes(
+	oldProp []byte, oldSuffix, newSuffix []byte,
+) error {
+	if _, n := binary.Uvarint(oldProp); n <= 0 {
+		return errors.Errorf("pebble: invalid tombstone density property %x", oldProp)
+	}
+	return nil
+}
+
+// decodeTombstoneDensity decodes the counts of tombstone-dense data blocks and
+// data blocks from the table-level property written by the
+// tombstoneDensityCollector. It returns zeroes if the table was written
+// without the collector.
+func decodeTombstoneDensity(userProps map[string]string) (denseBlocks, dataBlocks uint64) {
+	prop, ok := userProps[tombstoneDensityCollectorName]
+	// The first byte of the property is the collector's shortID.
+	if !ok || len(prop) < 1 {
+		return 0, 0
+	}
+	b := []byte(prop[1:])
+	denseBlocks, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0
+	}
+	dataBlocks, m := binary.Uvarint(b[n:])
+	if m <= 0 || denseBlocks > dataBlocks {
+		return 0, 0
+	}
+	return denseBlocks, dataBlocks
+}
+
+// setTombstoneDensityStats populates the tombstone density statistics of the
+// given table stats from the table's user properties. For virtual tables, the
+// count of tombstone-dense blocks is scaled by the virtual table's share of its
+// backing table.
+func setTombstoneDensityStats(
+	meta *fileMetadata, userProps map[string]string, stats *manifest.TableStats,
+) {
+	denseBlocks, dataBlocks := decodeTombstoneDensity(userProps)
+	if dataBlocks == 0 {
+		stats.TombstoneDenseBlocks = 0
+		stats.TombstoneDenseBlocksRatio = 0
+		return
+	}
+	stats.TombstoneDenseBlocksRatio = float64(denseBlocks) / float64(dataBlocks)
+	if meta.Virtual && meta.FileBacking.Size > 0 {
+		denseBlocks = (denseBlocks*meta.Size + meta.FileBacking.Size - 1) / meta.FileBacking.Size
+	}
+	stats.TombstoneDenseBlocks = denseBlocks
+}
+
+// tombstoneDenseAnnotator implements the manifest.Annotator interface,
+// annotating B-Tree nodes with the *fileMetadata of the file with the highest
+// TombstoneDenseBlocksRatio at or above the configured threshold within the
+// subtree. Files that are compacting are ignored.
+type tombstoneDenseAnnotator struct {
+	threshold float64
+}
+
+var _ manifest.Annotator = tombstoneDenseAnnotator{}
+
+func (a tombstoneDenseAnnotator) Zero(interface{}) interface{} {
+	return nil
+}
+
+func (a tombstoneDenseAnnotator) Accumulate(f *fileMetadata, dst interface{}) (interface{}, bool) {
+	if f.IsCompacting() {
+		return dst, true
+	}
+	if !f.StatsValid() {
+		return dst, false
+	}
+	if f.Stats.TombstoneDenseBlocksRatio < a.threshold {
+		return dst, true
+	}
+	return tombstoneDenseMergeHelper(f, dst), true
+}
+
+func (a tombstoneDenseAnnotator) Merge(v interface{}, accum interface{}) interface{} {
+	if v == nil {
+		return accum
+	}
+	return tombstoneDenseMergeHelper(v.(*fileMetadata), accum)
+}
+
+func tombstoneDenseMergeHelper(f *fileMetadata, dst interface{}) interface{} {
+	if dst == nil || dst.(*fileMetadata).Stats.TombstoneDenseBlocksRatio < f.Stats.TombstoneDenseBlocksRatio {
+		return f
+	}
+	return dst
+}
+
+// tombstoneDenseBlocksAnnotator implements manifest.Annotator, annotating
+// B-Tree nodes with the sum of the files' counts of tombstone-dense data
+// blocks. Its annotation type is a *uint64. The count may change once a
+// table's stats are loaded asynchronously, so its values are marked as
+// cacheable only if a file's stats have been loaded.
+type tombstoneDenseBlocksAnnotator struct{}
+
+var _ manifest.Annotator = tombstoneDenseBlocksAnnotator{}
+
+func (a tombstoneDenseBlocksAnnotator) Zero(dst interface{}) interface{} {
+	if dst == nil {
+		return new(uint64)
+	}
+	v := dst.(*uint64)
+	*v = 0
+	return v
+}
+
+func (a tombstoneDenseBlocksAnnotator) Accumulate(
+	f *fileMetadata, dst interface{},
+) (v interface{}, cacheOK bool) {
+	vptr := dst.(*uint64)
+	*vptr = *vptr + f.Stats.TombstoneDenseBlocks
+	return vptr, f.StatsValid()
+}
+
+func (a tombstoneDenseBlocksAnnotator) Merge(src interface{}, dst interface{}) interface{} {
+	srcV := src.(*uint64)
+	dstV := dst.(*uint64)
+	*dstV = *dstV + *srcV
+	return dstV
+}
+
+// countTombstoneDenseBlocks counts the number of tombstone-dense data blocks
+// across all files of the LSM. It only counts blocks in files for which table
+// stats have been loaded.
+func countTombstoneDenseBlocks(v *version) (count uint64) {
+	for l := 0; l < numLevels; l++ {
+		if v.Levels[l].Empty() {
+			continue
+		}
+		count += *v.Levels[l].Annotation(tombstoneDenseBlocksAnnotator{}).(*uint64)
+	}
+	return count
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTombstoneDensityCollector(t *testing.T) {
+	c := newTombstoneDensityCollector()
+	add := func(kind base.InternalKeyKind, n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, c.Add(base.MakeInternalKey([]byte("a"), 1, kind), nil))
+		}
+	}
+	finishBlock := func() uint64 {
+		buf, err := c.FinishDataBlock(nil)
+		require.NoError(t, err)
+		c.AddPrevDataBlockToIndexBlock()
+		return decodeUvarint(t, buf)
+	}
+
+	// A block with few tombstones is not dense.
+	add(InternalKeyKindSet, 9)
+	add(InternalKeyKindDelete, 1)
+	require.Equal(t, uint64(1), finishBlock())
+	// Blocks that are at least half tombstones are dense.
+	add(InternalKeyKindSet, 2)
+	add(InternalKeyKindSingleDelete, 1)
+	add(InternalKeyKindDeleteSized, 1)
+	require.Equal(t, uint64(2), finishBlock())
+	add(InternalKeyKindDelete, 5)
+	require.Equal(t, uint64(5), finishBlock())
+	buf, err := c.FinishIndexBlock(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), decodeUvarint(t, buf))
+
+	// A block without tombstones is not dense.
+	add(InternalKeyKindSet, 3)
+	require.Equal(t, uint64(0), finishBlock())
+	buf, err = c.FinishIndexBlock(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), decodeUvarint(t, buf))
+
+	// The table property is prefixed by the collector's shortID.
+	buf, err = c.FinishTable([]byte{0})
+	require.NoError(t, err)
+	dense, blocks := decodeTombstoneDensity(map[string]string{
+		tombstoneDensityCollectorName: string(buf),
+	})
+	require.Equal(t, uint64(2), dense)
+	require.Equal(t, uint64(4), blocks)
+
+	// A block whose suffixes are replaced is counted once, without
+	// tombstones.
+	c = newTombstoneDensityCollector()
+	sc := c.(sstable.SuffixReplaceableBlockCollector)
+	require.NoError(t, sc.UpdateKeySuffixes(binary.AppendUvarint(nil, 0), []byte("@1"), []byte("@2")))
+	require.Equal(t, uint64(0), finishBlock())
+	require.Error(t, sc.UpdateKeySuffixes(nil, []byte("@1"), []byte("@2")))
+	buf, err = c.FinishTable([]byte{0})
+	require.NoError(t, err)
+	dense, blocks = decodeTombstoneDensity(map[string]string{
+		tombstoneDensityCollectorName: string(buf),
+	})
+	require.Equal(t, uint64(0), dense)
+	require.Equal(t, uint64(1), blocks)
+
+	dense, blocks = decodeTombstoneDensity(nil)
+	require.Equal(t, uint64(0), dense)
+	require.Equal(t, uint64(0), blocks)
+}
+
+func decodeUvarint(t *testing.T, buf []byte) uint64 {
+	v, n := binary.Uvarint(buf)
+	require.Less(t, 0, n)
+	require.Equal(t, len(buf), n)
+	return v
+}
+
+func TestTombstoneDensityCompaction(t *testing.T) {
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+	}).WithFSDefaults()
+	opts.Levels = make([]LevelOptions, numLevels)
+	for i := range opts.Levels {
+		opts.Levels[i] = LevelOptions{BlockSize: 512, Compression: NoCompression}
+	}
+	opts.Experimental.TombstoneDenseCompactionThreshold = 0.5
+	opts.Experimental.MultiLevelCompactionHeuristic = NoMultiLevel{}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	maybeCompact := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.opts.DisableAutomaticCompactions = false
+		d.maybeScheduleCompaction()
+		for d.mu.compact.compactingCount > 0 {
+			d.mu.compact.cond.Wait()
+		}
+		d.opts.DisableAutomaticCompactions = true
+	}
+	waitTableStats := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.waitTableStats()
+	}
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%04d", i)) }
+
+	// Write keys into L6.
+	const numKeys = 1000
+	for i := 0; i < numKeys; i++ {
+		require.NoError(t, d.Set(key(i), []byte("value"), nil))
+	}
+	require.NoError(t, d.Compact(key(0), key(numKeys), false /* parallelize */))
+	waitTableStats()
+	m := d.Metrics()
+	require.Equal(t, int64(1), m.Levels[6].NumFiles)
+	require.Equal(t, uint64(0), m.Keys.TombstoneDenseBlocksCount)
+
+	// Delete most of the keys, placing the tombstones in L1.
+	d.mu.Lock()
+	d.mu.versions.dynamicBaseLevel = false
+	d.mu.versions.picker.forceBaseLevel1()
+	d.mu.Unlock()
+	for i := 0; i < 900; i++ {
+		require.NoError(t, d.Delete(key(i), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.manualCompact(key(0), key(numKeys), 0, false /* parallelize */))
+	waitTableStats()
+	m = d.Metrics()
+	require.Equal(t, int64(1), m.Levels[1].NumFiles)
+	require.Less(t, uint64(1), m.Keys.TombstoneDenseBlocksCount)
+
+	// The level scores don't warrant a compaction, but the density of
+	// tombstones does. The tombstones are compacted down, until they reach L6
+	// and are elided along with the keys they delete.
+	for i := 0; i < numLevels; i++ {
+		maybeCompact()
+		waitTableStats()
+	}
+	m = d.Metrics()
+	require.Equal(t, int64(5), m.Compact.TombstoneDensityCount)
+	for l := 0; l < numLevels-1; l++ {
+		require.Equal(t, int64(0), m.Levels[l].NumFiles)
+	}
+	require.Equal(t, uint64(0), m.Keys.TombstoneDenseBlocksCount)
+	require.Equal(t, uint64(0), m.Keys.TombstoneCount)
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var n int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		n++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, numKeys-900, n)
+}
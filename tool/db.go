@@ -27,17 +27,27 @@ import (
 // dbT implements db-level tools, including both configuration state and the
 // commands themselves.
 type dbT struct {
-	Root       *cobra.Command
-	Check      *cobra.Command
-	Checkpoint *cobra.Command
-	Get        *cobra.Command
-	Logs       *cobra.Command
-	LSM        *cobra.Command
-	Properties *cobra.Command
-	Scan       *cobra.Command
-	Set        *cobra.Command
-	Space      *cobra.Command
-	IOBench    *cobra.Command
+	Root         *cobra.Command
+	Check        *cobra.Command
+	Checkpoint   *cobra.Command
+	Compact      *cobra.Command
+	Diff         *cobra.Command
+	Distribution *cobra.Command
+	Export       *cobra.Command
+	Excise       *cobra.Command
+	Fingerprint  *cobra.Command
+	Flush        *cobra.Command
+	Get          *cobra.Command
+	Import       *cobra.Command
+	Logs         *cobra.Command
+	LSM          *cobra.Command
+	Properties   *cobra.Command
+	Repair       *cobra.Command
+	Scan         *cobra.Command
+	Set          *cobra.Command
+	Shell        *cobra.Command
+	Space        *cobra.Command
+	IOBench      *cobra.Command
 
 	// Configuration.
 	opts            *pebble.Options
@@ -54,11 +64,26 @@ type dbT struct {
 	start         key
 	end           key
 	count         int64
+	hashRanges    int64
+	fillCache     bool
 	allLevels     bool
 	ioCount       int
 	ioParallelism int
 	ioSizes       string
 	verbose       bool
+
+	exportFormat    string
+	exportFileSize  int64
+	exportFmtKey    keyFormatter
+	exportFmtValue  valueFormatter
+	importBatchSize int64
+
+	shellReadWrite bool
+
+	dryRun      bool
+	parallelize bool
+
+	distribution distributionFlags
 }
 
 func newDB(
@@ -77,6 +102,8 @@ func newDB(
 	}
 	d.fmtKey.mustSet("quoted")
 	d.fmtValue.mustSet("[%x]")
+	d.exportFmtKey.mustSet("%x")
+	d.exportFmtValue.mustSet("%x")
 
 	d.Root = &cobra.Command{
 		Use:   "db",
@@ -103,6 +130,78 @@ database not be in use by another process.
 		Args: cobra.ExactArgs(2),
 		Run:  d.runCheckpoint,
 	}
+	d.Compact = &cobra.Command{
+		Use:   "compact <dir>",
+		Short: "compact a range of keys",
+		Long: `
+Compact the range specified by --start and --end, which must be specified,
+down to the lowest level holding keys of the range. The sstables overlapping
+the range and an estimate of the bytes rewritten are printed first, and the
+compaction is skipped if --dry-run is specified. Requires that the specified
+database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runCompact,
+	}
+	d.Diff = &cobra.Command{
+		Use:   "diff <dir-a> <dir-b>",
+		Short: "print the differences between two DBs",
+		Long: `
+Print the point keys and range keys of the range specified by --start and
+--end that differ between the two databases. Keys only present in the first
+database are prefixed by "-", keys only present in the second one by "+", and
+keys whose values differ by "~". The keys deleted by range deletions are not
+present, and so are reported individually.
+
+If --hash-ranges is specified, the point keys are instead grouped in ranges
+of about that many keys, determined by the keys themselves, and only the
+ranges whose hashes differ are reported. Requires that the specified databases
+not be in use by another process.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  d.runDiff,
+	}
+	d.Excise = &cobra.Command{
+		Use:   "excise <dir>",
+		Short: "remove a range of keys",
+		Long: `
+Remove all the keys of the range specified by --start and --end, which must be
+specified, by excising the range from the sstables overlapping it. The sstables
+overlapping the range and an estimate of the bytes excised are printed first,
+and the excise is skipped if --dry-run is specified. Requires that the
+specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runExcise,
+	}
+	d.Export = &cobra.Command{
+		Use:   "export <dir> <dest-dir>",
+		Short: "export a key range to sstables or text files",
+		Long: `
+Export the point keys and range keys of the range specified by --start and
+--end, read at a consistent snapshot, into files in the destination directory.
+The files are either sstables that can be ingested, or JSON or CSV lines of
+keys and values formatted by --key and --value. Range keys are CSV lines
+starting with "rangekeyset", and JSON lines with a "kind" field. Range
+deletions aren't exported: the export holds the keys visible at the snapshot.
+A new file is started once a file reaches --file-size. Requires that the
+specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  d.runExport,
+	}
+	d.Flush = &cobra.Command{
+		Use:   "flush <dir>",
+		Short: "flush the memtables",
+		Long: `
+Flush the memtables replayed from the WALs of the database to sstables. The
+unflushed WALs are printed first, and the flush is skipped if --dry-run is
+specified. Requires that the specified database not be in use by another
+process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runFlush,
+	}
 	d.Get = &cobra.Command{
 		Use:   "get <dir> <key>",
 		Short: "get value for a key",
@@ -114,6 +213,22 @@ process.
 		Args: cobra.ExactArgs(2),
 		Run:  d.runGet,
 	}
+	d.Import = &cobra.Command{
+		Use:   "import <dir> <file-or-dir>...",
+		Short: "import exported sstables or text files",
+		Long: `
+Import the files written by "db export", or the files of the specified
+directories. Copies of the sstables are ingested, and the records of JSON and
+CSV files are written in batches of --batch-size bytes, decoding the keys and
+values as formatted by --key and --value. The progress of the import is
+recorded in the <dir>.import-progress file next to the database directory, so
+that an interrupted import resumes where it stopped when run again with the
+same files. Requires that the specified database not be in use by another
+process.
+`,
+		Args: cobra.MinimumNArgs(2),
+		Run:  d.runImport,
+	}
 	d.Logs = logs.NewCmd()
 	d.LSM = &cobra.Command{
 		Use:   "lsm <dir>",
@@ -134,6 +249,20 @@ Print SSTable properties, aggregated per level of the LSM.
 		Args: cobra.ExactArgs(1),
 		Run:  d.runProperties,
 	}
+	d.Repair = &cobra.Command{
+		Use:   "repair <dir>",
+		Short: "rebuild a lost or corrupted MANIFEST",
+		Long: `
+Rebuild the MANIFEST of a DB from the sstables and WALs in its directory, when
+the MANIFEST is lost or corrupted. Tables that don't overlap any other table are
+placed in L6, and the others in L0. WALs are replayed into new tables, except
+those already flushed. Existing MANIFESTs and the files that can't be read are
+moved to the quarantine subdirectory. Requires that the specified database not
+be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runRepair,
+	}
 	d.Scan = &cobra.Command{
 		Use:   "scan <dir>",
 		Short: "print db records",
@@ -154,6 +283,19 @@ not be in use by another process.
 		Args: cobra.ExactArgs(3),
 		Run:  d.runSet,
 	}
+	d.Shell = &cobra.Command{
+		Use:   "shell <dir>",
+		Short: "run an interactive shell",
+		Long: `
+Run an interactive shell reading commands from the standard input, such as get,
+scan, set and delete, against the DB which is only opened once. The DB is
+opened read-only unless --read-write is specified, and writes must be
+confirmed. Run "help" in the shell for the list of commands. Requires that the
+specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runShell,
+	}
 	d.Space = &cobra.Command{
 		Use:   "space <dir>",
 		Short: "print filesystem space used",
@@ -165,6 +307,35 @@ use by another process.
 		Args: cobra.ExactArgs(1),
 		Run:  d.runSpace,
 	}
+	d.Distribution = &cobra.Command{
+		Use:   "distribution <dir>",
+		Short: "print the distribution of keys by prefix",
+		Long: `
+Print the estimated size, number of keys and number of sampled reads of the
+point keys of the sstables grouped by prefix, within the range specified by
+--start and --end. The keys are grouped by the prefix returned by the comparer's
+Split function, or by their first bytes with --prefix-len. The data blocks are
+attributed to prefixes using the index blocks of the sstables, only reading
+the data blocks that straddle prefixes. Reads are only sampled by a running
+process, such as the db shell, so they are zero when the DB was just opened.
+Requires that the specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runDistribution,
+	}
+	d.Fingerprint = &cobra.Command{
+		Use:   "fingerprint <dir>",
+		Short: "print the fingerprint of a range of keys",
+		Long: `
+Print the fingerprint of the point keys and range keys of the range specified
+by --start and --end. The fingerprint only depends on the visible keys and
+their values, so that databases holding the same data have the same
+fingerprint regardless of their history. Requires that the specified database
+not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runFingerprint,
+	}
 	d.IOBench = &cobra.Command{
 		Use:   "io-bench <dir>",
 		Short: "perform sstable IO benchmark",
@@ -176,26 +347,28 @@ specified database.
 		Run:  d.runIOBench,
 	}
 
-	d.Root.AddCommand(d.Check, d.Checkpoint, d.Get, d.Logs, d.LSM, d.Properties, d.Scan, d.Set, d.Space, d.IOBench)
+	d.Root.AddCommand(d.Check, d.Checkpoint, d.Compact, d.Diff, d.Distribution, d.Excise, d.Export, d.Fingerprint, d.Flush, d.Get, d.Import, d.Logs, d.LSM, d.Properties, d.Repair, d.Scan, d.Set, d.Shell, d.Space, d.IOBench)
 	d.Root.PersistentFlags().BoolVarP(&d.verbose, "verbose", "v", false, "verbose output")
 
-	for _, cmd := range []*cobra.Command{d.Check, d.Checkpoint, d.Get, d.LSM, d.Properties, d.Scan, d.Set, d.Space} {
+	for _, cmd := range []*cobra.Command{d.Check, d.Checkpoint, d.Compact, d.Diff, d.Distribution, d.Excise, d.Export, d.Fingerprint, d.Flush, d.Get, d.Import, d.LSM, d.Properties, d.Repair, d.Scan, d.Set, d.Shell, d.Space} {
 		cmd.Flags().StringVar(
 			&d.comparerName, "comparer", "", "comparer name (use default if empty)")
 		cmd.Flags().StringVar(
 			&d.mergerName, "merger", "", "merger name (use default if empty)")
 	}
 
-	for _, cmd := range []*cobra.Command{d.Scan, d.Space} {
+	for _, cmd := range []*cobra.Command{d.Compact, d.Diff, d.Distribution, d.Excise, d.Export, d.Fingerprint, d.Scan, d.Space} {
 		cmd.Flags().Var(
 			&d.start, "start", "start key for the range")
 		cmd.Flags().Var(
 			&d.end, "end", "end key for the range")
 	}
 
-	d.Scan.Flags().Var(
-		&d.fmtKey, "key", "key formatter")
-	for _, cmd := range []*cobra.Command{d.Scan, d.Get} {
+	for _, cmd := range []*cobra.Command{d.Compact, d.Diff, d.Distribution, d.Excise, d.Flush, d.Scan, d.Shell} {
+		cmd.Flags().Var(
+			&d.fmtKey, "key", "key formatter")
+	}
+	for _, cmd := range []*cobra.Command{d.Diff, d.Scan, d.Get, d.Shell} {
 		cmd.Flags().Var(
 			&d.fmtValue, "value", "value formatter")
 	}
@@ -203,6 +376,37 @@ specified database.
 	d.Scan.Flags().Int64Var(
 		&d.count, "count", 0, "key count for scan (0 is unlimited)")
 
+	d.Diff.Flags().Int64Var(
+		&d.hashRanges, "hash-ranges", 0, "compare the hashes of ranges of about this many keys (0 compares keys)")
+
+	d.Fingerprint.Flags().BoolVar(
+		&d.fillCache, "fill-cache", false, "add the blocks read to the block cache")
+
+	for _, cmd := range []*cobra.Command{d.Compact, d.Excise, d.Flush} {
+		cmd.Flags().BoolVar(
+			&d.dryRun, "dry-run", false, "only print the affected sstables or WALs")
+	}
+	d.Compact.Flags().BoolVar(
+		&d.parallelize, "parallelize", false, "compact non-overlapping ranges in parallel")
+
+	d.distribution.register(d.Distribution)
+
+	d.Shell.Flags().BoolVar(
+		&d.shellReadWrite, "read-write", false, "open the DB for writing")
+
+	d.Export.Flags().StringVar(
+		&d.exportFormat, "format", exportFormatSST, "export format (sst, jsonl or csv)")
+	d.Export.Flags().Int64Var(
+		&d.exportFileSize, "file-size", 64<<20, "target size of the exported files in bytes")
+	for _, cmd := range []*cobra.Command{d.Export, d.Import} {
+		cmd.Flags().Var(
+			&d.exportFmtKey, "key", "key formatter of text files")
+		cmd.Flags().Var(
+			&d.exportFmtValue, "value", "value formatter of text files")
+	}
+	d.Import.Flags().Int64Var(
+		&d.importBatchSize, "batch-size", 4<<20, "size of the batches importing text files in bytes")
+
 	d.IOBench.Flags().BoolVar(
 		&d.allLevels, "all-levels", false, "if set, benchmark all levels (default is only L5/L6)")
 	d.IOBench.Flags().IntVar(
@@ -303,22 +507,31 @@ func (d *dbT) openDB(dir string, openOptions ...OpenOption) (*pebble.DB, error)
 	return db, nil
 }
 
-func (d *dbT) openDBInternal(dir string, openOptions ...OpenOption) (*pebble.DB, error) {
+// configureOptions sets the comparer and merger of the DB in dir, as
+// specified by its OPTIONS file or the --comparer and --merger flags.
+func (d *dbT) configureOptions(dir string) error {
 	if err := d.loadOptions(dir); err != nil {
-		return nil, errors.Wrap(err, "error loading options")
+		return errors.Wrap(err, "error loading options")
 	}
 	if d.comparerName != "" {
 		d.opts.Comparer = d.comparers[d.comparerName]
 		if d.opts.Comparer == nil {
-			return nil, errors.Errorf("unknown comparer %q", errors.Safe(d.comparerName))
+			return errors.Errorf("unknown comparer %q", errors.Safe(d.comparerName))
 		}
 	}
 	if d.mergerName != "" {
 		d.opts.Merger = d.mergers[d.mergerName]
 		if d.opts.Merger == nil {
-			return nil, errors.Errorf("unknown merger %q", errors.Safe(d.mergerName))
+			return errors.Errorf("unknown merger %q", errors.Safe(d.mergerName))
 		}
 	}
+	return nil
+}
+
+func (d *dbT) openDBInternal(dir string, openOptions ...OpenOption) (*pebble.DB, error) {
+	if err := d.configureOptions(dir); err != nil {
+		return nil, err
+	}
 	opts := *d.opts
 	for _, opt := range openOptions {
 		opt.Apply(dir, &opts)
@@ -491,6 +704,27 @@ func (d *dbT) runSpace(cmd *cobra.Command, args []string) {
 	fmt.Fprintf(stdout, "%d\n", bytes)
 }
 
+func (d *dbT) runFingerprint(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	db, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stdout, db)
+
+	fp, err := db.Fingerprint(d.start, d.end, &pebble.FingerprintOptions{FillCache: d.fillCache})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "%016x\n", fp.Hash)
+	fmt.Fprintf(stdout, "%d point %s, %d range %s, %d %s reused\n",
+		fp.PointKeys, makePlural("key", int64(fp.PointKeys)),
+		fp.RangeKeys, makePlural("key", int64(fp.RangeKeys)),
+		fp.TablesReused, makePlural("table", int64(fp.TablesReused)))
+}
+
 func (d *dbT) runProperties(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
 	dirname := args[0]
@@ -0,0 +1,231 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/wal"
+	"github.com/spf13/cobra"
+)
+
+// checkSpan returns an error unless both --start and --end were specified.
+func (d *dbT) checkSpan() error {
+	if d.start == nil || d.end == nil {
+		return errors.New("--start and --end must be specified")
+	}
+	return nil
+}
+
+// openMaintenanceDB opens the DB for writing, unless --dry-run is specified.
+func (d *dbT) openMaintenanceDB(dir string) (*pebble.DB, error) {
+	if d.dryRun {
+		return d.openDB(dir)
+	}
+	return d.openDB(dir, nonReadOnly{})
+}
+
+// printTables prints the sstables overlapping [start, end), and returns their
+// total size. A nil start and end print all the sstables.
+func (d *dbT) printTables(w io.Writer, db *pebble.DB, start, end []byte) error {
+	levels, err := db.SSTables(pebble.WithKeyRangeFilter(start, end))
+	if err != nil {
+		return err
+	}
+	var count int64
+	var size uint64
+	for level, tables := range levels {
+		for _, t := range tables {
+			fmt.Fprintf(w, "  L%d %s ", level, t.FileNum)
+			formatKeyRange(w, d.fmtKey, &t.Smallest, &t.Largest)
+			fmt.Fprintf(w, " %d bytes\n", t.Size)
+			count++
+			size += t.Size
+		}
+	}
+	fmt.Fprintf(w, "  %d %s, %d bytes\n", count, makePlural("sstable", count), size)
+	return nil
+}
+
+// printSpanPlan prints the sstables overlapping the span specified by --start
+// and --end, and the estimated number of bytes of the span.
+func (d *dbT) printSpanPlan(w io.Writer, db *pebble.DB, estimate string) error {
+	fmt.Fprintf(w, "sstables overlapping [%s, %s):\n", d.fmtKey.fn(d.start), d.fmtKey.fn(d.end))
+	if err := d.printTables(w, db, d.start, d.end); err != nil {
+		return err
+	}
+	bytes, err := db.EstimateDiskUsage(d.start, d.end)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "estimated bytes %s: %d\n", estimate, bytes)
+	return nil
+}
+
+func (d *dbT) runCompact(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	if err := d.checkSpan(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	db, err := d.openMaintenanceDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+	d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+
+	err = func() error {
+		if err := d.printSpanPlan(stdout, db, "rewritten"); err != nil || d.dryRun {
+			return err
+		}
+		if err := db.Compact(d.start, d.end, d.parallelize); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "compacted; sstables overlapping the span:\n")
+		return d.printTables(stdout, db, d.start, d.end)
+	}()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+func (d *dbT) runExcise(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	if err := d.checkSpan(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	db, err := d.openMaintenanceDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+	d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+
+	err = func() error {
+		if v := db.FormatMajorVersion(); v < pebble.FormatMinForSharedObjects {
+			return errors.Errorf("store has format major version %d; excise requires at least %d",
+				v, pebble.FormatMinForSharedObjects)
+		}
+		if err := d.printSpanPlan(stdout, db, "excised"); err != nil || d.dryRun {
+			return err
+		}
+		span := pebble.KeyRange{Start: d.start, End: d.end}
+		if _, err := db.IngestAndExcise(nil /* paths */, nil /* shared */, nil /* external */, span); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "excised; sstables overlapping the span:\n")
+		return d.printTables(stdout, db, d.start, d.end)
+	}()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+func (d *dbT) runFlush(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	dir := args[0]
+	err := func() error {
+		// The memtables to flush are those replayed from the unflushed WALs
+		// when the DB is opened.
+		logs, err := d.unflushedWALs(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "unflushed WALs:\n")
+		var size uint64
+		for _, ll := range logs {
+			n, err := ll.PhysicalSize()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "  %s %d bytes\n", ll.Num, n)
+			size += n
+		}
+		fmt.Fprintf(stdout, "  %d %s, %d bytes\n", len(logs), makePlural("WAL", int64(len(logs))), size)
+		if d.dryRun {
+			return nil
+		}
+
+		// Opening the DB for writing flushes the memtables replayed from the
+		// WALs, and flushing afterwards is a no-op unless the replay stopped
+		// short of doing so.
+		db, err := d.openDB(dir, nonReadOnly{})
+		if err != nil {
+			return err
+		}
+		defer d.closeDB(stderr, db)
+		d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+		if err := db.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "flushed; sstables:\n")
+		return d.printTables(stdout, db, nil, nil)
+	}()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+// unflushedWALs returns the WALs of the DB whose contents haven't been flushed,
+// according to its current MANIFEST.
+func (d *dbT) unflushedWALs(dir string) (wal.Logs, error) {
+	if err := d.configureOptions(dir); err != nil {
+		return nil, err
+	}
+	desc, err := pebble.Peek(dir, d.opts.FS)
+	if err != nil {
+		return nil, err
+	}
+	if !desc.Exists {
+		return nil, errors.Errorf("pebble: database %q does not exist", dir)
+	}
+	f, err := d.opts.FS.Open(desc.ManifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var minUnflushedLogNum wal.NumWAL
+	rr := record.NewReader(f, 0 /* logNum */)
+	for {
+		r, err := rr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		var ve manifest.VersionEdit
+		if err := ve.Decode(r); err != nil {
+			return nil, err
+		}
+		if ve.MinUnflushedLogNum != 0 {
+			minUnflushedLogNum = wal.NumWAL(ve.MinUnflushedLogNum)
+		}
+	}
+
+	walDir := dir
+	if d.opts.WALDir != "" {
+		walDir = d.opts.WALDir
+	}
+	logs, err := wal.Scan(wal.Dir{FS: d.opts.FS, Dirname: walDir})
+	if err != nil {
+		return nil, err
+	}
+	var unflushed wal.Logs
+	for _, ll := range logs {
+		if ll.Num >= minUnflushedLogNum {
+			unflushed = append(unflushed, ll)
+		}
+	}
+	return unflushed, nil
+}
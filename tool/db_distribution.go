@@ -0,0 +1,124 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/spf13/cobra"
+)
+
+// distributionFlags are the flags of the db distribution command, and of the
+// distribution command of the db shell.
+type distributionFlags struct {
+	prefixLen int
+	sort      string
+	top       int
+	json      bool
+}
+
+// distributionSorts are the orders accepted by --sort, the prefixes being
+// sorted by decreasing size, number of keys or read samples, or in key order.
+var distributionSorts = map[string]func(a, b pebble.KeyPrefixStats) int{
+	"prefix": nil,
+	"size":   func(a, b pebble.KeyPrefixStats) int { return cmp.Compare(b.Size, a.Size) },
+	"keys":   func(a, b pebble.KeyPrefixStats) int { return cmp.Compare(b.Keys, a.Keys) },
+	"reads":  func(a, b pebble.KeyPrefixStats) int { return cmp.Compare(b.ReadSamples, a.ReadSamples) },
+}
+
+func (f *distributionFlags) register(cmd *cobra.Command) {
+	cmd.Flags().IntVar(
+		&f.prefixLen, "prefix-len", 0, "group keys by their first bytes (0 groups them by Comparer.Split)")
+	cmd.Flags().StringVar(
+		&f.sort, "sort", "prefix", fmt.Sprintf("sort order (%s)", flagNames(distributionSorts)))
+	cmd.Flags().IntVar(
+		&f.top, "top", 0, "only print the first prefixes in sort order (0 prints all)")
+	cmd.Flags().BoolVar(
+		&f.json, "json", false, "print JSON")
+}
+
+// distributionRecord is a prefix printed by --json.
+type distributionRecord struct {
+	Prefix      string  `json:"prefix"`
+	Size        uint64  `json:"size"`
+	Keys        uint64  `json:"keys"`
+	Tables      int     `json:"tables"`
+	ReadSamples float64 `json:"read_samples"`
+}
+
+// printDistribution prints the distribution by prefix of the keys of the DB
+// within [start, end).
+func printDistribution(
+	w io.Writer, db *pebble.DB, start, end []byte, fmtKey keyFormatter, f distributionFlags,
+) error {
+	compare, ok := distributionSorts[f.sort]
+	if !ok {
+		return errors.Errorf("unknown sort order %q (expected one of %s)", f.sort, flagNames(distributionSorts))
+	}
+	distribution, err := db.KeyDistribution(start, end, &pebble.KeyDistributionOptions{PrefixLen: f.prefixLen})
+	if err != nil {
+		return err
+	}
+	total := pebble.KeyPrefixStats{}
+	for _, s := range distribution {
+		total.Size += s.Size
+		total.Keys += s.Keys
+		total.ReadSamples += s.ReadSamples
+	}
+	if compare != nil {
+		slices.SortStableFunc(distribution, compare)
+	}
+	if f.top > 0 && f.top < len(distribution) {
+		distribution = distribution[:f.top]
+	}
+
+	if f.json {
+		records := make([]distributionRecord, len(distribution))
+		for i, s := range distribution {
+			records[i] = distributionRecord{
+				Prefix:      fmt.Sprint(fmtKey.fn(s.Prefix)),
+				Size:        s.Size,
+				Keys:        s.Keys,
+				Tables:      s.Tables,
+				ReadSamples: s.ReadSamples,
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+	tw := tabwriter.NewWriter(w, 2, 1, 2, ' ', 0)
+	fmt.Fprintf(tw, "prefix\tsize\tkeys\ttables\treads\n")
+	for _, s := range distribution {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.0f\n", fmtKey.fn(s.Prefix),
+			humanize.Bytes.Uint64(s.Size), s.Keys, s.Tables, s.ReadSamples)
+	}
+	fmt.Fprintf(tw, "total\t%s\t%d\t\t%.0f\n",
+		humanize.Bytes.Uint64(total.Size), total.Keys, total.ReadSamples)
+	return tw.Flush()
+}
+
+func (d *dbT) runDistribution(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	db, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+	d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+
+	if err := printDistribution(stdout, db, d.start, d.end, d.fmtKey, d.distribution); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
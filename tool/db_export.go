@@ -0,0 +1,561 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+)
+
+// The formats of exported files, which are also their file extensions.
+const (
+	exportFormatSST  = "sst"
+	exportFormatJSON = "jsonl"
+	exportFormatCSV  = "csv"
+)
+
+// importProgressSuffix is appended to the path of the DB to name the file,
+// next to the DB directory, recording the progress of an import so that it may
+// be resumed.
+const importProgressSuffix = ".import-progress"
+
+// exportKindRangeKeySet is the kind of the range key records of text files.
+// The kind of point key records is omitted.
+const exportKindRangeKeySet = "rangekeyset"
+
+// exportKey is an exported key: a point key-value pair, or a range key
+// [key, end) with the given suffix and value.
+type exportKey struct {
+	kind   base.InternalKeyKind
+	key    []byte
+	end    []byte
+	suffix []byte
+	value  []byte
+}
+
+// exportRecord is a record of a JSON export. The kind of point keys is
+// omitted.
+type exportRecord struct {
+	Kind   string `json:"kind,omitempty"`
+	Key    string `json:"key"`
+	End    string `json:"end,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// exportWriter writes the keys of an exported file.
+type exportWriter interface {
+	add(k exportKey) error
+	// size returns the (estimated) size of the file.
+	size() uint64
+	close() error
+}
+
+type sstExportWriter struct {
+	w *sstable.Writer
+}
+
+func (w *sstExportWriter) add(k exportKey) error {
+	if k.kind == base.InternalKeyKindRangeKeySet {
+		return w.w.RangeKeySet(k.key, k.end, k.suffix, k.value)
+	}
+	return w.w.Set(k.key, k.value)
+}
+
+func (w *sstExportWriter) size() uint64 { return w.w.EstimatedSize() }
+func (w *sstExportWriter) close() error { return w.w.Close() }
+
+type textExportWriter struct {
+	f        vfs.File
+	bw       *bufio.Writer
+	csv      *csv.Writer
+	fmtKey   keyFormatter
+	fmtValue valueFormatter
+	written  uint64
+}
+
+func (w *textExportWriter) add(k exportKey) error {
+	rec := exportRecord{Key: fmt.Sprint(w.fmtKey.fn(k.key))}
+	rec.Value = fmt.Sprint(w.fmtValue.fn(k.key, k.value))
+	if k.kind == base.InternalKeyKindRangeKeySet {
+		rec.Kind = exportKindRangeKeySet
+		rec.End = fmt.Sprint(w.fmtKey.fn(k.end))
+		rec.Suffix = fmt.Sprint(w.fmtKey.fn(k.suffix))
+	}
+	if w.csv != nil {
+		// Point keys are written as (key, value) pairs, and range keys as
+		// records starting with their kind.
+		fields := []string{rec.Key, rec.Value}
+		if rec.Kind == exportKindRangeKeySet {
+			fields = []string{rec.Kind, rec.Key, rec.End, rec.Suffix, rec.Value}
+		}
+		for _, f := range fields {
+			w.written += uint64(len(f) + 1)
+		}
+		return w.csv.Write(fields)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	w.written += uint64(len(line) + 1)
+	w.bw.Write(line)
+	return w.bw.WriteByte('\n')
+}
+
+func (w *textExportWriter) size() uint64 { return w.written }
+
+func (w *textExportWriter) close() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return errors.CombineErrors(err, w.f.Close())
+		}
+	}
+	if err := w.bw.Flush(); err != nil {
+		return errors.CombineErrors(err, w.f.Close())
+	}
+	if err := w.f.Sync(); err != nil {
+		return errors.CombineErrors(err, w.f.Close())
+	}
+	return w.f.Close()
+}
+
+func (d *dbT) runExport(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	switch d.exportFormat {
+	case exportFormatSST, exportFormatJSON, exportFormatCSV:
+	default:
+		fmt.Fprintf(stderr, "unknown export format %q\n", d.exportFormat)
+		return
+	}
+	db, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+	// Pretty formatters are only meant to be read, and can't be imported.
+	if strings.HasPrefix(d.exportFmtKey.spec, "pretty") {
+		d.exportFmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+	if strings.HasPrefix(d.exportFmtValue.spec, "pretty") {
+		d.exportFmtValue.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+
+	fs, dest := d.opts.FS, args[1]
+	if err := fs.MkdirAll(dest, 0755); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+
+	// Read the key range at a consistent snapshot.
+	snap := db.NewSnapshot()
+	defer snap.Close()
+	iter, err := snap.NewIter(&pebble.IterOptions{
+		KeyTypes:   pebble.IterKeyTypePointsAndRanges,
+		LowerBound: d.start,
+		UpperBound: d.end,
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer iter.Close()
+
+	var w exportWriter
+	var filename string
+	var fileCount, count, total int64
+	finish := func() error {
+		if w == nil {
+			return nil
+		}
+		err := w.close()
+		w = nil
+		if err == nil {
+			fmt.Fprintf(stdout, "%s: %d %s\n", filename, count, makePlural("record", count))
+		}
+		return err
+	}
+	add := func(k exportKey) error {
+		if w == nil {
+			fileCount++
+			count = 0
+			filename = fmt.Sprintf("export-%06d.%s", fileCount, d.exportFormat)
+			var err error
+			if w, err = d.newExportWriter(db, fs.PathJoin(dest, filename)); err != nil {
+				return err
+			}
+		}
+		if err := w.add(k); err != nil {
+			return errors.CombineErrors(err, finish())
+		}
+		count++
+		total++
+		if w.size() >= uint64(d.exportFileSize) {
+			return finish()
+		}
+		return nil
+	}
+	for valid := iter.First(); valid; valid = iter.Next() {
+		var err error
+		if iter.RangeKeyChanged() {
+			if _, hasRange := iter.HasPointAndRange(); hasRange {
+				start, end := iter.RangeBounds()
+				for _, rk := range iter.RangeKeys() {
+					err = add(exportKey{
+						kind:   base.InternalKeyKindRangeKeySet,
+						key:    start,
+						end:    end,
+						suffix: rk.Suffix,
+						value:  rk.Value,
+					})
+					if err != nil {
+						break
+					}
+				}
+			}
+		}
+		if hasPoint, _ := iter.HasPointAndRange(); err == nil && hasPoint {
+			var value []byte
+			if value, err = iter.ValueAndErr(); err == nil {
+				err = add(exportKey{kind: base.InternalKeyKindSet, key: iter.Key(), value: value})
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+	}
+	if err := iter.Error(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", errors.CombineErrors(err, finish()))
+		return
+	}
+	if err := finish(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "exported %d %s to %d %s\n",
+		total, makePlural("record", total), fileCount, makePlural("file", fileCount))
+}
+
+func (d *dbT) newExportWriter(db *pebble.DB, path string) (exportWriter, error) {
+	f, err := d.opts.FS.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	switch d.exportFormat {
+	case exportFormatSST:
+		mergerName := base.DefaultMerger.Name
+		if d.opts.Merger != nil {
+			mergerName = d.opts.Merger.Name
+		}
+		// The table is written in the newest format supported by the DB, as
+		// required to ingest it in a DB at the same format major version.
+		return &sstExportWriter{w: sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+			Comparer:    d.opts.Comparer,
+			MergerName:  mergerName,
+			TableFormat: db.FormatMajorVersion().MaxTableFormat(),
+		})}, nil
+	default:
+		w := &textExportWriter{f: f, bw: bufio.NewWriter(f), fmtKey: d.exportFmtKey, fmtValue: d.exportFmtValue}
+		if d.exportFormat == exportFormatCSV {
+			w.csv = csv.NewWriter(w.bw)
+		}
+		return w, nil
+	}
+}
+
+// decodeFormatted inverts the formatting of a key or value by the given
+// formatter spec. Only specs formatting the bytes through a single %x, %X, %q
+// or %s verb, possibly surrounded by constant text, can be decoded.
+func decodeFormatted(spec, s string) ([]byte, error) {
+	i := strings.IndexByte(spec, '%')
+	if i < 0 || i+1 >= len(spec) {
+		return nil, errors.Errorf("formatter %q can't be decoded", errors.Safe(spec))
+	}
+	prefix, verb, suffix := spec[:i], spec[i+1], spec[i+2:]
+	if !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s, suffix) || len(s) < len(prefix)+len(suffix) {
+		return nil, errors.Errorf("%q doesn't match formatter %q", s, errors.Safe(spec))
+	}
+	s = s[len(prefix) : len(s)-len(suffix)]
+	switch verb {
+	case 'x', 'X':
+		return hex.DecodeString(s)
+	case 'q':
+		u, err := strconv.Unquote(s)
+		return []byte(u), err
+	case 's':
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("formatter %q can't be decoded", errors.Safe(spec))
+	}
+}
+
+// importProgress records the progress of an import: the number of records
+// imported from each file, or -1 once a file is completely imported.
+type importProgress map[string]int64
+
+func (d *dbT) loadImportProgress(path string) (importProgress, error) {
+	progress := make(importProgress)
+	f, err := d.opts.FS.Open(path)
+	if oserror.IsNotExist(err) {
+		return progress, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid import progress %q", line)
+		}
+		progress[line[:i]] = n
+	}
+	return progress, nil
+}
+
+func (d *dbT) saveImportProgress(path string, progress importProgress) error {
+	var buf strings.Builder
+	names := make([]string, 0, len(progress))
+	for name := range progress {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s %d\n", name, progress[name])
+	}
+	tmp := path + ".tmp"
+	f, err := d.opts.FS.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, buf.String()); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return d.opts.FS.Rename(tmp, path)
+}
+
+func (d *dbT) runImport(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	fs, dir := d.opts.FS, args[0]
+
+	// Expand the directories into the files they contain.
+	var paths []string
+	for _, arg := range args[1:] {
+		if stat, err := fs.Stat(arg); err == nil && stat.IsDir() {
+			ls, err := fs.List(arg)
+			if err != nil {
+				fmt.Fprintf(stderr, "%s\n", err)
+				return
+			}
+			sort.Strings(ls)
+			for _, name := range ls {
+				paths = append(paths, fs.PathJoin(arg, name))
+			}
+			continue
+		}
+		paths = append(paths, arg)
+	}
+
+	db, err := d.openDB(dir, nonReadOnly{})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+
+	progressPath := filepath.Clean(dir) + importProgressSuffix
+	progress, err := d.loadImportProgress(progressPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	for _, path := range paths {
+		done, ok := progress[path]
+		switch {
+		case ok && done < 0:
+			fmt.Fprintf(stdout, "%s: already imported\n", path)
+			continue
+		case strings.HasSuffix(path, "."+exportFormatSST):
+			// Ingest moves the tables it ingests into the DB: ingest a copy, next
+			// to the progress file, to leave the exported table in place.
+			tmp := progressPath + "." + exportFormatSST
+			err := vfs.Copy(fs, path, tmp)
+			if err == nil {
+				err = db.Ingest([]string{tmp})
+			}
+			if rmErr := fs.Remove(tmp); rmErr != nil && !oserror.IsNotExist(rmErr) {
+				err = errors.CombineErrors(err, rmErr)
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", path, err)
+				return
+			}
+			fmt.Fprintf(stdout, "%s: ingested\n", path)
+			progress[path] = -1
+		case strings.HasSuffix(path, "."+exportFormatJSON), strings.HasSuffix(path, "."+exportFormatCSV):
+			n, err := d.importText(db, path, done, func(n int64) error {
+				progress[path] = n
+				return d.saveImportProgress(progressPath, progress)
+			})
+			if err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", path, err)
+				return
+			}
+			fmt.Fprintf(stdout, "%s: imported %d %s\n", path, n-done, makePlural("record", n-done))
+			progress[path] = -1
+		default:
+			fmt.Fprintf(stderr, "%s: unknown import format\n", path)
+			return
+		}
+		if err := d.saveImportProgress(progressPath, progress); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+	}
+	// The import is complete.
+	if err := fs.Remove(progressPath); err != nil && !oserror.IsNotExist(err) {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+// importText writes the records of the JSON or CSV file in batches, skipping
+// the first skip records, imported by an interrupted import. The number of
+// records imported so far is passed to checkpoint after each batch is
+// committed. It returns the number of records of the file.
+func (d *dbT) importText(
+	db *pebble.DB, path string, skip int64, checkpoint func(n int64) error,
+) (int64, error) {
+	f, err := d.opts.FS.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var next func() (exportRecord, error)
+	if strings.HasSuffix(path, "."+exportFormatCSV) {
+		r := csv.NewReader(bufio.NewReader(f))
+		r.FieldsPerRecord = -1
+		next = func() (exportRecord, error) {
+			fields, err := r.Read()
+			if err != nil {
+				return exportRecord{}, err
+			}
+			switch {
+			case len(fields) == 2:
+				return exportRecord{Key: fields[0], Value: fields[1]}, nil
+			case len(fields) == 5 && fields[0] == exportKindRangeKeySet:
+				return exportRecord{
+					Kind: fields[0], Key: fields[1], End: fields[2], Suffix: fields[3], Value: fields[4],
+				}, nil
+			default:
+				return exportRecord{}, errors.Errorf("invalid record %q", fields)
+			}
+		}
+	} else {
+		dec := json.NewDecoder(bufio.NewReader(f))
+		next = func() (exportRecord, error) {
+			var rec exportRecord
+			err := dec.Decode(&rec)
+			return rec, err
+		}
+	}
+
+	var n int64
+	b := db.NewBatch()
+	defer func() { b.Close() }()
+	commit := func() error {
+		if b.Empty() {
+			return nil
+		}
+		if err := b.Commit(pebble.Sync); err != nil {
+			return err
+		}
+		b.Reset()
+		return checkpoint(n)
+	}
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return n, errors.Wrapf(err, "record %d", n)
+		}
+		n++
+		if n <= skip {
+			continue
+		}
+		if err := d.importRecord(b, rec); err != nil {
+			return n, errors.Wrapf(err, "record %d", n)
+		}
+		if int64(b.Len()) >= d.importBatchSize {
+			if err := commit(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, commit()
+}
+
+// importRecord decodes the record of a JSON or CSV file and applies it to the
+// batch.
+func (d *dbT) importRecord(b *pebble.Batch, rec exportRecord) error {
+	key, err := decodeFormatted(d.exportFmtKey.spec, rec.Key)
+	if err != nil {
+		return errors.Wrap(err, "key")
+	}
+	value, err := decodeFormatted(d.exportFmtValue.spec, rec.Value)
+	if err != nil {
+		return errors.Wrap(err, "value")
+	}
+	switch rec.Kind {
+	case "":
+		return b.Set(key, value, nil)
+	case exportKindRangeKeySet:
+		end, err := decodeFormatted(d.exportFmtKey.spec, rec.End)
+		if err != nil {
+			return errors.Wrap(err, "end")
+		}
+		suffix, err := decodeFormatted(d.exportFmtKey.spec, rec.Suffix)
+		if err != nil {
+			return errors.Wrap(err, "suffix")
+		}
+		return b.RangeKeySet(key, end, suffix, value, nil)
+	default:
+		return errors.Errorf("unknown kind %q", rec.Kind)
+	}
+}
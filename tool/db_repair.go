@@ -0,0 +1,536 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs/atomicfs"
+	"github.com/cockroachdb/pebble/wal"
+	"github.com/spf13/cobra"
+)
+
+// repairQuarantineDir is the subdirectory of the DB directory into which
+// repair moves the files it can't use.
+const repairQuarantineDir = "quarantine"
+
+// repairWAL describes a WAL found by repair.
+type repairWAL struct {
+	num base.DiskFileNum
+	// filenames are the names of the WAL's segments.
+	filenames []string
+	// minSeqNum and maxSeqNum are the smallest and largest sequence numbers of
+	// the batches of the WAL that could be read.
+	minSeqNum, maxSeqNum uint64
+}
+
+// runRepair rebuilds the MANIFEST of a DB from the sstables and WALs present
+// in its directory. Existing MANIFESTs are quarantined, as are the sstables
+// and WALs that can't be read.
+//
+// Tables that don't overlap any other table are placed in L6, and the others
+// in L0, ordered by their sequence numbers. WALs are replayed into new L0
+// tables by opening the repaired DB, except those whose batches are all
+// older than the newest table, which must have been flushed before the
+// MANIFEST was lost. The batches of the remaining WALs that are older than the
+// newest table are removed from them, so that the data they hold isn't
+// written again on top of the tables.
+//
+// The DB directory is locked for the duration of the repair, so a DB that is
+// still open can't be repaired.
+//
+// Repair can't recover information that only the MANIFEST records: the
+// sequence numbers assigned to ingested tables, which are treated as older
+// than every other table, and the bounds of virtual tables, whose backing
+// tables are restored in their entirety.
+func (d *dbT) runRepair(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	dir := args[0]
+	if err := d.configureOptions(dir); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	lock, err := pebble.LockDirectory(dir, d.opts.FS)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer func() {
+		if err := lock.Close(); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+		}
+	}()
+	if err := d.repair(stdout, dir); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+
+	// Replay the WALs into new tables.
+	db, err := d.openDB(dir, repairOpenOption{lock: lock})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+	var stats pebble.CheckLevelsStats
+	if err := db.CheckLevels(&stats); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "repaired: %d %s and %d %s\n",
+		stats.NumPoints, makePlural("point", stats.NumPoints), stats.NumTombstones, makePlural("tombstone", int64(stats.NumTombstones)))
+}
+
+// repairOpenOption opens the repaired DB for writing, salvaging as many WAL
+// records as possible and leaving the salvaged tables in place. The DB is
+// opened with the directory lock held by the repair.
+type repairOpenOption struct {
+	lock *pebble.Lock
+}
+
+func (o repairOpenOption) Apply(dirname string, opts *pebble.Options) {
+	opts.Lock = o.lock
+	opts.ReadOnly = false
+	opts.DisableAutomaticCompactions = true
+	opts.WALRecoveryMode = pebble.WALRecoverySkipAnyCorruptedRecords
+}
+
+func (d *dbT) repair(stdout io.Writer, dir string) error {
+	fs := d.opts.FS
+	ls, err := fs.List(dir)
+	if err != nil {
+		return err
+	}
+	sort.Strings(ls)
+
+	quarantine := func(filename string, reason error) error {
+		if err := fs.MkdirAll(fs.PathJoin(dir, repairQuarantineDir), 0755); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "quarantined %s: %s\n", filename, reason)
+		return fs.Rename(fs.PathJoin(dir, filename), fs.PathJoin(dir, repairQuarantineDir, filename))
+	}
+
+	var tables []*manifest.FileMetadata
+	walsByNum := make(map[base.DiskFileNum]*repairWAL)
+	var maxFileNum base.DiskFileNum
+	for _, filename := range ls {
+		if num, _, ok := wal.ParseLogFilename(filename); ok {
+			fileNum := base.DiskFileNum(num)
+			maxFileNum = max(maxFileNum, fileNum)
+			minSeqNum, maxSeqNum, err := d.scanRepairWAL(dir, filename, fileNum)
+			if err != nil {
+				if err := quarantine(filename, err); err != nil {
+					return err
+				}
+				continue
+			}
+			w := walsByNum[fileNum]
+			if w == nil {
+				w = &repairWAL{num: fileNum, minSeqNum: base.InternalKeySeqNumMax}
+				walsByNum[fileNum] = w
+			}
+			w.filenames = append(w.filenames, filename)
+			w.minSeqNum = min(w.minSeqNum, minSeqNum)
+			w.maxSeqNum = max(w.maxSeqNum, maxSeqNum)
+			continue
+		}
+		ft, fileNum, ok := base.ParseFilename(fs, filename)
+		if !ok {
+			continue
+		}
+		maxFileNum = max(maxFileNum, fileNum)
+		switch ft {
+		case base.FileTypeManifest:
+			err = quarantine(filename, errors.New("replaced by the repaired MANIFEST"))
+		case base.FileTypeTable:
+			var meta *manifest.FileMetadata
+			if meta, err = d.loadRepairTable(dir, filename, fileNum); err != nil {
+				err = quarantine(filename, err)
+			} else {
+				tables = append(tables, meta)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The WALs whose batches are all older than the newest table were flushed.
+	var lastSeqNum uint64
+	for _, meta := range tables {
+		lastSeqNum = max(lastSeqNum, meta.LargestSeqNum)
+	}
+	var wals []*repairWAL
+	for _, w := range walsByNum {
+		wals = append(wals, w)
+	}
+	slices.SortFunc(wals, func(a, b *repairWAL) int { return cmp.Compare(a.num, b.num) })
+	for len(wals) > 0 && wals[0].maxSeqNum <= lastSeqNum {
+		for _, filename := range wals[0].filenames {
+			if err := quarantine(filename, errors.New("already flushed")); err != nil {
+				return err
+			}
+		}
+		wals = wals[1:]
+	}
+	// The remaining WALs may have been partly flushed, if their memtables were
+	// flushed along with newer ones. Remove the flushed batches, so that
+	// replaying the WALs doesn't write them again.
+	for _, w := range wals {
+		if w.minSeqNum > lastSeqNum {
+			break
+		}
+		for _, filename := range w.filenames {
+			if err := d.trimRepairWAL(dir, filename, w.num, lastSeqNum, quarantine); err != nil {
+				return err
+			}
+		}
+	}
+	minUnflushedLogNum := maxFileNum + 1
+	if len(wals) > 0 {
+		minUnflushedLogNum = wals[0].num
+	}
+
+	ve := manifest.VersionEdit{
+		ComparerName:       d.opts.Comparer.Name,
+		MinUnflushedLogNum: minUnflushedLogNum,
+		NextFileNum:        uint64(maxFileNum) + 2,
+		LastSeqNum:         lastSeqNum,
+	}
+	levels := d.placeRepairTables(tables)
+	for level := range levels {
+		if len(levels[level]) == 0 {
+			continue
+		}
+		fmt.Fprintf(stdout, "L%d:", level)
+		for _, meta := range levels[level] {
+			fmt.Fprintf(stdout, " %s", base.MakeFilename(base.FileTypeTable, meta.FileBacking.DiskFileNum))
+			ve.NewFiles = append(ve.NewFiles, manifest.NewFileEntry{Level: level, Meta: meta})
+		}
+		fmt.Fprintf(stdout, "\n")
+	}
+
+	// Write the MANIFEST and point the marker to it.
+	manifestNum := maxFileNum + 1
+	filename := base.MakeFilename(base.FileTypeManifest, manifestNum)
+	if err := d.writeRepairManifest(fs.PathJoin(dir, filename), &ve); err != nil {
+		return err
+	}
+	marker, _, err := atomicfs.LocateMarker(fs, dir, "manifest")
+	if err != nil {
+		return err
+	}
+	if err := marker.Move(filename); err != nil {
+		return errors.CombineErrors(err, marker.Close())
+	}
+	if err := marker.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "wrote %s, replaying %d %s\n", filename, len(wals), makePlural("WAL", int64(len(wals))))
+	return nil
+}
+
+// loadRepairTable reads the table and returns its metadata. The whole table
+// is read, so that corrupted tables are detected.
+func (d *dbT) loadRepairTable(
+	dir, filename string, fileNum base.DiskFileNum,
+) (*manifest.FileMetadata, error) {
+	fs := d.opts.FS
+	f, err := fs.Open(fs.PathJoin(dir, filename))
+	if err != nil {
+		return nil, err
+	}
+	readable, err := sstable.NewSimpleReadable(f)
+	if err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	r, err := sstable.NewReader(readable, sstable.ReaderOptions{Comparer: d.opts.Comparer}, d.comparers, d.mergers)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if r.Properties.ComparerName != d.opts.Comparer.Name {
+		return nil, errors.Errorf("table comparer %q doesn't match the DB's comparer %q",
+			errors.Safe(r.Properties.ComparerName), errors.Safe(d.opts.Comparer.Name))
+	}
+
+	compare := d.opts.Comparer.Compare
+	meta := &manifest.FileMetadata{
+		FileNum:        base.FileNum(fileNum),
+		Size:           uint64(readable.Size()),
+		CreationTime:   timeNow().Unix(),
+		SmallestSeqNum: base.InternalKeySeqNumMax,
+	}
+	meta.InitPhysicalBacking()
+	seqNums := func(seqNum uint64) {
+		meta.SmallestSeqNum = min(meta.SmallestSeqNum, seqNum)
+		meta.LargestSeqNum = max(meta.LargestSeqNum, seqNum)
+	}
+
+	iter, err := r.NewIter(sstable.NoTransforms, nil /* lower */, nil /* upper */)
+	if err != nil {
+		return nil, err
+	}
+	var smallest, largest base.InternalKey
+	for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+		if smallest.UserKey == nil {
+			smallest = key.Clone()
+		}
+		largest.CopyFrom(*key)
+		seqNums(key.SeqNum())
+	}
+	if err := errors.CombineErrors(iter.Error(), iter.Close()); err != nil {
+		return nil, err
+	}
+	if smallest.UserKey != nil {
+		meta.ExtendPointKeyBounds(compare, smallest, largest)
+	}
+
+	// Extend the bounds by those of the range deletions and range keys.
+	spanBounds := func(iter keyspan.FragmentIterator, extend func(smallest, largest base.InternalKey)) error {
+		if iter == nil {
+			return nil
+		}
+		defer iter.Close()
+		var smallest, largest base.InternalKey
+		s, err := iter.First()
+		for ; s != nil; s, err = iter.Next() {
+			if smallest.UserKey == nil {
+				smallest = s.SmallestKey().Clone()
+			}
+			largest = s.LargestKey().Clone()
+			for _, k := range s.Keys {
+				seqNums(k.SeqNum())
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if smallest.UserKey != nil {
+			extend(smallest, largest)
+		}
+		return nil
+	}
+	rangeDelIter, err := r.NewRawRangeDelIter(sstable.NoTransforms)
+	if err != nil {
+		return nil, err
+	}
+	if err := spanBounds(rangeDelIter, func(smallest, largest base.InternalKey) {
+		meta.ExtendPointKeyBounds(compare, smallest, largest)
+	}); err != nil {
+		return nil, err
+	}
+	rangeKeyIter, err := r.NewRawRangeKeyIter(sstable.NoTransforms)
+	if err != nil {
+		return nil, err
+	}
+	if err := spanBounds(rangeKeyIter, func(smallest, largest base.InternalKey) {
+		meta.ExtendRangeKeyBounds(compare, smallest, largest)
+	}); err != nil {
+		return nil, err
+	}
+
+	if !meta.HasPointKeys && !meta.HasRangeKeys {
+		return nil, errors.New("table is empty")
+	}
+	if err := meta.Validate(compare, d.opts.Comparer.FormatKey); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// scanRepairWAL reads the WAL and returns the smallest and largest sequence
+// numbers of its batches. Reading stops at the first corrupted record, which
+// is tolerated as the repaired DB is opened with
+// WALRecoverySkipAnyCorruptedRecords.
+func (d *dbT) scanRepairWAL(
+	dir, filename string, fileNum base.DiskFileNum,
+) (minSeqNum, maxSeqNum uint64, err error) {
+	fs := d.opts.FS
+	f, err := fs.Open(fs.PathJoin(dir, filename))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	minSeqNum = base.InternalKeySeqNumMax
+	var buf bytes.Buffer
+	rr := record.NewReader(f, fileNum)
+	for {
+		r, err := rr.Next()
+		if err == nil {
+			buf.Reset()
+			_, err = io.Copy(&buf, r)
+		}
+		if err != nil {
+			return minSeqNum, maxSeqNum, nil
+		}
+		h, ok := readRepairBatchHeader(buf.Bytes())
+		if !ok {
+			return minSeqNum, maxSeqNum, nil
+		}
+		if h.Count == 0 {
+			continue
+		}
+		minSeqNum = min(minSeqNum, h.SeqNum)
+		maxSeqNum = max(maxSeqNum, h.SeqNum+uint64(h.Count)-1)
+	}
+}
+
+// trimRepairWAL removes the batches whose sequence numbers are all at or
+// below lastSeqNum from a WAL segment: a copy of the segment without them
+// replaces the segment, which is quarantined. Corrupted records are skipped,
+// as they would be when replaying the WAL.
+func (d *dbT) trimRepairWAL(
+	dir, filename string,
+	fileNum base.DiskFileNum,
+	lastSeqNum uint64,
+	quarantine func(filename string, reason error) error,
+) error {
+	fs := d.opts.FS
+	f, err := fs.Open(fs.PathJoin(dir, filename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tmpPath := fs.PathJoin(dir, filename+".repair")
+	out, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := record.NewWriter(out)
+	var buf bytes.Buffer
+	var trimmed int
+	rr := record.NewReader(f, fileNum)
+	for {
+		r, err := rr.Next()
+		if err == nil {
+			buf.Reset()
+			_, err = io.Copy(&buf, r)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			rr.Recover()
+			continue
+		}
+		if h, ok := readRepairBatchHeader(buf.Bytes()); ok && h.SeqNum+uint64(max(h.Count, 1))-1 <= lastSeqNum {
+			trimmed++
+			continue
+		}
+		if _, err := w.WriteRecord(buf.Bytes()); err != nil {
+			return errors.CombineErrors(err, errors.CombineErrors(out.Close(), fs.Remove(tmpPath)))
+		}
+	}
+	if err := w.Close(); err != nil {
+		return errors.CombineErrors(err, errors.CombineErrors(out.Close(), fs.Remove(tmpPath)))
+	}
+	if err := out.Sync(); err != nil {
+		return errors.CombineErrors(err, errors.CombineErrors(out.Close(), fs.Remove(tmpPath)))
+	}
+	if err := out.Close(); err != nil {
+		return errors.CombineErrors(err, fs.Remove(tmpPath))
+	}
+	if trimmed == 0 {
+		return fs.Remove(tmpPath)
+	}
+	if err := quarantine(filename, errors.Newf("replaced by a copy without its %d already flushed batches", trimmed)); err != nil {
+		return err
+	}
+	return fs.Rename(tmpPath, fs.PathJoin(dir, filename))
+}
+
+// readRepairBatchHeader returns the header of the batch of a WAL record.
+func readRepairBatchHeader(data []byte) (batchrepr.Header, bool) {
+	repr, err := batchrepr.Decompress(nil, data)
+	if err != nil {
+		return batchrepr.Header{}, false
+	}
+	return batchrepr.ReadHeader(repr)
+}
+
+// placeRepairTables returns the tables placed in levels: the tables that
+// don't overlap any other table are placed in L6, and the others in L0.
+func (d *dbT) placeRepairTables(
+	tables []*manifest.FileMetadata,
+) [manifest.NumLevels][]*manifest.FileMetadata {
+	compare := d.opts.Comparer.Compare
+	slices.SortFunc(tables, func(a, b *manifest.FileMetadata) int {
+		return compare(a.Smallest.UserKey, b.Smallest.UserKey)
+	})
+	// A table overlaps a preceding table if it starts before the largest end
+	// of the preceding tables, and overlaps a following table if it ends after
+	// the start of the next one. Table bounds are treated as inclusive, which
+	// is conservative for tables whose largest key is an exclusive sentinel.
+	var levels [manifest.NumLevels][]*manifest.FileMetadata
+	var maxLargest []byte
+	for i, meta := range tables {
+		overlaps := i > 0 && compare(maxLargest, meta.Smallest.UserKey) >= 0
+		if i+1 < len(tables) && compare(tables[i+1].Smallest.UserKey, meta.Largest.UserKey) <= 0 {
+			overlaps = true
+		}
+		if i == 0 || compare(meta.Largest.UserKey, maxLargest) > 0 {
+			maxLargest = meta.Largest.UserKey
+		}
+		level := manifest.NumLevels - 1
+		if overlaps {
+			level = 0
+		}
+		levels[level] = append(levels[level], meta)
+	}
+	slices.SortFunc(levels[0], func(a, b *manifest.FileMetadata) int {
+		if c := cmp.Compare(a.LargestSeqNum, b.LargestSeqNum); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.SmallestSeqNum, b.SmallestSeqNum); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.FileNum, b.FileNum)
+	})
+	return levels
+}
+
+func (d *dbT) writeRepairManifest(path string, ve *manifest.VersionEdit) (err error) {
+	fs := d.opts.FS
+	f, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.CombineErrors(err, fs.Remove(path))
+		}
+	}()
+	w := record.NewWriter(f)
+	rw, err := w.Next()
+	if err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := ve.Encode(rw); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := w.Close(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	return f.Close()
+}
@@ -0,0 +1,420 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/spf13/cobra"
+)
+
+// errShellExit is returned by the exit command of the shell.
+var errShellExit = errors.New("exit")
+
+// shell is an interactive session of the db shell command, reading commands
+// from in and running them against a DB opened once for the whole session.
+type shell struct {
+	d         *dbT
+	db        *pebble.DB
+	in        *bufio.Scanner
+	out       io.Writer
+	readWrite bool
+	// snap, if set, is the snapshot the session is pinned to, which the read
+	// commands read from.
+	snap *pebble.Snapshot
+
+	// Flags of the current command.
+	start        key
+	end          key
+	count        int64
+	distribution distributionFlags
+}
+
+func (d *dbT) runShell(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	var openOptions []OpenOption
+	if d.shellReadWrite {
+		openOptions = append(openOptions, nonReadOnly{})
+	}
+	db, err := d.openDB(args[0], openOptions...)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, db)
+
+	// Update the internal formatter if this comparator has one specified.
+	if d.opts.Comparer != nil {
+		d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+		d.fmtValue.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+
+	s := &shell{
+		d:         d,
+		db:        db,
+		in:        bufio.NewScanner(cmd.InOrStdin()),
+		out:       stdout,
+		readWrite: d.shellReadWrite,
+	}
+	defer s.release()
+
+	// Only prompt when reading commands from a terminal, so that the output
+	// of a script piped into the shell is only that of its commands.
+	prompt := false
+	if f, ok := cmd.InOrStdin().(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			prompt = true
+		}
+	}
+	for {
+		if prompt {
+			fmt.Fprint(stdout, "pebble> ")
+		}
+		if !s.in.Scan() {
+			break
+		}
+		args := strings.Fields(s.in.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		if err := s.run(args); err != nil {
+			if errors.Is(err, errShellExit) {
+				break
+			}
+			fmt.Fprintf(stdout, "error: %s\n", err)
+		}
+	}
+	if err := s.in.Err(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+// run runs a command of the shell. The commands are built anew for every
+// command so that their flags start out unset.
+func (s *shell) run(args []string) error {
+	s.start, s.end, s.count = nil, nil, 0
+	s.distribution = distributionFlags{}
+
+	root := &cobra.Command{
+		Use:           "pebble>",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	get := &cobra.Command{
+		Use:   "get <key>",
+		Short: "print the value of a key",
+		Args:  cobra.ExactArgs(1),
+		RunE:  s.runGet,
+	}
+	scan := &cobra.Command{
+		Use:   "scan [<prefix>]",
+		Short: "print the keys and values of a range, or of the keys with a prefix",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  s.runScan,
+	}
+	rangeKeys := &cobra.Command{
+		Use:   "rangekeys",
+		Short: "print the range keys of a range",
+		Args:  cobra.NoArgs,
+		RunE:  s.runRangeKeys,
+	}
+	set := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "set the value of a key, after confirmation",
+		Args:  cobra.ExactArgs(2),
+		RunE:  s.runSet,
+	}
+	del := &cobra.Command{
+		Use:   "delete <key>",
+		Short: "delete a key, after confirmation",
+		Args:  cobra.ExactArgs(1),
+		RunE:  s.runDelete,
+	}
+	metrics := &cobra.Command{
+		Use:   "metrics",
+		Short: "print the metrics of the DB",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintf(s.out, "%s", s.db.Metrics())
+			return nil
+		},
+	}
+	lsm := &cobra.Command{
+		Use:   "lsm",
+		Short: "print the sstables of each level of the LSM",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintf(s.out, "%s", s.db.DebugString())
+			return nil
+		},
+	}
+	distribution := &cobra.Command{
+		Use:   "distribution",
+		Short: "print the distribution of keys by prefix, with the reads sampled in the session",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printDistribution(s.out, s.db, s.start, s.end, s.d.fmtKey, s.distribution)
+		},
+	}
+	compact := &cobra.Command{
+		Use:   "compact <start> <end>",
+		Short: "compact the range [start, end)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  s.runCompact,
+	}
+	flush := &cobra.Command{
+		Use:   "flush",
+		Short: "flush the memtables",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return s.db.Flush()
+		},
+	}
+	checkpoint := &cobra.Command{
+		Use:   "checkpoint <dir>",
+		Short: "create a checkpoint in the specified directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return s.db.Checkpoint(args[0])
+		},
+	}
+	snapshot := &cobra.Command{
+		Use:   "snapshot",
+		Short: "pin the session to a new snapshot, read by the following commands",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s.release()
+			s.snap = s.db.NewSnapshot()
+			fmt.Fprintln(s.out, "pinned snapshot")
+			return nil
+		},
+	}
+	release := &cobra.Command{
+		Use:   "release",
+		Short: "release the snapshot the session is pinned to",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if s.snap == nil {
+				return errors.New("no pinned snapshot")
+			}
+			s.release()
+			fmt.Fprintln(s.out, "released snapshot")
+			return nil
+		},
+	}
+	exit := &cobra.Command{
+		Use:     "exit",
+		Aliases: []string{"quit"},
+		Short:   "exit the shell",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return errShellExit
+		},
+	}
+
+	for _, cmd := range []*cobra.Command{scan, rangeKeys, distribution} {
+		cmd.Flags().Var(&s.start, "start", "start key for the range")
+		cmd.Flags().Var(&s.end, "end", "end key for the range")
+	}
+	for _, cmd := range []*cobra.Command{scan, rangeKeys} {
+		cmd.Flags().Int64Var(&s.count, "count", 0, "key count (0 is unlimited)")
+	}
+	s.distribution.register(distribution)
+	root.AddCommand(get, scan, rangeKeys, set, del, metrics, lsm, distribution, compact,
+		flush, checkpoint, snapshot, release, exit)
+	root.SetArgs(args)
+	root.SetOut(s.out)
+	root.SetErr(s.out)
+	return root.Execute()
+}
+
+// release releases the snapshot the session is pinned to, if any.
+func (s *shell) release() {
+	if s.snap != nil {
+		if err := s.snap.Close(); err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", err)
+		}
+		s.snap = nil
+	}
+}
+
+// reader returns the reader of the read commands, which is the pinned snapshot
+// if any.
+func (s *shell) reader() pebble.Reader {
+	if s.snap != nil {
+		return s.snap
+	}
+	return s.db
+}
+
+// confirm asks for the confirmation of an operation, returning whether it was
+// confirmed.
+func (s *shell) confirm(format string, args ...interface{}) bool {
+	fmt.Fprintf(s.out, format+"? [y/N] ", args...)
+	if !s.in.Scan() {
+		fmt.Fprintln(s.out)
+		return false
+	}
+	answer := strings.TrimSpace(s.in.Text())
+	fmt.Fprintln(s.out, answer)
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+}
+
+// checkWritable returns an error if the session can't write to the DB.
+func (s *shell) checkWritable() error {
+	if !s.readWrite {
+		return errors.New("read-only session (restart the shell with --read-write)")
+	}
+	return nil
+}
+
+func (s *shell) runGet(cmd *cobra.Command, args []string) error {
+	var k key
+	if err := k.Set(args[0]); err != nil {
+		return err
+	}
+	val, closer, err := s.reader().Get(k)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	fmt.Fprintf(s.out, "%s\n", s.d.fmtValue.fn(k, val))
+	return nil
+}
+
+func (s *shell) runScan(cmd *cobra.Command, args []string) error {
+	var prefix key
+	if len(args) > 0 {
+		if err := prefix.Set(args[0]); err != nil {
+			return err
+		}
+	}
+	iter, err := s.reader().NewIter(&pebble.IterOptions{
+		LowerBound: s.start,
+		UpperBound: s.end,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmtKeys := s.d.fmtKey.spec != "null"
+	fmtValues := s.d.fmtValue.spec != "null"
+	var count int64
+	// Seeking clamps the prefix to the lower bound.
+	for valid := iter.SeekGE(prefix); valid; valid = iter.Next() {
+		if prefix != nil && !bytes.HasPrefix(iter.Key(), prefix) {
+			break
+		}
+		if fmtKeys || fmtValues {
+			needDelimiter := false
+			if fmtKeys {
+				fmt.Fprintf(s.out, "%s", s.d.fmtKey.fn(iter.Key()))
+				needDelimiter = true
+			}
+			if fmtValues {
+				if needDelimiter {
+					s.out.Write([]byte{' '})
+				}
+				fmt.Fprintf(s.out, "%s", s.d.fmtValue.fn(iter.Key(), iter.Value()))
+			}
+			s.out.Write([]byte{'\n'})
+		}
+
+		count++
+		if s.count > 0 && count >= s.count {
+			break
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "scanned %d %s\n", count, makePlural("record", count))
+	return nil
+}
+
+func (s *shell) runRangeKeys(cmd *cobra.Command, args []string) error {
+	iter, err := s.reader().NewIter(&pebble.IterOptions{
+		KeyTypes:   pebble.IterKeyTypeRangesOnly,
+		LowerBound: s.start,
+		UpperBound: s.end,
+	})
+	if err != nil {
+		return err
+	}
+	var count int64
+	for valid := iter.First(); valid; valid = iter.Next() {
+		start, end := iter.RangeBounds()
+		fmt.Fprintf(s.out, "[%s, %s): ", s.d.fmtKey.fn(start), s.d.fmtKey.fn(end))
+		for i, rk := range iter.RangeKeys() {
+			if i > 0 {
+				fmt.Fprint(s.out, ", ")
+			}
+			if len(rk.Suffix) > 0 {
+				fmt.Fprintf(s.out, "%s=", s.d.fmtKey.fn(rk.Suffix))
+			}
+			fmt.Fprintf(s.out, "%s", s.d.fmtValue.fn(start, rk.Value))
+		}
+		fmt.Fprintln(s.out)
+
+		count++
+		if s.count > 0 && count >= s.count {
+			break
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "scanned %d %s\n", count, makePlural("span", count))
+	return nil
+}
+
+func (s *shell) runSet(cmd *cobra.Command, args []string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	var k, v key
+	if err := k.Set(args[0]); err != nil {
+		return err
+	}
+	if err := v.Set(args[1]); err != nil {
+		return err
+	}
+	if !s.confirm("set %s to %s", s.d.fmtKey.fn(k), s.d.fmtValue.fn(k, v)) {
+		return nil
+	}
+	return s.db.Set(k, v, pebble.Sync)
+}
+
+func (s *shell) runDelete(cmd *cobra.Command, args []string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	var k key
+	if err := k.Set(args[0]); err != nil {
+		return err
+	}
+	if !s.confirm("delete %s", s.d.fmtKey.fn(k)) {
+		return nil
+	}
+	return s.db.Delete(k, pebble.Sync)
+}
+
+func (s *shell) runCompact(cmd *cobra.Command, args []string) error {
+	var start, end key
+	if err := start.Set(args[0]); err != nil {
+		return err
+	}
+	if err := end.Set(args[1]); err != nil {
+		return err
+	}
+	return s.db.Compact(start, end, false /* parallelize */)
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBShell(t *testing.T) {
+	fs := vfs.NewMem()
+	ok, err := vfs.Clone(vfs.Default, fs, "../testdata/db-stage-4", "db")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	datadriven.RunTest(t, "testdata/shell", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "shell":
+			args := []string{"db", "shell"}
+			for _, arg := range td.CmdArgs {
+				args = append(args, arg.String())
+			}
+			args = append(args, "db")
+
+			var buf bytes.Buffer
+			c := &cobra.Command{}
+			c.AddCommand(New(FS(fs)).Commands...)
+			c.SetArgs(args)
+			c.SetIn(strings.NewReader(td.Input))
+			c.SetOut(&buf)
+			c.SetErr(&buf)
+			if err := c.Execute(); err != nil {
+				return err.Error()
+			}
+			return buf.String()
+		default:
+			return "unknown command: " + td.Cmd
+		}
+	})
+}
@@ -0,0 +1,448 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/spf13/cobra"
+)
+
+// diffSpan is a span of range keys or range deletions, as compared by the
+// diff commands.
+type diffSpan struct {
+	start, end []byte
+	// keys describes the keys of the span, formatted, and rawKeys encodes them
+	// for comparison.
+	keys, rawKeys string
+}
+
+// differ writes the differences between two sides, the "a" side and the "b"
+// side, compared by merge-iterating both. Keys only present on the a side are
+// reported as removed, and keys only present on the b side as added.
+type differ struct {
+	w        io.Writer
+	cmp      base.Compare
+	fmtKey   keyFormatter
+	fmtValue valueFormatter
+	// hashRanges, if positive, is the average number of keys of the ranges
+	// whose hashes are compared instead of individual keys. Range boundaries
+	// are determined by the keys themselves, so that both sides agree on them
+	// regardless of the keys that differ.
+	hashRanges int64
+	// diffs is the number of differences reported.
+	diffs int64
+}
+
+// diffSide is one side of a diff, positioned at a point key.
+type diffSide struct {
+	iter  *pebble.Iterator
+	valid bool
+	// rangeKeys accumulates the range key spans encountered by iter.
+	rangeKeys []diffSpan
+	// hash accumulates the hash of the keys of the current range when
+	// comparing hashes, and count their number.
+	hash  hash.Hash64
+	count int64
+}
+
+// next advances the side to the next point key, recording the range keys it
+// steps over.
+func (s *diffSide) next(d *differ, first bool) {
+	for {
+		if first {
+			s.valid = s.iter.First()
+			first = false
+		} else {
+			s.valid = s.iter.Next()
+		}
+		if !s.valid {
+			return
+		}
+		hasPoint, hasRange := s.iter.HasPointAndRange()
+		if hasRange && s.iter.RangeKeyChanged() {
+			start, end := s.iter.RangeBounds()
+			var keys, rawKeys strings.Builder
+			for i, rk := range s.iter.RangeKeys() {
+				if i > 0 {
+					keys.WriteString(", ")
+				}
+				if len(rk.Suffix) > 0 {
+					fmt.Fprintf(&keys, "%s=", d.fmtKey.fn(rk.Suffix))
+				}
+				fmt.Fprintf(&keys, "%s", d.fmtValue.fn(start, rk.Value))
+				fmt.Fprintf(&rawKeys, "%q=%q,", rk.Suffix, rk.Value)
+			}
+			s.rangeKeys = append(s.rangeKeys, diffSpan{
+				start:   slices.Clone(start),
+				end:     slices.Clone(end),
+				keys:    keys.String(),
+				rawKeys: rawKeys.String(),
+			})
+		}
+		if hasPoint {
+			return
+		}
+	}
+}
+
+// hashKey adds the key and its value to the hash of the current range.
+func (s *diffSide) hashKey(key, value []byte) {
+	var buf [binary.MaxVarintLen64]byte
+	s.hash.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key)))])
+	s.hash.Write(key)
+	s.hash.Write(buf[:binary.PutUvarint(buf[:], uint64(len(value)))])
+	s.hash.Write(value)
+	s.count++
+}
+
+// diffIters reports the differences between the point keys and range keys of
+// the iterators, which must be configured with IterKeyTypePointsAndRanges.
+func (d *differ) diffIters(a, b *pebble.Iterator) error {
+	sa := &diffSide{iter: a, hash: fnv.New64a()}
+	sb := &diffSide{iter: b, hash: fnv.New64a()}
+	sa.next(d, true /* first */)
+	sb.next(d, true /* first */)
+
+	// The first and last keys of the current range when comparing hashes.
+	var rangeStart, rangeEnd []byte
+	finishRange := func() {
+		if rangeStart == nil {
+			return
+		}
+		if sa.hash.Sum64() != sb.hash.Sum64() || sa.count != sb.count {
+			d.diffs++
+			fmt.Fprintf(d.w, "~ range [%s, %s]: %d vs %d %s\n", d.fmtKey.fn(rangeStart), d.fmtKey.fn(rangeEnd),
+				sa.count, sb.count, makePlural("key", sb.count))
+		}
+		rangeStart, rangeEnd = nil, nil
+		sa.hash.Reset()
+		sb.hash.Reset()
+		sa.count, sb.count = 0, 0
+	}
+
+	for sa.valid || sb.valid {
+		c := 0
+		switch {
+		case !sa.valid:
+			c = 1
+		case !sb.valid:
+			c = -1
+		default:
+			c = d.cmp(sa.iter.Key(), sb.iter.Key())
+		}
+		var key, aValue, bValue []byte
+		if c <= 0 {
+			key = sa.iter.Key()
+			var err error
+			if aValue, err = sa.iter.ValueAndErr(); err != nil {
+				return err
+			}
+		}
+		if c >= 0 {
+			key = sb.iter.Key()
+			var err error
+			if bValue, err = sb.iter.ValueAndErr(); err != nil {
+				return err
+			}
+		}
+
+		if d.hashRanges > 0 {
+			if rangeStart == nil {
+				rangeStart = slices.Clone(key)
+			}
+			rangeEnd = append(rangeEnd[:0], key...)
+			if c <= 0 {
+				sa.hashKey(key, aValue)
+			}
+			if c >= 0 {
+				sb.hashKey(key, bValue)
+			}
+			if d.endsRange(key) {
+				finishRange()
+			}
+		} else {
+			switch {
+			case c < 0:
+				d.diffs++
+				fmt.Fprintf(d.w, "- %s%s\n", d.fmtKey.fn(key), d.formatValue(key, aValue))
+			case c > 0:
+				d.diffs++
+				fmt.Fprintf(d.w, "+ %s%s\n", d.fmtKey.fn(key), d.formatValue(key, bValue))
+			case !bytes.Equal(aValue, bValue):
+				d.diffs++
+				fmt.Fprintf(d.w, "~ %s", d.fmtKey.fn(key))
+				if d.fmtValue.spec != "null" {
+					fmt.Fprintf(d.w, " %s ->%s", d.fmtValue.fn(key, aValue), d.formatValue(key, bValue))
+				}
+				fmt.Fprintln(d.w)
+			}
+		}
+
+		if c <= 0 {
+			sa.next(d, false /* first */)
+		}
+		if c >= 0 {
+			sb.next(d, false /* first */)
+		}
+	}
+	finishRange()
+	if err := a.Error(); err != nil {
+		return err
+	}
+	if err := b.Error(); err != nil {
+		return err
+	}
+	d.diffSpans("range key", sa.rangeKeys, sb.rangeKeys)
+	return nil
+}
+
+// formatValue formats the value preceded by a space, or returns the empty
+// string if values aren't output.
+func (d *differ) formatValue(key, value []byte) string {
+	if d.fmtValue.spec == "null" {
+		return ""
+	}
+	return fmt.Sprintf(" %s", d.fmtValue.fn(key, value))
+}
+
+// endsRange returns true if the range whose hashes are compared ends after the
+// key, which is the case of the keys whose hash is a multiple of hashRanges.
+func (d *differ) endsRange(key []byte) bool {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()%uint64(d.hashRanges) == 0
+}
+
+// diffSpans reports the spans that aren't identical on both sides. The spans
+// of each side must be sorted and non-overlapping.
+func (d *differ) diffSpans(kind string, a, b []diffSpan) {
+	for len(a) > 0 || len(b) > 0 {
+		c := 0
+		switch {
+		case len(a) == 0:
+			c = 1
+		case len(b) == 0:
+			c = -1
+		default:
+			if c = d.cmp(a[0].start, b[0].start); c == 0 {
+				if d.cmp(a[0].end, b[0].end) == 0 && a[0].rawKeys == b[0].rawKeys {
+					a, b = a[1:], b[1:]
+					continue
+				}
+				// Report both spans.
+				c = -1
+			}
+		}
+		d.diffs++
+		var op string
+		var span diffSpan
+		if c < 0 {
+			op, span = "-", a[0]
+			a = a[1:]
+		} else {
+			op, span = "+", b[0]
+			b = b[1:]
+		}
+		fmt.Fprintf(d.w, "%s %s [%s, %s)", op, kind, d.fmtKey.fn(span.start), d.fmtKey.fn(span.end))
+		if span.keys != "" {
+			fmt.Fprintf(d.w, ": %s", span.keys)
+		}
+		fmt.Fprintln(d.w)
+	}
+}
+
+// summary writes the number of differences.
+func (d *differ) summary() {
+	fmt.Fprintf(d.w, "%d %s\n", d.diffs, makePlural("difference", d.diffs))
+}
+
+func (d *dbT) runDiff(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	a, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, a)
+	comparer := d.opts.Comparer
+	b, err := d.openDB(args[1])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer d.closeDB(stderr, b)
+	if comparer.Name != d.opts.Comparer.Name {
+		fmt.Fprintf(stderr, "comparers differ: %s vs %s\n", comparer.Name, d.opts.Comparer.Name)
+		return
+	}
+
+	// Update the internal formatter if this comparator has one specified.
+	d.fmtKey.setForComparer(comparer.Name, d.comparers)
+	d.fmtValue.setForComparer(comparer.Name, d.comparers)
+
+	iterOpts := &pebble.IterOptions{
+		KeyTypes:   pebble.IterKeyTypePointsAndRanges,
+		LowerBound: d.start,
+		UpperBound: d.end,
+	}
+	aIter, err := a.NewIter(iterOpts)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer aIter.Close()
+	bIter, err := b.NewIter(iterOpts)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	defer bIter.Close()
+
+	df := &differ{
+		w:          stdout,
+		cmp:        comparer.Compare,
+		fmtKey:     d.fmtKey,
+		fmtValue:   d.fmtValue,
+		hashRanges: d.hashRanges,
+	}
+	fmt.Fprintf(stdout, "--- %s\n+++ %s\n", args[0], args[1])
+	if err := df.diffIters(aIter, bIter); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	df.summary()
+}
+
+func (s *sstableT) runDiff(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	var comparer *base.Comparer
+	var rangeDels [2][]diffSpan
+	for i, arg := range args {
+		c, spans, err := s.loadDiffRangeDels(arg)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", arg, err)
+			return
+		}
+		if comparer != nil && comparer.Name != c.Name {
+			fmt.Fprintf(stderr, "comparers differ: %s vs %s\n", comparer.Name, c.Name)
+			return
+		}
+		comparer, rangeDels[i] = c, spans
+	}
+
+	// Update the internal formatter if this comparator has one specified.
+	s.fmtKey.setForComparer(comparer.Name, s.comparers)
+	s.fmtValue.setForComparer(comparer.Name, s.comparers)
+
+	var iters [2]*pebble.Iterator
+	for i, arg := range args {
+		f, err := s.opts.FS.Open(arg)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+		o := *s.opts
+		o.Comparer = comparer
+		o.EnsureDefaults()
+		// The iterator takes ownership of the file.
+		iters[i], err = pebble.NewExternalIter(&o, &pebble.IterOptions{
+			KeyTypes:   pebble.IterKeyTypePointsAndRanges,
+			LowerBound: s.start,
+			UpperBound: s.end,
+		}, [][]sstable.ReadableFile{{f}})
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", arg, err)
+			return
+		}
+		defer iters[i].Close()
+	}
+
+	d := &differ{
+		w:          stdout,
+		cmp:        comparer.Compare,
+		fmtKey:     s.fmtKey,
+		fmtValue:   s.fmtValue,
+		hashRanges: s.hashRanges,
+	}
+	fmt.Fprintf(stdout, "--- %s\n+++ %s\n", args[0], args[1])
+	if err := d.diffIters(iters[0], iters[1]); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	d.diffSpans("range del", rangeDels[0], rangeDels[1])
+	d.summary()
+}
+
+// loadDiffRangeDels returns the comparer of the sstable, and the spans of its
+// range deletions overlapping the range specified by --start and --end.
+// Abutting spans are merged, so that the spans only describe the keyspace
+// deleted regardless of the fragmentation of the range deletions and of
+// their sequence numbers.
+func (s *sstableT) loadDiffRangeDels(path string) (*base.Comparer, []diffSpan, error) {
+	f, err := s.opts.FS.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.newReader(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	comparer := s.comparers[r.Properties.ComparerName]
+	if comparer == nil {
+		if r.Properties.ComparerName != s.opts.Comparer.Name {
+			return nil, nil, errors.Errorf("unknown comparer %q", errors.Safe(r.Properties.ComparerName))
+		}
+		comparer = s.opts.Comparer
+	}
+
+	iter, err := r.NewRawRangeDelIter(sstable.NoTransforms)
+	if err != nil || iter == nil {
+		return comparer, nil, err
+	}
+	defer iter.Close()
+	// The sstable.Reader is configured to return raw tombstones, which may be
+	// unsorted and overlapping.
+	var tombstones []diffSpan
+	t, err := iter.First()
+	for ; t != nil; t, err = iter.Next() {
+		if s.end != nil && r.Compare(s.end, t.Start) <= 0 {
+			continue
+		}
+		if r.Compare(s.start, t.End) >= 0 {
+			continue
+		}
+		tombstones = append(tombstones, diffSpan{start: slices.Clone(t.Start), end: slices.Clone(t.End)})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	slices.SortFunc(tombstones, func(a, b diffSpan) int {
+		return r.Compare(a.start, b.start)
+	})
+	var spans []diffSpan
+	for _, t := range tombstones {
+		if n := len(spans); n > 0 && r.Compare(spans[n-1].end, t.start) >= 0 {
+			if r.Compare(spans[n-1].end, t.end) < 0 {
+				spans[n-1].end = t.end
+			}
+			continue
+		}
+		spans = append(spans, t)
+	}
+	return comparer, spans, nil
+}
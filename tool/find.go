@@ -14,6 +14,7 @@ import (
 	"sort"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
@@ -355,8 +356,13 @@ func (f *findT) searchLogs(stdout io.Writer, searchKey []byte, refs []findRef) [
 					return err
 				}
 
+				repr, err := batchrepr.Decompress(nil, buf.Bytes())
+				if err != nil {
+					fmt.Fprintf(stdout, "%s: corrupt log file: %v", ll, err)
+					continue
+				}
 				b = pebble.Batch{}
-				if err := b.SetRepr(buf.Bytes()); err != nil {
+				if err := b.SetRepr(repr); err != nil {
 					fmt.Fprintf(stdout, "%s: corrupt log file: %v", ll, err)
 					continue
 				}
@@ -0,0 +1,66 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build make_test_export_db
+// +build make_test_export_db
+
+// Run using: go run -tags make_test_export_db ./tool/make_test_export_db.go
+package main
+
+import (
+	"log"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+const dir = "tool/testdata/export-db"
+
+func main() {
+	fs := vfs.Default
+	if err := fs.RemoveAll(dir); err != nil {
+		log.Fatal(err)
+	}
+	db, err := pebble.Open(dir, &pebble.Options{
+		FS:                          fs,
+		DisableAutomaticCompactions: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Write point keys, and delete some of them with a range deletion that is
+	// older than a key it covers.
+	b := db.NewBatch()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if err := b.Set([]byte(k), []byte(k+"1"), nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := b.Commit(pebble.Sync); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	b = db.NewBatch()
+	if err := b.DeleteRange([]byte("b"), []byte("d"), nil); err != nil {
+		log.Fatal(err)
+	}
+	if err := b.Set([]byte("c"), []byte("c2"), nil); err != nil {
+		log.Fatal(err)
+	}
+	if err := b.RangeKeySet([]byte("e"), []byte("g"), []byte("@1"), []byte("v1"), nil); err != nil {
+		log.Fatal(err)
+	}
+	if err := b.Commit(pebble.Sync); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
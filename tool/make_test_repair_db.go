@@ -0,0 +1,135 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build make_test_repair_db
+// +build make_test_repair_db
+
+// Run using: go run -tags make_test_repair_db ./tool/make_test_repair_db.go
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+const dir = "tool/testdata/repair-db"
+
+func writeFile(fs vfs.FS, name, data string) {
+	f, err := fs.Create(fs.PathJoin(dir, name))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := f.Write([]byte(data)); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	fs := vfs.Default
+	if err := fs.RemoveAll(dir); err != nil {
+		log.Fatal(err)
+	}
+	d, err := pebble.Open(dir, &pebble.Options{
+		DisableAutomaticCompactions: true,
+		FS:                          fs,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	set := func(key, value string) {
+		if err := d.Set([]byte(key), []byte(value), nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+	flush := func() {
+		if err := d.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Two overlapping tables, and one that doesn't overlap any other.
+	set("a", "1")
+	set("b", "1")
+	set("c", "1")
+	flush()
+	set("b", "2")
+	set("d", "2")
+	flush()
+	set("x", "3")
+	set("y", "3")
+	flush()
+	// Unflushed writes, only present in the WAL.
+	set("e", "4")
+	if err := d.Delete([]byte("a"), nil); err != nil {
+		log.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Corrupt the MANIFESTs, and add an unreadable table.
+	ls, err := fs.List(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range ls {
+		if len(name) > 9 && name[:9] == "MANIFEST-" {
+			writeFile(fs, name, "corrupted MANIFEST")
+		}
+	}
+	writeFile(fs, "000100.sst", "corrupted table")
+
+	// Prepend the records of the flushed WALs to the last WAL, as if it had
+	// been partly flushed.
+	var logs []string
+	for _, name := range ls {
+		if _, _, ok := wal.ParseLogFilename(name); ok {
+			logs = append(logs, name)
+		}
+	}
+	sort.Strings(logs)
+	var buf bytes.Buffer
+	w := record.NewWriter(&buf)
+	for _, name := range logs {
+		num, _, _ := wal.ParseLogFilename(name)
+		f, err := fs.Open(fs.PathJoin(dir, name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		rr := record.NewReader(f, base.DiskFileNum(num))
+		for {
+			r, err := rr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				log.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := w.WriteRecord(data); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	writeFile(fs, logs[len(logs)-1], buf.String())
+}
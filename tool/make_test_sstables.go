@@ -44,6 +44,63 @@ func makeOutOfOrder() {
 	}
 }
 
+// makeDiff writes two tables whose point keys, range deletions and range keys
+// partially differ, for the tests of sstable diff.
+func makeDiff() {
+	type op struct {
+		kind       string
+		start, end string
+		value      string
+	}
+	write := func(path string, ops []op) {
+		f, err := vfs.Default.Create(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+			TableFormat: sstable.TableFormatPebblev2,
+		})
+		for _, o := range ops {
+			switch o.kind {
+			case "set":
+				err = w.Set([]byte(o.start), []byte(o.value))
+			case "del-range":
+				err = w.DeleteRange([]byte(o.start), []byte(o.end))
+			case "range-key-set":
+				err = w.RangeKeySet([]byte(o.start), []byte(o.end), nil, []byte(o.value))
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	write("tool/testdata/diff-a.sst", []op{
+		{kind: "set", start: "apple", value: "1"},
+		{kind: "set", start: "banana", value: "2"},
+		{kind: "set", start: "cherry", value: "3"},
+		{kind: "set", start: "date", value: "4"},
+		{kind: "set", start: "fig", value: "6"},
+		{kind: "del-range", start: "m", end: "p"},
+		{kind: "range-key-set", start: "x", end: "z", value: "a"},
+	})
+	write("tool/testdata/diff-b.sst", []op{
+		{kind: "set", start: "apple", value: "1"},
+		{kind: "set", start: "cherry", value: "33"},
+		{kind: "set", start: "date", value: "4"},
+		{kind: "set", start: "elderberry", value: "5"},
+		{kind: "set", start: "fig", value: "6"},
+		{kind: "del-range", start: "m", end: "n"},
+		{kind: "del-range", start: "n", end: "p"},
+		{kind: "del-range", start: "q", end: "r"},
+		{kind: "range-key-set", start: "x", end: "z", value: "b"},
+	})
+}
+
 func main() {
 	makeOutOfOrder()
+	makeDiff()
 }
@@ -29,8 +29,10 @@ import (
 type sstableT struct {
 	Root       *cobra.Command
 	Check      *cobra.Command
+	Diff       *cobra.Command
 	Layout     *cobra.Command
 	Properties *cobra.Command
+	Rewrite    *cobra.Command
 	Scan       *cobra.Command
 	Space      *cobra.Command
 
@@ -40,13 +42,18 @@ type sstableT struct {
 	mergers   sstable.Mergers
 
 	// Flags.
-	fmtKey   keyFormatter
-	fmtValue valueFormatter
-	start    key
-	end      key
-	filter   key
-	count    int64
-	verbose  bool
+	fmtKey     keyFormatter
+	fmtValue   valueFormatter
+	start      key
+	end        key
+	filter     key
+	count      int64
+	hashRanges int64
+	verbose    bool
+
+	rewriteFormat      string
+	rewriteCompression string
+	rewriteBlockSize   int
 }
 
 func newSSTable(
@@ -71,6 +78,22 @@ func newSSTable(
 		Args:  cobra.MinimumNArgs(1),
 		Run:   s.runCheck,
 	}
+	s.Diff = &cobra.Command{
+		Use:   "diff <sstable-a> <sstable-b>",
+		Short: "print the differences between two sstables",
+		Long: `
+Print the point keys, range keys and range deletions of the range specified
+by --start and --end that differ between the two sstables. Keys only present
+in the first sstable are prefixed by "-", keys only present in the second one
+by "+", and keys whose values differ by "~". Sequence numbers are ignored.
+
+If --hash-ranges is specified, the point keys are instead grouped in ranges
+of about that many keys, determined by the keys themselves, and only the
+ranges whose hashes differ are reported.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  s.runDiff,
+	}
 	s.Layout = &cobra.Command{
 		Use:   "layout <sstables>",
 		Short: "print sstable block and record layout",
@@ -91,6 +114,20 @@ properties are pretty-printed or displayed in a verbose/raw format.
 		Args: cobra.MinimumNArgs(1),
 		Run:  s.runProperties,
 	}
+	s.Rewrite = &cobra.Command{
+		Use:   "rewrite <src-sstable> <dst-sstable>",
+		Short: "rewrite an sstable with different options",
+		Long: `
+Rewrite the sstable to a new sstable with the table format, compression and
+block size specified by --format, --compression and --block-size, which default
+to those of the source sstable, and with the registered block property
+collectors. The keys, range deletions, range keys and user properties are
+preserved, which is verified by comparing the iteration of both sstables once
+the new one is written.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  s.runRewrite,
+	}
 	s.Scan = &cobra.Command{
 		Use:   "scan <sstables>",
 		Short: "print sstable records",
@@ -113,7 +150,7 @@ inclusive-inclusive range specified by --start and --end.
 		Run:  s.runSpace,
 	}
 
-	s.Root.AddCommand(s.Check, s.Layout, s.Properties, s.Scan, s.Space)
+	s.Root.AddCommand(s.Check, s.Diff, s.Layout, s.Properties, s.Rewrite, s.Scan, s.Space)
 	s.Root.PersistentFlags().BoolVarP(&s.verbose, "verbose", "v", false, "verbose output")
 
 	s.Check.Flags().Var(
@@ -122,16 +159,26 @@ inclusive-inclusive range specified by --start and --end.
 		&s.fmtKey, "key", "key formatter")
 	s.Layout.Flags().Var(
 		&s.fmtValue, "value", "value formatter")
-	s.Scan.Flags().Var(
-		&s.fmtKey, "key", "key formatter")
-	s.Scan.Flags().Var(
-		&s.fmtValue, "value", "value formatter")
-	for _, cmd := range []*cobra.Command{s.Scan, s.Space} {
+	for _, cmd := range []*cobra.Command{s.Diff, s.Scan} {
+		cmd.Flags().Var(
+			&s.fmtKey, "key", "key formatter")
+		cmd.Flags().Var(
+			&s.fmtValue, "value", "value formatter")
+	}
+	for _, cmd := range []*cobra.Command{s.Diff, s.Scan, s.Space} {
 		cmd.Flags().Var(
 			&s.start, "start", "start key for the range")
 		cmd.Flags().Var(
 			&s.end, "end", "end key for the range")
 	}
+	s.Diff.Flags().Int64Var(
+		&s.hashRanges, "hash-ranges", 0, "compare the hashes of ranges of about this many keys (0 compares keys)")
+	s.Rewrite.Flags().StringVar(
+		&s.rewriteFormat, "format", "", fmt.Sprintf("table format (%s)", flagNames(rewriteTableFormats)))
+	s.Rewrite.Flags().StringVar(
+		&s.rewriteCompression, "compression", "", fmt.Sprintf("compression (%s)", flagNames(rewriteCompressions)))
+	s.Rewrite.Flags().IntVar(
+		&s.rewriteBlockSize, "block-size", 0, "target size of the data blocks in bytes (0 is the default size)")
 	s.Scan.Flags().Var(
 		&s.filter, "filter", "only output records with matching prefix or overlapping range tombstones")
 	s.Scan.Flags().Int64Var(
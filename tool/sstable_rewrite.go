@@ -0,0 +1,170 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+)
+
+// rewriteTableFormats are the table formats accepted by sstable rewrite.
+var rewriteTableFormats = map[string]sstable.TableFormat{
+	"leveldb":   sstable.TableFormatLevelDB,
+	"rocksdbv2": sstable.TableFormatRocksDBv2,
+	"pebblev1":  sstable.TableFormatPebblev1,
+	"pebblev2":  sstable.TableFormatPebblev2,
+	"pebblev3":  sstable.TableFormatPebblev3,
+	"pebblev4":  sstable.TableFormatPebblev4,
+}
+
+// rewriteCompressions are the compressions accepted by sstable rewrite.
+var rewriteCompressions = map[string]sstable.Compression{
+	"none":   sstable.NoCompression,
+	"snappy": sstable.SnappyCompression,
+	"zstd":   sstable.ZstdCompression,
+}
+
+// flagNames returns the sorted keys of the map of accepted flag values.
+func flagNames[T any](m map[string]T) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (s *sstableT) runRewrite(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	src, dst := args[0], args[1]
+	if err := s.rewrite(src, dst); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+
+	// Verify the rewritten table against the original one.
+	var summary [2]string
+	err := func() error {
+		var readers [2]*sstable.Reader
+		for i, path := range []string{src, dst} {
+			f, err := s.opts.FS.Open(path)
+			if err != nil {
+				return err
+			}
+			stat, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return err
+			}
+			r, err := s.openRewriteReader(f)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			readers[i] = r
+			format, err := r.TableFormat()
+			if err != nil {
+				return err
+			}
+			summary[i] = fmt.Sprintf("%s, %s, %d bytes", format, r.Properties.CompressionName, stat.Size())
+		}
+		return sstable.VerifyRewrite(readers[0], readers[1])
+	}()
+	if err != nil {
+		fmt.Fprintf(stderr, "verification failed: %s\n", err)
+		if err := s.opts.FS.Remove(dst); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+		}
+		return
+	}
+	fmt.Fprintf(stdout, "%s: %s\n", src, summary[0])
+	fmt.Fprintf(stdout, "%s: %s\n", dst, summary[1])
+}
+
+// rewrite rewrites the sstable src to dst with the options specified by the
+// flags, defaulting to those of src.
+func (s *sstableT) rewrite(src, dst string) error {
+	f, err := s.opts.FS.Open(src)
+	if err != nil {
+		return err
+	}
+	r, err := s.openRewriteReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	o := sstable.WriterOptions{
+		BlockPropertyCollectors: s.opts.BlockPropertyCollectors,
+		BlockSize:               s.rewriteBlockSize,
+		Comparer:                s.comparers[r.Properties.ComparerName],
+	}
+	if o.Comparer == nil {
+		return errors.Errorf("unknown comparer %q", errors.Safe(r.Properties.ComparerName))
+	}
+	if name := r.Properties.FilterPolicyName; name != "" {
+		if o.FilterPolicy = s.opts.Filters[name]; o.FilterPolicy == nil {
+			return errors.Errorf("unknown filter policy %q", errors.Safe(name))
+		}
+	}
+	if s.rewriteFormat == "" {
+		if o.TableFormat, err = r.TableFormat(); err != nil {
+			return err
+		}
+	} else {
+		var ok bool
+		if o.TableFormat, ok = rewriteTableFormats[strings.ToLower(s.rewriteFormat)]; !ok {
+			return errors.Errorf("unknown table format %q (expected one of %s)",
+				s.rewriteFormat, flagNames(rewriteTableFormats))
+		}
+	}
+	if s.rewriteCompression == "" {
+		for _, c := range rewriteCompressions {
+			if c.String() == r.Properties.CompressionName {
+				o.Compression = c
+			}
+		}
+	} else {
+		var ok bool
+		if o.Compression, ok = rewriteCompressions[strings.ToLower(s.rewriteCompression)]; !ok {
+			return errors.Errorf("unknown compression %q (expected one of %s)",
+				s.rewriteCompression, flagNames(rewriteCompressions))
+		}
+	}
+
+	out, err := s.opts.FS.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := sstable.RewriteTable(r, objstorageprovider.NewFileWritable(out), o); err != nil {
+		return errors.CombineErrors(err, s.opts.FS.Remove(dst))
+	}
+	return nil
+}
+
+// openRewriteReader opens a reader on the file, which unlike newReader
+// fragments the range deletions of tables in the RocksDB format, as required
+// to rewrite them.
+func (s *sstableT) openRewriteReader(f vfs.File) (*sstable.Reader, error) {
+	readable, err := sstable.NewSimpleReadable(f)
+	if err != nil {
+		return nil, err
+	}
+	o := sstable.ReaderOptions{
+		Cache:    pebble.NewCache(128 << 20 /* 128 MB */),
+		Comparer: s.opts.Comparer,
+		Filters:  s.opts.Filters,
+	}
+	defer o.Cache.Unref()
+	return sstable.NewReader(readable, o, s.comparers, s.mergers)
+}
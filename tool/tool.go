@@ -14,6 +14,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// BlockPropertyCollector exports the sstable.BlockPropertyCollector type.
+type BlockPropertyCollector = sstable.BlockPropertyCollector
+
 // Comparer exports the base.Comparer type.
 type Comparer = base.Comparer
 
@@ -63,6 +66,14 @@ func DefaultComparer(c *Comparer) Option {
 	}
 }
 
+// BlockPropertyCollectors may be passed to New to register block property
+// collectors, used to write sstables by the introspection tools.
+func BlockPropertyCollectors(collectors ...func() BlockPropertyCollector) Option {
+	return func(t *T) {
+		t.opts.BlockPropertyCollectors = append(t.opts.BlockPropertyCollectors, collectors...)
+	}
+}
+
 // Mergers may be passed to New to register mergers for use by the
 // introspection tools.
 func Mergers(mergers ...*Merger) Option {
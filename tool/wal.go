@@ -11,6 +11,7 @@ import (
 	"io"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/rangekey"
 	"github.com/cockroachdb/pebble/record"
@@ -22,8 +23,10 @@ import (
 // walT implements WAL-level tools, including both configuration state and the
 // commands themselves.
 type walT struct {
-	Root *cobra.Command
-	Dump *cobra.Command
+	Root     *cobra.Command
+	Dump     *cobra.Command
+	Truncate *cobra.Command
+	Verify   *cobra.Command
 
 	opts     *pebble.Options
 	fmtKey   keyFormatter
@@ -57,7 +60,35 @@ Print the contents of the WAL files.
 		Run:  w.runDump,
 	}
 
-	w.Root.AddCommand(w.Dump)
+	w.Truncate = &cobra.Command{
+		Use:   "truncate <wal-file>",
+		Short: "truncate a WAL to its last valid record",
+		Long: `
+Truncate the WAL file to the end of the last valid record preceding its first
+invalid record, so that a DB whose WAL has a corrupted tail can be opened. The
+records following the invalid record are lost. The original WAL file is moved
+to <wal-file>.bak. Requires that the DB not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  w.runTruncate,
+	}
+	w.Verify = &cobra.Command{
+		Use:   "verify <wal-files|dirs>",
+		Short: "verify WALs",
+		Long: `
+Verify the WAL files, and the WAL files of the directories. The checksums of
+the records and the encoding of their batches are verified, as well as the
+continuity of their sequence numbers across the WALs, in order. WALs split into
+several files by WAL failover are read as a whole. Gaps in the sequence numbers
+are reported but aren't errors, since ingestions allocate sequence numbers
+without writing to the WAL. An invalid tail is only an error in a WAL other
+than the most recent one.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  w.runVerify,
+	}
+
+	w.Root.AddCommand(w.Dump, w.Truncate, w.Verify)
 	w.Root.PersistentFlags().BoolVarP(&w.verbose, "verbose", "v", false, "verbose output")
 
 	w.Dump.Flags().Var(
@@ -118,13 +149,22 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 					return
 				}
 
+				repr, err := batchrepr.Decompress(nil, buf.Bytes())
+				if err != nil {
+					fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
+					return
+				}
 				b = pebble.Batch{}
-				if err := b.SetRepr(buf.Bytes()); err != nil {
+				if err := b.SetRepr(repr); err != nil {
 					fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
 					return
 				}
-				fmt.Fprintf(stdout, "%d(%d) seq=%d count=%d\n",
-					offset, len(b.Repr()), b.SeqNum(), b.Count())
+				fmt.Fprintf(stdout, "%d(%d) seq=%d count=%d",
+					offset, buf.Len(), b.SeqNum(), b.Count())
+				if c := batchrepr.ReadCompression(buf.Bytes()); c != batchrepr.NoCompression {
+					fmt.Fprintf(stdout, " compression=%s(%d)", c, len(repr))
+				}
+				fmt.Fprintf(stdout, "\n")
 				for r, idx := b.Reader(), 0; ; idx++ {
 					kind, ukey, value, ok, err := r.Next()
 					if !ok {
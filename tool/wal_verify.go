@@ -0,0 +1,303 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/wal"
+	"github.com/spf13/cobra"
+)
+
+// checkWALBatch checks that the record read from a WAL holds a valid batch,
+// returning its header.
+func checkWALBatch(data []byte) (batchrepr.Header, error) {
+	repr, err := batchrepr.Decompress(nil, data)
+	if err != nil {
+		return batchrepr.Header{}, err
+	}
+	h, ok := batchrepr.ReadHeader(repr)
+	if !ok {
+		return h, base.CorruptionErrorf("invalid batch header")
+	}
+	var b pebble.Batch
+	if err := b.SetRepr(repr); err != nil {
+		return h, err
+	}
+	// LogData entries don't count towards the count of the batch.
+	var count uint32
+	for r := b.Reader(); ; {
+		kind, _, _, ok, err := r.Next()
+		if !ok {
+			if err != nil {
+				return h, err
+			}
+			break
+		}
+		if kind != base.InternalKeyKindLogData {
+			count++
+		}
+	}
+	if count != h.Count {
+		return h, base.CorruptionErrorf("batch has count %d but %d entries", h.Count, count)
+	}
+	return h, nil
+}
+
+// walVerifier verifies a sequence of WALs, checking that the sequence numbers
+// of their batches are contiguous.
+type walVerifier struct {
+	w      io.Writer
+	errors int
+	// nextSeqNum is the sequence number following the batches verified so
+	// far, or zero if no batch was verified yet.
+	nextSeqNum uint64
+}
+
+// verify verifies the logical WAL, which is only allowed to have an invalid
+// tail if it's the most recent one.
+func (v *walVerifier) verify(ll wal.LogicalLog, mostRecent bool) error {
+	rr := ll.OpenForRead()
+	defer rr.Close()
+
+	fmt.Fprintf(v.w, "%s", ll.Num)
+	if n := ll.NumSegments(); n > 1 {
+		fmt.Fprintf(v.w, " (%d segments)", n)
+	}
+	fmt.Fprintf(v.w, "\n")
+	var records int
+	var start, end uint64
+	for {
+		r, off, err := rr.NextRecord()
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(r)
+		}
+		if err == io.EOF {
+			break
+		} else if record.IsInvalidRecord(err) || errors.Is(err, base.ErrCorruption) {
+			// Determine whether the invalid record is the tail of the WAL, or
+			// whether it's followed by valid records which would be dropped.
+			var dropped int
+			var droppedStart, droppedEnd uint64
+			if wal.RecoverReader(rr) {
+				dropped, droppedStart, droppedEnd = scanWALRecords(rr)
+			}
+			switch {
+			case dropped > 0:
+				fmt.Fprintf(v.w, "  %s: corrupt record: %s; %d %s with seqnums [%d, %d) follow\n",
+					off, err, dropped, makePlural("record", int64(dropped)), droppedStart, droppedEnd)
+				v.errors++
+			case mostRecent:
+				fmt.Fprintf(v.w, "  %s: invalid tail: %s\n", off, err)
+			default:
+				fmt.Fprintf(v.w, "  %s: invalid tail of a WAL that isn't the most recent: %s\n", off, err)
+				v.errors++
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+
+		h, err := checkWALBatch(data)
+		if err != nil {
+			fmt.Fprintf(v.w, "  %s: corrupt batch: %s\n", off, err)
+			v.errors++
+			continue
+		}
+		if v.nextSeqNum != 0 {
+			switch {
+			case h.SeqNum > v.nextSeqNum:
+				// Ingestions allocate sequence numbers without writing to the
+				// WAL, so gaps are expected.
+				fmt.Fprintf(v.w, "  %s: seqnums [%d, %d) missing\n", off, v.nextSeqNum, h.SeqNum)
+			case h.SeqNum < v.nextSeqNum:
+				fmt.Fprintf(v.w, "  %s: seqnum %d overlaps the previous batches, expected %d\n",
+					off, h.SeqNum, v.nextSeqNum)
+				v.errors++
+			}
+		}
+		if records == 0 {
+			start = h.SeqNum
+		}
+		records++
+		end = h.SeqNum + uint64(h.Count)
+		v.nextSeqNum = end
+	}
+	fmt.Fprintf(v.w, "  %d %s", records, makePlural("record", int64(records)))
+	if records > 0 {
+		fmt.Fprintf(v.w, ", seqnums [%d, %d)", start, end)
+	}
+	fmt.Fprintf(v.w, "\n")
+	return nil
+}
+
+// scanWALRecords reads the remaining records of the WAL, skipping invalid
+// ones, and returns the number of valid records and the range of sequence
+// numbers of their batches.
+func scanWALRecords(rr wal.Reader) (records int, start, end uint64) {
+	for {
+		r, _, err := rr.NextRecord()
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(r)
+		}
+		if err == io.EOF {
+			return records, start, end
+		} else if (record.IsInvalidRecord(err) || errors.Is(err, base.ErrCorruption)) && wal.RecoverReader(rr) {
+			continue
+		} else if err != nil {
+			return records, start, end
+		}
+		if h, err := checkWALBatch(data); err == nil && h.Count > 0 {
+			if records == 0 {
+				start = h.SeqNum
+			}
+			records++
+			end = max(end, h.SeqNum+uint64(h.Count))
+		}
+	}
+}
+
+func (w *walT) runVerify(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	logs, err := w.findLogs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return
+	}
+	v := walVerifier{w: stdout}
+	for i, ll := range logs {
+		if err := v.verify(ll, i == len(logs)-1); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return
+		}
+	}
+	fmt.Fprintf(stdout, "verified %d %s: ", len(logs), makePlural("WAL", int64(len(logs))))
+	if v.errors == 0 {
+		fmt.Fprintf(stdout, "ok\n")
+	} else {
+		fmt.Fprintf(stdout, "%d %s\n", v.errors, makePlural("error", int64(v.errors)))
+	}
+}
+
+// findLogs returns the logical WALs made up of the specified WAL files, and of
+// the WAL files of the specified directories.
+func (w *walT) findLogs(args []string) (wal.Logs, error) {
+	var fa wal.FileAccumulator
+	for _, arg := range args {
+		stat, err := w.opts.FS.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			if ok, err := fa.MaybeAccumulate(w.opts.FS, arg); err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, errors.Errorf("%s is not a WAL file", arg)
+			}
+			continue
+		}
+		names, err := w.opts.FS.List(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if _, err := fa.MaybeAccumulate(w.opts.FS, w.opts.FS.PathJoin(arg, name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fa.Finish(), nil
+}
+
+func (w *walT) runTruncate(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	path := args[0]
+	fs := w.opts.FS
+	err := func() error {
+		fileNum, _, ok := wal.ParseLogFilename(fs.PathBase(path))
+		if !ok {
+			return errors.Errorf("%s is not a WAL file", path)
+		}
+		// Find the end of the last valid record preceding the first invalid
+		// one.
+		f, err := fs.Open(path)
+		if err != nil {
+			return err
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		var records int
+		var validEnd int64
+		var invalid error
+		rr := record.NewReader(f, base.DiskFileNum(fileNum))
+		for {
+			r, err := rr.Next()
+			var data []byte
+			if err == nil {
+				data, err = io.ReadAll(r)
+			}
+			if err == nil {
+				_, err = checkWALBatch(data)
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				invalid = err
+				break
+			}
+			records++
+			validEnd = rr.Offset()
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if invalid == nil {
+			fmt.Fprintf(stdout, "%s is valid, not truncating\n", path)
+			return nil
+		}
+		fmt.Fprintf(stdout, "invalid record at offset %d: %s\n", validEnd, invalid)
+
+		// Move the WAL to the backup, and copy its valid records back.
+		backup := path + ".bak"
+		if _, err := fs.Stat(backup); err == nil {
+			return errors.Errorf("backup %s already exists", backup)
+		}
+		if err := fs.Rename(path, backup); err != nil {
+			return err
+		}
+		src, err := fs.Open(backup)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := fs.Create(path)
+		if err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dst, src, validEnd); err != nil {
+			return errors.CombineErrors(err, dst.Close())
+		}
+		if err := errors.CombineErrors(dst.Sync(), dst.Close()); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "truncated %s from %d to %d bytes, keeping %d %s; original saved as %s\n",
+			path, stat.Size(), validEnd, records, makePlural("record", int64(records)), backup)
+		return nil
+	}()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
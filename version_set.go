@@ -79,6 +79,9 @@ type versionSet struct {
 	obsoleteTables    []fileInfo
 	obsoleteManifests []fileInfo
 	obsoleteOptions   []fileInfo
+	// obsoleteCompactionCheckpoints are the checkpoint files of resumable
+	// compactions that completed or were abandoned.
+	obsoleteCompactionCheckpoints []fileInfo
 
 	// Zombie tables which have been removed from the current version but are
 	// still referenced by an inuse iterator.
@@ -776,6 +779,18 @@ func (vs *versionSet) incrementCompactions(
 	case compactionKindRewrite:
 		vs.metrics.Compact.Count++
 		vs.metrics.Compact.RewriteCount++
+
+	case compactionKindAge:
+		vs.metrics.Compact.Count++
+		vs.metrics.Compact.AgeCount++
+
+	case compactionKindTombstoneDensity:
+		vs.metrics.Compact.Count++
+		vs.metrics.Compact.TombstoneDensityCount++
+
+	case compactionKindHint:
+		vs.metrics.Compact.Count++
+		vs.metrics.Compact.HintCount++
 	}
 	if len(extraLevels) > 0 {
 		vs.metrics.Compact.MultiLevelCount++
@@ -0,0 +1,134 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+)
+
+// ArchivedLog describes a log file that was copied to a WAL archive once it
+// became obsolete. The description is encoded in the name of the archived
+// file, so that an archive may be searched without reading its files.
+type ArchivedLog struct {
+	// Num is the number of the virtual WAL that the log file belongs to.
+	Num NumWAL
+	// Index is the index of the log file within the virtual WAL.
+	Index LogNameIndex
+	// MinSeqNum and MaxSeqNum are the smallest and largest sequence numbers of
+	// the keys written to the log file. They're both zero if the log file
+	// contains no keys.
+	MinSeqNum, MaxSeqNum uint64
+	// SealedAt is the time of the last write to the log file.
+	SealedAt time.Time
+}
+
+// String implements fmt.Stringer.
+func (l ArchivedLog) String() string {
+	return fmt.Sprintf("%s seqnums=[%d,%d] sealed=%s",
+		makeLogFilename(l.Num, l.Index), l.MinSeqNum, l.MaxSeqNum, l.SealedAt.UTC().Format(time.RFC3339Nano))
+}
+
+const archivedLogSuffix = ".archive"
+
+// Filename returns the name of the archived log file, of the form
+// <log filename>.<min seqnum>-<max seqnum>.<sealed unix nanos>.archive.
+func (l ArchivedLog) Filename() string {
+	return fmt.Sprintf("%s.%d-%d.%d%s", makeLogFilename(l.Num, l.Index),
+		l.MinSeqNum, l.MaxSeqNum, l.SealedAt.UnixNano(), archivedLogSuffix)
+}
+
+// ParseArchivedLogFilename parses the name of an archived log file. If the
+// filename is not an archived log file, it returns false for the final return
+// value.
+func ParseArchivedLogFilename(name string) (ArchivedLog, bool) {
+	name, ok := strings.CutSuffix(name, archivedLogSuffix)
+	if !ok {
+		return ArchivedLog{}, false
+	}
+	parts := strings.Split(name, ".")
+	if len(parts) != 4 {
+		return ArchivedLog{}, false
+	}
+	var l ArchivedLog
+	if l.Num, l.Index, ok = ParseLogFilename(parts[0] + "." + parts[1]); !ok {
+		return ArchivedLog{}, false
+	}
+	minSeqNum, maxSeqNum, ok := strings.Cut(parts[2], "-")
+	if !ok {
+		return ArchivedLog{}, false
+	}
+	var err error
+	if l.MinSeqNum, err = strconv.ParseUint(minSeqNum, 10, 64); err != nil {
+		return ArchivedLog{}, false
+	}
+	if l.MaxSeqNum, err = strconv.ParseUint(maxSeqNum, 10, 64); err != nil {
+		return ArchivedLog{}, false
+	}
+	sealedAt, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return ArchivedLog{}, false
+	}
+	l.SealedAt = time.Unix(0, sealedAt)
+	return l, true
+}
+
+// ScanArchivedLog reads the log file r, which belongs to the virtual WAL num,
+// and invokes fn with each batch it contains, in order. The batches may be
+// compressed (see batchrepr.Decompress) and are only valid for the duration
+// of the call to fn. An invalid record at the tail of the log file, as is
+// expected if the process exited while writing to the log file, ends the
+// scan without error.
+func ScanArchivedLog(r io.Reader, num NumWAL, fn func(repr []byte) error) error {
+	rr := record.NewReader(r, base.DiskFileNum(num))
+	var buf bytes.Buffer
+	for {
+		buf.Reset()
+		rec, err := rr.Next()
+		if err == nil {
+			_, err = io.Copy(&buf, rec)
+		}
+		if err == io.EOF || record.IsInvalidRecord(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if buf.Len() < batchrepr.HeaderLen {
+			return base.CorruptionErrorf("pebble: corrupt log file %s: invalid batch",
+				errors.Safe(base.DiskFileNum(num)))
+		}
+		if err := fn(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadSeqNumRange returns the smallest and largest sequence numbers of the
+// keys written to the log file r, which belongs to the virtual WAL num.
+func ReadSeqNumRange(r io.Reader, num NumWAL) (minSeqNum, maxSeqNum uint64, err error) {
+	err = ScanArchivedLog(r, num, func(repr []byte) error {
+		h, _ := batchrepr.ReadHeader(repr)
+		if h.Count == 0 {
+			// Batches that only contain LogData don't consume sequence
+			// numbers.
+			return nil
+		}
+		if minSeqNum == 0 || h.SeqNum < minSeqNum {
+			minSeqNum = h.SeqNum
+		}
+		maxSeqNum = max(maxSeqNum, h.SeqNum+uint64(h.Count)-1)
+		return nil
+	})
+	return minSeqNum, maxSeqNum, err
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package wal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivedLogFilename(t *testing.T) {
+	for _, l := range []ArchivedLog{
+		{Num: 5, MinSeqNum: 10, MaxSeqNum: 20, SealedAt: time.Unix(0, 1700000000123456789)},
+		{Num: 123, Index: 2, MinSeqNum: 1, MaxSeqNum: 1, SealedAt: time.Unix(1, 0)},
+	} {
+		name := l.Filename()
+		parsed, ok := ParseArchivedLogFilename(name)
+		require.True(t, ok, name)
+		require.Equal(t, l.Num, parsed.Num)
+		require.Equal(t, l.Index, parsed.Index)
+		require.Equal(t, l.MinSeqNum, parsed.MinSeqNum)
+		require.Equal(t, l.MaxSeqNum, parsed.MaxSeqNum)
+		require.True(t, l.SealedAt.Equal(parsed.SealedAt))
+	}
+	require.Equal(t, "000005.log.10-20.1700000000123456789.archive",
+		ArchivedLog{Num: 5, MinSeqNum: 10, MaxSeqNum: 20, SealedAt: time.Unix(0, 1700000000123456789)}.Filename())
+	for _, name := range []string{
+		"000005.log",
+		"000005.log.10-20.1700000000123456789.archive.tmp",
+		"000005.log.10.1700000000123456789.archive",
+		"000005.sst.10-20.1700000000123456789.archive",
+		"000005.log.10-20.archive",
+	} {
+		_, ok := ParseArchivedLogFilename(name)
+		require.False(t, ok, name)
+	}
+}
+
+func TestReadSeqNumRange(t *testing.T) {
+	fs := vfs.NewMem()
+	f, err := fs.Create("000007.log")
+	require.NoError(t, err)
+	w := record.NewLogWriter(f, base.DiskFileNum(7), record.LogWriterConfig{})
+	for _, h := range []batchrepr.Header{
+		{SeqNum: 10, Count: 3},
+		// A batch containing only LogData doesn't consume sequence numbers.
+		{SeqNum: 13, Count: 0},
+		{SeqNum: 13, Count: 2},
+	} {
+		repr := make([]byte, batchrepr.HeaderLen)
+		batchrepr.SetSeqNum(repr, h.SeqNum)
+		batchrepr.SetCount(repr, h.Count)
+		_, err := w.WriteRecord(repr)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	f, err = fs.Open("000007.log")
+	require.NoError(t, err)
+	defer f.Close()
+	minSeqNum, maxSeqNum, err := ReadSeqNumRange(f, 7)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), minSeqNum)
+	require.Equal(t, uint64(14), maxSeqNum)
+}
@@ -466,8 +466,8 @@ var _ Manager = &failoverManager{}
 // - log deletion: if record.LogWriter did not close yet, the cleaner may
 //   get an error when deleting or renaming (only under windows?).
 
-// init implements Manager.
-func (wm *failoverManager) init(o Options, initial Logs) error {
+// Init implements Manager.
+func (wm *failoverManager) Init(o Options, initial Logs) error {
 	if o.timeSource == nil {
 		o.timeSource = defaultTime{}
 	}
@@ -371,7 +371,7 @@ func TestManagerFailover(t *testing.T) {
 				}
 				logs, err := Scan(o.Dirs()...)
 				require.NoError(t, err)
-				err = fm.init(o, logs)
+				err = fm.Init(o, logs)
 				var b strings.Builder
 				fmt.Fprintf(&b, "%s\n", errorToStr(err))
 				if err == nil {
@@ -558,7 +558,7 @@ func TestFailoverManager_Quiesce(t *testing.T) {
 	fs := errorfs.Wrap(memFS, errorfs.RandomLatency(errorfs.Randomly(0.50, seed), 10*time.Millisecond, seed))
 
 	var m failoverManager
-	require.NoError(t, m.init(Options{
+	require.NoError(t, m.Init(Options{
 		Primary:              Dir{FS: fs, Dirname: "primary"},
 		Secondary:            Dir{FS: fs, Dirname: "secondary"},
 		MaxNumRecyclableLogs: 2,
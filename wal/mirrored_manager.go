@@ -0,0 +1,463 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package wal
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// mirroredManager implements Manager in mirrored mode: each WAL is written to
+// a log file in the primary dir and in each of the mirror dirs, and syncs are
+// acknowledged according to MirrorOptions.AckPolicy. Log files are not
+// recycled.
+type mirroredManager struct {
+	o Options
+	// dirs holds the primary dir followed by the mirrors. The log file in
+	// dirs[i] has LogNameIndex i.
+	dirs       []Dir
+	dirHandles []vfs.File
+	// initialObsolete holds the set of DeletableLogs that formed the logs
+	// passed into Init. See StandaloneManager.initialObsolete.
+	initialObsolete []DeletableLog
+
+	// External synchronization is relied on when accessing w in Manager.Create,
+	// Writer.{WriteRecord,Close}.
+	w *mirroredWriter
+
+	mu struct {
+		sync.Mutex
+		// The queue of WALs created by the manager, containing both flushed and
+		// unflushed WALs. The flushed logs are a prefix, the unflushed logs a
+		// suffix. If w != nil, the last entry here is that active WAL.
+		queue []mirroredLog
+	}
+}
+
+// mirroredLog describes a WAL created by the mirroredManager.
+type mirroredLog struct {
+	num NumWAL
+	// copies holds the indexes into mirroredManager.dirs of the WAL's copies.
+	// A copy whose writes failed is removed once the WAL is closed.
+	copies []int
+	// size is the size of each of the copies. It's updated when the WAL is
+	// closed.
+	size uint64
+}
+
+var _ Manager = &mirroredManager{}
+
+// Init implements Manager.
+func (m *mirroredManager) Init(o Options, initial Logs) error {
+	if len(o.Mirrors) == 0 {
+		return errors.AssertionFailedf("cannot create mirroredManager without mirrors")
+	}
+	if o.Secondary.FS != nil {
+		return errors.AssertionFailedf("cannot create mirroredManager with a secondary")
+	}
+	*m = mirroredManager{
+		o:    o,
+		dirs: o.Dirs(),
+	}
+	for _, d := range m.dirs {
+		f, err := d.FS.OpenDir(d.Dirname)
+		if err != nil {
+			return firstError(err, m.closeDirs())
+		}
+		m.dirHandles = append(m.dirHandles, f)
+	}
+	for _, ll := range initial {
+		var err error
+		if m.initialObsolete, err = appendDeletableLogs(m.initialObsolete, ll); err != nil {
+			return firstError(err, m.closeDirs())
+		}
+	}
+	return nil
+}
+
+func (m *mirroredManager) closeDirs() error {
+	var err error
+	for _, f := range m.dirHandles {
+		err = firstError(err, f.Close())
+	}
+	m.dirHandles = nil
+	return err
+}
+
+func (m *mirroredManager) logPath(num NumWAL, dirIndex int) string {
+	d := m.dirs[dirIndex]
+	return d.FS.PathJoin(d.Dirname, makeLogFilename(num, LogNameIndex(dirIndex)))
+}
+
+// List implements Manager.
+func (m *mirroredManager) List() (Logs, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wals := make(Logs, len(m.mu.queue))
+	for i, l := range m.mu.queue {
+		wals[i] = LogicalLog{Num: l.num, segments: make([]segment, len(l.copies))}
+		for j, dirIndex := range l.copies {
+			wals[i].segments[j] = segment{logNameIndex: LogNameIndex(dirIndex), dir: m.dirs[dirIndex]}
+		}
+	}
+	return wals, nil
+}
+
+// Obsolete implements Manager.
+func (m *mirroredManager) Obsolete(
+	minUnflushedNum NumWAL, noRecycle bool,
+) (toDelete []DeletableLog, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If this is the first call to Obsolete after Open, we may have deletable
+	// logs outside the queue.
+	toDelete, m.initialObsolete = m.initialObsolete, nil
+
+	i := 0
+	for ; i < len(m.mu.queue); i++ {
+		l := m.mu.queue[i]
+		if l.num >= minUnflushedNum {
+			break
+		}
+		for _, dirIndex := range l.copies {
+			toDelete = append(toDelete, DeletableLog{
+				FS:             m.dirs[dirIndex].FS,
+				Path:           m.logPath(l.num, dirIndex),
+				NumWAL:         l.num,
+				ApproxFileSize: l.size,
+			})
+		}
+	}
+	m.mu.queue = m.mu.queue[i:]
+	return toDelete, nil
+}
+
+// Create implements Manager.
+func (m *mirroredManager) Create(wn NumWAL, jobID int) (Writer, error) {
+	n := len(m.dirs)
+	w := &mirroredWriter{
+		m:            m,
+		required:     m.o.AckPolicy.required(n),
+		queueSemChan: m.o.QueueSemChan,
+	}
+	w.mu.synced = make([]int64, n)
+	w.mu.errs = make([]error, n)
+	for i := range m.dirs {
+		w.mu.synced[i] = record.NoSyncIndex
+		lw, err := m.createLogWriter(wn, jobID, i, w.doneSyncCallback(i))
+		if err != nil {
+			for _, lw := range w.writers {
+				err = firstError(err, lw.Close())
+			}
+			return nil, err
+		}
+		w.writers = append(w.writers, lw)
+	}
+	m.w = w
+	copies := make([]int, n)
+	for i := range copies {
+		copies[i] = i
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mu.queue = append(m.mu.queue, mirroredLog{num: wn, copies: copies})
+	return w, nil
+}
+
+// createLogWriter creates the log file for the WAL wn in m.dirs[dirIndex].
+func (m *mirroredManager) createLogWriter(
+	wn NumWAL, jobID int, dirIndex int, callback record.ExternalSyncQueueCallback,
+) (_ *record.LogWriter, err error) {
+	fs, path := m.dirs[dirIndex].FS, m.logPath(wn, dirIndex)
+	defer func() {
+		if m.o.EventListener != nil {
+			m.o.EventListener.LogCreated(CreateInfo{
+				JobID:       jobID,
+				Path:        path,
+				IsSecondary: dirIndex > 0,
+				Num:         wn,
+				Err:         err,
+			})
+		}
+	}()
+	f, err := fs.Create(path)
+	base.MustExist(fs, path, m.o.Logger, err)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.dirHandles[dirIndex].Sync(); err != nil {
+		return nil, firstError(err, f.Close())
+	}
+	f = vfs.NewSyncingFile(f, vfs.SyncingFileOptions{
+		NoSyncOnClose:   m.o.NoSyncOnClose,
+		BytesPerSync:    m.o.BytesPerSync,
+		PreallocateSize: m.o.PreallocateSize(),
+	})
+	// Using NumWAL as the DiskFileNum is fine since log files are not
+	// recycled in mirrored mode.
+	return record.NewLogWriter(f, base.DiskFileNum(wn), record.LogWriterConfig{
+		WALFsyncLatency:           m.o.FsyncLatency,
+		WALMinSyncInterval:        m.o.MinSyncInterval,
+		ExternalSyncQueueCallback: callback,
+	}), nil
+}
+
+// ElevateWriteStallThresholdForFailover implements Manager.
+func (m *mirroredManager) ElevateWriteStallThresholdForFailover() bool {
+	return false
+}
+
+// Stats implements Manager.
+func (m *mirroredManager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var s Stats
+	for _, l := range m.mu.queue {
+		s.LiveFileCount += len(l.copies)
+		s.LiveFileSize += l.size * uint64(len(l.copies))
+	}
+	for i := range m.initialObsolete {
+		if i == 0 || m.initialObsolete[i].NumWAL != m.initialObsolete[i-1].NumWAL {
+			s.ObsoleteFileCount++
+		}
+		s.ObsoleteFileSize += m.initialObsolete[i].ApproxFileSize
+	}
+	return s
+}
+
+// Close implements Manager.
+func (m *mirroredManager) Close() error {
+	var err error
+	if m.w != nil {
+		_, err = m.w.Close()
+	}
+	return firstError(err, m.closeDirs())
+}
+
+// RecyclerForTesting implements Manager. Log files are not recycled in
+// mirrored mode.
+func (m *mirroredManager) RecyclerForTesting() *LogRecycler {
+	return nil
+}
+
+// mirroredWriter is the implementation of Writer in mirrored mode. Each
+// record is written to a record.LogWriter per copy. A record that requested a
+// sync is acknowledged once the required number of copies have synced it, or
+// fails once too many copies have failed for that to happen.
+type mirroredWriter struct {
+	m        *mirroredManager
+	writers  []*record.LogWriter
+	required int
+	// See the comment for Options.QueueSemChan.
+	queueSemChan chan struct{}
+
+	// nextIndex is the index of the next record. It's only accessed by
+	// WriteRecord and Close, which are externally synchronized.
+	nextIndex int64
+	// psiBacking is used to avoid allocations when calling
+	// SyncRecordGeneralized.
+	psiBacking record.PendingSyncIndex
+
+	mu struct {
+		sync.Mutex
+		// pending holds the records that requested a sync and haven't been
+		// acknowledged yet, in increasing index order.
+		pending []mirroredSync
+		// synced[i] is the index of the last record known to be durable in
+		// the i-th copy.
+		synced []int64
+		// errs[i] is the first error encountered by the i-th copy.
+		errs []error
+	}
+}
+
+// mirroredSync is a record that requested a sync.
+type mirroredSync struct {
+	index int64
+	opts  SyncOptions
+}
+
+var _ Writer = &mirroredWriter{}
+var _ FlushWaiter = &mirroredWriter{}
+
+// WriteRecord implements Writer.
+func (w *mirroredWriter) WriteRecord(
+	p []byte, opts SyncOptions, _ RefFunc,
+) (logicalOffset int64, err error) {
+	index := w.nextIndex
+	w.nextIndex++
+	w.psiBacking = record.PendingSyncIndex{Index: record.NoSyncIndex}
+	if opts.Done != nil {
+		w.psiBacking.Index = index
+		w.mu.Lock()
+		w.mu.pending = append(w.mu.pending, mirroredSync{index: index, opts: opts})
+		// If too many copies have already failed, the record fails
+		// immediately.
+		w.ackLocked()
+		w.mu.Unlock()
+	}
+	// The LogWriters copy p, so p is not retained.
+	failed := 0
+	for i, lw := range w.writers {
+		if _, writeErr := lw.SyncRecordGeneralized(p, &w.psiBacking); writeErr != nil {
+			failed++
+			err = firstError(err, writeErr)
+			w.mu.Lock()
+			w.failLocked(i, writeErr)
+			w.mu.Unlock()
+		}
+	}
+	if failed > len(w.writers)-w.required {
+		return -1, errors.Wrapf(err, "pebble: %d of %d WAL copies failed", failed, len(w.writers))
+	}
+	return w.writers[0].Size(), nil
+}
+
+// WaitFlushed implements FlushWaiter. The copies are written identically, so
+// logicalOffset applies to each of them.
+func (w *mirroredWriter) WaitFlushed(logicalOffset int64) error {
+	var failed int
+	var err error
+	for _, lw := range w.writers {
+		if flushErr := lw.WaitFlushed(logicalOffset); flushErr != nil {
+			failed++
+			err = firstError(err, flushErr)
+		}
+	}
+	if failed > len(w.writers)-w.required {
+		return errors.Wrapf(err, "pebble: %d of %d WAL copies failed", failed, len(w.writers))
+	}
+	return nil
+}
+
+// doneSyncCallback returns the callback invoked when the i-th copy has synced
+// records up to and including doneSync, or failed to.
+func (w *mirroredWriter) doneSyncCallback(i int) record.ExternalSyncQueueCallback {
+	return func(doneSync record.PendingSyncIndex, err error) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err != nil {
+			w.failLocked(i, err)
+			return
+		}
+		if doneSync.Index > w.mu.synced[i] {
+			w.mu.synced[i] = doneSync.Index
+		}
+		w.ackLocked()
+	}
+}
+
+// failLocked records the failure of the i-th copy.
+func (w *mirroredWriter) failLocked(i int, err error) {
+	if w.mu.errs[i] == nil {
+		w.mu.errs[i] = err
+	}
+	w.ackLocked()
+}
+
+// ackLocked notifies the pending records that have been synced by the
+// required number of copies, and fails those that can no longer be.
+func (w *mirroredWriter) ackLocked() {
+	var failed int
+	var err error
+	for i := range w.mu.errs {
+		if w.mu.errs[i] != nil {
+			failed++
+			err = firstError(err, w.mu.errs[i])
+		}
+	}
+	i := 0
+	for ; i < len(w.mu.pending); i++ {
+		s := w.mu.pending[i]
+		synced := 0
+		for _, index := range w.mu.synced {
+			if index >= s.index {
+				synced++
+			}
+		}
+		if synced < w.required {
+			if failed <= len(w.writers)-w.required {
+				// Since copies sync records in order, the remaining records
+				// can't be acknowledged either.
+				break
+			}
+			*s.opts.Err = err
+		}
+		s.opts.Done.Done()
+		if w.queueSemChan != nil {
+			<-w.queueSemChan
+		}
+	}
+	w.mu.pending = slices.Delete(w.mu.pending, 0, i)
+}
+
+// Close implements Writer.
+func (w *mirroredWriter) Close() (logicalOffset int64, err error) {
+	logicalOffset = w.writers[0].Size()
+	// Closing a LogWriter syncs all of its records. NB: NoSyncIndex is -1, so
+	// no callback is requested if no records were written.
+	lastQueuedRecord := record.PendingSyncIndex{Index: w.nextIndex - 1}
+	closeErrs := make([]error, len(w.writers))
+	for i, lw := range w.writers {
+		closeErrs[i] = lw.CloseWithLastQueuedRecord(lastQueuedRecord)
+	}
+
+	w.mu.Lock()
+	var failed int
+	for i := range w.writers {
+		if closeErrs[i] != nil {
+			w.failLocked(i, closeErrs[i])
+		}
+		if w.mu.errs[i] != nil {
+			failed++
+			err = firstError(err, w.mu.errs[i])
+		}
+	}
+	errs := slices.Clone(w.mu.errs)
+	// Every record has either been acknowledged or failed.
+	pending := len(w.mu.pending)
+	w.mu.Unlock()
+
+	m := w.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.w = nil
+	l := &m.mu.queue[len(m.mu.queue)-1]
+	l.size = max(l.size, uint64(logicalOffset))
+	if pending > 0 {
+		return logicalOffset, errors.AssertionFailedf("%d WAL records pending after close", pending)
+	}
+	if failed > len(w.writers)-w.required {
+		return logicalOffset, errors.Wrapf(err, "pebble: %d of %d WAL copies failed", failed, len(w.writers))
+	}
+
+	// The remaining copies contain every record. The failed copies may have an
+	// unclean tail, which would be mistaken for corruption when the WAL is
+	// replayed, so remove them.
+	l.copies = slices.DeleteFunc(l.copies, func(i int) bool {
+		if errs[i] == nil {
+			return false
+		}
+		path := m.logPath(l.num, i)
+		if rmErr := m.dirs[i].FS.Remove(path); rmErr != nil {
+			m.o.Logger.Errorf("pebble: unable to remove failed WAL copy %s: %v", path, rmErr)
+			return false
+		}
+		m.o.Logger.Infof("pebble: removed failed WAL copy %s: %v", path, errs[i])
+		return true
+	})
+	return logicalOffset, nil
+}
+
+// Metrics implements Writer.
+func (w *mirroredWriter) Metrics() record.LogWriterMetrics {
+	return w.writers[0].Metrics()
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package wal
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/errorfs"
+	"github.com/stretchr/testify/require"
+)
+
+// mirroredRecord returns the i-th record written by the mirrored manager
+// tests: a batch with a single key at sequence number i+1.
+func mirroredRecord(i int) []byte {
+	repr := make([]byte, batchrepr.HeaderLen, batchrepr.HeaderLen+100)
+	batchrepr.SetSeqNum(repr, uint64(i+1))
+	batchrepr.SetCount(repr, 1)
+	return append(repr, bytes.Repeat([]byte{byte(i)}, 100)...)
+}
+
+// readMirroredLog reads the records of the only WAL in dirs, returning them
+// along with the error that ended the read, if other than io.EOF.
+func readMirroredLog(t *testing.T, dirs ...Dir) ([][]byte, error) {
+	logs, err := Scan(dirs...)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	r := logs[0].OpenForRead()
+	defer r.Close()
+	var records [][]byte
+	for {
+		rec, _, err := r.NextRecord()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		b, err := io.ReadAll(rec)
+		require.NoError(t, err)
+		records = append(records, b)
+	}
+}
+
+func TestMirroredManager(t *testing.T) {
+	for _, policy := range []MirrorAckPolicy{MirrorAckAll, MirrorAckQuorum, MirrorAckAny} {
+		t.Run(policy.String(), func(t *testing.T) {
+			memFS := vfs.NewMem()
+			require.NoError(t, memFS.MkdirAll("primary", os.ModePerm))
+			require.NoError(t, memFS.MkdirAll("mirror", os.ModePerm))
+			var failMirror atomic.Bool
+			fs := errorfs.Wrap(memFS, errorfs.InjectorFunc(func(op errorfs.Op) error {
+				switch op.Kind {
+				case errorfs.OpFileWrite, errorfs.OpFileSync, errorfs.OpFileSyncData:
+					if failMirror.Load() && strings.HasPrefix(op.Path, "mirror") {
+						return errorfs.ErrInjected
+					}
+				}
+				return nil
+			}))
+			primary, mirror := Dir{FS: fs, Dirname: "primary"}, Dir{FS: fs, Dirname: "mirror"}
+			queueSemChan := make(chan struct{}, 10)
+			logger := &base.InMemLogger{}
+			m, err := Init(Options{
+				Primary:         primary,
+				PreallocateSize: func() int { return 0 },
+				QueueSemChan:    queueSemChan,
+				Logger:          logger,
+				MirrorOptions: MirrorOptions{
+					Mirrors:   []Dir{mirror},
+					AckPolicy: policy,
+				},
+			}, nil /* initial logs */)
+			require.NoError(t, err)
+			require.Nil(t, m.RecyclerForTesting())
+
+			w, err := m.Create(1, 1)
+			require.NoError(t, err)
+			syncWrite := func(i int) error {
+				var wg sync.WaitGroup
+				var syncErr error
+				wg.Add(1)
+				queueSemChan <- struct{}{}
+				_, err := w.WriteRecord(mirroredRecord(i), SyncOptions{Done: &wg, Err: &syncErr}, nil)
+				require.NoError(t, err)
+				wg.Wait()
+				// The semaphore is released once the sync completes.
+				require.Len(t, queueSemChan, 0)
+				return syncErr
+			}
+			for i := 0; i < 10; i++ {
+				require.NoError(t, syncWrite(i))
+			}
+			logs, err := m.List()
+			require.NoError(t, err)
+			require.Len(t, logs, 1)
+			require.Equal(t, 2, logs[0].NumSegments())
+
+			// With a single mirror, both copies make a quorum, so only
+			// MirrorAckAny tolerates the failure of the mirror.
+			failMirror.Store(true)
+			err = syncWrite(10)
+			_, closeErr := w.Close()
+			if policy == MirrorAckAny {
+				require.NoError(t, err)
+				require.NoError(t, closeErr)
+				// The failed copy is removed.
+				_, err = memFS.Stat("mirror/000001-001.log")
+				require.True(t, oserror.IsNotExist(err))
+				require.Contains(t, logger.String(), "removed failed WAL copy mirror/000001-001.log")
+				logs, err := m.List()
+				require.NoError(t, err)
+				require.Equal(t, 1, logs[0].NumSegments())
+			} else {
+				require.ErrorIs(t, err, errorfs.ErrInjected)
+				require.ErrorIs(t, closeErr, errorfs.ErrInjected)
+			}
+			require.NoError(t, m.Close())
+
+			records, err := readMirroredLog(t, Dir{FS: memFS, Dirname: "primary"}, Dir{FS: memFS, Dirname: "mirror"})
+			require.NoError(t, err)
+			require.Len(t, records, 11)
+			for i := range records {
+				require.Equal(t, mirroredRecord(i), records[i])
+			}
+		})
+	}
+}
+
+func TestMirroredManagerDivergentTails(t *testing.T) {
+	for _, truncate := range []string{"primary/000001.log", "mirror/000001-001.log"} {
+		t.Run(truncate, func(t *testing.T) {
+			fs := vfs.NewMem()
+			require.NoError(t, fs.MkdirAll("primary", os.ModePerm))
+			require.NoError(t, fs.MkdirAll("mirror", os.ModePerm))
+			dirs := []Dir{{FS: fs, Dirname: "primary"}, {FS: fs, Dirname: "mirror"}}
+			m, err := Init(Options{
+				Primary:         dirs[0],
+				PreallocateSize: func() int { return 0 },
+				MirrorOptions:   MirrorOptions{Mirrors: dirs[1:]},
+			}, nil /* initial logs */)
+			require.NoError(t, err)
+			w, err := m.Create(1, 1)
+			require.NoError(t, err)
+			for i := 0; i < 20; i++ {
+				_, err := w.WriteRecord(mirroredRecord(i), SyncOptions{}, nil)
+				require.NoError(t, err)
+			}
+			_, err = w.Close()
+			require.NoError(t, err)
+			require.NoError(t, m.Close())
+
+			// Truncate one of the copies in the middle of a record, as if it
+			// were torn when the process crashed.
+			f, err := fs.Open(truncate)
+			require.NoError(t, err)
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			f, err = fs.Create(truncate)
+			require.NoError(t, err)
+			_, err = f.Write(data[:len(data)/2+3])
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			// The longest valid prefix among the copies is recovered.
+			records, err := readMirroredLog(t, dirs...)
+			if truncate == "primary/000001.log" {
+				require.NoError(t, err)
+			}
+			require.Len(t, records, 20)
+			for i := range records {
+				require.Equal(t, mirroredRecord(i), records[i])
+			}
+		})
+	}
+}
@@ -338,6 +338,27 @@ func (r *virtualWALReader) NextRecord() (io.Reader, Offset, error) {
 	}
 }
 
+// Recover clears the error returned by the last call to NextRecord, if the
+// error was caused by a corrupted record, so that the next call to NextRecord
+// resumes at the next intact record. Records sharing the corrupted record's
+// 32KiB block are skipped along with it.
+func (r *virtualWALReader) Recover() {
+	if r.currReader != nil {
+		r.currReader.Recover()
+	}
+}
+
+// RecoverReader clears the corruption error last returned by r.NextRecord, so
+// that the next call to NextRecord resumes at the next intact record. It
+// returns false if r can't resume reading after a corrupted record.
+func RecoverReader(r Reader) bool {
+	vr, ok := r.(*virtualWALReader)
+	if ok {
+		vr.Recover()
+	}
+	return ok
+}
+
 // Close closes the reader, releasing open resources.
 func (r *virtualWALReader) Close() error {
 	if r.currFile != nil {
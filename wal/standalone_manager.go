@@ -46,8 +46,8 @@ type StandaloneManager struct {
 
 var _ Manager = &StandaloneManager{}
 
-// init implements Manager.
-func (m *StandaloneManager) init(o Options, initial Logs) error {
+// Init implements Manager.
+func (m *StandaloneManager) Init(o Options, initial Logs) error {
 	if o.Secondary.FS != nil {
 		return errors.AssertionFailedf("cannot create StandaloneManager with a secondary")
 	}
@@ -266,6 +266,7 @@ type standaloneWriter struct {
 }
 
 var _ Writer = &standaloneWriter{}
+var _ FlushWaiter = &standaloneWriter{}
 
 // WriteRecord implements Writer.
 func (w *standaloneWriter) WriteRecord(
@@ -274,6 +275,11 @@ func (w *standaloneWriter) WriteRecord(
 	return w.w.SyncRecord(p, opts.Done, opts.Err)
 }
 
+// WaitFlushed implements FlushWaiter.
+func (w *standaloneWriter) WaitFlushed(logicalOffset int64) error {
+	return w.w.WaitFlushed(logicalOffset)
+}
+
 // Close implements Writer.
 func (w *standaloneWriter) Close() (logicalOffset int64, err error) {
 	logicalOffset = w.w.Size()
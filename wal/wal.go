@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/vfs"
@@ -142,25 +143,36 @@ type Options struct {
 	EventListener EventListener
 
 	FailoverOptions
+	MirrorOptions
 }
 
 // Init constructs and initializes a WAL manager from the provided options and
 // the set of initial logs.
 func Init(o Options, initial Logs) (Manager, error) {
 	var m Manager
-	if o.Secondary == (Dir{}) {
+	switch {
+	case len(o.Mirrors) > 0:
+		if o.Secondary != (Dir{}) {
+			return nil, errors.New("pebble: WAL mirroring and failover are mutually exclusive")
+		}
+		m = new(mirroredManager)
+	case o.Secondary == (Dir{}):
 		m = new(StandaloneManager)
-	} else {
+	default:
 		m = new(failoverManager)
 	}
-	if err := m.init(o, initial); err != nil {
+	if err := m.Init(o, initial); err != nil {
 		return nil, err
 	}
 	return m, nil
 }
 
-// Dirs returns the primary Dir and the secondary if provided.
+// Dirs returns the primary Dir, followed by the secondary or the mirrors if
+// provided.
 func (o *Options) Dirs() []Dir {
+	if len(o.Mirrors) > 0 {
+		return append([]Dir{o.Primary}, o.Mirrors...)
+	}
 	if o.Secondary == (Dir{}) {
 		return []Dir{o.Primary}
 	}
@@ -229,6 +241,73 @@ func (o *FailoverOptions) EnsureDefaults() {
 	}
 }
 
+// MirrorOptions are options that are specific to mirrored mode. In mirrored
+// mode, every record is written to the primary dir and to each of the
+// mirrors, and a sync is acknowledged according to AckPolicy.
+type MirrorOptions struct {
+	// Mirrors are the dirs to which records are written in addition to the
+	// primary dir. The log file in the i-th mirror is named with LogNameIndex
+	// i+1, so that Scan treats a WAL's copies as segments of a single virtual
+	// WAL. When reading the WAL, the copies are read in order and records
+	// already read from an earlier copy are skipped, so the reader recovers the
+	// longest valid prefix among the copies, even if their tails diverge.
+	Mirrors []Dir
+	// AckPolicy determines how many of the copies must be durable for a sync
+	// to be acknowledged.
+	AckPolicy MirrorAckPolicy
+}
+
+// MirrorAckPolicy determines when a sync of a mirrored WAL is acknowledged.
+type MirrorAckPolicy uint8
+
+const (
+	// MirrorAckAll acknowledges a sync once every copy is durable.
+	MirrorAckAll MirrorAckPolicy = iota
+	// MirrorAckQuorum acknowledges a sync once a majority of the copies are
+	// durable.
+	MirrorAckQuorum
+	// MirrorAckAny acknowledges a sync once any copy is durable.
+	MirrorAckAny
+)
+
+// String implements fmt.Stringer.
+func (p MirrorAckPolicy) String() string {
+	switch p {
+	case MirrorAckAll:
+		return "all"
+	case MirrorAckQuorum:
+		return "quorum"
+	case MirrorAckAny:
+		return "any"
+	default:
+		return fmt.Sprintf("MirrorAckPolicy(%d)", uint8(p))
+	}
+}
+
+// ParseMirrorAckPolicy parses the string representation of a
+// MirrorAckPolicy.
+func ParseMirrorAckPolicy(s string) (MirrorAckPolicy, error) {
+	for _, p := range []MirrorAckPolicy{MirrorAckAll, MirrorAckQuorum, MirrorAckAny} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return 0, errors.Errorf("pebble: unknown WAL mirror ack policy %q", s)
+}
+
+// required returns the number of the n copies that must be durable for a sync
+// to be acknowledged.
+func (p MirrorAckPolicy) required(n int) int {
+	switch p {
+	case MirrorAckQuorum:
+		return n/2 + 1
+	case MirrorAckAny:
+		return 1
+	default:
+		return n
+	}
+}
+
 // EventListener is called on events, like log file creation.
 type EventListener interface {
 	// LogCreated informs the listener of a log file creation.
@@ -308,9 +387,20 @@ type FailoverStats struct {
 //   - WAL writing: Is done via Create, and the various Writer methods. These
 //     are required to be serialized via external synchronization (specifically,
 //     the caller does it via commitPipeline.mu).
+//
+// Manager may be implemented outside this package, for example to replicate
+// the WAL to another node before acknowledging a write. Such an implementation
+// typically wraps a Manager constructed by Init and must preserve the
+// guarantees the commit pipeline relies on, which are documented on Writer.
+// In addition, List must include every virtual WAL that may contain records
+// not yet reflected in flushed sstables, since the DB replays these WALs (via
+// Scan) when it is next opened.
 type Manager interface {
-	// init initializes the Manager. init is called during DB initialization.
-	init(o Options, initial Logs) error
+	// Init initializes the Manager. Init is called once, during DB
+	// initialization, before any other method. The initial logs are those
+	// returned by Scan for the directories in Options; the Manager is
+	// responsible for deleting or recycling the ones that become obsolete.
+	Init(o Options, initial Logs) error
 
 	// List returns the virtual WALs in ascending order.
 	List() (Logs, error)
@@ -338,7 +428,8 @@ type Manager interface {
 	// REQUIRES: Writers and Readers have already been closed.
 	Close() error
 
-	// RecyclerForTesting exposes the internal LogRecycler.
+	// RecyclerForTesting exposes the internal LogRecycler. Implementations
+	// that don't recycle log files may return nil.
 	RecyclerForTesting() *LogRecycler
 }
 
@@ -361,6 +452,26 @@ type SyncOptions struct {
 // Writer writes to a virtual WAL. A Writer in standalone mode maps to a
 // single record.LogWriter. In failover mode, it can failover across multiple
 // physical log files.
+//
+// The commit pipeline relies on the following contract, which
+// implementations outside this package must also honor:
+//
+//   - Ordering: records are persisted in the order in which WriteRecord is
+//     called. The order of records in the WAL defines the order of their
+//     sequence numbers, and replay assumes that a record is only present if
+//     all the records preceding it are.
+//   - Durability: when SyncOptions.Done is non-nil, Done is notified exactly
+//     once, after the record and all the records preceding it are durable, or
+//     after an error has been set in SyncOptions.Err. A record written without
+//     SyncOptions.Done becomes durable no later than the next record written
+//     with it, or when the Writer is closed.
+//   - Backpressure: for every record written with a non-nil SyncOptions.Done,
+//     an element must be received from Options.QueueSemChan once the sync has
+//     completed, whether or not it succeeded. The commit pipeline sends to
+//     QueueSemChan before calling WriteRecord in order to bound the number of
+//     outstanding syncs, so failing to receive stalls writes.
+//   - Close returns only after all records written so far are durable, or
+//     with an error.
 type Writer interface {
 	// WriteRecord writes a complete record. The record is asynchronously
 	// persisted to the underlying writer. If SyncOptions.Done != nil, the wait
@@ -386,6 +497,17 @@ type Writer interface {
 	Metrics() record.LogWriterMetrics
 }
 
+// FlushWaiter is an optional interface implemented by Writers that can wait
+// for records to be handed to the operating system without waiting for them
+// to be synced. Records written without requesting a sync may otherwise be
+// buffered by the Writer until a later sync.
+type FlushWaiter interface {
+	// WaitFlushed blocks until the records written before logicalOffset, as
+	// returned by WriteRecord, have been written to the underlying files, or
+	// an error has occurred.
+	WaitFlushed(logicalOffset int64) error
+}
+
 // RefFunc holds funcs to increment a reference count associated with a record
 // passed to [Writer.WriteRecord]. See the comment on WriteRecord.
 type RefFunc func() (unref func())
@@ -0,0 +1,318 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// WALArchiveOptions configures the archiving of obsolete write-ahead logs.
+// Ordinarily, a log is deleted or recycled as soon as the memtables it backs
+// have been flushed. When archiving is configured, a copy of the log is
+// retained in the archive, which together with a checkpoint allows a
+// database to be restored to a later point in time (see
+// RestoreFromWALArchive). Logs are never recycled while archiving is
+// configured.
+//
+// Exactly one of Dir and Storage must be set.
+type WALArchiveOptions struct {
+	// Dir is the directory into which logs are archived. It's created if it
+	// doesn't exist.
+	Dir wal.Dir
+	// Storage is the remote storage to which logs are archived. The archived
+	// logs are stored as objects named with Prefix followed by the archived
+	// log's filename (see wal.ArchivedLog).
+	Storage remote.Storage
+	// Prefix is prepended to the names of archived log objects in Storage.
+	Prefix string
+	// Retention is the duration for which archived logs are retained, measured
+	// from the time of the last write to the log. Older archived logs are
+	// deleted as new logs are archived. If zero, archived logs are never
+	// deleted.
+	Retention time.Duration
+}
+
+// validate returns an error if the options are invalid.
+func (o *WALArchiveOptions) validate() error {
+	if (o.Dir.FS != nil) == (o.Storage != nil) {
+		return errors.New("pebble: exactly one of WALArchiveOptions.Dir and WALArchiveOptions.Storage must be set")
+	}
+	if o.Retention < 0 {
+		return errors.Newf("pebble: negative WAL archive retention %s", o.Retention)
+	}
+	return nil
+}
+
+// list returns the archived logs, sorted by WAL number and log file index.
+func (o *WALArchiveOptions) list() ([]wal.ArchivedLog, error) {
+	var names []string
+	var err error
+	if o.Storage != nil {
+		names, err = o.Storage.List(o.Prefix, "")
+	} else {
+		names, err = o.Dir.FS.List(o.Dir.Dirname)
+		if oserror.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var logs []wal.ArchivedLog
+	for _, name := range names {
+		// Not all remote.Storage implementations trim the prefix from the
+		// listed names.
+		name = strings.TrimPrefix(name, o.Prefix)
+		if l, ok := wal.ParseArchivedLogFilename(name); ok {
+			logs = append(logs, l)
+		}
+	}
+	slices.SortFunc(logs, func(a, b wal.ArchivedLog) int {
+		if a.Num != b.Num {
+			return int(a.Num) - int(b.Num)
+		}
+		return int(a.Index) - int(b.Index)
+	})
+	return logs, nil
+}
+
+// archive copies the obsolete log file to the archive.
+func (o *WALArchiveOptions) archive(log wal.DeletableLog) error {
+	_, index, ok := wal.ParseLogFilename(log.FS.PathBase(log.Path))
+	if !ok {
+		return errors.Newf("pebble: unable to parse log filename %q", log.Path)
+	}
+	f, err := log.FS.Open(log.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	l := wal.ArchivedLog{Num: log.NumWAL, Index: index, SealedAt: stat.ModTime()}
+	l.MinSeqNum, l.MaxSeqNum, err = wal.ReadSeqNumRange(io.NewSectionReader(f, 0, stat.Size()), log.NumWAL)
+	if err != nil {
+		return err
+	}
+	if l.MaxSeqNum == 0 {
+		// The log doesn't contain any keys.
+		return nil
+	}
+	r := io.NewSectionReader(f, 0, stat.Size())
+
+	if o.Storage != nil {
+		w, err := o.Storage.CreateObject(o.Prefix + l.Filename())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			_ = w.Close()
+			return err
+		}
+		return w.Close()
+	}
+
+	// Copy the log to a temporary file and rename it, so that a partially
+	// copied log is never mistaken for an archived log.
+	fs, dirname := o.Dir.FS, o.Dir.Dirname
+	if err := fs.MkdirAll(dirname, 0755); err != nil {
+		return err
+	}
+	path := fs.PathJoin(dirname, l.Filename())
+	tmpPath := path + ".tmp"
+	w, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Sync(); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := fs.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	dir, err := fs.OpenDir(dirname)
+	if err != nil {
+		return err
+	}
+	return errors.CombineErrors(dir.Sync(), dir.Close())
+}
+
+// prune deletes the archived logs that have outlived the retention period.
+func (o *WALArchiveOptions) prune(now time.Time) error {
+	if o.Retention == 0 {
+		return nil
+	}
+	logs, err := o.list()
+	if err != nil {
+		return err
+	}
+	for _, l := range logs {
+		if now.Sub(l.SealedAt) <= o.Retention {
+			continue
+		}
+		if o.Storage != nil {
+			err = o.Storage.Delete(o.Prefix + l.Filename())
+		} else {
+			err = o.Dir.FS.Remove(o.Dir.FS.PathJoin(o.Dir.Dirname, l.Filename()))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the contents of the archived log.
+func (o *WALArchiveOptions) read(l wal.ArchivedLog) ([]byte, error) {
+	if o.Storage != nil {
+		r, size, err := o.Storage.ReadObject(context.TODO(), o.Prefix+l.Filename())
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		data := make([]byte, size)
+		if err := r.ReadAt(context.TODO(), data, 0); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	f, err := o.Dir.FS.Open(o.Dir.FS.PathJoin(o.Dir.Dirname, l.Filename()))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// WALRestoreTarget is the point in time to which RestoreFromWALArchive
+// restores a database. A zero target restores all archived writes.
+type WALRestoreTarget struct {
+	// SeqNum, if non-zero, is the largest sequence number to restore. Batches
+	// are restored atomically, so a batch containing SeqNum is not restored
+	// unless SeqNum is the batch's last sequence number.
+	SeqNum uint64
+	// Time, if non-zero, restricts the restore to the archived logs last
+	// written at or before Time. Since the time of individual writes is not
+	// recorded, writes that precede Time but share a log with a write that
+	// follows Time are not restored.
+	Time time.Time
+}
+
+// RestoreFromWALArchive restores the database in dirname, typically a
+// checkpoint (see DB.Checkpoint), to a later point in time by replaying the
+// writes recorded in the archived write-ahead logs. The writes that follow the
+// database's last sequence number are replayed, in order, up to the target.
+// It returns the sequence number of the last restored write.
+//
+// The restore fails if the archive is missing writes between the database's
+// last sequence number and the target, which is the case if archived logs
+// were pruned, or if the database ingested sstables, as ingested sstables are
+// not recorded in the write-ahead log.
+//
+// The database must not be open. The options' WALArchive, if any, is ignored
+// while restoring.
+func RestoreFromWALArchive(
+	dirname string, opts *Options, archive *WALArchiveOptions, target WALRestoreTarget,
+) (seqNum uint64, err error) {
+	if err := archive.validate(); err != nil {
+		return 0, err
+	}
+	logs, err := archive.list()
+	if err != nil {
+		return 0, err
+	}
+
+	opts = opts.Clone()
+	opts.WALArchive = nil
+	d, err := Open(dirname, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = errors.CombineErrors(err, d.Close()) }()
+
+	nextSeqNum := d.mu.versions.logSeqNum.Load()
+	for _, l := range logs {
+		if l.MaxSeqNum < nextSeqNum {
+			// The log's writes are all reflected in the database.
+			continue
+		}
+		if (target.SeqNum != 0 && l.MinSeqNum > target.SeqNum) ||
+			(!target.Time.IsZero() && l.SealedAt.After(target.Time)) {
+			break
+		}
+		data, err := archive.read(l)
+		if err != nil {
+			return 0, err
+		}
+		var done bool
+		err = wal.ScanArchivedLog(bytes.NewReader(data), l.Num, func(repr []byte) error {
+			h, _ := batchrepr.ReadHeader(repr)
+			if done || h.Count == 0 || h.SeqNum+uint64(h.Count) <= nextSeqNum {
+				// The batch consumes no sequence numbers or is already
+				// reflected in the database. Batches may be repeated across
+				// the log files of a WAL that failed over.
+				return nil
+			}
+			if target.SeqNum != 0 && h.SeqNum+uint64(h.Count)-1 > target.SeqNum {
+				done = true
+				return nil
+			}
+			if h.SeqNum != nextSeqNum {
+				return errors.Newf("pebble: WAL archive is missing sequence numbers [%d,%d)",
+					nextSeqNum, h.SeqNum)
+			}
+			if repr, err = batchrepr.Decompress(nil, repr); err != nil {
+				return err
+			}
+			b := &Batch{}
+			if err := b.SetRepr(slices.Clone(repr)); err != nil {
+				return err
+			}
+			br := b.Reader()
+			if kind, _, _, ok, _ := br.Next(); ok && kind == InternalKeyKindIngestSST {
+				return errors.Newf("pebble: WAL archive contains ingested sstables at sequence number %d",
+					h.SeqNum)
+			}
+			if err := d.Apply(b, NoSync); err != nil {
+				return err
+			}
+			nextSeqNum = h.SeqNum + uint64(h.Count)
+			return nil
+		})
+		if err != nil {
+			return 0, errors.Wrapf(err, "restoring archived log %s", l)
+		}
+		if done {
+			break
+		}
+	}
+	// Flush the restored writes, so that they're durable once
+	// RestoreFromWALArchive returns.
+	if err := d.Flush(); err != nil {
+		return 0, err
+	}
+	return nextSeqNum - 1, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/wal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALArchive(t *testing.T) {
+	for _, storage := range []bool{false, true} {
+		t.Run(fmt.Sprintf("storage=%t", storage), func(t *testing.T) {
+			fs := vfs.NewMem()
+			archive := &WALArchiveOptions{Dir: wal.Dir{FS: fs, Dirname: "archive"}}
+			if storage {
+				archive = &WALArchiveOptions{Storage: remote.NewInMem(), Prefix: "wals/"}
+			}
+			opts := &Options{
+				FS:                          fs,
+				Logger:                      testLogger{t},
+				DisableAutomaticCompactions: true,
+				WALArchive:                  archive,
+			}
+			opts.private.testingAlwaysWaitForCleanup = true
+			d, err := Open("db", opts)
+			require.NoError(t, err)
+
+			key := func(i int) []byte { return []byte(fmt.Sprintf("key%03d", i)) }
+			set := func(from, to int) uint64 {
+				for i := from; i < to; i++ {
+					require.NoError(t, d.Set(key(i), key(i), nil))
+				}
+				require.NoError(t, d.Flush())
+				return d.mu.versions.visibleSeqNum.Load() - 1
+			}
+			set(0, 10)
+			require.NoError(t, d.Checkpoint("checkpoint1"))
+			require.NoError(t, d.Checkpoint("checkpoint2"))
+			require.NoError(t, d.Checkpoint("checkpoint3"))
+			set(10, 20)
+			targetSeqNum := set(20, 30)
+			lastSeqNum := set(30, 40)
+			require.NoError(t, d.Close())
+
+			logs, err := archive.list()
+			require.NoError(t, err)
+			require.Less(t, 3, len(logs))
+			for i := 1; i < len(logs); i++ {
+				require.Less(t, logs[i-1].MaxSeqNum, logs[i].MinSeqNum)
+			}
+
+			check := func(dirname string, n int) {
+				d, err := Open(dirname, &Options{FS: fs, Logger: testLogger{t}})
+				require.NoError(t, err)
+				defer func() { require.NoError(t, d.Close()) }()
+				for i := 0; i < 40; i++ {
+					_, closer, err := d.Get(key(i))
+					if i < n {
+						require.NoError(t, err)
+						require.NoError(t, closer.Close())
+					} else {
+						require.ErrorIs(t, err, ErrNotFound)
+					}
+				}
+			}
+
+			// Restore to a sequence number.
+			seqNum, err := RestoreFromWALArchive("checkpoint1", &Options{FS: fs, Logger: testLogger{t}}, archive, WALRestoreTarget{SeqNum: targetSeqNum})
+			require.NoError(t, err)
+			require.Equal(t, targetSeqNum, seqNum)
+			check("checkpoint1", 30)
+
+			// Restore all archived writes.
+			seqNum, err = RestoreFromWALArchive("checkpoint2", &Options{FS: fs, Logger: testLogger{t}}, archive, WALRestoreTarget{})
+			require.NoError(t, err)
+			require.Equal(t, lastSeqNum, seqNum)
+			check("checkpoint2", 40)
+
+			// Restore to a time preceding all archived logs.
+			_, err = RestoreFromWALArchive("checkpoint3", &Options{FS: fs, Logger: testLogger{t}}, archive, WALRestoreTarget{
+				Time: logs[0].SealedAt.Add(-time.Nanosecond),
+			})
+			require.NoError(t, err)
+			check("checkpoint3", 10)
+
+			// Archived logs are pruned once they outlive the retention period.
+			archive.Retention = time.Hour
+			require.NoError(t, archive.prune(logs[len(logs)-1].SealedAt.Add(time.Hour)))
+			pruned, err := archive.list()
+			require.NoError(t, err)
+			require.Len(t, pruned, 1)
+			require.NoError(t, archive.prune(logs[len(logs)-1].SealedAt.Add(2*time.Hour)))
+			pruned, err = archive.list()
+			require.NoError(t, err)
+			require.Len(t, pruned, 0)
+		})
+	}
+}
+
+func TestWALArchiveOptionsValidate(t *testing.T) {
+	opts := &Options{WALArchive: &WALArchiveOptions{}}
+	opts.EnsureDefaults()
+	require.Error(t, opts.Validate())
+	opts.WALArchive.Dir = wal.Dir{FS: vfs.NewMem(), Dirname: "archive"}
+	require.NoError(t, opts.Validate())
+	opts.WALArchive.Storage = remote.NewInMem()
+	require.Error(t, opts.Validate())
+}